@@ -60,8 +60,9 @@ func main() {
 	}
 
 	// Initialize Transport
-	transport := sharding.NewTransport(*nodeID, *address, peerConfig, leader)
-	if err := transport.Start(); err != nil {
+	transport := sharding.NewTransport(*nodeID, peerConfig, sharding.TransportConfig{}, nil)
+	transport.AddShard(leader)
+	if err := transport.Start(*address); err != nil {
 		logger.Fatalf("Failed to start transport: %v", err)
 	}
 
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/pkg/errors"
+)
+
+// queryDependencies prints the transactions that own or read keys of a
+// shard, as read by any of its replicas:
+//
+//	shard-server dependencies -server replica:port -shard my-shard key1 key2
+func queryDependencies(args []string) error {
+	var (
+		server  string
+		shardID string
+		timeout time.Duration
+	)
+
+	flags := flag.NewFlagSet("dependencies", flag.ExitOnError)
+	flags.StringVar(&server, "server", "", "Address of a replica of the shard")
+	flags.StringVar(&shardID, "shard", "my-shard", "Shard ID/Contract Name")
+	flags.DurationVar(&timeout, "timeout", 10*time.Second, "Time to wait for the shard to serve the query")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if server == "" {
+		return errors.New("the address of a replica is required")
+	}
+	if flags.NArg() == 0 {
+		return errors.New("at least one key is required")
+	}
+
+	conn, err := comm.ClientConfig{DialTimeout: comm.DefaultConnectionTimeout}.Dial(server)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", server)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := protos.NewShardCommunicationClient(conn).QueryDependencies(ctx, &protos.DependencyQuery{ShardId: shardID, Keys: flags.Args()})
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Shard %s at read index %d", shardID, resp.ReadIndex)
+	for _, key := range resp.Keys {
+		logger.Infof("Key %s: owner %q, readers %v", key.Key, key.OwnerTxId, key.ReaderTxIds)
+	}
+	return nil
+}
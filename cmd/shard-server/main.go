@@ -23,17 +23,34 @@ type ClusterConfig struct {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "membership" {
+		if err := changeMembership(os.Args[2:]); err != nil {
+			logger.Errorf("Failed to change membership: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "dependencies" {
+		if err := queryDependencies(os.Args[2:]); err != nil {
+			logger.Errorf("Failed to query dependencies: %v", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	var (
 		nodeID     uint64
 		configFile string
 		shardID    string
 		txCount    int
+		join       bool
 	)
 
 	flag.Uint64Var(&nodeID, "id", 0, "Node ID (must be > 0)")
 	flag.StringVar(&configFile, "config", "cluster.json", "Path to cluster config file")
 	flag.StringVar(&shardID, "shard", "my-shard", "Shard ID/Contract Name")
 	flag.IntVar(&txCount, "load", 0, "Number of transactions to generate (0 for follower mode)")
+	flag.BoolVar(&join, "join", false, "Join a running shard as a replica added with the membership command")
 	flag.Parse()
 
 	if nodeID == 0 {
@@ -75,6 +92,7 @@ func main() {
 		ShardID:      shardID,
 		ReplicaNodes: dummyNodes,
 		ReplicaID:    nodeID,
+		Join:         join,
 	}
 
 	leader, err := sharding.NewShardLeader(cfg, 300*time.Millisecond, 50)
@@ -85,9 +103,10 @@ func main() {
 
 	// Create Transport
 	peerConfig := sharding.PeerConfig(clusterConfig.Peers)
-	transport := sharding.NewTransport(nodeID, myAddr, peerConfig, leader)
+	transport := sharding.NewTransport(nodeID, peerConfig, sharding.TransportConfig{}, nil)
+	transport.AddShard(leader)
 
-	if err := transport.Start(); err != nil {
+	if err := transport.Start(myAddr); err != nil {
 		logger.Errorf("Failed to start transport: %v", err)
 		os.Exit(1)
 	}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/pkg/errors"
+)
+
+// changeMembership asks the leader of a shard to add, remove or replace a
+// replica:
+//
+//	shard-server membership -server leader:port -shard my-shard -add 4=host:port
+//	shard-server membership -server leader:port -shard my-shard -remove 2
+//	shard-server membership -server leader:port -shard my-shard -remove 2 -add 4=host:port
+//
+// A replica is added before it is started with -join, so that it is known
+// to the shard when it asks for the log.
+func changeMembership(args []string) error {
+	var (
+		server  string
+		shardID string
+		add     string
+		tlsCert string
+		remove  uint64
+		timeout time.Duration
+	)
+
+	flags := flag.NewFlagSet("membership", flag.ExitOnError)
+	flags.StringVar(&server, "server", "", "Address of the leader of the shard")
+	flags.StringVar(&shardID, "shard", "my-shard", "Shard ID/Contract Name")
+	flags.StringVar(&add, "add", "", "Replica to add, as ID=host:port")
+	flags.StringVar(&tlsCert, "tls-cert", "", "Path to the PEM encoded TLS certificate of the added replica")
+	flags.Uint64Var(&remove, "remove", 0, "ID of the replica to remove")
+	flags.DurationVar(&timeout, "timeout", time.Minute, "Time to wait for the change to be applied")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if server == "" {
+		return errors.New("the address of the leader is required")
+	}
+
+	req := &protos.MembershipRequest{ShardId: shardID, RemovedId: remove}
+	switch {
+	case add != "" && remove != 0:
+		req.Operation = protos.MembershipOperation_REPLACE_REPLICA
+	case add != "":
+		req.Operation = protos.MembershipOperation_ADD_REPLICA
+	case remove != 0:
+		req.Operation = protos.MembershipOperation_REMOVE_REPLICA
+	default:
+		return errors.New("a replica to add or to remove is required")
+	}
+
+	if add != "" {
+		replica, err := parseReplica(add)
+		if err != nil {
+			return err
+		}
+		if tlsCert != "" {
+			if replica.TlsCert, err = ioutil.ReadFile(tlsCert); err != nil {
+				return errors.Wrap(err, "failed to read TLS certificate")
+			}
+		}
+		req.Replica = replica
+	}
+
+	conn, err := comm.ClientConfig{DialTimeout: comm.DefaultConnectionTimeout}.Dial(server)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", server)
+	}
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	resp, err := protos.NewShardCommunicationClient(conn).ChangeMembership(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Shard %s has voters %v and learners %v", shardID, resp.Voters, resp.Learners)
+	return nil
+}
+
+// parseReplica parses a replica given as ID=host:port
+func parseReplica(s string) (*protos.ReplicaInfo, error) {
+	parts := strings.SplitN(s, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("replica %q is not given as ID=host:port", s)
+	}
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid ID of replica %q", s)
+	}
+	return &protos.ReplicaInfo{Id: id, Address: parts[1]}, nil
+}
@@ -45,6 +45,7 @@ const (
 	Qscc_GetBlockByHash     = "qscc/GetBlockByHash"
 	Qscc_GetTransactionByID = "qscc/GetTransactionByID"
 	Qscc_GetBlockByTxID     = "qscc/GetBlockByTxID"
+	Qscc_GetDAGStats        = "qscc/GetDAGStats"
 
 	// Cscc resources
 	Cscc_JoinChain            = "cscc/JoinChain"
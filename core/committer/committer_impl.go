@@ -8,17 +8,18 @@ package committer
 
 import (
 	// "fmt"
-	"strconv"
-	"strings"
+	"sort"
 	"sync"
+	"time"
 
-	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/common"
-	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
-	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/internal/pkg/txflags"
 	"github.com/hyperledger/fabric/protoutil"
 	"github.com/pkg/errors"
 )
@@ -30,6 +31,9 @@ type TransactionDependency struct {
 	TxID           string
 	DependentTxIDs []string
 	HasDependency  bool
+	// Conflicts are the preceding transactions of the block that the
+	// read/write set of the transaction conflicts with
+	Conflicts []Conflict
 }
 
 // TransactionDAG represents a Directed Acyclic Graph of transaction dependencies
@@ -43,6 +47,8 @@ type TransactionDAG struct {
 	ValidationResults map[string]bool
 	// Map of transaction IDs to their index in the block
 	TxIndices map[string]int
+	// Transactions whose declared dependencies disagree with their read/write set
+	Mismatches []DependencyMismatch
 	// Mutex for thread safety
 	mutex sync.RWMutex
 }
@@ -90,62 +96,75 @@ func (dag *TransactionDAG) AddTransaction(txID string, txIndex int, hasDependenc
 }
 
 // CalculateLevels determines the level of each transaction in the DAG
-// Level 0 transactions have no dependencies
-// Higher levels depend on lower levels
+// Level 0 transactions have no dependencies nor conflicts
+// Higher levels depend on, or conflict with, lower levels
+//
+// The levels are computed in block order from the edges that lead to
+// preceding transactions of the block, so that every peer derives the same
+// levels. The DAGs built from a block have no other edges and thus no
+// cycles; the edges of the DAGs assembled with AddTransaction that lead to
+// following transactions are ignored.
 func (dag *TransactionDAG) CalculateLevels() {
 	dag.mutex.Lock()
 	defer dag.mutex.Unlock()
 
-	// First, reset all levels
-	dag.Levels = make(map[string]int)
-
-	// First pass: Set all transactions with no dependencies to level 0
-	for txID, node := range dag.Nodes {
-		if !node.HasDependency || len(node.DependentTxIDs) == 0 {
-			dag.Levels[txID] = 0
+	order := dag.blockOrder()
+	dag.Levels = make(map[string]int, len(order))
+	for _, txID := range order {
+		level := 0
+		for _, predTxID := range dag.inBlockPredecessors(txID) {
+			if dag.Levels[predTxID]+1 > level {
+				level = dag.Levels[predTxID] + 1
+			}
 		}
+		dag.Levels[txID] = level
 	}
+}
 
-	// Keep processing until all transactions have been assigned a level
-	changed := true
-	for changed {
-		changed = false
-		for txID, node := range dag.Nodes {
-			// Skip transactions that already have a level assigned
-			if _, hasLevel := dag.Levels[txID]; hasLevel {
-				continue
-			}
-
-			// Check if all dependencies have levels assigned
-			allDepsHaveLevel := true
-			maxDepLevel := -1
-
-			for _, depTxID := range node.DependentTxIDs {
-				if level, exists := dag.Levels[depTxID]; exists {
-					if level > maxDepLevel {
-						maxDepLevel = level
-					}
-				} else {
-					allDepsHaveLevel = false
-					break
-				}
-			}
+// blockOrder returns the transactions of the DAG in block order. The caller
+// must hold the mutex.
+func (dag *TransactionDAG) blockOrder() []string {
+	order := make([]string, 0, len(dag.Nodes))
+	for txID := range dag.Nodes {
+		order = append(order, txID)
+	}
+	sort.Slice(order, func(i, j int) bool {
+		return dag.TxIndices[order[i]] < dag.TxIndices[order[j]]
+	})
+	return order
+}
 
-			// If all dependencies have levels, set this transaction's level to max + 1
-			if allDepsHaveLevel {
-				dag.Levels[txID] = maxDepLevel + 1
-				changed = true
-			}
+// inBlockPredecessors returns the distinct preceding transactions of the
+// block that the transaction depends on or conflicts with. The caller must
+// hold the mutex.
+func (dag *TransactionDAG) inBlockPredecessors(txID string) []string {
+	var predecessors []string
+	seen := make(map[string]struct{})
+	for _, predTxID := range dag.Nodes[txID].predecessors() {
+		if _, ok := seen[predTxID]; ok {
+			continue
+		}
+		// Dependencies on transactions of earlier blocks are already satisfied
+		if _, inBlock := dag.Nodes[predTxID]; !inBlock || dag.TxIndices[predTxID] >= dag.TxIndices[txID] {
+			continue
 		}
+		seen[predTxID] = struct{}{}
+		predecessors = append(predecessors, predTxID)
 	}
+	return predecessors
+}
 
-	// Log any transactions that couldn't be assigned a level (circular dependencies)
-	for txID := range dag.Nodes {
-		if _, hasLevel := dag.Levels[txID]; !hasLevel {
-			logger.Warningf("Transaction %s has circular dependencies, setting to level 0", txID)
-			dag.Levels[txID] = 0
-		}
+// predecessors returns the transactions that the transaction declares a
+// dependency on or conflicts with
+func (node *TransactionDependency) predecessors() []string {
+	if len(node.Conflicts) == 0 {
+		return node.DependentTxIDs
+	}
+	predecessors := append([]string{}, node.DependentTxIDs...)
+	for _, conflict := range node.Conflicts {
+		predecessors = append(predecessors, conflict.TxID)
 	}
+	return predecessors
 }
 
 // GetTransactionsByLevel returns transactions grouped by their level in the DAG
@@ -184,6 +203,23 @@ func (dag *TransactionDAG) IsValid(txID string) bool {
 	return false
 }
 
+// Stats returns the number of transactions, the widths of the levels and the
+// number of edges between the transactions of the DAG
+func (dag *TransactionDAG) Stats() *ledger.DAGStats {
+	dag.mutex.RLock()
+	defer dag.mutex.RUnlock()
+
+	stats := &ledger.DAGStats{Transactions: len(dag.Nodes)}
+	for txID, level := range dag.Levels {
+		for len(stats.LevelWidths) <= level {
+			stats.LevelWidths = append(stats.LevelWidths, 0)
+		}
+		stats.LevelWidths[level]++
+		stats.Edges += len(dag.inBlockPredecessors(txID))
+	}
+	return stats
+}
+
 // GetIndexByTxID returns the block index for a transaction ID
 func (dag *TransactionDAG) GetIndexByTxID(txID string) (int, bool) {
 	dag.mutex.RLock()
@@ -193,10 +229,20 @@ func (dag *TransactionDAG) GetIndexByTxID(txID string) (int, bool) {
 	return index, exists
 }
 
-// BuildDAGFromBlock constructs a DAG for the block by extracting dependency information from transactions
+// BuildDAGFromBlock constructs a DAG for the block from the conflicts
+// between the read/write sets of its transactions and from the dependency
+// information declared by their endorsers. The conflicts give every peer the
+// same DAG without trusting the endorsers: only the declared dependencies
+// that they justify are kept, and the others are recorded as mismatches.
 func BuildDAGFromBlock(block *common.Block) (*TransactionDAG, error) {
 	dag := NewTransactionDAG()
 
+	// The transactions of the DAG in block order, with their accesses and
+	// declared dependencies
+	var txIDs []string
+	var accesses []*rwsetutil.Accesses
+	var declared [][]string
+
 	// Extract envelope from each transaction
 	for i := 0; i < len(block.Data.Data); i++ {
 		txEnvelopeBytes := block.Data.Data[i]
@@ -215,6 +261,11 @@ func BuildDAGFromBlock(block *common.Block) (*TransactionDAG, error) {
 			continue
 		}
 
+		if payload.Header == nil {
+			logger.Warningf("Missing payload header for tx %d", i)
+			continue
+		}
+
 		// Extract the channel header to get the transaction ID
 		chdr, err := protoutil.UnmarshalChannelHeader(payload.Header.ChannelHeader)
 		if err != nil {
@@ -223,6 +274,11 @@ func BuildDAGFromBlock(block *common.Block) (*TransactionDAG, error) {
 		}
 
 		txID := chdr.TxId
+		if _, exists := dag.Nodes[txID]; exists {
+			// The txvalidator invalidates the duplicates of a transaction
+			logger.Warningf("Ignoring duplicate of tx %s at index %d", txID, i)
+			continue
+		}
 
 		// Extract the transaction
 		tx, err := protoutil.UnmarshalTransaction(payload.Data)
@@ -231,79 +287,143 @@ func BuildDAGFromBlock(block *common.Block) (*TransactionDAG, error) {
 			continue
 		}
 
-		// Extract dependency information from transaction actions
-		hasDependency := false
-		dependentTxID := ""
-
-		for _, action := range tx.Actions {
-			chaincodeAction := &peer.ChaincodeAction{}
-			if err := proto.Unmarshal(action.Payload, chaincodeAction); err != nil {
-				logger.Warningf("Failed to unmarshal chaincode action for tx %s: %s", txID, err)
-				continue
-			}
-
-			// Extract dependency information from the response message
-			if chaincodeAction.Response != nil && chaincodeAction.Response.Message != "" {
-				hasDependency, dependentTxID, _, err = ParseDependencyInfo(chaincodeAction.Response.Message)
-				if err != nil {
-					logger.Warningf("Failed to parse dependency info for tx %s: %s", txID, err)
-					continue
-				}
-				if hasDependency {
-					break
-				}
+		// Extract the keys the transaction accesses
+		var txAccesses *rwsetutil.Accesses
+		if chdr.Type == int32(common.HeaderType_ENDORSER_TRANSACTION) {
+			if txAccesses, err = accessesOf(tx); err != nil {
+				logger.Warningf("Failed to extract read/write set of tx %s: %s", txID, err)
 			}
 		}
+		// Extract dependency information from the endorsements of each action
+		var dependentTxIDs []string
+		if infos := dependencyInfos(txID, tx); len(infos) > 0 {
+			dependentTxIDs = append([]string{}, dependentTxIDsFromInfos(infos)...)
+		}
 
-		// Add transaction to DAG
-		dag.AddTransaction(txID, i, hasDependency, dependentTxID)
+		dag.AddTransaction(txID, i, false, "")
+		txIDs = append(txIDs, txID)
+		accesses = append(accesses, txAccesses)
+		declared = append(declared, dependentTxIDs)
 	}
 
+	dag.addEdges(txIDs, accesses, declared)
+
 	// Calculate levels for parallel processing
 	dag.CalculateLevels()
 
 	return dag, nil
 }
 
-// ParseDependencyInfo parses the dependency info from the response message
-func ParseDependencyInfo(responseMsg string) (bool, string, int64, error) {
-	// Example format: "DependencyInfo:HasDependency=true,DependentTxID=tx123,ExpiryTime=1234567"
-	if !strings.Contains(responseMsg, "DependencyInfo:") {
-		return false, "", 0, nil
-	}
+// dependentTxIDsFromInfos returns the union, in endorsement order, of the
+// transactions that the dependency infos of a transaction report it as
+// depending on
+func dependentTxIDsFromInfos(infos []*protos.DependencyInfo) []string {
+	var dependentTxIDs []string
+	seen := make(map[string]struct{})
 
-	parts := strings.Split(responseMsg, ":")
-	if len(parts) < 2 {
-		return false, "", 0, errors.New("invalid dependency info format")
+	for _, info := range infos {
+		if !info.HasDependency {
+			continue
+		}
+		for _, dependentTxID := range info.DependentTxIds {
+			if _, ok := seen[dependentTxID]; ok || dependentTxID == "" {
+				continue
+			}
+			seen[dependentTxID] = struct{}{}
+			dependentTxIDs = append(dependentTxIDs, dependentTxID)
+		}
 	}
 
-	info := parts[1]
-	infoMap := make(map[string]string)
+	return dependentTxIDs
+}
+
+// shardIDsFromTransaction returns, in endorsement order, the shards that
+// prepared the given transaction
+func shardIDsFromTransaction(txID string, tx *peer.Transaction) []string {
+	var shardIDs []string
+	seen := make(map[string]struct{})
 
-	items := strings.Split(info, ",")
-	for _, item := range items {
-		kv := strings.Split(item, "=")
-		if len(kv) == 2 {
-			infoMap[kv[0]] = kv[1]
+	for _, info := range dependencyInfos(txID, tx) {
+		if _, ok := seen[info.ShardId]; ok || info.ShardId == "" {
+			continue
 		}
+		seen[info.ShardId] = struct{}{}
+		shardIDs = append(shardIDs, info.ShardId)
 	}
 
-	hasDependency := false
-	if val, ok := infoMap["HasDependency"]; ok {
-		hasDependency, _ = strconv.ParseBool(val)
+	return shardIDs
+}
+
+// dependencyInfos returns the dependency info attached to the endorsements
+// of the given transaction. Dependency info issued for another transaction
+// is ignored. The endorsement signature does not cover the dependency info,
+// so the dependencies it declares are cross-checked by addEdges.
+func dependencyInfos(txID string, tx *peer.Transaction) []*protos.DependencyInfo {
+	var infos []*protos.DependencyInfo
+
+	for _, action := range tx.Actions {
+		cap, err := protoutil.UnmarshalChaincodeActionPayload(action.Payload)
+		if err != nil {
+			logger.Warningf("Failed to unmarshal chaincode action payload for tx %s: %s", txID, err)
+			continue
+		}
+		if cap.Action == nil {
+			continue
+		}
+
+		for _, endorsement := range cap.Action.Endorsements {
+			endorsementInfos, err := sharding.DependencyInfosFromEndorsement(endorsement)
+			if err != nil {
+				logger.Warningf("Failed to extract dependency info for tx %s: %s", txID, err)
+				continue
+			}
+			for _, info := range endorsementInfos {
+				if info.TxId != txID {
+					logger.Warningf("Ignoring dependency info for tx %s attached to tx %s", info.TxId, txID)
+					continue
+				}
+				infos = append(infos, info)
+			}
+		}
 	}
 
-	dependentTxID := ""
-	if val, ok := infoMap["DependentTxID"]; ok {
-		dependentTxID = val
+	return infos
+}
+
+// txOutcomes returns the final validation result of every transaction in
+// the committed block that was prepared by a shard
+func txOutcomes(block *common.Block) []sharding.TxOutcome {
+	var flags txflags.ValidationFlags
+	if len(block.Metadata.GetMetadata()) > int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+		flags = txflags.ValidationFlags(block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
 	}
 
-	expiryTime := int64(0)
-	if val, ok := infoMap["ExpiryTime"]; ok {
-		expiryTime, _ = strconv.ParseInt(val, 10, 64)
+	var outcomes []sharding.TxOutcome
+	for i, txEnvelopeBytes := range block.Data.Data {
+		env, err := protoutil.GetEnvelopeFromBlock(txEnvelopeBytes)
+		if err != nil {
+			continue
+		}
+		payload, err := protoutil.UnmarshalPayload(env.Payload)
+		if err != nil || payload.Header == nil {
+			continue
+		}
+		chdr, err := protoutil.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+		if err != nil || chdr.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+			continue
+		}
+		tx, err := protoutil.UnmarshalTransaction(payload.Data)
+		if err != nil {
+			continue
+		}
+
+		valid := i < len(flags) && flags.IsValid(i)
+		for _, shardID := range shardIDsFromTransaction(chdr.TxId, tx) {
+			outcomes = append(outcomes, sharding.TxOutcome{TxID: chdr.TxId, ShardID: shardID, Valid: valid})
+		}
 	}
 
-	return hasDependency, dependentTxID, expiryTime, nil
+	return outcomes
 }
 
 //--------!!!IMPORTANT!!-!!IMPORTANT!!-!!IMPORTANT!!---------
@@ -340,17 +460,45 @@ type PeerLedgerSupport interface {
 // chain information
 type LedgerCommitter struct {
 	PeerLedgerSupport
+	listeners []CommitListener
+}
+
+// CommitListener is notified of the outcome of the shard prepared
+// transactions of every block committed to the ledger
+type CommitListener interface {
+	BlockCommitted(blockNumber uint64, outcomes []sharding.TxOutcome)
 }
 
 // NewLedgerCommitter is a factory function to create an instance of the committer
 // which passes incoming blocks via validation and commits them into the ledger.
-func NewLedgerCommitter(ledger PeerLedgerSupport) *LedgerCommitter {
-	return &LedgerCommitter{PeerLedgerSupport: ledger}
+func NewLedgerCommitter(ledger PeerLedgerSupport, listeners ...CommitListener) *LedgerCommitter {
+	return &LedgerCommitter{PeerLedgerSupport: ledger, listeners: listeners}
 }
 
 // CommitLegacy commits blocks atomically with private data
 func (lc *LedgerCommitter) CommitLegacy(blockAndPvtData *ledger.BlockAndPvtData, commitOpts *ledger.CommitOptions) error {
+	if err := lc.commit(blockAndPvtData, commitOpts); err != nil {
+		return err
+	}
+
+	if len(lc.listeners) > 0 {
+		block := blockAndPvtData.Block
+		outcomes := txOutcomes(block)
+		for _, listener := range lc.listeners {
+			listener.BlockCommitted(block.Header.Number, outcomes)
+		}
+	}
+
+	return nil
+}
+
+// commit validates the dependencies of the transactions of the block on top
+// of the validation flags of the txvalidator, then commits it along the
+// statistics of its DAG. A block whose DAG cannot be built is committed with
+// the flags of the txvalidator alone.
+func (lc *LedgerCommitter) commit(blockAndPvtData *ledger.BlockAndPvtData, commitOpts *ledger.CommitOptions) error {
 	block := blockAndPvtData.Block
+	start := time.Now()
 
 	// 1. Construct a DAG for the block
 	dag, err := BuildDAGFromBlock(block)
@@ -363,18 +511,24 @@ func (lc *LedgerCommitter) CommitLegacy(blockAndPvtData *ledger.BlockAndPvtData,
 	logger.Infof("Successfully built DAG for block %d with %d transactions",
 		block.Header.Number, len(dag.Nodes))
 
-	// 2. Process transactions according to the DAG
-	err = lc.processBlockWithDAG(blockAndPvtData, commitOpts, dag)
-	if err != nil {
-		logger.Errorf("Failed to process block with DAG: %s", err)
-		// Fall back to legacy commit if DAG processing fails
-		return lc.legacyCommit(blockAndPvtData, commitOpts)
+	// 2. Validate transactions according to the DAG
+	dependencyInvalid := lc.validateWithDAG(block, dag)
+
+	// 3. Commit the block along the statistics of the DAG, without changing
+	// the options of the caller
+	stats := dag.Stats()
+	stats.DependencyInvalid = dependencyInvalid
+	stats.Duration = time.Since(start)
+	opts := ledger.CommitOptions{}
+	if commitOpts != nil {
+		opts = *commitOpts
 	}
+	opts.DAGStats = stats
 
-	return nil
+	return lc.legacyCommit(blockAndPvtData, &opts)
 }
 
-// legacyCommit is the original commit function without DAG processing
+// legacyCommit commits the block with the validation flags it carries
 func (lc *LedgerCommitter) legacyCommit(blockAndPvtData *ledger.BlockAndPvtData, commitOpts *ledger.CommitOptions) error {
 	// Committing new block
 	if err := lc.PeerLedgerSupport.CommitLegacy(blockAndPvtData, commitOpts); err != nil {
@@ -384,10 +538,24 @@ func (lc *LedgerCommitter) legacyCommit(blockAndPvtData *ledger.BlockAndPvtData,
 	return nil
 }
 
-// processBlockWithDAG processes a block using the transaction dependency DAG
-func (lc *LedgerCommitter) processBlockWithDAG(blockAndPvtData *ledger.BlockAndPvtData,
-	commitOpts *ledger.CommitOptions, dag *TransactionDAG,
-) error {
+// validateWithDAG is a validation stage that follows the txvalidator and only
+// ever invalidates transactions of the block. It visits the DAG level by
+// level, validating the transactions of a level in parallel:
+//   - a transaction invalidated by the txvalidator keeps its code
+//   - a transaction that depends on an invalid transaction of the block is
+//     marked DependencyInvalid
+//   - a transaction whose chaincode response is not successful is marked
+//     BAD_RESPONSE_PAYLOAD
+//
+// The conflicts between the read/write sets of the transactions only order
+// the DAG: whether a transaction that reads or writes the keys written by a
+// preceding transaction is valid is left to the MVCC validation of the
+// ledger, as without dependencies.
+//
+// It returns the number of transactions marked DependencyInvalid.
+func (lc *LedgerCommitter) validateWithDAG(block *common.Block, dag *TransactionDAG) int {
+	flags := validationFlags(block)
+
 	// Get transactions by level for parallel processing
 	txsByLevel := dag.GetTransactionsByLevel()
 	maxLevel := -1
@@ -399,196 +567,147 @@ func (lc *LedgerCommitter) processBlockWithDAG(blockAndPvtData *ledger.BlockAndP
 		}
 	}
 
-	logger.Infof("Processing block with DAG: %d levels of transactions", maxLevel+1)
+	logger.Debugf("Validating block %d with DAG: %d levels of transactions", block.Header.Number, maxLevel+1)
+
+	dependencyInvalid := 0
 
 	// Process each level in order (level 0 first, then 1, etc.)
 	for level := 0; level <= maxLevel; level++ {
-		txs, exists := txsByLevel[level]
-		if !exists {
-			continue
-		}
-
-		logger.Debugf("Processing %d transactions at level %d", len(txs), level)
+		txs := txsByLevel[level]
+		logger.Debugf("Validating %d transactions at level %d", len(txs), level)
 
-		// Process transactions at this level in parallel
+		// The results of a level are only recorded once the whole level is
+		// validated, so that the validity of a transaction never depends on
+		// the order in which the transactions of its level are visited
+		results := make([]bool, len(txs))
 		var wg sync.WaitGroup
-		var mutex sync.Mutex
-		txValidationResults := make(map[string]bool)
-
-		for _, txID := range txs {
-			// Check if dependencies are valid (if any)
-			if level > 0 {
-				// For transactions with dependencies, check if dependencies were valid
-				node := dag.Nodes[txID]
-				allDepsValid := true
-
-				for _, depTxID := range node.DependentTxIDs {
-					if !dag.IsValid(depTxID) {
-						// One of the dependencies is invalid, so this transaction is also invalid
-						allDepsValid = false
-						logger.Infof("Transaction %s marked as invalid because dependency %s is invalid",
-							txID, depTxID)
-						break
-					}
-				}
 
-				if !allDepsValid {
-					// Mark this transaction as invalid and skip processing
-					dag.SetValidationResult(txID, false)
-					txValidationResults[txID] = false
-					continue
-				}
+		for i, txID := range txs {
+			txIndex, exists := dag.GetIndexByTxID(txID)
+			if !exists {
+				logger.Warningf("Transaction %s not found in index map", txID)
+				continue
+			}
+
+			if flags.IsInvalid(txIndex) {
+				continue
+			}
+
+			if depTxID, invalid := invalidDependency(dag, txID); invalid {
+				logger.Infof("Transaction %s marked as invalid because dependency %s is invalid", txID, depTxID)
+				flags.SetFlag(txIndex, txflags.DependencyInvalid)
+				dependencyInvalid++
+				continue
 			}
 
-			// Process the transaction
 			wg.Add(1)
-			go func(id string) {
+			go func(i int, txID string, txIndex int) {
 				defer wg.Done()
 
-				// Get the transaction index in the block
-				txIndex, exists := dag.GetIndexByTxID(id)
-				if !exists {
-					logger.Warningf("Transaction %s not found in index map", id)
-					return
-				}
+				code := lc.validateTransaction(block, txID, txIndex)
+				flags.SetFlag(txIndex, code)
+				results[i] = code == peer.TxValidationCode_VALID
 
-				// Extract the transaction envelope
-				txEnvelopeBytes := blockAndPvtData.Block.Data.Data[txIndex]
-				env, err := protoutil.GetEnvelopeFromBlock(txEnvelopeBytes)
-				if err != nil {
-					logger.Errorf("Failed to get envelope for tx %s: %s", id, err)
-					mutex.Lock()
-					txValidationResults[id] = false
-					mutex.Unlock()
-					dag.SetValidationResult(id, false)
-					return
-				}
+				logger.Debugf("Transaction %s (index %d) validated with code %s", txID, txIndex, txflags.CodeName(code))
+			}(i, txID, txIndex)
+		}
 
-				// Extract the payload
-				payload, err := protoutil.UnmarshalPayload(env.Payload)
-				if err != nil {
-					logger.Errorf("Failed to unmarshal payload for tx %s: %s", id, err)
-					mutex.Lock()
-					txValidationResults[id] = false
-					mutex.Unlock()
-					dag.SetValidationResult(id, false)
-					return
-				}
+		// Wait for all transactions at this level to be validated
+		wg.Wait()
+		for i, txID := range txs {
+			dag.SetValidationResult(txID, results[i])
+		}
+	}
 
-				// Extract the transaction
-				tx, err := protoutil.UnmarshalTransaction(payload.Data)
-				if err != nil {
-					logger.Errorf("Failed to unmarshal transaction for tx %s: %s", id, err)
-					mutex.Lock()
-					txValidationResults[id] = false
-					mutex.Unlock()
-					dag.SetValidationResult(id, false)
-					return
-				}
+	return dependencyInvalid
+}
 
-				// Validate chaincode actions
-				isValid := true
-				for _, action := range tx.Actions {
-					chaincodeAction := &peer.ChaincodeAction{}
-					if err := proto.Unmarshal(action.Payload, chaincodeAction); err != nil {
-						logger.Errorf("Failed to unmarshal chaincode action for tx %s: %s", id, err)
-						isValid = false
-						break
-					}
-
-					// Check chaincode response status
-					if chaincodeAction.Response == nil || chaincodeAction.Response.Status != 200 {
-						logger.Errorf("Chaincode action failed for tx %s with status %d", id,
-							chaincodeAction.Response.GetStatus())
-						isValid = false
-						break
-					}
-				}
+// validateTransaction returns the code of the transaction at the given index
+// of the block, which the txvalidator found valid
+func (lc *LedgerCommitter) validateTransaction(block *common.Block, txID string, txIndex int) peer.TxValidationCode {
+	tx, err := endorserTransactionAt(block, txIndex)
+	if err != nil {
+		logger.Errorf("Failed to extract transaction %s: %s", txID, err)
+		return peer.TxValidationCode_BAD_PAYLOAD
+	}
+	if tx == nil {
+		// only endorser transactions have dependencies
+		return peer.TxValidationCode_VALID
+	}
 
-				// Check for read/write set conflicts with dependencies
-				if level > 0 && isValid {
-					node := dag.Nodes[id]
-					for _, depTxID := range node.DependentTxIDs {
-						// Get the dependent transaction
-						depTxIndex, exists := dag.GetIndexByTxID(depTxID)
-						if !exists {
-							continue
-						}
-
-						// Extract the dependent transaction
-						depTxEnvelopeBytes := blockAndPvtData.Block.Data.Data[depTxIndex]
-						depEnv, err := protoutil.GetEnvelopeFromBlock(depTxEnvelopeBytes)
-						if err != nil {
-							continue
-						}
-
-						depPayload, err := protoutil.UnmarshalPayload(depEnv.Payload)
-						if err != nil {
-							continue
-						}
-
-						depTx, err := protoutil.UnmarshalTransaction(depPayload.Data)
-						if err != nil {
-							continue
-						}
-
-						// Check for read/write set conflicts
-						if lc.checkRWSetConflicts(tx, depTx) {
-							logger.Infof("Transaction %s marked as invalid due to read/write set conflict with dependency %s",
-								id, depTxID)
-							isValid = false
-							break
-						}
-					}
-				}
+	// Validate chaincode actions
+	for _, action := range tx.Actions {
+		_, chaincodeAction, err := protoutil.GetPayloads(action)
+		if err != nil {
+			logger.Errorf("Failed to extract chaincode action of tx %s: %s", txID, err)
+			return peer.TxValidationCode_BAD_RESPONSE_PAYLOAD
+		}
 
-				// Set the result
-				mutex.Lock()
-				txValidationResults[id] = isValid
-				mutex.Unlock()
+		// Check chaincode response status
+		if chaincodeAction.Response.GetStatus() != 200 {
+			logger.Infof("Chaincode action failed for tx %s with status %d", txID, chaincodeAction.Response.GetStatus())
+			return peer.TxValidationCode_BAD_RESPONSE_PAYLOAD
+		}
+	}
 
-				// Update the DAG
-				dag.SetValidationResult(id, isValid)
+	return peer.TxValidationCode_VALID
+}
 
-				logger.Debugf("Transaction %s (index %d) processed and marked as %v",
-					id, txIndex, isValid)
-			}(txID)
+// invalidDependency returns a transaction of the block that the given
+// transaction depends on and that is invalid, or was not validated at a lower
+// level of the DAG. A dependency of a transaction on itself is ignored.
+func invalidDependency(dag *TransactionDAG, txID string) (string, bool) {
+	for _, depTxID := range dag.Nodes[txID].DependentTxIDs {
+		// Dependencies on transactions of earlier blocks are already satisfied
+		if _, inBlock := dag.GetIndexByTxID(depTxID); !inBlock || depTxID == txID {
+			continue
+		}
+		if !dag.IsValid(depTxID) {
+			return depTxID, true
 		}
-
-		// Wait for all transactions at this level to be processed
-		wg.Wait()
-		logger.Debugf("Completed processing of level %d", level)
 	}
+	return "", false
+}
 
-	// After DAG-based processing, update the transaction validation flags in the block
-	metadata := blockAndPvtData.Block.Metadata
-	if len(metadata.Metadata) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
+// validationFlags returns the validation flags that the txvalidator set in
+// the metadata of the block. A block without flags for all its transactions
+// gets flags marking every transaction valid.
+func validationFlags(block *common.Block) txflags.ValidationFlags {
+	metadata := block.Metadata
+	for len(metadata.Metadata) <= int(common.BlockMetadataIndex_TRANSACTIONS_FILTER) {
 		metadata.Metadata = append(metadata.Metadata, []byte{})
 	}
 
-	txFilter := make([]uint8, len(blockAndPvtData.Block.Data.Data))
-	for i := 0; i < len(txFilter); i++ {
-		txFilter[i] = uint8(peer.TxValidationCode_VALID)
+	flags := txflags.ValidationFlags(metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	if len(flags) != len(block.Data.Data) {
+		flags = txflags.NewWithValues(len(block.Data.Data), peer.TxValidationCode_VALID)
+		metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
 	}
+	return flags
+}
 
-	// Update validation flags based on our DAG processing results
-	for txID := range dag.Nodes {
-		txIndex, exists := dag.GetIndexByTxID(txID)
-		if !exists {
-			continue
-		}
-
-		if !dag.IsValid(txID) {
-			// Mark as invalid with appropriate validation code
-			txFilter[txIndex] = uint8(peer.TxValidationCode_MVCC_READ_CONFLICT)
-		}
+// endorserTransactionAt returns the transaction at the given index of the
+// block, or nil if it is not an endorser transaction
+func endorserTransactionAt(block *common.Block, txIndex int) (*peer.Transaction, error) {
+	env, err := protoutil.GetEnvelopeFromBlock(block.Data.Data[txIndex])
+	if err != nil {
+		return nil, err
 	}
-
-	// Update the block metadata with our modified validation flags
-	metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = txFilter
-
-	// Now commit the block with the updated validation flags
-	return lc.PeerLedgerSupport.CommitLegacy(blockAndPvtData, commitOpts)
+	payload, err := protoutil.UnmarshalPayload(env.Payload)
+	if err != nil {
+		return nil, err
+	}
+	if payload.Header == nil {
+		return nil, errors.New("payload header is missing")
+	}
+	chdr, err := protoutil.UnmarshalChannelHeader(payload.Header.ChannelHeader)
+	if err != nil {
+		return nil, err
+	}
+	if chdr.Type != int32(common.HeaderType_ENDORSER_TRANSACTION) {
+		return nil, nil
+	}
+	return protoutil.UnmarshalTransaction(payload.Data)
 }
 
 // GetPvtDataAndBlockByNum retrieves private data and block for given sequence number
@@ -649,180 +768,3 @@ func (lc *LedgerCommitter) CommitPvtDataOfOldBlocks(reconciledPvtdata []*ledger.
 func (lc *LedgerCommitter) Close() {
 	lc.PeerLedgerSupport.Close()
 }
-
-// checkRWSetConflicts checks for read/write set conflicts between transactions
-func (lc *LedgerCommitter) checkRWSetConflicts(tx1, tx2 *peer.Transaction) bool {
-	// Extract RW sets from both transactions
-	ns1Map, err := extractRWSet(tx1)
-	if err != nil {
-		logger.Errorf("Failed to extract RW set from tx1: %v", err)
-		return false
-	}
-
-	ns2Map, err := extractRWSet(tx2)
-	if err != nil {
-		logger.Errorf("Failed to extract RW set from tx2: %v", err)
-		return false
-	}
-
-	// Check for conflicts in each namespace
-	for ns1, ns1Data := range ns1Map {
-		ns2Data, exists := ns2Map[ns1]
-		if !exists {
-			continue // No conflict if namespaces don't overlap
-		}
-
-		// Unmarshal RW sets
-		kvrw1 := &kvrwset.KVRWSet{}
-		if err := proto.Unmarshal(ns1Data.Rwset, kvrw1); err != nil {
-			logger.Errorf("Failed to unmarshal RW set for ns1: %v", err)
-			return false
-		}
-
-		kvrw2 := &kvrwset.KVRWSet{}
-		if err := proto.Unmarshal(ns2Data.Rwset, kvrw2); err != nil {
-			logger.Errorf("Failed to unmarshal RW set for ns2: %v", err)
-			return false
-		}
-
-		// Check for conflicts in public read/write sets
-		if hasConflictInKVRWSet(kvrw1.Reads, kvrw2.Writes) ||
-			hasConflictInKVRWSet(kvrw2.Reads, kvrw1.Writes) ||
-			hasWriteWriteConflict(kvrw1.Writes, kvrw2.Writes) {
-			return true
-		}
-
-		// Check for conflicts in private read/write sets
-		for _, coll1 := range ns1Data.CollectionHashedRwset {
-			hashedRW1 := &kvrwset.HashedRWSet{}
-			if err := proto.Unmarshal(coll1.HashedRwset, hashedRW1); err != nil {
-				logger.Errorf("Failed to unmarshal hashed RW set for collection %s: %v", coll1.CollectionName, err)
-				continue
-			}
-
-			for _, coll2 := range ns2Data.CollectionHashedRwset {
-				if coll1.CollectionName != coll2.CollectionName {
-					continue
-				}
-
-				hashedRW2 := &kvrwset.HashedRWSet{}
-				if err := proto.Unmarshal(coll2.HashedRwset, hashedRW2); err != nil {
-					logger.Errorf("Failed to unmarshal hashed RW set for collection %s: %v", coll2.CollectionName, err)
-					continue
-				}
-
-				if hasConflictInHashedRWSet(hashedRW1.HashedReads, hashedRW2.HashedWrites) ||
-					hasConflictInHashedRWSet(hashedRW2.HashedReads, hashedRW1.HashedWrites) ||
-					hasHashedWriteWriteConflict(hashedRW1.HashedWrites, hashedRW2.HashedWrites) {
-					return true
-				}
-			}
-		}
-	}
-
-	return false
-}
-
-// hasConflictInKVRWSet checks for conflicts between reads and writes in KVRWSet
-func hasConflictInKVRWSet(reads []*kvrwset.KVRead, writes []*kvrwset.KVWrite) bool {
-	// Create a map of write keys for efficient lookup
-	writeKeys := make(map[string]struct{})
-	for _, w := range writes {
-		writeKeys[w.Key] = struct{}{}
-	}
-
-	// Check if any read key exists in writes
-	for _, r := range reads {
-		if _, exists := writeKeys[r.Key]; exists {
-			return true
-		}
-	}
-	return false
-}
-
-// hasConflictInHashedRWSet checks for conflicts between hashed reads and writes
-func hasConflictInHashedRWSet(reads []*kvrwset.KVReadHash, writes []*kvrwset.KVWriteHash) bool {
-	// Create a map of write key hashes for efficient lookup
-	writeKeyHashes := make(map[string]struct{})
-	for _, w := range writes {
-		writeKeyHashes[string(w.KeyHash)] = struct{}{}
-	}
-
-	// Check if any read key hash exists in writes
-	for _, r := range reads {
-		if _, exists := writeKeyHashes[string(r.KeyHash)]; exists {
-			return true
-		}
-	}
-	return false
-}
-
-// hasWriteWriteConflict checks for conflicts between two write sets
-func hasWriteWriteConflict(writes1 []*kvrwset.KVWrite, writes2 []*kvrwset.KVWrite) bool {
-	// Create a map of write keys from the first set
-	writeKeys := make(map[string]struct{})
-	for _, w := range writes1 {
-		writeKeys[w.Key] = struct{}{}
-	}
-
-	// Check if any key from second set exists in first set
-	for _, w := range writes2 {
-		if _, exists := writeKeys[w.Key]; exists {
-			return true
-		}
-	}
-	return false
-}
-
-// hasHashedWriteWriteConflict checks for conflicts between two hashed write sets
-func hasHashedWriteWriteConflict(writes1 []*kvrwset.KVWriteHash, writes2 []*kvrwset.KVWriteHash) bool {
-	// Create a map of write key hashes from the first set
-	writeKeyHashes := make(map[string]struct{})
-	for _, w := range writes1 {
-		writeKeyHashes[string(w.KeyHash)] = struct{}{}
-	}
-
-	// Check if any key hash from second set exists in first set
-	for _, w := range writes2 {
-		if _, exists := writeKeyHashes[string(w.KeyHash)]; exists {
-			return true
-		}
-	}
-	return false
-}
-
-// extractRWSet extracts read/write sets from a transaction
-func extractRWSet(tx *peer.Transaction) (map[string]*rwset.NsReadWriteSet, error) {
-	rwSets := make(map[string]*rwset.NsReadWriteSet)
-
-	for _, action := range tx.Actions {
-		chaincodeAction := &peer.ChaincodeAction{}
-		if err := proto.Unmarshal(action.Payload, chaincodeAction); err != nil {
-			return nil, err
-		}
-
-		// Extract read/write set from chaincode action
-		if chaincodeAction.Results == nil {
-			continue
-		}
-
-		txRWSet := &rwset.TxReadWriteSet{}
-		if err := proto.Unmarshal(chaincodeAction.Results, txRWSet); err != nil {
-			return nil, err
-		}
-
-		// Process each namespace's read/write set
-		for _, nsRWSet := range txRWSet.NsRwset {
-			ns := nsRWSet.Namespace
-			if _, exists := rwSets[ns]; !exists {
-				rwSets[ns] = &rwset.NsReadWriteSet{
-					Namespace:             ns,
-					Rwset:                 nsRWSet.Rwset,
-					CollectionHashedRwset: nsRWSet.CollectionHashedRwset,
-				}
-			}
-		}
-	}
-
-	return rwSets, nil
-}
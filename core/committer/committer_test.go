@@ -8,6 +8,7 @@ package committer
 
 import (
 	"fmt"
+	"math/rand"
 	"testing"
 
 	"github.com/golang/protobuf/proto"
@@ -18,7 +19,13 @@ import (
 	"github.com/hyperledger/fabric/common/configtx/test"
 	"github.com/hyperledger/fabric/common/ledger"
 	"github.com/hyperledger/fabric/common/ledger/testutil"
+	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
 	ledger2 "github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/internal/pkg/txflags"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -28,6 +35,7 @@ type mockLedger struct {
 	height       uint64
 	currentHash  []byte
 	previousHash []byte
+	commitOpts   *ledger2.CommitOptions
 	mock.Mock
 }
 
@@ -118,6 +126,7 @@ func (m *mockLedger) CommitLegacy(blockAndPvtdata *ledger2.BlockAndPvtData, comm
 	m.height += 1
 	m.previousHash = m.currentHash
 	m.currentHash = blockAndPvtdata.Block.Header.DataHash
+	m.commitOpts = commitOpts
 	args := m.Called(blockAndPvtdata)
 	return args.Error(0)
 }
@@ -178,7 +187,7 @@ func TestTransactionDependencyTracking(t *testing.T) {
 	tx3 := createTestTransaction("tx3", "key3", "value3", "tx2")
 
 	// Create a block with these transactions
-	block := createTestBlock([]*pb.Transaction{tx1, tx2, tx3})
+	block := createTestEnvelopeBlock(t, []string{"tx1", "tx2", "tx3"}, []*pb.Transaction{tx1, tx2, tx3})
 
 	// Create test committer
 	lc := createTestLedgerCommitter(t)
@@ -194,16 +203,26 @@ func TestTransactionDependencyTracking(t *testing.T) {
 	height, err := lc.LedgerHeight()
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(2), height)
+	assert.Equal(t, []pb.TxValidationCode{
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_VALID,
+	}, codes(validationFlags(block)))
 }
 
 func TestTransactionValidationWithDependencies(t *testing.T) {
-	// Create test transactions
+	// Create test transactions, whose dependencies are justified by the key
+	// they share
 	tx1 := createTestTransaction("tx1", "key1", "value1", "")
-	tx2 := createTestTransaction("tx2", "key2", "value2", "tx1")
-	tx3 := createTestTransaction("tx3", "key3", "value3", "tx2")
+	tx2 := createTestTransaction("tx2", "key1", "value2", "tx1")
+	tx3 := createTestTransaction("tx3", "key1", "value3", "tx2")
 
-	// Create a block with these transactions
-	block := createTestBlock([]*pb.Transaction{tx1, tx2, tx3})
+	// Create a block with these transactions, whose first transaction the
+	// txvalidator invalidated
+	block := createTestEnvelopeBlock(t, []string{"tx1", "tx2", "tx3"}, []*pb.Transaction{tx1, tx2, tx3})
+	flags := txflags.NewWithValues(3, pb.TxValidationCode_VALID)
+	flags.SetFlag(0, pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE)
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
 
 	// Create test committer
 	lc := createTestLedgerCommitter(t)
@@ -219,16 +238,21 @@ func TestTransactionValidationWithDependencies(t *testing.T) {
 	height, err := lc.LedgerHeight()
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(2), height)
+	assert.Equal(t, []pb.TxValidationCode{
+		pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE,
+		txflags.DependencyInvalid,
+		txflags.DependencyInvalid,
+	}, codes(validationFlags(block)))
 }
 
 func TestTransactionValidationWithConflicts(t *testing.T) {
 	// Create test transactions with conflicting read/write sets
 	tx1 := createTestTransaction("tx1", "key1", "value1", "")
-	tx2 := createTestTransaction("tx2", "key1", "value2", "tx1") // Conflicts with tx1
-	tx3 := createTestTransaction("tx3", "key3", "value3", "tx2")
+	tx2 := createTestTransaction("tx2", "key1", "value2", "tx1") // Conflicts with tx1, which MVCC validates
+	tx3 := createTestTransaction("tx3", "key3", "value3", "tx2") // Shares no key with tx2
 
 	// Create a block with these transactions
-	block := createTestBlock([]*pb.Transaction{tx1, tx2, tx3})
+	block := createTestEnvelopeBlock(t, []string{"tx1", "tx2", "tx3"}, []*pb.Transaction{tx1, tx2, tx3})
 
 	// Create test committer
 	lc := createTestLedgerCommitter(t)
@@ -244,16 +268,47 @@ func TestTransactionValidationWithConflicts(t *testing.T) {
 	height, err := lc.LedgerHeight()
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(2), height)
+	assert.Equal(t, []pb.TxValidationCode{
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_VALID,
+	}, codes(validationFlags(block)))
+}
+
+func TestBlindWritersOfAKey(t *testing.T) {
+	results := func(value string) *rwset.TxReadWriteSet {
+		kvRWSet := &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "key1", Value: []byte(value)}}}
+		return &rwset.TxReadWriteSet{
+			DataModel: rwset.TxReadWriteSet_KV,
+			NsRwset:   []*rwset.NsReadWriteSet{{Namespace: "test-ns", Rwset: protoutil.MarshalOrPanic(kvRWSet)}},
+		}
+	}
+	// tx2 declares its write-write conflict with tx1, which justifies it
+	tx1 := createTestTransactionWithResults("tx1", results("value1"), createTestEndorsements("tx1"))
+	tx2 := createTestTransactionWithResults("tx2", results("value2"), createTestEndorsements("tx2", "tx1"))
+
+	block := createTestEnvelopeBlock(t, []string{"tx1", "tx2"}, []*pb.Transaction{tx1, tx2})
+	dag, err := BuildDAGFromBlock(block)
+	require.NoError(t, err)
+	require.Equal(t, []string{"tx1"}, dag.Nodes["tx2"].DependentTxIDs)
+	require.Empty(t, dag.Mismatches)
+
+	// both writes commit, the last one wins
+	require.Equal(t, []pb.TxValidationCode{
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_VALID,
+	}, codes(commitBlock(t, block)))
 }
 
 func TestCircularDependencyHandling(t *testing.T) {
-	// Create test transactions with circular dependencies
+	// Create test transactions with circular dependencies, which the read/write
+	// sets do not justify
 	tx1 := createTestTransaction("tx1", "key1", "value1", "tx3")
 	tx2 := createTestTransaction("tx2", "key2", "value2", "tx1")
 	tx3 := createTestTransaction("tx3", "key3", "value3", "tx2")
 
 	// Create a block with these transactions
-	block := createTestBlock([]*pb.Transaction{tx1, tx2, tx3})
+	block := createTestEnvelopeBlock(t, []string{"tx1", "tx2", "tx3"}, []*pb.Transaction{tx1, tx2, tx3})
 
 	// Create test committer
 	lc := createTestLedgerCommitter(t)
@@ -269,6 +324,508 @@ func TestCircularDependencyHandling(t *testing.T) {
 	height, err := lc.LedgerHeight()
 	assert.NoError(t, err)
 	assert.Equal(t, uint64(2), height)
+	assert.Equal(t, []pb.TxValidationCode{
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_VALID,
+	}, codes(validationFlags(block)))
+}
+
+func TestBuildDAGFromBlock(t *testing.T) {
+	tx1 := createTestTransaction("tx1", "key1", "value1", "")
+	tx2 := createTestTransaction("tx2", "key1", "value2", "tx1")
+	tx3 := createTestTransaction("tx3", "key1", "value3", "tx2")
+
+	// the dependencies reported by every endorser are combined
+	cap, err := protoutil.UnmarshalChaincodeActionPayload(tx3.Actions[0].Payload)
+	require.NoError(t, err)
+	cap.Action.Endorsements = append(cap.Action.Endorsements, createTestEndorsements("tx3", "tx1", "tx2")...)
+	tx3.Actions[0].Payload = protoutil.MarshalOrPanic(cap)
+
+	// dependencies on transactions of earlier blocks do not hold back a transaction
+	tx4 := createTestTransaction("tx4", "key4", "value4", "")
+	cap, err = protoutil.UnmarshalChaincodeActionPayload(tx4.Actions[0].Payload)
+	require.NoError(t, err)
+	cap.Action.Endorsements = createTestEndorsements("tx4", "tx0", "tx1")
+	tx4.Actions[0].Payload = protoutil.MarshalOrPanic(cap)
+
+	block := createTestEnvelopeBlock(t, []string{"tx1", "tx2", "tx3", "tx4"}, []*pb.Transaction{tx1, tx2, tx3, tx4})
+	dag, err := BuildDAGFromBlock(block)
+	require.NoError(t, err)
+
+	require.Empty(t, dag.Nodes["tx1"].DependentTxIDs)
+	require.Equal(t, []string{"tx1"}, dag.Nodes["tx2"].DependentTxIDs)
+	require.Equal(t, []string{"tx2", "tx1"}, dag.Nodes["tx3"].DependentTxIDs)
+	require.Equal(t, 0, dag.Levels["tx1"])
+	require.Equal(t, 1, dag.Levels["tx2"])
+	require.Equal(t, 2, dag.Levels["tx3"])
+
+	// tx4 shares no key with tx1, so that its dependency on tx1 is left out
+	require.Equal(t, []string{"tx0"}, dag.Nodes["tx4"].DependentTxIDs)
+	require.Equal(t, 0, dag.Levels["tx4"])
+	require.Equal(t, []DependencyMismatch{{TxID: "tx4", Unjustified: []string{"tx1"}}}, dag.Mismatches)
+}
+
+func TestBuildDAGFromRWSets(t *testing.T) {
+	results := func(kvRWSet *kvrwset.KVRWSet, hashedRWSet *kvrwset.HashedRWSet) *rwset.TxReadWriteSet {
+		nsRWSet := &rwset.NsReadWriteSet{Namespace: "test-ns", Rwset: protoutil.MarshalOrPanic(kvRWSet)}
+		if hashedRWSet != nil {
+			nsRWSet.CollectionHashedRwset = []*rwset.CollectionHashedReadWriteSet{{
+				CollectionName: "coll",
+				HashedRwset:    protoutil.MarshalOrPanic(hashedRWSet),
+			}}
+		}
+		return &rwset.TxReadWriteSet{DataModel: rwset.TxReadWriteSet_KV, NsRwset: []*rwset.NsReadWriteSet{nsRWSet}}
+	}
+	undeclared := []*pb.Endorsement{{Endorser: []byte("endorser")}}
+
+	txIDs := []string{"tx1", "tx2", "tx3", "tx4", "tx5", "tx6", "tx7", "tx8"}
+	txs := []*pb.Transaction{
+		createTestTransactionWithResults("tx1", results(&kvrwset.KVRWSet{
+			Writes: []*kvrwset.KVWrite{{Key: "key1"}},
+		}, nil), undeclared),
+		createTestTransactionWithResults("tx2", results(&kvrwset.KVRWSet{
+			Reads: []*kvrwset.KVRead{{Key: "key1"}},
+		}, nil), undeclared),
+		createTestTransactionWithResults("tx3", results(&kvrwset.KVRWSet{
+			MetadataWrites: []*kvrwset.KVMetadataWrite{{Key: "key1"}},
+		}, nil), undeclared),
+		createTestTransactionWithResults("tx4", results(&kvrwset.KVRWSet{
+			RangeQueriesInfo: []*kvrwset.RangeQueryInfo{{StartKey: "key0", EndKey: "key1"}},
+		}, nil), undeclared),
+		createTestTransactionWithResults("tx5", results(&kvrwset.KVRWSet{}, &kvrwset.HashedRWSet{
+			HashedWrites: []*kvrwset.KVWriteHash{{KeyHash: []byte("hash1")}},
+		}), undeclared),
+		createTestTransactionWithResults("tx6", results(&kvrwset.KVRWSet{}, &kvrwset.HashedRWSet{
+			HashedReads: []*kvrwset.KVReadHash{{KeyHash: []byte("hash1")}},
+		}), undeclared),
+		createTestTransactionWithResults("tx7", results(&kvrwset.KVRWSet{
+			Writes: []*kvrwset.KVWrite{{Key: "key7"}},
+		}, nil), undeclared),
+		// tx8 declares tx7 but reads key1 and writes the key read by tx2
+		createTestTransactionWithResults("tx8", results(&kvrwset.KVRWSet{
+			Reads:  []*kvrwset.KVRead{{Key: "key1"}},
+			Writes: []*kvrwset.KVWrite{{Key: "key1"}},
+		}, nil), createTestEndorsements("tx8", "tx7", "tx2")),
+	}
+
+	dag, err := BuildDAGFromBlock(createTestEnvelopeBlock(t, txIDs, txs))
+	require.NoError(t, err)
+
+	conflicts := map[string][]Conflict{}
+	for txID, node := range dag.Nodes {
+		if len(node.Conflicts) > 0 {
+			conflicts[txID] = node.Conflicts
+		}
+	}
+	require.Equal(t, map[string][]Conflict{
+		"tx2": {{TxID: "tx1", Kind: ReadAfterWrite}},
+		"tx3": {{TxID: "tx1", Kind: WriteAfterWrite}},
+		"tx4": {{TxID: "tx1", Kind: PhantomRead}, {TxID: "tx3", Kind: PhantomRead}},
+		"tx6": {{TxID: "tx5", Kind: ReadAfterWrite}},
+		"tx8": {{TxID: "tx1", Kind: ReadAfterWrite | WriteAfterWrite}, {TxID: "tx3", Kind: ReadAfterWrite | WriteAfterWrite}},
+	}, conflicts)
+	require.Equal(t, "READ_AFTER_WRITE|WRITE_AFTER_WRITE", (ReadAfterWrite | WriteAfterWrite).String())
+
+	require.Equal(t, map[string]int{
+		"tx1": 0, "tx2": 1, "tx3": 1, "tx4": 2, "tx5": 0, "tx6": 1, "tx7": 0, "tx8": 2,
+	}, dag.Levels)
+
+	// the transactions without dependency info are not cross-checked, and
+	// tx2 is justified by the write of the key it reads
+	require.Equal(t, []string{"tx2"}, dag.Nodes["tx8"].DependentTxIDs)
+	require.Equal(t, []DependencyMismatch{{
+		TxID:        "tx8",
+		Undeclared:  []string{"tx1", "tx3"},
+		Unjustified: []string{"tx7"},
+	}}, dag.Mismatches)
+}
+
+func TestBuildDAGFromBlockIgnoresForeignDependencyInfo(t *testing.T) {
+	tx1 := createTestTransaction("tx1", "key1", "value1", "")
+	tx2 := createTestTransaction("tx2", "key1", "value2", "")
+
+	// dependency info issued for another transaction is not trusted
+	cap, err := protoutil.UnmarshalChaincodeActionPayload(tx2.Actions[0].Payload)
+	require.NoError(t, err)
+	cap.Action.Endorsements = createTestEndorsements("tx3", "tx1")
+	tx2.Actions[0].Payload = protoutil.MarshalOrPanic(cap)
+
+	block := createTestEnvelopeBlock(t, []string{"tx1", "tx2"}, []*pb.Transaction{tx1, tx2})
+	dag, err := BuildDAGFromBlock(block)
+	require.NoError(t, err)
+	require.Empty(t, dag.Nodes["tx2"].DependentTxIDs)
+}
+
+func TestForgedDependencies(t *testing.T) {
+	// tx1 forges a dependency on tx2, which reads the key tx1 writes, and on
+	// tx3, which shares no key with it. Were the forward dependency on tx2
+	// kept, tx1 and tx2 would form a cycle that invalidates tx2.
+	tx1 := createTestTransaction("tx1", "key1", "value1", "")
+	cap, err := protoutil.UnmarshalChaincodeActionPayload(tx1.Actions[0].Payload)
+	require.NoError(t, err)
+	cap.Action.Endorsements = createTestEndorsements("tx1", "tx2", "tx3")
+	tx1.Actions[0].Payload = protoutil.MarshalOrPanic(cap)
+	tx2 := createTestTransaction("tx2", "key1", "value2", "")
+	tx3 := createTestTransaction("tx3", "key3", "value3", "")
+	// tx4 forges a dependency on the invalid tx3, which shares no key with it
+	tx4 := createTestTransaction("tx4", "key4", "value4", "tx3")
+
+	txIDs := []string{"tx1", "tx2", "tx3", "tx4"}
+	txs := []*pb.Transaction{tx1, tx2, tx3, tx4}
+	dag, err := BuildDAGFromBlock(createTestEnvelopeBlock(t, txIDs, txs))
+	require.NoError(t, err)
+	require.Empty(t, dag.Nodes["tx1"].DependentTxIDs)
+	require.Empty(t, dag.Nodes["tx4"].DependentTxIDs)
+	require.Equal(t, []DependencyMismatch{
+		{TxID: "tx1", Unjustified: []string{"tx2", "tx3"}},
+		{TxID: "tx2", Undeclared: []string{"tx1"}},
+		{TxID: "tx4", Unjustified: []string{"tx3"}},
+	}, dag.Mismatches)
+
+	block := createTestEnvelopeBlock(t, txIDs, txs)
+	flags := txflags.NewWithValues(len(txs), pb.TxValidationCode_VALID)
+	flags.SetFlag(2, pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE)
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
+	require.Equal(t, []pb.TxValidationCode{
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_VALID,
+		pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE,
+		pb.TxValidationCode_VALID,
+	}, codes(commitBlock(t, block)))
+}
+
+func TestForwardDependencies(t *testing.T) {
+	// tx1 depends on the following tx3, which depends on tx1 through tx2, and
+	// tx4 on itself. The DAGs built from a block only lead to preceding
+	// transactions, so this one is assembled by hand.
+	txIDs := []string{"tx1", "tx2", "tx3", "tx4"}
+	dependencies := []string{"tx3", "tx1", "tx2", "tx4"}
+	var txs []*pb.Transaction
+	dag := NewTransactionDAG()
+	for i, txID := range txIDs {
+		txs = append(txs, createTestTransaction(txID, "key"+txID[2:], "value"+txID[2:], ""))
+		dag.AddTransaction(txID, i, true, dependencies[i])
+	}
+	dag.CalculateLevels()
+
+	// the levels ignore the dependencies on following transactions
+	require.Equal(t, map[string]int{"tx1": 0, "tx2": 1, "tx3": 2, "tx4": 0}, dag.Levels)
+
+	// tx1 depends on a transaction that is not validated before it, and a
+	// transaction depending on itself is not invalidated
+	block := createTestEnvelopeBlock(t, txIDs, txs)
+	require.Equal(t, 3, createTestLedgerCommitter(t).validateWithDAG(block, dag))
+	require.Equal(t, []pb.TxValidationCode{
+		txflags.DependencyInvalid,
+		txflags.DependencyInvalid,
+		txflags.DependencyInvalid,
+		pb.TxValidationCode_VALID,
+	}, codes(validationFlags(block)))
+}
+
+// TestDependencyResolutionIsDeterministic commits random blocks on several
+// peers, each receiving the endorsements of the transactions and the
+// dependencies they declare in another order, and checks that they all
+// commit the same flags and compute the same levels
+func TestDependencyResolutionIsDeterministic(t *testing.T) {
+	const peers = 4
+	for seed := int64(0); seed < 50; seed++ {
+		txs, txvalidatorFlags := randomDependencyTxs(rand.New(rand.NewSource(seed)), 30)
+
+		var committed []pb.TxValidationCode
+		var levels map[string]int
+		for p := 0; p < peers; p++ {
+			block := dependencyBlock(t, rand.New(rand.NewSource(seed*peers+int64(p))), txs, txvalidatorFlags)
+			dag, err := BuildDAGFromBlock(proto.Clone(block).(*common.Block))
+			require.NoError(t, err)
+			peerCodes := codes(commitBlock(t, block))
+			if p == 0 {
+				committed, levels = peerCodes, dag.Levels
+				requireDependenciesResolved(t, dag, txvalidatorFlags, committed)
+				continue
+			}
+			require.Equal(t, committed, peerCodes, "seed %d: peer %d committed other flags", seed, p)
+			require.Equal(t, levels, dag.Levels, "seed %d: peer %d computed other levels", seed, p)
+		}
+	}
+}
+
+// dependencyTx is a transaction of a random dependency block
+type dependencyTx struct {
+	txID    string
+	kvRWSet *kvrwset.KVRWSet
+	// declared are the dependencies declared by each endorsement
+	declared [][]string
+}
+
+// randomDependencyTxs returns random transactions that read and write a few
+// keys and whose endorsements declare random dependencies on the
+// transactions of the block, or of an earlier one, along with the
+// txvalidator flags of their block
+func randomDependencyTxs(rnd *rand.Rand, numTxs int) ([]dependencyTx, txflags.ValidationFlags) {
+	var txs []dependencyTx
+	for i := 1; i <= numTxs; i++ {
+		tx := dependencyTx{txID: fmt.Sprintf("tx%d", i), kvRWSet: &kvrwset.KVRWSet{}}
+		key := fmt.Sprintf("key%d", rnd.Intn(10))
+		if rnd.Intn(2) == 0 {
+			tx.kvRWSet.Reads = append(tx.kvRWSet.Reads, &kvrwset.KVRead{Key: key})
+		}
+		if rnd.Intn(2) == 0 {
+			tx.kvRWSet.Writes = append(tx.kvRWSet.Writes, &kvrwset.KVWrite{Key: key, Value: []byte(tx.txID)})
+		}
+
+		for e := 1 + rnd.Intn(3); e > 0; e-- {
+			var dependentTxIDs []string
+			for n := rnd.Intn(4); n > 0; n-- {
+				// tx0 belongs to an earlier block
+				dependentTxIDs = append(dependentTxIDs, fmt.Sprintf("tx%d", rnd.Intn(numTxs+1)))
+			}
+			tx.declared = append(tx.declared, dependentTxIDs)
+		}
+		txs = append(txs, tx)
+	}
+
+	flags := txflags.NewWithValues(numTxs, pb.TxValidationCode_VALID)
+	for i := range txs {
+		if rnd.Intn(10) == 0 {
+			flags.SetFlag(i, pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE)
+		}
+	}
+	return txs, flags
+}
+
+// dependencyBlock returns the block of the transactions with their
+// txvalidator flags, shuffling the endorsements of every transaction and the
+// dependencies that each endorsement declares
+func dependencyBlock(t *testing.T, rnd *rand.Rand, txs []dependencyTx, txvalidatorFlags txflags.ValidationFlags) *common.Block {
+	var txIDs []string
+	var blockTxs []*pb.Transaction
+	for _, tx := range txs {
+		var endorsements []*pb.Endorsement
+		for e, declared := range tx.declared {
+			dependentTxIDs := append([]string{}, declared...)
+			rnd.Shuffle(len(dependentTxIDs), func(i, j int) {
+				dependentTxIDs[i], dependentTxIDs[j] = dependentTxIDs[j], dependentTxIDs[i]
+			})
+			endorsement := createTestEndorsements(tx.txID, dependentTxIDs...)[0]
+			endorsement.Endorser = []byte(fmt.Sprintf("endorser%d", e))
+			endorsements = append(endorsements, endorsement)
+		}
+		rnd.Shuffle(len(endorsements), func(i, j int) {
+			endorsements[i], endorsements[j] = endorsements[j], endorsements[i]
+		})
+
+		results := &rwset.TxReadWriteSet{
+			DataModel: rwset.TxReadWriteSet_KV,
+			NsRwset:   []*rwset.NsReadWriteSet{{Namespace: "test-ns", Rwset: protoutil.MarshalOrPanic(tx.kvRWSet)}},
+		}
+		txIDs = append(txIDs, tx.txID)
+		blockTxs = append(blockTxs, createTestTransactionWithResults(tx.txID, results, endorsements))
+	}
+
+	block := createTestEnvelopeBlock(t, txIDs, blockTxs)
+	block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = append(txflags.ValidationFlags{}, txvalidatorFlags...)
+	return block
+}
+
+// requireDependenciesResolved checks that the levels order the edges of the
+// DAG, and that the committed codes never let a valid transaction depend on
+// an invalid one
+func requireDependenciesResolved(t *testing.T, dag *TransactionDAG, txvalidatorFlags txflags.ValidationFlags, committed []pb.TxValidationCode) {
+	for txID, node := range dag.Nodes {
+		for _, predTxID := range dag.inBlockPredecessors(txID) {
+			require.Less(t, dag.Levels[predTxID], dag.Levels[txID], "%s is not above %s", txID, predTxID)
+		}
+
+		idx := dag.TxIndices[txID]
+		switch {
+		case txvalidatorFlags.IsInvalid(idx):
+			require.Equal(t, txvalidatorFlags.Flag(idx), committed[idx])
+		case committed[idx] == pb.TxValidationCode_VALID:
+			for _, depTxID := range node.DependentTxIDs {
+				depIdx, inBlock := dag.TxIndices[depTxID]
+				if inBlock && depTxID != txID {
+					require.Equal(t, pb.TxValidationCode_VALID, committed[depIdx], "valid %s depends on invalid %s", txID, depTxID)
+				}
+			}
+		}
+	}
+}
+
+type commitListenerFunc func(blockNumber uint64, outcomes []sharding.TxOutcome)
+
+func (f commitListenerFunc) BlockCommitted(blockNumber uint64, outcomes []sharding.TxOutcome) {
+	f(blockNumber, outcomes)
+}
+
+func TestCommitListeners(t *testing.T) {
+	tx1 := createTestTransaction("tx1", "key1", "value1", "")
+	tx2 := createTestTransaction("tx2", "key2", "value2", "")
+
+	// transactions that were not prepared by a shard are not reported
+	tx3 := createTestTransaction("tx3", "key3", "value3", "")
+	cap, err := protoutil.UnmarshalChaincodeActionPayload(tx3.Actions[0].Payload)
+	require.NoError(t, err)
+	cap.Action.Endorsements = []*pb.Endorsement{{Endorser: []byte("endorser")}}
+	tx3.Actions[0].Payload = protoutil.MarshalOrPanic(cap)
+
+	block := createTestEnvelopeBlock(t, []string{"tx1", "tx2", "tx3"}, []*pb.Transaction{tx1, tx2, tx3})
+	block.Header.Number = 5
+
+	_, l := createLedger("testchannel")
+	l.On("CommitLegacy", mock.Anything).Run(func(args mock.Arguments) {
+		// the ledger has the final say on the validity of a transaction
+		blk := args.Get(0).(*ledger2.BlockAndPvtData).Block
+		flags := txflags.NewWithValues(len(blk.Data.Data), pb.TxValidationCode_VALID)
+		flags.SetFlag(1, pb.TxValidationCode_MVCC_READ_CONFLICT)
+		blk.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
+	}).Return(nil)
+
+	var notified []sharding.TxOutcome
+	listener := commitListenerFunc(func(blockNumber uint64, outcomes []sharding.TxOutcome) {
+		require.Equal(t, uint64(5), blockNumber)
+		notified = outcomes
+	})
+
+	committer := NewLedgerCommitter(l, listener)
+	require.NoError(t, committer.CommitLegacy(&ledger2.BlockAndPvtData{Block: block}, &ledger2.CommitOptions{}))
+	require.Equal(t, []sharding.TxOutcome{
+		{TxID: "tx1", ShardID: "test-ns", Valid: true},
+		{TxID: "tx2", ShardID: "test-ns", Valid: false},
+	}, notified)
+
+	// listeners are not notified of blocks that fail to commit
+	notified = nil
+	l.ExpectedCalls = nil
+	l.On("CommitLegacy", mock.Anything).Return(errors.New("commit failed"))
+	require.EqualError(t, committer.CommitLegacy(&ledger2.BlockAndPvtData{Block: block}, &ledger2.CommitOptions{}), "commit failed")
+	require.Nil(t, notified)
+}
+
+func TestValidateWithDAG(t *testing.T) {
+	tx1 := createTestTransaction("tx1", "key1", "value1", "")
+	tx2 := createTestTransaction("tx2", "key1", "value2", "tx1")
+	tx3 := createTestTransaction("tx3", "key1", "value3", "tx2")
+	tx4 := createTestTransaction("tx4", "key4", "value4", "")
+	tx5 := createTestTransaction("tx5", "key4", "value5", "tx4")
+	tx6 := createTestTransaction("tx6", "key4", "value6", "tx5")
+	tx7 := createTestTransaction("tx7", "key1", "value7", "tx1")
+	// tx8 shares no key with the transaction it declares
+	tx8 := createTestTransaction("tx8", "key8", "value8", "tx7")
+	tx9 := createTestTransaction("tx9", "key9", "value9", "")
+	tx10 := createTestTransaction("tx10", "key9", "value10", "tx9")
+
+	// the chaincode of tx9 failed
+	cap, err := protoutil.UnmarshalChaincodeActionPayload(tx9.Actions[0].Payload)
+	require.NoError(t, err)
+	cap.Action.ProposalResponsePayload = createTestProposalResponsePayload("tx9", protoutil.MarshalOrPanic(&pb.ChaincodeAction{
+		Response: &pb.Response{Status: 500},
+		Results:  createTestRWSet("key9", "value9"),
+	}))
+	tx9.Actions[0].Payload = protoutil.MarshalOrPanic(cap)
+
+	txIDs := []string{"tx1", "tx2", "tx3", "tx4", "tx5", "tx6", "tx7", "tx8", "tx9", "tx10"}
+	txs := []*pb.Transaction{tx1, tx2, tx3, tx4, tx5, tx6, tx7, tx8, tx9, tx10}
+
+	t.Run("merges with the txvalidator flags", func(t *testing.T) {
+		block := createTestEnvelopeBlock(t, txIDs, txs)
+		flags := txflags.NewWithValues(len(txs), pb.TxValidationCode_VALID)
+		flags.SetFlag(1, pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE)
+		flags.SetFlag(3, pb.TxValidationCode_BAD_CREATOR_SIGNATURE)
+		block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
+
+		require.Equal(t, []pb.TxValidationCode{
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE,
+			txflags.DependencyInvalid,
+			pb.TxValidationCode_BAD_CREATOR_SIGNATURE,
+			txflags.DependencyInvalid,
+			txflags.DependencyInvalid,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_BAD_RESPONSE_PAYLOAD,
+			txflags.DependencyInvalid,
+		}, codes(commitBlock(t, block)))
+	})
+
+	t.Run("without txvalidator flags", func(t *testing.T) {
+		block := createTestEnvelopeBlock(t, txIDs, txs)
+
+		// the conflicts with valid dependencies are left to the MVCC validation
+		require.Equal(t, []pb.TxValidationCode{
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_BAD_RESPONSE_PAYLOAD,
+			txflags.DependencyInvalid,
+		}, codes(commitBlock(t, block)))
+	})
+
+	t.Run("records the DAG statistics", func(t *testing.T) {
+		block := createTestEnvelopeBlock(t, txIDs, txs)
+		flags := txflags.NewWithValues(len(txs), pb.TxValidationCode_VALID)
+		flags.SetFlag(1, pb.TxValidationCode_ENDORSEMENT_POLICY_FAILURE)
+		flags.SetFlag(3, pb.TxValidationCode_BAD_CREATOR_SIGNATURE)
+		block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
+
+		_, l := createLedger("testchannel")
+		l.On("CommitLegacy", mock.Anything).Return(nil)
+		commitOpts := &ledger2.CommitOptions{FetchPvtDataFromLedger: true}
+		require.NoError(t, NewLedgerCommitter(l).CommitLegacy(&ledger2.BlockAndPvtData{Block: block}, commitOpts))
+		require.Nil(t, commitOpts.DAGStats)
+
+		stats := l.commitOpts.DAGStats
+		require.NotNil(t, stats)
+		require.True(t, l.commitOpts.FetchPvtDataFromLedger)
+		require.Positive(t, stats.Duration)
+		stats.Duration = 0
+		require.Equal(t, &ledger2.DAGStats{
+			Transactions:      10,
+			LevelWidths:       []int{4, 3, 2, 1},
+			Edges:             10,
+			DependencyInvalid: 4,
+		}, stats)
+	})
+
+	t.Run("duplicate transactions", func(t *testing.T) {
+		// the duplicate of tx1 does not stand for tx1 in the DAG
+		block := createTestEnvelopeBlock(t, []string{"tx1", "tx2", "tx1"}, []*pb.Transaction{tx1, tx2, tx1})
+		flags := txflags.NewWithValues(3, pb.TxValidationCode_VALID)
+		flags.SetFlag(2, pb.TxValidationCode_DUPLICATE_TXID)
+		block.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER] = flags
+
+		require.Equal(t, []pb.TxValidationCode{
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_VALID,
+			pb.TxValidationCode_DUPLICATE_TXID,
+		}, codes(commitBlock(t, block)))
+	})
+}
+
+// commitBlock commits the block and returns the flags it is committed with
+func commitBlock(t *testing.T, block *common.Block) txflags.ValidationFlags {
+	_, l := createLedger("testchannel")
+	var committed txflags.ValidationFlags
+	l.On("CommitLegacy", mock.Anything).Run(func(args mock.Arguments) {
+		blk := args.Get(0).(*ledger2.BlockAndPvtData).Block
+		committed = txflags.ValidationFlags(blk.Metadata.Metadata[common.BlockMetadataIndex_TRANSACTIONS_FILTER])
+	}).Return(nil)
+	require.NoError(t, NewLedgerCommitter(l).CommitLegacy(&ledger2.BlockAndPvtData{Block: block}, &ledger2.CommitOptions{}))
+	return committed
+}
+
+func codes(flags txflags.ValidationFlags) []pb.TxValidationCode {
+	var codes []pb.TxValidationCode
+	for i := range flags {
+		codes = append(codes, flags.Flag(i))
+	}
+	return codes
 }
 
 func TestReadWriteSetConflictDetection(t *testing.T) {
@@ -276,20 +833,15 @@ func TestReadWriteSetConflictDetection(t *testing.T) {
 	tx1 := createTestTransaction("tx1", "key1", "value1", "")
 	tx2 := createTestTransaction("tx2", "key1", "value2", "") // Conflicts with tx1
 
-	// Create test committer
-	lc := createTestLedgerCommitter(t)
-
 	// Check for conflicts
-	hasConflict := lc.checkRWSetConflicts(tx1, tx2)
-	assert.True(t, hasConflict)
+	assert.True(t, sharesWrittenKey(t, tx1, tx2))
 
 	// Create test transactions with non-conflicting read/write sets
 	tx3 := createTestTransaction("tx3", "key3", "value3", "")
 	tx4 := createTestTransaction("tx4", "key4", "value4", "")
 
 	// Check for conflicts
-	hasConflict = lc.checkRWSetConflicts(tx3, tx4)
-	assert.False(t, hasConflict)
+	assert.False(t, sharesWrittenKey(t, tx3, tx4))
 }
 
 func TestPrivateDataConflictDetection(t *testing.T) {
@@ -297,29 +849,50 @@ func TestPrivateDataConflictDetection(t *testing.T) {
 	tx1 := createTestTransactionWithPrivateData("tx1", "key1", "value1", "", "collection1")
 	tx2 := createTestTransactionWithPrivateData("tx2", "key1", "value2", "tx1", "collection1")
 
-	// Create test committer
-	lc := createTestLedgerCommitter(t)
-
 	// Check for conflicts
-	hasConflict := lc.checkRWSetConflicts(tx1, tx2)
-	assert.True(t, hasConflict)
+	assert.True(t, sharesWrittenKey(t, tx1, tx2))
 
 	// Create test transactions with non-conflicting private data
 	tx3 := createTestTransactionWithPrivateData("tx3", "key3", "value3", "", "collection1")
 	tx4 := createTestTransactionWithPrivateData("tx4", "key4", "value4", "", "collection2")
 
 	// Check for conflicts
-	hasConflict = lc.checkRWSetConflicts(tx3, tx4)
-	assert.False(t, hasConflict)
+	assert.False(t, sharesWrittenKey(t, tx3, tx4))
+}
+
+// sharesWrittenKey returns whether one of the transactions writes a key that
+// the other accesses
+func sharesWrittenKey(t *testing.T, tx1, tx2 *pb.Transaction) bool {
+	accesses1, err := accessesOf(tx1)
+	require.NoError(t, err)
+	accesses2, err := accessesOf(tx2)
+	require.NoError(t, err)
+	return accesses1.SharesWrittenKey(accesses2)
 }
 
 // Helper functions for creating test data
+func createTestTransactionWithResults(txID string, results *rwset.TxReadWriteSet, endorsements []*pb.Endorsement) *pb.Transaction {
+	chaincodeAction := &pb.ChaincodeAction{
+		Response: &pb.Response{Status: 200},
+		Results:  protoutil.MarshalOrPanic(results),
+	}
+	return &pb.Transaction{
+		Actions: []*pb.TransactionAction{{
+			Payload: protoutil.MarshalOrPanic(&pb.ChaincodeActionPayload{
+				Action: &pb.ChaincodeEndorsedAction{
+					ProposalResponsePayload: createTestProposalResponsePayload(txID, protoutil.MarshalOrPanic(chaincodeAction)),
+					Endorsements:            endorsements,
+				},
+			}),
+		}},
+	}
+}
+
 func createTestTransaction(txID, key, value, dependentTxID string) *pb.Transaction {
 	// Create chaincode action
 	chaincodeAction := &pb.ChaincodeAction{
 		Response: &pb.Response{
-			Status:  200,
-			Message: fmt.Sprintf("Dependency: %s", dependentTxID),
+			Status: 200,
 		},
 		Results: createTestRWSet(key, value),
 	}
@@ -329,6 +902,7 @@ func createTestTransaction(txID, key, value, dependentTxID string) *pb.Transacti
 	chaincodeActionPayload := &pb.ChaincodeActionPayload{
 		Action: &pb.ChaincodeEndorsedAction{
 			ProposalResponsePayload: createTestProposalResponsePayload(txID, chaincodeActionBytes),
+			Endorsements:            createTestEndorsements(txID, dependentTxID),
 		},
 	}
 	chaincodeActionPayloadBytes, _ := proto.Marshal(chaincodeActionPayload)
@@ -345,6 +919,25 @@ func createTestTransaction(txID, key, value, dependentTxID string) *pb.Transacti
 	return tx
 }
 
+func createTestEndorsements(txID string, dependentTxIDs ...string) []*pb.Endorsement {
+	endorsement := &pb.Endorsement{Endorser: []byte("endorser")}
+	info := &protos.DependencyInfo{
+		Version: sharding.DependencyInfoVersion,
+		ShardId: "test-ns",
+		TxId:    txID,
+	}
+	for _, dependentTxID := range dependentTxIDs {
+		if dependentTxID != "" {
+			info.HasDependency = true
+			info.DependentTxIds = append(info.DependentTxIds, dependentTxID)
+		}
+	}
+	if err := sharding.AttachDependencyInfo(endorsement, info); err != nil {
+		panic(err)
+	}
+	return []*pb.Endorsement{endorsement}
+}
+
 func createTestProposalResponsePayload(txID string, chaincodeActionBytes []byte) []byte {
 	proposalResponsePayload := &pb.ProposalResponsePayload{
 		ProposalHash: []byte(txID),
@@ -407,12 +1000,35 @@ func createTestBlock(txs []*pb.Transaction) *common.Block {
 	return block
 }
 
+func createTestEnvelopeBlock(t *testing.T, txIDs []string, txs []*pb.Transaction) *common.Block {
+	block := createTestBlock(txs)
+	for i, tx := range txs {
+		txBytes, err := proto.Marshal(tx)
+		require.NoError(t, err)
+		chdr, err := proto.Marshal(&common.ChannelHeader{
+			Type: int32(common.HeaderType_ENDORSER_TRANSACTION),
+			TxId: txIDs[i],
+		})
+		require.NoError(t, err)
+		payload, err := proto.Marshal(&common.Payload{
+			Header: &common.Header{ChannelHeader: chdr},
+			Data:   txBytes,
+		})
+		require.NoError(t, err)
+		env, err := proto.Marshal(&common.Envelope{Payload: payload})
+		require.NoError(t, err)
+		block.Data.Data[i] = env
+	}
+	return block
+}
+
 func createTestLedgerCommitter(t *testing.T) *LedgerCommitter {
 	ledger := &mockLedger{
 		height:       1,
 		currentHash:  []byte("test-hash"),
 		previousHash: []byte("test-prev-hash"),
 	}
+	ledger.On("CommitLegacy", mock.Anything).Return(nil)
 	return NewLedgerCommitter(ledger)
 }
 
@@ -429,8 +1045,7 @@ func createTestTransactionWithPrivateData(txID, key, value, dependentTxID, colle
 	// Create chaincode action
 	chaincodeAction := &pb.ChaincodeAction{
 		Response: &pb.Response{
-			Status:  200,
-			Message: fmt.Sprintf("Dependency: %s", dependentTxID),
+			Status: 200,
 		},
 		Results: createTestRWSetWithPrivateData(key, value, collection),
 	}
@@ -440,6 +1055,7 @@ func createTestTransactionWithPrivateData(txID, key, value, dependentTxID, colle
 	chaincodeActionPayload := &pb.ChaincodeActionPayload{
 		Action: &pb.ChaincodeEndorsedAction{
 			ProposalResponsePayload: createTestProposalResponsePayload(txID, chaincodeActionBytes),
+			Endorsements:            createTestEndorsements(txID, dependentTxID),
 		},
 	}
 	chaincodeActionPayloadBytes, _ := proto.Marshal(chaincodeActionPayload)
@@ -465,7 +1081,7 @@ func createTestRWSetWithPrivateData(key, value, collection string) []byte {
 				CollectionHashedRwset: []*rwset.CollectionHashedReadWriteSet{
 					{
 						CollectionName: collection,
-						HashedRwset:    createTestKVRWSet(key, value),
+						HashedRwset:    createTestHashedRWSet(key, value),
 					},
 				},
 			},
@@ -474,3 +1090,21 @@ func createTestRWSetWithPrivateData(key, value, collection string) []byte {
 	rwSetBytes, _ := proto.Marshal(rwSet)
 	return rwSetBytes
 }
+
+func createTestHashedRWSet(key, value string) []byte {
+	hashedRWSet := &kvrwset.HashedRWSet{
+		HashedReads: []*kvrwset.KVReadHash{
+			{
+				KeyHash: util.ComputeSHA256([]byte(key)),
+			},
+		},
+		HashedWrites: []*kvrwset.KVWriteHash{
+			{
+				KeyHash:   util.ComputeSHA256([]byte(key)),
+				ValueHash: util.ComputeSHA256([]byte(value)),
+			},
+		},
+	}
+	hashedRWSetBytes, _ := proto.Marshal(hashedRWSet)
+	return hashedRWSetBytes
+}
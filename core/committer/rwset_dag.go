@@ -0,0 +1,160 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package committer
+
+import (
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+)
+
+// ConflictKind is the set of ways in which the read/write set of a
+// transaction conflicts with the one of a preceding transaction of its block
+type ConflictKind = rwsetutil.ConflictKind
+
+// The kinds of conflicts, as derived by rwsetutil for the committer and for
+// the parallel validation of the ledger
+const (
+	ReadAfterWrite  = rwsetutil.ReadAfterWrite
+	WriteAfterWrite = rwsetutil.WriteAfterWrite
+	PhantomRead     = rwsetutil.PhantomRead
+)
+
+// Conflict is an edge of the DAG derived from the read/write sets of the
+// block, from a transaction to a preceding transaction of the block
+type Conflict struct {
+	TxID string
+	Kind ConflictKind
+}
+
+// DependencyMismatch is a transaction whose declared dependencies on the
+// transactions of its block disagree with its read/write set
+type DependencyMismatch struct {
+	TxID string
+	// Undeclared are the preceding transactions of the block that the
+	// transaction conflicts with but does not declare
+	Undeclared []string
+	// Unjustified are the declared transactions of the block that do not
+	// precede the transaction, or that the read/write set of the transaction
+	// shares no written key with. They are left out of the DAG.
+	Unjustified []string
+}
+
+// accessesOf returns the keys accessed by the actions of the transaction
+func accessesOf(tx *peer.Transaction) (*rwsetutil.Accesses, error) {
+	var txRWSets []*rwsetutil.TxRwSet
+	for _, action := range tx.Actions {
+		_, chaincodeAction, err := protoutil.GetPayloads(action)
+		if err != nil {
+			return nil, err
+		}
+		if chaincodeAction.Results == nil {
+			continue
+		}
+
+		txRWSet := &rwsetutil.TxRwSet{}
+		if err := txRWSet.FromProtoBytes(chaincodeAction.Results); err != nil {
+			return nil, errors.WithMessage(err, "failed to unmarshal read/write set")
+		}
+		txRWSets = append(txRWSets, txRWSet)
+	}
+
+	return rwsetutil.AccessesOf(txRWSets...), nil
+}
+
+// conflictsOf returns, for each transaction, the preceding transactions it
+// conflicts with, in the order of the block. The accesses are in the order of
+// the block, and nil for the transactions without a read/write set.
+func conflictsOf(txIDs []string, accesses []*rwsetutil.Accesses) [][]Conflict {
+	conflicts := make([][]Conflict, len(accesses))
+	for i, txConflicts := range rwsetutil.Conflicts(accesses) {
+		for _, conflict := range txConflicts {
+			conflicts[i] = append(conflicts[i], Conflict{TxID: txIDs[conflict.Position], Kind: conflict.Kind})
+		}
+	}
+	return conflicts
+}
+
+// justifiedDependencies cross-checks the dependencies that the endorsers
+// declared for the transaction at the given position of the block against
+// its conflicts, and returns those that the read/write sets justify along
+// with the mismatch, if any. Dependencies on transactions outside of the
+// block are not checked. A dependency on a transaction of the block is
+// justified if that transaction precedes it and they share a written key in
+// either direction, as the shards also report the writes of keys read by a
+// dependency.
+func justifiedDependencies(txID string, position int, declared []string, conflicts []Conflict, accesses []*rwsetutil.Accesses, positions map[string]int) ([]string, *DependencyMismatch) {
+	mismatch := &DependencyMismatch{TxID: txID}
+
+	var justified []string
+	isDeclared := map[string]struct{}{}
+	for _, depTxID := range declared {
+		isDeclared[depTxID] = struct{}{}
+		depPosition, inBlock := positions[depTxID]
+		if !inBlock {
+			justified = append(justified, depTxID)
+			continue
+		}
+		txAccesses, depAccesses := accesses[position], accesses[depPosition]
+		if depPosition >= position || txAccesses == nil || depAccesses == nil || !txAccesses.SharesWrittenKey(depAccesses) {
+			mismatch.Unjustified = append(mismatch.Unjustified, depTxID)
+			continue
+		}
+		justified = append(justified, depTxID)
+	}
+	for _, conflict := range conflicts {
+		if _, ok := isDeclared[conflict.TxID]; !ok {
+			mismatch.Undeclared = append(mismatch.Undeclared, conflict.TxID)
+		}
+	}
+
+	if len(mismatch.Undeclared) == 0 && len(mismatch.Unjustified) == 0 {
+		return justified, nil
+	}
+	return justified, mismatch
+}
+
+// addEdges derives the conflicts of the transactions of the block from their
+// read/write sets and adds them to the DAG, along with the dependencies
+// declared for the transactions that the read/write sets justify. The
+// dependency info is not covered by the signature of the endorsements, so the
+// other declared dependencies are left out of the DAG and the transactions
+// that declare them are recorded as mismatches. Every edge of the DAG thus
+// leads to a preceding transaction of the block. The declared dependencies
+// are in the order of the block, and nil for the transactions without
+// dependency info, which declare nothing.
+func (dag *TransactionDAG) addEdges(txIDs []string, accesses []*rwsetutil.Accesses, declared [][]string) {
+	dag.mutex.Lock()
+	defer dag.mutex.Unlock()
+
+	positions := make(map[string]int, len(txIDs))
+	for i, txID := range txIDs {
+		positions[txID] = i
+	}
+
+	for i, txConflicts := range conflictsOf(txIDs, accesses) {
+		txID := txIDs[i]
+		node := dag.Nodes[txID]
+		node.Conflicts = txConflicts
+
+		if declared[i] == nil {
+			continue
+		}
+		justified, mismatch := justifiedDependencies(txID, i, declared[i], txConflicts, accesses, positions)
+		if mismatch != nil {
+			logger.Warningf("Dependencies declared for tx %s disagree with its read/write set: undeclared %v, unjustified %v",
+				txID, mismatch.Undeclared, mismatch.Unjustified)
+			dag.Mismatches = append(dag.Mismatches, *mismatch)
+		}
+		for _, depTxID := range justified {
+			node.HasDependency = true
+			node.DependentTxIDs = append(node.DependentTxIDs, depTxID)
+			dag.Dependencies[depTxID] = append(dag.Dependencies[depTxID], txID)
+		}
+	}
+}
@@ -1523,6 +1523,12 @@ func (m *mockLedger) GetConfigHistoryRetriever() (ledger.ConfigHistoryRetriever,
 	return args.Get(0).(ledger.ConfigHistoryRetriever), nil
 }
 
+// GetDAGStats returns the DAG statistics of the block
+func (m *mockLedger) GetDAGStats(blockNum uint64) (*ledger.DAGStats, error) {
+	args := m.Called(blockNum)
+	return args.Get(0).(*ledger.DAGStats), args.Error(1)
+}
+
 func (m *mockLedger) CommitPvtDataOfOldBlocks(reconciledPvtdata []*ledger.ReconciledPvtdata, unreconciled ledger.MissingPvtDataInfo) ([]*ledger.PvtdataHashMismatch, error) {
 	return nil, nil
 }
@@ -147,6 +147,10 @@ type EndorserConfig struct {
 	LeaderEndorser string // Address of the leader endorser
 	EndorserID     string // Unique ID of this endorser
 	ChannelID      string // Channel ID this endorser belongs to
+	ShardDataDir   string // Directory for shard raft data; empty keeps shards in memory
+	// ShardTopology lists the endorsers that replicate the shards; nil serves
+	// every shard from this endorser alone
+	ShardTopology *sharding.Topology
 }
 
 // Endorser provides the Endorser service ProcessProposal
@@ -181,6 +185,11 @@ type Endorser struct {
 func NewEndorser(channelFetcher ChannelFetcher, localMSP msp.IdentityDeserializer,
 	pvtDataDistributor PrivateDataDistributor, support Support,
 	pvtRWSetAssembler PvtRWSetAssembler, metrics *Metrics, config EndorserConfig) *Endorser {
+	var shardMetrics *sharding.Metrics
+	if metrics != nil {
+		shardMetrics = metrics.Sharding
+	}
+
 	endorser := &Endorser{
 		ChannelFetcher:            channelFetcher,
 		LocalMSP:                  localMSP,
@@ -189,7 +198,7 @@ func NewEndorser(channelFetcher ChannelFetcher, localMSP msp.IdentityDeserialize
 		PvtRWSetAssembler:         pvtRWSetAssembler,
 		Metrics:                   metrics,
 		Config:                    config,
-		ShardManager:              sharding.NewShardManager(nil, metrics),
+		ShardManager:              sharding.NewShardManager(config.ShardDataDir, support, config.ShardTopology, nil, shardMetrics),
 		stopChan:                  make(chan struct{}),
 		VariableMap:               make(map[string]TransactionDependencyInfo),
 		EndorsementExpiryDuration: sharding.DefaultExpiryDuration,
@@ -285,6 +294,13 @@ func (e *Endorser) ProcessProposal(ctx context.Context, signedProp *pb.SignedPro
 	}()
 
 	pResp, err := e.ProcessProposalSuccessfullyOrError(up)
+	if retryAfter, ok := sharding.RetryAfter(err); ok {
+		logger.Warnw("Shard rejected proposal", "channel", up.ChannelHeader.ChannelId, "chaincode", up.ChaincodeName, "retryAfter", retryAfter, "error", err.Error())
+		// The distinct status and its retry hint let clients back off
+		if resp, respErr := sharding.NewOverloadedResponse(err); respErr == nil {
+			return &pb.ProposalResponse{Response: resp}, nil
+		}
+	}
 	if err != nil {
 		logger.Warnw("Failed to invoke chaincode", "channel", up.ChannelHeader.ChannelId, "chaincode", up.ChaincodeName, "error", err.Error())
 		// Return a nil error since clients are expected to look at the ProposalResponse response status code (500) and message.
@@ -361,65 +377,54 @@ func (e *Endorser) ProcessProposalSuccessfullyOrError(up *UnpackedProposal) (*pb
 		return nil, errors.WithMessage(err, "error getting simulation results")
 	}
 
-	dependencies, err := e.extractTransactionDependencies(simResults)
+	reads, writes, err := e.extractTransactionDependencies(simResults)
 	if err != nil {
 		return nil, errors.WithMessage(err, "error extracting transaction dependencies")
 	}
 
 	// ===== SHARDED RAFT-BASED DEPENDENCY RESOLUTION =====
-	
-	// Group dependencies by shard (contract)
-	contractName := up.ChaincodeName
-	shard, err := e.ShardManager.GetOrCreateShard(contractName)
-	if err != nil {
-		return nil, errors.WithMessage(err, "failed to get shard for contract")
-	}
 
-	// Create and send prepare request to shard
+	// Prepare the dependencies on every shard that tracks one of the keys,
+	// including the keys of other namespaces written by chaincode to
+	// chaincode calls
 	prepareReq := &sharding.PrepareRequest{
 		TxID:      up.ChannelHeader.TxId,
-		ShardID:   contractName,
-		ReadSet:   make(map[string][]byte),
-		WriteSet:  make(map[string][]byte),
+		ReadSet:   reads,
+		WriteSet:  writes,
 		Timestamp: time.Now(),
 	}
-
-	for varKey, varValue := range dependencies {
-		prepareReq.WriteSet[varKey] = varValue
+	// system chaincode transactions keep being admitted by overloaded shards
+	if e.Support.IsSysCC(up.ChaincodeName) {
+		prepareReq.Priority = sharding.PrioritySystem
 	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), DefaultPrepareTimeout)
 	defer cancel()
 
-	select {
-	case shard.ProposeC() <- prepareReq:
-		logger.Debugf("Submitted prepare request for tx %s to shard %s", prepareReq.TxID, contractName)
-	case <-ctx.Done():
-		return nil, errors.New("timeout submitting to shard")
+	coordinator := sharding.NewCoordinator(e.ShardManager)
+	bundle, err := coordinator.Prepare(ctx, up.ChaincodeName, prepareReq)
+	if err != nil {
+		return nil, errors.WithMessage(err, "dependency resolution from shard failed")
 	}
-
-	// Wait for proof from shard
-	var proof *sharding.PrepareProof
-	select {
-	case proof = <-shard.CommitC():
+	// the transaction can only be submitted with the endorsement returned
+	// below, so the shards stop tracking it on every other path
+	endorsed := false
+	defer func() {
+		if !endorsed {
+			coordinator.Abort(prepareReq.TxID, bundle.ShardIDs())
+		}
+	}()
+	for _, proof := range bundle.Proofs {
 		logger.Debugf("Received proof for tx %s from shard %s at commit index %d",
 			proof.TxID, proof.ShardID, proof.CommitIndex)
-	case <-ctx.Done():
-		logger.Warnf("Timeout waiting for proof for tx %s, sending abort", prepareReq.TxID)
-		shard.HandleAbort(prepareReq.TxID)
-		return nil, errors.New("timeout waiting for dependency resolution from shard")
 	}
 
-	// Verify the proof
-	if !e.verifyProof(proof) {
-		logger.Errorf("Invalid proof for tx %s from shard %s", proof.TxID, proof.ShardID)
-		shard.HandleAbort(prepareReq.TxID)
-		return nil, errors.New("invalid proof from shard")
+	// Verify the proofs
+	if err := e.verifyProofBundle(up, prepareReq.TxID, bundle); err != nil {
+		logger.Errorf("Invalid proof for tx %s: %s", prepareReq.TxID, err)
+		return nil, errors.WithMessage(err, "invalid proof from shard")
 	}
 
-	hasDependency := proof.CommitIndex > 1
-	dependentTxID := ""
-
 	// Create chaincode event bytes
 	cceventBytes, err := CreateCCEventBytes(ccevent)
 	if err != nil {
@@ -465,10 +470,12 @@ func (e *Endorser) ProcessProposalSuccessfullyOrError(up *UnpackedProposal) (*pb
 		return nil, errors.WithMessage(err, "endorsing with plugin failed")
 	}
 
-	// Include dependency and proof information in response message
-	res.Message = fmt.Sprintf("%s; DependencyInfo:HasDependency=%v,DependentTxID=%s,ShardCommitIndex=%d,ProofTerm=%d",
-		res.Message, hasDependency, dependentTxID, proof.CommitIndex, proof.Term)
+	// Carry the dependency resolution and its proofs alongside the endorsement
+	if err := sharding.AttachDependencyInfo(endorsement, bundle.DependencyInfos()...); err != nil {
+		return nil, errors.WithMessage(err, "failed to attach dependency info")
+	}
 
+	endorsed = true
 	return &pb.ProposalResponse{
 		Version:     1,
 		Endorsement: endorsement,
@@ -478,15 +485,23 @@ func (e *Endorser) ProcessProposalSuccessfullyOrError(up *UnpackedProposal) (*pb
 	}, nil
 }
 
-// verifyProof verifies a prepare proof from the shard
-func (e *Endorser) verifyProof(proof *sharding.PrepareProof) bool {
-	if proof == nil || proof.TxID == "" || proof.ShardID == "" {
-		return false
+// verifyProofBundle checks that the proofs answer the prepare request of the
+// given transaction and are signed by members of the proposal's channel
+func (e *Endorser) verifyProofBundle(up *UnpackedProposal, txID string, bundle *sharding.ProofBundle) error {
+	if bundle == nil || bundle.TxID != txID {
+		return errors.Errorf("proof does not match transaction %s", txID)
+	}
+
+	deserializer := e.LocalMSP
+	if up.ChannelID() != "" {
+		channel := e.ChannelFetcher.Channel(up.ChannelID())
+		if channel == nil {
+			return errors.Errorf("channel '%s' not found", up.ChannelID())
+		}
+		deserializer = channel.IdentityDeserializer
 	}
 
-	// Verify signature (simplified - in production, use actual crypto verification)
-	expectedSig := fmt.Sprintf("%s:%d:%s", proof.ShardID, proof.CommitIndex, proof.TxID)
-	return string(proof.Signature) == expectedSig
+	return sharding.VerifyProofBundle(bundle, deserializer)
 }
 
 // runHealthChecks periodically performs health checks
@@ -12,21 +12,25 @@ import (
 	"testing"
 	"time"
 
-	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/common"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
 	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/common/metrics"
 	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
 	"github.com/hyperledger/fabric/core/chaincode/lifecycle"
 	"github.com/hyperledger/fabric/core/common/ccprovider"
 	"github.com/hyperledger/fabric/core/endorser"
-	"github.com/hyperledger/fabric/core/endorser/mocks"
+	"github.com/hyperledger/fabric/core/endorser/fake"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/protoutil"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 // EndorserRole represents the role of an endorser in the network
@@ -141,42 +145,225 @@ var _ = Describe("Endorser", func() {
 	})
 })
 
-func TestEndorserDependencyTracking(t *testing.T) {
-	t.Run("Dependency Tracking", func(t *testing.T) {
-		// Create mock objects
-		support := &mocks.Support{}
-		chaincodeSupport := &mocks.ChaincodeSupport{}
-		aclProvider := &mocks.ACLProvider{}
-		metrics := endorser.NewMetrics(&metricsfakes.Provider{})
+// newMetricsProvider returns a provider of fake metrics whose labelled
+// metrics are the metrics themselves
+func newMetricsProvider() *metricsfakes.Provider {
+	provider := &metricsfakes.Provider{}
+	provider.NewCounterStub = func(metrics.CounterOpts) metrics.Counter {
+		counter := &metricsfakes.Counter{}
+		counter.WithReturns(counter)
+		return counter
+	}
+	provider.NewGaugeStub = func(metrics.GaugeOpts) metrics.Gauge {
+		gauge := &metricsfakes.Gauge{}
+		gauge.WithReturns(gauge)
+		return gauge
+	}
+	provider.NewHistogramStub = func(metrics.HistogramOpts) metrics.Histogram {
+		histogram := &metricsfakes.Histogram{}
+		histogram.WithReturns(histogram)
+		return histogram
+	}
+	return provider
+}
 
-		// Set up mock expectations
-		chaincodeSupport.On("Channel", "test-channel").Return(&endorser.Channel{
-			IdentityDeserializer: aclProvider,
-		})
+// shardedEndorser is an endorser whose shards run in memory, and whose peer
+// is faked
+type shardedEndorser struct {
+	*endorser.Endorser
+	support     *fake.Support
+	identity    *fake.Identity
+	txSimulator *fake.TxSimulator
+}
 
-		// Create endorser config
-		config := endorser.EndorserConfig{
-			Role:      endorser.NormalEndorser,
-			ChannelID: "test-channel",
-		}
-		e := endorser.NewEndorser(chaincodeSupport, aclProvider, nil, support, nil, metrics, config)
+func newShardedEndorser(t *testing.T, role endorser.EndorserRole) *shardedEndorser {
+	identity := &fake.Identity{}
+	deserializer := &fake.IdentityDeserializer{}
+	deserializer.DeserializeIdentityReturns(identity, nil)
+	channelFetcher := &fake.ChannelFetcher{}
+	channelFetcher.ChannelReturns(&endorser.Channel{IdentityDeserializer: deserializer})
+
+	txSimulator := &fake.TxSimulator{}
+	support := &fake.Support{}
+	support.SerializeReturns([]byte("shard-replica"), nil)
+	support.SignReturns([]byte("proof-signature"), nil)
+	support.GetTxSimulatorReturns(txSimulator, nil)
+	support.GetHistoryQueryExecutorReturns(&fake.HistoryQueryExecutor{}, nil)
+	support.GetTransactionByIDReturns(nil, fmt.Errorf("txid not found"))
+	support.ChaincodeEndorsementInfoReturns(&lifecycle.ChaincodeEndorsementInfo{Version: "1.0", EndorsementPlugin: "escc"}, nil)
+	support.ExecuteReturns(&pb.Response{Status: 200, Payload: []byte("response-payload")}, nil, nil)
+	support.EndorseWithPluginStub = func(_, _ string, prpBytes []byte, _ *pb.SignedProposal) (*pb.Endorsement, []byte, error) {
+		return &pb.Endorsement{Endorser: []byte("endorser"), Signature: []byte("endorsement-signature")}, prpBytes, nil
+	}
 
-		// Create a test proposal
-		proposal := createTestProposal("test-key", "test-value")
-		signedProposal := &pb.SignedProposal{
-			ProposalBytes: proposal,
-		}
+	e := endorser.NewEndorser(channelFetcher, deserializer, nil, support, nil, endorser.NewMetrics(newMetricsProvider()), endorser.EndorserConfig{
+		Role:       role,
+		EndorserID: "test-endorser",
+		ChannelID:  "test-channel",
+	})
+	t.Cleanup(e.Shutdown)
+
+	return &shardedEndorser{
+		Endorser:    e,
+		support:     support,
+		identity:    identity,
+		txSimulator: txSimulator,
+	}
+}
+
+// elect starts the shard of test-chaincode and waits for it to elect its
+// leader, which takes longer than the endorser waits for a prepare
+func (se *shardedEndorser) elect(t *testing.T) {
+	shard, err := se.ShardManager.GetOrCreateShard("test-chaincode")
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return shard.Info().Leader != 0 }, 20*time.Second, 100*time.Millisecond)
+}
 
-		// Process the proposal
-		_, err := e.ProcessProposal(context.Background(), signedProposal)
-		assert.NoError(t, err)
+// propose has the endorser process a proposal of test-chaincode whose
+// simulation writes the key, and returns the ID of its transaction
+func (se *shardedEndorser) propose(t *testing.T, key string) (string, *pb.ProposalResponse) {
+	se.txSimulator.GetTxSimulationResultsReturns(&ledger.TxSimulationResults{
+		PubSimulationResults: &rwset.TxReadWriteSet{
+			NsRwset: []*rwset.NsReadWriteSet{{
+				Namespace: "test-chaincode",
+				Rwset: protoutil.MarshalOrPanic(&kvrwset.KVRWSet{
+					Writes: []*kvrwset.KVWrite{{Key: key, Value: []byte("value")}},
+				}),
+			}},
+		},
+	}, nil)
 
-		// Verify metrics
-		proposalsReceived := metrics.ProposalsReceived.(*metricsfakes.Counter)
-		successfulProposals := metrics.SuccessfulProposals.(*metricsfakes.Counter)
-		assert.Equal(t, 1, proposalsReceived.AddCallCount())
-		assert.Equal(t, 1, successfulProposals.AddCallCount())
+	prop, txID, err := protoutil.CreateChaincodeProposal(common.HeaderType_ENDORSER_TRANSACTION, "test-channel", &pb.ChaincodeInvocationSpec{
+		ChaincodeSpec: &pb.ChaincodeSpec{
+			ChaincodeId: &pb.ChaincodeID{Name: "test-chaincode"},
+			Input:       &pb.ChaincodeInput{Args: [][]byte{[]byte("put"), []byte(key)}},
+		},
+	}, []byte("creator"))
+	require.NoError(t, err)
+
+	resp, err := se.ProcessProposal(context.Background(), &pb.SignedProposal{
+		ProposalBytes: protoutil.MarshalOrPanic(prop),
+		Signature:     []byte("proposal-signature"),
 	})
+	require.NoError(t, err)
+	return txID, resp
+}
+
+// dependencyInfo returns the dependency info attached to the endorsement of
+// the response by the single shard of test-chaincode
+func dependencyInfo(t *testing.T, resp *pb.ProposalResponse) *protos.DependencyInfo {
+	infos, err := sharding.DependencyInfosFromEndorsement(resp.Endorsement)
+	require.NoError(t, err)
+	require.Len(t, infos, 1)
+	return infos[0]
+}
+
+func TestEndorserDependencyTracking(t *testing.T) {
+	se := newShardedEndorser(t, endorser.NormalEndorser)
+	se.elect(t)
+
+	txID1, resp := se.propose(t, "key1")
+	require.Equal(t, int32(200), resp.Response.Status)
+	info := dependencyInfo(t, resp)
+	require.Equal(t, txID1, info.TxId)
+	require.False(t, info.HasDependency)
+
+	// the proof of the shard is checked against the channel's members
+	require.NotZero(t, se.identity.VerifyCallCount())
+	msg, sig := se.identity.VerifyArgsForCall(se.identity.VerifyCallCount() - 1)
+	require.Equal(t, []byte("proof-signature"), sig)
+	signedBytes, err := sharding.ProofFromDependencyInfo(info).SignedBytes()
+	require.NoError(t, err)
+	require.Equal(t, signedBytes, msg)
+
+	// a transaction writing the same key depends on the prepared one
+	txID2, resp := se.propose(t, "key1")
+	require.Equal(t, int32(200), resp.Response.Status)
+	info = dependencyInfo(t, resp)
+	require.Equal(t, txID2, info.TxId)
+	require.True(t, info.HasDependency)
+	require.Equal(t, []string{txID1}, info.DependentTxIds)
+	require.Len(t, info.Dependencies, 1)
+	require.Equal(t, txID1, info.Dependencies[0].TxId)
+	require.Equal(t, protos.DependencyKind_WRITE_WRITE, info.Dependencies[0].Kind)
+
+	// a transaction writing another key does not
+	_, resp = se.propose(t, "key2")
+	require.Equal(t, int32(200), resp.Response.Status)
+	require.False(t, dependencyInfo(t, resp).HasDependency)
+}
+
+func TestEndorserAbortsUnendorsedTransactions(t *testing.T) {
+	tests := []struct {
+		name          string
+		fail          func(se *shardedEndorser)
+		restore       func(se *shardedEndorser)
+		expectedError string
+	}{
+		{
+			name: "invalid proof",
+			fail: func(se *shardedEndorser) {
+				se.identity.VerifyStub = func(_, sig []byte) error {
+					if string(sig) == "proof-signature" {
+						return fmt.Errorf("bad signature")
+					}
+					return nil
+				}
+			},
+			restore:       func(se *shardedEndorser) { se.identity.VerifyReturns(nil) },
+			expectedError: "invalid proof from shard",
+		},
+		{
+			name: "endorsement failure",
+			fail: func(se *shardedEndorser) {
+				se.support.EndorseWithPluginReturns(nil, nil, fmt.Errorf("plugin failed"))
+			},
+			restore: func(se *shardedEndorser) {
+				se.support.EndorseWithPluginStub = func(_, _ string, prpBytes []byte, _ *pb.SignedProposal) (*pb.Endorsement, []byte, error) {
+					return &pb.Endorsement{Endorser: []byte("endorser")}, prpBytes, nil
+				}
+			},
+			expectedError: "endorsing with plugin failed",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			se := newShardedEndorser(t, endorser.NormalEndorser)
+			se.elect(t)
+
+			tt.fail(se)
+			_, resp := se.propose(t, "key1")
+			require.Equal(t, int32(500), resp.Response.Status)
+			require.Contains(t, resp.Response.Message, tt.expectedError)
+			require.Nil(t, resp.Endorsement)
+
+			// the shard stopped tracking the transaction that was never
+			// endorsed, so that the next writer of the key does not depend
+			// on it
+			tt.restore(se)
+			_, resp = se.propose(t, "key1")
+			require.Equal(t, int32(200), resp.Response.Status)
+			require.False(t, dependencyInfo(t, resp).HasDependency)
+		})
+	}
+}
+
+func TestEndorserShardOverloaded(t *testing.T) {
+	se := newShardedEndorser(t, endorser.NormalEndorser)
+	// the shard only admits system chaincode transactions
+	se.ShardManager.SetAdmission(sharding.AdmissionConfig{MaxInFlight: 0, PriorityReserve: 1})
+
+	_, resp := se.propose(t, "key1")
+	require.Equal(t, int32(sharding.StatusTooManyRequests), resp.Response.Status)
+	retryInfo, err := sharding.RetryInfoFromResponse(resp.Response)
+	require.NoError(t, err)
+	require.Positive(t, retryInfo.RetryDelay.AsDuration())
+	require.Nil(t, resp.Endorsement)
+	require.Zero(t, se.support.EndorseWithPluginCallCount())
+
+	successfulProposals := se.Metrics.SuccessfulProposals.(*metricsfakes.Counter)
+	require.Zero(t, successfulProposals.AddCallCount())
 }
 
 func TestEndorserRoles(t *testing.T) {
@@ -210,105 +397,44 @@ func TestEndorserRoles(t *testing.T) {
 }
 
 func TestEndorserMetrics(t *testing.T) {
-	t.Run("Proposal Processing Metrics", func(t *testing.T) {
-		metrics := endorser.NewMetrics(&metricsfakes.Provider{})
-		support := &mockSupport{}
-		config := endorser.EndorserConfig{
-			Role:       endorser.LeaderEndorser,
-			EndorserID: "test-endorser",
-			ChannelID:  "test-channel",
-		}
-		e := endorser.NewEndorser(nil, nil, nil, support, nil, metrics, config)
-
-		// Create and process a test proposal
-		proposal := createTestProposal("test-key", "test-value")
-		signedProposal := &pb.SignedProposal{
-			ProposalBytes: proposal,
-		}
-
-		_, err := e.ProcessProposal(context.Background(), signedProposal)
-		assert.NoError(t, err)
-
-		// Verify metrics
-		proposalsReceived := metrics.ProposalsReceived.(*metricsfakes.Counter)
-		successfulProposals := metrics.SuccessfulProposals.(*metricsfakes.Counter)
-		assert.Equal(t, 1, proposalsReceived.AddCallCount())
-		assert.Equal(t, 1, successfulProposals.AddCallCount())
-	})
-}
-
-func createTestProposal(key, value string) []byte {
-	header := &common.Header{
-		ChannelHeader: protoutil.MarshalOrPanic(&common.ChannelHeader{
-			Type:      int32(common.HeaderType_ENDORSER_TRANSACTION),
-			ChannelId: "test-channel",
-		}),
-	}
-	headerBytes, _ := proto.Marshal(header)
-
-	ccHeader := &pb.ChaincodeHeaderExtension{
-		ChaincodeId: &pb.ChaincodeID{
-			Name: "test-chaincode",
-		},
-	}
-	_ = ccHeader // Use the variable to avoid unused variable error
-
-	proposal := &pb.Proposal{
-		Header: headerBytes,
-		Payload: protoutil.MarshalOrPanic(&pb.ChaincodeProposalPayload{
-			Input: protoutil.MarshalOrPanic(&pb.ChaincodeInvocationSpec{
-				ChaincodeSpec: &pb.ChaincodeSpec{
-					ChaincodeId: &pb.ChaincodeID{
-						Name: "test-chaincode",
-					},
-					Input: &pb.ChaincodeInput{
-						Args: [][]byte{[]byte("invoke"), []byte(key), []byte(value)},
-					},
-				},
-			}),
-		}),
-	}
-
-	proposalBytes, _ := proto.Marshal(proposal)
-	return proposalBytes
-}
-
-func createTestRWSet(key, value string) []byte {
-	rwSet := &kvrwset.KVRWSet{
-		Reads: []*kvrwset.KVRead{
-			{
-				Key: key,
-			},
-		},
-		Writes: []*kvrwset.KVWrite{
-			{
-				Key:   key,
-				Value: []byte(value),
-			},
-		},
-	}
-	rwSetBytes, _ := proto.Marshal(rwSet)
-	return rwSetBytes
+	se := newShardedEndorser(t, endorser.LeaderEndorser)
+	se.elect(t)
+
+	_, resp := se.propose(t, "key1")
+	require.Equal(t, int32(200), resp.Response.Status)
+
+	proposalsReceived := se.Metrics.ProposalsReceived.(*metricsfakes.Counter)
+	successfulProposals := se.Metrics.SuccessfulProposals.(*metricsfakes.Counter)
+	require.Equal(t, 1, proposalsReceived.AddCallCount())
+	require.Equal(t, 1, successfulProposals.AddCallCount())
+
+	proposalDuration := se.Metrics.ProposalDuration.(*metricsfakes.Histogram)
+	require.Equal(t, 1, proposalDuration.ObserveCallCount())
+	require.Equal(t, []string{
+		"channel", "test-channel",
+		"chaincode", "test-chaincode",
+		"success", "true",
+	}, proposalDuration.WithArgsForCall(0))
 }
 
 func TestCircuitBreaker(t *testing.T) {
 	t.Run("Circuit Breaker State Transitions", func(t *testing.T) {
 		// Create proper metrics with fake counters
 		fakeMetrics := &endorser.Metrics{
-			ProposalDuration:              &metricsfakes.Histogram{},
-			ProposalsReceived:             &metricsfakes.Counter{},
-			SuccessfulProposals:           &metricsfakes.Counter{},
-			ProposalValidationFailed:      &metricsfakes.Counter{},
-			ProposalACLCheckFailed:        &metricsfakes.Counter{},
-			InitFailed:                    &metricsfakes.Counter{},
-			EndorsementsFailed:            &metricsfakes.Counter{},
-			DuplicateTxsFailure:           &metricsfakes.Counter{},
-			SimulationFailure:             &metricsfakes.Counter{},
-			LeaderCircuitBreakerOpen:      &metricsfakes.Counter{},
-			LeaderCircuitBreakerClosed:    &metricsfakes.Counter{},
-			LeaderCircuitBreakerHalfOpen:  &metricsfakes.Counter{},
+			ProposalDuration:             &metricsfakes.Histogram{},
+			ProposalsReceived:            &metricsfakes.Counter{},
+			SuccessfulProposals:          &metricsfakes.Counter{},
+			ProposalValidationFailed:     &metricsfakes.Counter{},
+			ProposalACLCheckFailed:       &metricsfakes.Counter{},
+			InitFailed:                   &metricsfakes.Counter{},
+			EndorsementsFailed:           &metricsfakes.Counter{},
+			DuplicateTxsFailure:          &metricsfakes.Counter{},
+			SimulationFailure:            &metricsfakes.Counter{},
+			LeaderCircuitBreakerOpen:     &metricsfakes.Counter{},
+			LeaderCircuitBreakerClosed:   &metricsfakes.Counter{},
+			LeaderCircuitBreakerHalfOpen: &metricsfakes.Counter{},
 		}
-		
+
 		config := endorser.CircuitBreakerConfig{
 			Threshold:     3,
 			Timeout:       100 * time.Millisecond,
@@ -8,6 +8,7 @@ package endorser
 
 import (
 	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
 )
 
 var (
@@ -139,6 +140,9 @@ type Metrics struct {
 	LeaderCircuitBreakerOpen     metrics.Counter
 	LeaderCircuitBreakerHalfOpen metrics.Counter
 	LeaderCircuitBreakerClosed   metrics.Counter
+
+	// Shard metrics
+	Sharding *sharding.Metrics
 }
 
 // NewMetrics creates a new Metrics instance
@@ -163,5 +167,8 @@ func NewMetrics(provider metrics.Provider) *Metrics {
 		LeaderCircuitBreakerOpen:     provider.NewCounter(leaderCircuitBreakerOpenCounterOpts),
 		LeaderCircuitBreakerHalfOpen: provider.NewCounter(leaderCircuitBreakerHalfOpenCounterOpts),
 		LeaderCircuitBreakerClosed:   provider.NewCounter(leaderCircuitBreakerClosedCounterOpts),
+
+		// Shard metrics
+		Sharding: sharding.NewMetrics(provider),
 	}
 }
@@ -10,36 +10,57 @@ import (
 	"testing"
 
 	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
 	. "github.com/onsi/gomega"
 )
 
 func TestNewMetrics(t *testing.T) {
 	gt := NewGomegaWithT(t)
 
-	provider := &metricsfakes.Provider{}
-	provider.NewHistogramReturns(&metricsfakes.Histogram{})
-	provider.NewCounterReturns(&metricsfakes.Counter{})
+	newProvider := func() *metricsfakes.Provider {
+		provider := &metricsfakes.Provider{}
+		provider.NewHistogramReturns(&metricsfakes.Histogram{})
+		provider.NewCounterReturns(&metricsfakes.Counter{})
+		provider.NewGaugeReturns(&metricsfakes.Gauge{})
+		return provider
+	}
+	provider := newProvider()
+	// the shard metrics are created from the same provider
+	shardingProvider := newProvider()
+	shardingMetrics := sharding.NewMetrics(shardingProvider)
 
 	endorserMetrics := NewMetrics(provider)
 	gt.Expect(endorserMetrics).To(Equal(&Metrics{
-		ProposalDuration:         &metricsfakes.Histogram{},
-		ProposalsReceived:        &metricsfakes.Counter{},
-		SuccessfulProposals:      &metricsfakes.Counter{},
-		ProposalValidationFailed: &metricsfakes.Counter{},
-		ProposalACLCheckFailed:   &metricsfakes.Counter{},
-		InitFailed:               &metricsfakes.Counter{},
-		EndorsementsFailed:       &metricsfakes.Counter{},
-		DuplicateTxsFailure:      &metricsfakes.Counter{},
-		SimulationFailure:        &metricsfakes.Counter{},
+		ProposalDuration:             &metricsfakes.Histogram{},
+		ProposalsReceived:            &metricsfakes.Counter{},
+		SuccessfulProposals:          &metricsfakes.Counter{},
+		ProposalValidationFailed:     &metricsfakes.Counter{},
+		ProposalACLCheckFailed:       &metricsfakes.Counter{},
+		InitFailed:                   &metricsfakes.Counter{},
+		EndorsementsFailed:           &metricsfakes.Counter{},
+		DuplicateTxsFailure:          &metricsfakes.Counter{},
+		SimulationFailure:            &metricsfakes.Counter{},
+		TransactionsWithDependencies: &metricsfakes.Counter{},
+		DependencyMapSize:            &metricsfakes.Gauge{},
+		ExpiredDependenciesRemoved:   &metricsfakes.Counter{},
+		LeaderCircuitBreakerOpen:     &metricsfakes.Counter{},
+		LeaderCircuitBreakerHalfOpen: &metricsfakes.Counter{},
+		LeaderCircuitBreakerClosed:   &metricsfakes.Counter{},
+		Sharding:                     shardingMetrics,
 	}))
 
-	gt.Expect(provider.NewHistogramCallCount()).To(Equal(1))
-	gt.Expect(provider.Invocations()["NewHistogram"]).To(ConsistOf([][]interface{}{
+	gt.Expect(provider.NewHistogramCallCount()).To(Equal(1 + shardingProvider.NewHistogramCallCount()))
+	gt.Expect(provider.Invocations()["NewHistogram"]).To(ContainElements([][]interface{}{
 		{proposalDurationHistogramOpts},
 	}))
 
-	gt.Expect(provider.NewCounterCallCount()).To(Equal(8))
-	gt.Expect(provider.Invocations()["NewCounter"]).To(ConsistOf([][]interface{}{
+	gt.Expect(provider.NewGaugeCallCount()).To(Equal(1 + shardingProvider.NewGaugeCallCount()))
+	gt.Expect(provider.Invocations()["NewGauge"]).To(ContainElements([][]interface{}{
+		{dependencyMapSizeGaugeOpts},
+	}))
+
+	gt.Expect(provider.NewCounterCallCount()).To(Equal(13 + shardingProvider.NewCounterCallCount()))
+	gt.Expect(provider.Invocations()["NewCounter"]).To(ContainElements([][]interface{}{
 		{receivedProposalsCounterOpts},
 		{successfulProposalsCounterOpts},
 		{proposalValidationFailureCounterOpts},
@@ -48,5 +69,11 @@ func TestNewMetrics(t *testing.T) {
 		{endorsementFailureCounterOpts},
 		{duplicateTxsFailureCounterOpts},
 		{simulationFailureCounterOpts},
+		{transactionsWithDependenciesCounterOpts},
+		{expiredDependenciesRemovedCounterOpts},
+		{leaderCircuitBreakerOpenCounterOpts},
+		{leaderCircuitBreakerHalfOpenCounterOpts},
+		{leaderCircuitBreakerClosedCounterOpts},
 	}))
+	gt.Expect(provider.Invocations()["NewCounter"]).To(ContainElements(shardingProvider.Invocations()["NewCounter"]))
 }
@@ -0,0 +1,176 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// StatusTooManyRequests is the status of the proposal responses of an
+// endorser whose shards rejected the prepare of the transaction
+const StatusTooManyRequests = http.StatusTooManyRequests
+
+// latencyWeight is the weight of the latest prepare in the moving average of
+// the prepare latency of a shard
+const latencyWeight = 0.2
+
+// DefaultAdmissionConfig is the admission control of the shards of a manager
+// that is not given another one. The prepares it admits fit in the propose
+// channel of the shard, so that admitted prepares never wait to be queued.
+var DefaultAdmissionConfig = AdmissionConfig{
+	MaxInFlight:     900,
+	PriorityReserve: 100,
+}
+
+// AdmissionConfig bounds the prepares a shard handles at once. A prepare is
+// in flight from its admission until its caller gets the proof or gives up.
+type AdmissionConfig struct {
+	// MaxInFlight is the number of prepares in flight above which the
+	// prepares of the normal lane are rejected
+	MaxInFlight int
+	// PriorityReserve is the number of prepares in flight, above
+	// MaxInFlight, reserved to the priority lane
+	PriorityReserve int
+}
+
+// Priority is the admission lane of a prepare request
+type Priority int
+
+const (
+	// PriorityNormal is the lane of the transactions of user chaincodes
+	PriorityNormal Priority = iota
+	// PrioritySystem is the lane of the transactions of system chaincodes,
+	// through which administrators manage the channels and their chaincodes.
+	// Its prepares are admitted within the reserve of the shard and are
+	// batched ahead of the queued prepares of the normal lane.
+	PrioritySystem
+)
+
+func (p Priority) String() string {
+	switch p {
+	case PriorityNormal:
+		return "normal"
+	case PrioritySystem:
+		return "system"
+	default:
+		return fmt.Sprintf("priority(%d)", int(p))
+	}
+}
+
+// OverloadedError is returned when a shard rejects a prepare because it
+// has too many prepares in flight. The prepare can be retried after
+// RetryAfter.
+type OverloadedError struct {
+	ShardID  string
+	Priority Priority
+	// InFlight is the number of prepares in flight that exceeded the limit
+	// of the lane
+	InFlight int
+	// RetryAfter is the time the shard takes to prepare a transaction
+	RetryAfter time.Duration
+}
+
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("shard %s is overloaded with %d prepares in flight, retry after %s", e.ShardID, e.InFlight, e.RetryAfter)
+}
+
+// RetryAfter returns the time after which the prepare that failed with the
+// error may succeed, if the shard rejected it or had no leader
+func RetryAfter(err error) (time.Duration, bool) {
+	var overloaded *OverloadedError
+	if errors.As(err, &overloaded) {
+		return overloaded.RetryAfter, true
+	}
+	var noLeader *NoLeaderError
+	if errors.As(err, &noLeader) {
+		return noLeader.RetryAfter, true
+	}
+	return 0, false
+}
+
+// NewOverloadedResponse returns the response of an endorser whose shard
+// rejected a prepare. Its payload is the google.rpc.RetryInfo hinting when
+// to retry.
+func NewOverloadedResponse(err error) (*pb.Response, error) {
+	retryAfter, _ := RetryAfter(err)
+	payload, marshalErr := proto.Marshal(&errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	if marshalErr != nil {
+		return nil, errors.Wrap(marshalErr, "failed to marshal retry info")
+	}
+	return &pb.Response{
+		Status:  StatusTooManyRequests,
+		Message: err.Error(),
+		Payload: payload,
+	}, nil
+}
+
+// RetryInfoFromResponse returns the retry info of the response of an
+// endorser whose shard rejected a prepare
+func RetryInfoFromResponse(response *pb.Response) (*errdetails.RetryInfo, error) {
+	if response.GetStatus() != StatusTooManyRequests {
+		return nil, errors.Errorf("response status %d is not %d", response.GetStatus(), StatusTooManyRequests)
+	}
+	retryInfo := &errdetails.RetryInfo{}
+	if err := proto.Unmarshal(response.GetPayload(), retryInfo); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal retry info")
+	}
+	return retryInfo, nil
+}
+
+// admit admits a prepare in its lane or returns an OverloadedError. The
+// caller must hold waitersLock and release the admitted prepare once done.
+func (sl *ShardLeader) admit(priority Priority) error {
+	limit := sl.admission.MaxInFlight
+	if priority > PriorityNormal {
+		limit += sl.admission.PriorityReserve
+	}
+	if sl.inFlight >= limit {
+		sl.metrics.PreparesRejected.With("shard", sl.shardID, "priority", priority.String()).Add(1)
+		return &OverloadedError{
+			ShardID:    sl.shardID,
+			Priority:   priority,
+			InFlight:   sl.inFlight,
+			RetryAfter: sl.retryAfter(),
+		}
+	}
+	sl.inFlight++
+	sl.metrics.PreparesInFlight.With("shard", sl.shardID).Set(float64(sl.inFlight))
+	return nil
+}
+
+// release ends an admitted prepare, recording its latency if it got a
+// proof. The caller must hold waitersLock.
+func (sl *ShardLeader) release(latency time.Duration, proved bool) {
+	sl.inFlight--
+	sl.metrics.PreparesInFlight.With("shard", sl.shardID).Set(float64(sl.inFlight))
+	if !proved {
+		return
+	}
+	if sl.prepareLatency == 0 {
+		sl.prepareLatency = latency
+		return
+	}
+	sl.prepareLatency += time.Duration(latencyWeight * float64(latency-sl.prepareLatency))
+}
+
+// retryAfter estimates the time in which a prepare in flight completes, from
+// the moving average of the prepare latency, or from the batch timeout before
+// the first proof. The caller must hold waitersLock.
+func (sl *ShardLeader) retryAfter() time.Duration {
+	if sl.prepareLatency == 0 {
+		return sl.batch.Timeout
+	}
+	return sl.prepareLatency
+}
@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAdmission(t *testing.T) {
+	// with an hour of batch timeout and large batches, the admitted prepares
+	// stay in flight until their callers give up
+	sl, err := NewShardLeader(ShardConfig{
+		ShardID:      "registry",
+		ReplicaNodes: []string{"node1"},
+		ReplicaID:    1,
+		Batch:        BatchConfig{Timeout: time.Hour, MaxSize: 100},
+		Admission:    AdmissionConfig{MaxInFlight: 2, PriorityReserve: 1},
+	}, DefaultBatchTimeout, DefaultBatchMaxSize)
+	require.NoError(t, err)
+	defer sl.Stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 3)
+	prepare := func(txID string, priority Priority) error {
+		_, err := sl.Prepare(ctx, &PrepareRequest{TxID: txID, Timestamp: time.Now(), Priority: priority})
+		return err
+	}
+	inFlight := func() int {
+		sl.waitersLock.Lock()
+		defer sl.waitersLock.Unlock()
+		return sl.inFlight
+	}
+
+	for _, txID := range []string{"tx1", "tx2"} {
+		go func(txID string) { errC <- prepare(txID, PriorityNormal) }(txID)
+	}
+	require.Eventually(t, func() bool { return inFlight() == 2 }, 5*time.Second, 10*time.Millisecond)
+
+	// the normal lane is full
+	err = prepare("tx3", PriorityNormal)
+	var overloaded *OverloadedError
+	require.True(t, errors.As(err, &overloaded))
+	require.Equal(t, &OverloadedError{ShardID: "registry", Priority: PriorityNormal, InFlight: 2, RetryAfter: time.Hour}, overloaded)
+	require.EqualError(t, err, "shard registry is overloaded with 2 prepares in flight, retry after 1h0m0s")
+
+	// the priority lane uses the reserve, and is batched first
+	go func() { errC <- prepare("tx4", PrioritySystem) }()
+	require.Eventually(t, func() bool { return inFlight() == 3 }, 5*time.Second, 10*time.Millisecond)
+	require.Eventually(t, func() bool {
+		sl.batchLock.Lock()
+		defer sl.batchLock.Unlock()
+		return len(sl.batchQueue) == 3 && sl.batchQueue[0].TxID == "tx4"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	err = prepare("tx5", PrioritySystem)
+	require.True(t, errors.As(err, &overloaded))
+	require.Equal(t, PrioritySystem, overloaded.Priority)
+
+	// the prepares whose callers give up are no longer in flight
+	cancel()
+	for i := 0; i < 3; i++ {
+		require.ErrorIs(t, <-errC, context.Canceled)
+	}
+	require.Zero(t, inFlight())
+}
+
+func TestAdmissionRetryAfter(t *testing.T) {
+	sl, err := NewShardLeader(ShardConfig{
+		ShardID:      "registry",
+		ReplicaNodes: []string{"node1"},
+		ReplicaID:    1,
+		Admission:    AdmissionConfig{MaxInFlight: 1},
+	}, DefaultBatchTimeout, DefaultBatchMaxSize)
+	require.NoError(t, err)
+	defer sl.Stop()
+
+	sl.waitersLock.Lock()
+	defer sl.waitersLock.Unlock()
+	require.Equal(t, DefaultBatchTimeout, sl.retryAfter())
+
+	// the hint follows the moving average of the latency of the proved
+	// prepares
+	require.NoError(t, sl.admit(PriorityNormal))
+	sl.release(100*time.Millisecond, true)
+	require.Equal(t, 100*time.Millisecond, sl.retryAfter())
+	require.NoError(t, sl.admit(PriorityNormal))
+	sl.release(600*time.Millisecond, true)
+	require.Equal(t, 200*time.Millisecond, sl.retryAfter())
+	require.NoError(t, sl.admit(PriorityNormal))
+	sl.release(time.Hour, false)
+	require.Equal(t, 200*time.Millisecond, sl.retryAfter())
+
+	// without reserve, the priority lane shares the limit of the normal lane
+	require.NoError(t, sl.admit(PriorityNormal))
+	require.Error(t, sl.admit(PrioritySystem))
+}
+
+func TestOverloadedResponse(t *testing.T) {
+	err := errors.WithMessage(&OverloadedError{ShardID: "registry", InFlight: 900, RetryAfter: 150 * time.Millisecond}, "failed to prepare tx tx1 on shard registry")
+	retryAfter, ok := RetryAfter(err)
+	require.True(t, ok)
+	require.Equal(t, 150*time.Millisecond, retryAfter)
+
+	response, respErr := NewOverloadedResponse(err)
+	require.NoError(t, respErr)
+	require.Equal(t, int32(StatusTooManyRequests), response.Status)
+	require.Equal(t, err.Error(), response.Message)
+	retryInfo, respErr := RetryInfoFromResponse(response)
+	require.NoError(t, respErr)
+	require.Equal(t, 150*time.Millisecond, retryInfo.GetRetryDelay().AsDuration())
+
+	response.Status = 500
+	_, respErr = RetryInfoFromResponse(response)
+	require.EqualError(t, respErr, "response status 500 is not 429")
+
+	retryAfter, ok = RetryAfter(&NoLeaderError{ShardID: "registry", RetryAfter: time.Second, Err: context.DeadlineExceeded})
+	require.True(t, ok)
+	require.Equal(t, time.Second, retryAfter)
+	_, ok = RetryAfter(ErrShardStopped)
+	require.False(t, ok)
+}
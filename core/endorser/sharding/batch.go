@@ -0,0 +1,175 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"strings"
+	"time"
+)
+
+// DefaultBatchMaxBytes caps the size of a batch well below the maximum size
+// of a raft message, leaving room for the encoding of the batch
+const DefaultBatchMaxBytes = 512 * 1024
+
+// DefaultBatchConfig is the batching of the shards of a manager that is not
+// given another one
+var DefaultBatchConfig = BatchConfig{
+	Timeout:  DefaultBatchTimeout,
+	MaxSize:  DefaultBatchMaxSize,
+	MaxBytes: DefaultBatchMaxBytes,
+	Adaptive: true,
+}
+
+// BatchConfig tunes how a shard batches the prepare requests it proposes
+type BatchConfig struct {
+	// Timeout bounds the time a request waits for its batch to be flushed
+	Timeout time.Duration
+	// MaxSize is the number of requests that fill a batch
+	MaxSize int
+	// MaxBytes is the size of the transaction IDs, keys and values of the
+	// requests that fill a batch. A larger request is proposed alone.
+	MaxBytes int
+	// Adaptive flushes a batch as soon as none of the requests flushed by
+	// this replica waits to be applied, rather than when the batch is full
+	// or times out. A lone request is proposed right away, and the requests
+	// that arrive while a batch is in flight are batched together, so that
+	// batches grow with the load.
+	Adaptive bool
+}
+
+// Batching is the batching of the shards of a peer
+type Batching struct {
+	// Default is the batching of the shards without a config of their own
+	Default BatchConfig
+	// Shards are the configs of single shards by shard ID, or of the
+	// partitions of a contract by contract name
+	Shards map[string]BatchConfig
+}
+
+// For returns the batching of the shard
+func (b Batching) For(shardID string) BatchConfig {
+	if config, ok := b.Shards[shardID]; ok {
+		return config
+	}
+	// the shards of a partitioned contract are <contract>.<partition>
+	if i := strings.Index(shardID, "."); i > 0 {
+		if config, ok := b.Shards[shardID[:i]]; ok {
+			return config
+		}
+	}
+	return b.Default
+}
+
+// size approximates the size of the request in a proposal
+func (r *PrepareRequest) size() int {
+	size := len(r.TxID) + len(r.ShardID)
+	for key, value := range r.ReadSet {
+		size += len(key) + len(value)
+	}
+	for key, value := range r.WriteSet {
+		size += len(key) + len(value)
+	}
+	return size
+}
+
+// enqueue adds a request to the batch, behind the queued requests of the same
+// or a higher priority, and returns whether the batch must be flushed
+func (sl *ShardLeader) enqueue(req *PrepareRequest) bool {
+	sl.batchLock.Lock()
+	i := len(sl.batchQueue)
+	for i > 0 && sl.batchQueue[i-1].Priority < req.Priority {
+		i--
+	}
+	sl.batchQueue = append(sl.batchQueue, nil)
+	copy(sl.batchQueue[i+1:], sl.batchQueue[i:])
+	sl.batchQueue[i] = req
+	sl.batchBytes += req.size()
+	full := sl.batchFull()
+	sl.batchLock.Unlock()
+
+	return full || (sl.batch.Adaptive && sl.idle())
+}
+
+// batchFull returns whether the queued requests fill a batch. The caller must
+// hold batchLock.
+func (sl *ShardLeader) batchFull() bool {
+	return len(sl.batchQueue) >= sl.batch.MaxSize || sl.batchBytes >= sl.batch.MaxBytes
+}
+
+// takeBatch removes the next batch from the queue: as many requests as fit
+// in the size limits, and at least one. The caller must hold batchLock.
+func (sl *ShardLeader) takeBatch() []*PrepareRequest {
+	n, size := 0, 0
+	for n < len(sl.batchQueue) && n < sl.batch.MaxSize {
+		reqSize := sl.batchQueue[n].size()
+		if n > 0 && size+reqSize > sl.batch.MaxBytes {
+			break
+		}
+		n, size = n+1, size+reqSize
+	}
+
+	batch := sl.batchQueue[:n:n]
+	sl.batchQueue = append(make([]*PrepareRequest, 0, sl.batch.MaxSize), sl.batchQueue[n:]...)
+	sl.batchBytes -= size
+	return batch
+}
+
+// idle returns whether none of the requests flushed by this replica waits to
+// be applied
+func (sl *ShardLeader) idle() bool {
+	sl.waitersLock.Lock()
+	defer sl.waitersLock.Unlock()
+	return len(sl.flushedAt) == 0
+}
+
+// markFlushed records the time the requests of the batch were flushed
+func (sl *ShardLeader) markFlushed(batch []*PrepareRequest) {
+	sl.waitersLock.Lock()
+	defer sl.waitersLock.Unlock()
+
+	now := time.Now()
+	for _, req := range batch {
+		sl.flushedAt[req.TxID] = now
+	}
+}
+
+// pruneFlushed forgets the requests flushed before maxAge, whose proposal
+// raft dropped or whose forward failed
+func (sl *ShardLeader) pruneFlushed(maxAge time.Duration) {
+	sl.waitersLock.Lock()
+	defer sl.waitersLock.Unlock()
+
+	for txID, flushedAt := range sl.flushedAt {
+		if time.Since(flushedAt) > maxAge {
+			sl.unmarkFlushed(txID)
+		}
+	}
+}
+
+// unmarkFlushed forgets the flush of the request of the transaction, once
+// applied or abandoned, and returns the time it was flushed. An adaptive
+// shard flushes the queued requests when the last flushed one is settled.
+// The caller must hold waitersLock.
+func (sl *ShardLeader) unmarkFlushed(txID string) (time.Time, bool) {
+	flushedAt, ok := sl.flushedAt[txID]
+	if !ok {
+		return time.Time{}, false
+	}
+	delete(sl.flushedAt, txID)
+	if sl.batch.Adaptive && len(sl.flushedAt) == 0 {
+		sl.signalFlush()
+	}
+	return flushedAt, true
+}
+
+// signalFlush asks the batcher to flush the queued requests
+func (sl *ShardLeader) signalFlush() {
+	select {
+	case sl.flushC <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/raft/v3"
+)
+
+func TestBatchingFor(t *testing.T) {
+	batching := Batching{
+		Default: DefaultBatchConfig,
+		Shards: map[string]BatchConfig{
+			"registry":   {Timeout: time.Second, MaxSize: 1, MaxBytes: 1},
+			"registry.1": {Timeout: time.Second, MaxSize: 2, MaxBytes: 2},
+		},
+	}
+	require.Equal(t, DefaultBatchConfig, batching.For("callee"))
+	require.Equal(t, 1, batching.For("registry").MaxSize)
+	require.Equal(t, 1, batching.For("registry.0").MaxSize)
+	require.Equal(t, 2, batching.For("registry.1").MaxSize)
+}
+
+func TestTakeBatch(t *testing.T) {
+	sl, err := NewShardLeader(ShardConfig{
+		ShardID:      "registry",
+		ReplicaNodes: []string{"node1"},
+		ReplicaID:    1,
+		Batch:        BatchConfig{MaxSize: 3, MaxBytes: 100},
+	}, DefaultBatchTimeout, DefaultBatchMaxSize)
+	require.NoError(t, err)
+	// the queue is filled by the test
+	sl.Stop()
+
+	request := func(txID string, valueSize int) *PrepareRequest {
+		return &PrepareRequest{TxID: txID, WriteSet: map[string][]byte{"k": make([]byte, valueSize)}}
+	}
+	// each request takes 4 bytes of transaction ID and key
+	for _, req := range []*PrepareRequest{
+		request("tx1", 26), request("tx2", 26), request("tx3", 56), request("tx4", 196),
+		request("tx5", 0), request("tx6", 0), request("tx7", 0), request("tx8", 0),
+	} {
+		sl.enqueue(req)
+	}
+	require.True(t, sl.batchFull())
+
+	txIDs := func(batch []*PrepareRequest) []string {
+		var txIDs []string
+		for _, req := range batch {
+			txIDs = append(txIDs, req.TxID)
+		}
+		return txIDs
+	}
+	// the third request would exceed the byte limit
+	require.Equal(t, []string{"tx1", "tx2"}, txIDs(sl.takeBatch()))
+	require.Equal(t, []string{"tx3"}, txIDs(sl.takeBatch()))
+	// a request larger than the limit is taken alone
+	require.Equal(t, []string{"tx4"}, txIDs(sl.takeBatch()))
+	require.Equal(t, 16, sl.batchBytes)
+	require.Equal(t, []string{"tx5", "tx6", "tx7"}, txIDs(sl.takeBatch()))
+	require.False(t, sl.batchFull())
+	require.Equal(t, []string{"tx8"}, txIDs(sl.takeBatch()))
+	require.Zero(t, sl.batchBytes)
+}
+
+func TestAdaptiveBatching(t *testing.T) {
+	// with an hour of batch timeout, the requests are only proposed because
+	// the shard is idle
+	sl, err := NewShardLeader(ShardConfig{
+		ShardID:      "registry",
+		ReplicaNodes: []string{"node1"},
+		ReplicaID:    1,
+		Batch:        BatchConfig{Timeout: time.Hour, MaxSize: 100, Adaptive: true},
+	}, DefaultBatchTimeout, DefaultBatchMaxSize)
+	require.NoError(t, err)
+	defer sl.Stop()
+	require.Eventually(t, func() bool { return sl.node.Status().Lead == 1 }, 10*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// a lone request is proposed right away
+	_, err = sl.Prepare(ctx, &PrepareRequest{TxID: "tx0", Timestamp: time.Now()})
+	require.NoError(t, err)
+
+	// concurrent requests are all proposed, in batches formed while the
+	// previous ones are in flight
+	errC := make(chan error, 50)
+	for i := 1; i <= 50; i++ {
+		go func(txID string) {
+			_, err := sl.Prepare(ctx, &PrepareRequest{TxID: txID, Timestamp: time.Now()})
+			errC <- err
+		}(fmt.Sprintf("tx%d", i))
+	}
+	for i := 1; i <= 50; i++ {
+		require.NoError(t, <-errC)
+	}
+	require.True(t, sl.idle())
+}
+
+// stalledNode is the raft node of a leader whose proposals never go through,
+// as when it lost its leadership without noticing yet
+type stalledNode struct {
+	raft.Node
+}
+
+func (n *stalledNode) Status() raft.Status {
+	return raft.Status{BasicStatus: raft.BasicStatus{SoftState: raft.SoftState{Lead: 1}}}
+}
+
+func (n *stalledNode) Propose(ctx context.Context, data []byte) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestFlushBatchRequeuesStalledProposals(t *testing.T) {
+	newShard := func(timeout time.Duration) *ShardLeader {
+		sl := &ShardLeader{
+			shardID:   "registry",
+			replicaID: 1,
+			node:      &stalledNode{},
+			metrics:   NewMetrics(&disabled.Provider{}),
+			batch:     BatchConfig{Timeout: timeout, MaxSize: 10},
+			flushedAt: make(map[string]time.Time),
+			flushC:    make(chan struct{}, 1),
+			stopC:     make(chan struct{}),
+		}
+		sl.enqueue(&PrepareRequest{TxID: "tx1"})
+		return sl
+	}
+
+	t.Run("the proposal expires with the batch timeout", func(t *testing.T) {
+		sl := newShard(50 * time.Millisecond)
+		start := time.Now()
+		sl.flushBatch(true)
+		require.Less(t, time.Since(start), 5*time.Second)
+		require.Len(t, sl.batchQueue, 1)
+		require.Equal(t, "tx1", sl.batchQueue[0].TxID)
+	})
+
+	t.Run("the proposal is cancelled when the shard stops", func(t *testing.T) {
+		sl := newShard(time.Hour)
+		flushed := make(chan struct{})
+		go func() {
+			sl.flushBatch(true)
+			close(flushed)
+		}()
+		close(sl.stopC)
+		select {
+		case <-flushed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the batcher is blocked by the proposal")
+		}
+		require.Len(t, sl.batchQueue, 1)
+	})
+}
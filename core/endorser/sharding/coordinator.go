@@ -0,0 +1,194 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/pkg/errors"
+)
+
+// DefaultAbortTimeout bounds the proposal of an abort to a shard
+const DefaultAbortTimeout = 2 * time.Second
+
+// ProofBundle carries the proof of every shard that prepared a transaction
+type ProofBundle struct {
+	TxID   string
+	Proofs []*PrepareProof
+}
+
+// ShardIDs returns the shards that prepared the transaction
+func (b *ProofBundle) ShardIDs() []string {
+	shardIDs := make([]string, len(b.Proofs))
+	for i, proof := range b.Proofs {
+		shardIDs[i] = proof.ShardID
+	}
+	return shardIDs
+}
+
+// DependentTxIDs returns, without duplicates, the transactions that any shard
+// found the transaction to depend on
+func (b *ProofBundle) DependentTxIDs() []string {
+	var txIDs []string
+	seen := make(map[string]struct{})
+	for _, proof := range b.Proofs {
+		for _, txID := range proof.DependentTxIDs {
+			if _, ok := seen[txID]; ok {
+				continue
+			}
+			seen[txID] = struct{}{}
+			txIDs = append(txIDs, txID)
+		}
+	}
+	return txIDs
+}
+
+// DependencyInfos returns the dependency info of every proof of the bundle
+func (b *ProofBundle) DependencyInfos() []*protos.DependencyInfo {
+	infos := make([]*protos.DependencyInfo, len(b.Proofs))
+	for i, proof := range b.Proofs {
+		infos[i] = NewDependencyInfo(proof)
+	}
+	return infos
+}
+
+// Coordinator prepares a transaction atomically on every shard that tracks
+// one of its keys: either every shard holds the prepare of the transaction,
+// or the transaction is aborted on all of them.
+type Coordinator struct {
+	manager *ShardManager
+}
+
+// NewCoordinator returns a coordinator for the shards of the manager
+func NewCoordinator(manager *ShardManager) *Coordinator {
+	return &Coordinator{manager: manager}
+}
+
+// Prepare splits the keys of the request by namespace and, within each
+// namespace, by the partition that owns them, and prepares the transaction on
+// every shard involved. The keys of the request are prefixed with their
+// namespace. A transaction without keys is prepared on the shard of the empty
+// key of the given namespace so that it still receives a proof. The proofs of
+// the bundle are ordered by shard ID.
+func (c *Coordinator) Prepare(ctx context.Context, namespace string, req *PrepareRequest) (*ProofBundle, error) {
+	reqs := c.splitRequest(namespace, req)
+
+	shardIDs := make([]string, 0, len(reqs))
+	for shardID := range reqs {
+		shardIDs = append(shardIDs, shardID)
+	}
+	sort.Strings(shardIDs)
+
+	proofs := make([]*PrepareProof, len(shardIDs))
+	errs := make([]error, len(shardIDs))
+	var wg sync.WaitGroup
+	for i, shardID := range shardIDs {
+		shard, err := c.manager.GetOrCreateShard(shardID)
+		if err != nil {
+			errs[i] = errors.WithMessagef(err, "failed to get shard %s", shardID)
+			continue
+		}
+		wg.Add(1)
+		go func(i int, shard *ShardLeader, req *PrepareRequest) {
+			defer wg.Done()
+			proofs[i], errs[i] = shard.Prepare(ctx, req)
+		}(i, shard, reqs[shardID])
+	}
+	wg.Wait()
+
+	var prepareErr error
+	var prepared []string
+	for i, shardID := range shardIDs {
+		switch {
+		case errs[i] == nil:
+			prepared = append(prepared, shardID)
+		case errors.Is(errs[i], context.DeadlineExceeded) || errors.Is(errs[i], context.Canceled):
+			// the prepare may still be applied by the shard
+			prepared = append(prepared, shardID)
+			fallthrough
+		default:
+			if prepareErr == nil {
+				prepareErr = errors.WithMessagef(errs[i], "failed to prepare tx %s on shard %s", req.TxID, shardID)
+			}
+		}
+	}
+	if prepareErr != nil {
+		c.Abort(req.TxID, prepared)
+		return nil, prepareErr
+	}
+
+	return &ProofBundle{TxID: req.TxID, Proofs: proofs}, nil
+}
+
+// splitRequest splits the keys of the request by the shard that tracks them
+func (c *Coordinator) splitRequest(namespace string, req *PrepareRequest) map[string]*PrepareRequest {
+	reqs := make(map[string]*PrepareRequest)
+	shardRequest := func(ns, key string) *PrepareRequest {
+		shardID := c.manager.ShardForKey(ns, key)
+		shardReq, ok := reqs[shardID]
+		if !ok {
+			shardReq = &PrepareRequest{
+				TxID:      req.TxID,
+				ShardID:   shardID,
+				ReadSet:   make(map[string][]byte),
+				WriteSet:  make(map[string][]byte),
+				Timestamp: req.Timestamp,
+				Priority:  req.Priority,
+			}
+			reqs[shardID] = shardReq
+		}
+		return shardReq
+	}
+
+	for key, value := range req.ReadSet {
+		ns, nsKey := splitNamespace(namespace, key)
+		shardRequest(ns, nsKey).ReadSet[key] = value
+	}
+	for key, value := range req.WriteSet {
+		ns, nsKey := splitNamespace(namespace, key)
+		shardRequest(ns, nsKey).WriteSet[key] = value
+	}
+	if len(reqs) == 0 {
+		shardRequest(namespace, "")
+	}
+
+	return reqs
+}
+
+// splitNamespace returns the namespace of a tracked key and the key within
+// the namespace. Keys without a namespace belong to the default namespace.
+func splitNamespace(defaultNamespace, key string) (string, string) {
+	i := strings.IndexByte(key, ':')
+	if i < 0 {
+		return defaultNamespace, key
+	}
+	return key[:i], key[i+1:]
+}
+
+// Abort aborts the transaction on the given shards hosted by this peer.
+// Failures are logged and do not stop the abort on the other shards.
+func (c *Coordinator) Abort(txID string, shardIDs []string) {
+	for _, shardID := range shardIDs {
+		c.manager.shardsLock.RLock()
+		shard, exists := c.manager.shards[shardID]
+		c.manager.shardsLock.RUnlock()
+		if !exists {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), DefaultAbortTimeout)
+		if err := shard.Abort(ctx, txID); err != nil {
+			logger.Warnf("Failed to abort tx %s on shard %s: %s", txID, shardID, err)
+		}
+		cancel()
+	}
+}
@@ -0,0 +1,124 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Coordinator", func() {
+	var (
+		manager     *sharding.ShardManager
+		coordinator *sharding.Coordinator
+	)
+
+	newManager := func(configs map[string]sharding.ShardConfig) *sharding.ShardManager {
+		m := sharding.NewShardManager("", nil, nil, configs, nil)
+		p, err := sharding.NewRangePartitioner(map[string][]string{"registry": {"m"}})
+		Expect(err).NotTo(HaveOccurred())
+		m.SetPartitioner(p)
+		return m
+	}
+
+	BeforeEach(func() {
+		manager = newManager(map[string]sharding.ShardConfig{
+			"registry.0": {ShardID: "registry.0", ReplicaNodes: []string{"node1"}, ReplicaID: 1},
+			"registry.1": {ShardID: "registry.1", ReplicaNodes: []string{"node1"}, ReplicaID: 1},
+			"callee":     {ShardID: "callee", ReplicaNodes: []string{"node1"}, ReplicaID: 1},
+		})
+		coordinator = sharding.NewCoordinator(manager)
+	})
+
+	AfterEach(func() {
+		manager.Shutdown()
+	})
+
+	It("prepares a transaction on every partition that owns one of its keys", func() {
+		_, err := coordinator.Prepare(electionContext(), "registry", &sharding.PrepareRequest{
+			TxID:      "tx1",
+			WriteSet:  map[string][]byte{"registry:apple": []byte("1"), "registry:zebra": []byte("1")},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		bundle, err := coordinator.Prepare(electionContext(), "registry", &sharding.PrepareRequest{
+			TxID:      "tx2",
+			ReadSet:   map[string][]byte{"registry:apple": nil, "registry:zebra": nil},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.TxID).To(Equal("tx2"))
+		Expect(bundle.ShardIDs()).To(Equal([]string{"registry.0", "registry.1"}))
+		for _, proof := range bundle.Proofs {
+			Expect(proof.TxID).To(Equal("tx2"))
+			Expect(proof.DependentTxIDs).To(Equal([]string{"tx1"}))
+		}
+		Expect(bundle.DependentTxIDs()).To(Equal([]string{"tx1"}))
+		Expect(bundle.DependencyInfos()).To(HaveLen(2))
+	})
+
+	It("tracks the keys of every namespace in the shards of that namespace", func() {
+		bundle, err := coordinator.Prepare(electionContext(), "registry", &sharding.PrepareRequest{
+			TxID:      "tx1",
+			WriteSet:  map[string][]byte{"registry:apple": []byte("1"), "callee:key1": []byte("1")},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.ShardIDs()).To(Equal([]string{"callee", "registry.0"}))
+
+		bundle, err = coordinator.Prepare(electionContext(), "callee", &sharding.PrepareRequest{
+			TxID:      "tx2",
+			ReadSet:   map[string][]byte{"callee:key1": nil},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.ShardIDs()).To(Equal([]string{"callee"}))
+		Expect(bundle.DependentTxIDs()).To(Equal([]string{"tx1"}))
+	})
+
+	It("prepares a transaction without keys on the shard of its namespace", func() {
+		bundle, err := coordinator.Prepare(electionContext(), "registry", &sharding.PrepareRequest{TxID: "tx1", Timestamp: time.Now()})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.ShardIDs()).To(Equal([]string{"registry.0"}))
+	})
+
+	It("aborts the transaction on every shard when one shard fails", func() {
+		unavailable := newManager(map[string]sharding.ShardConfig{
+			"registry.0": {ShardID: "registry.0", ReplicaNodes: []string{"node1"}, ReplicaID: 1},
+			// a second replica that never answers keeps this shard without a leader
+			"registry.1": {ShardID: "registry.1", ReplicaNodes: []string{"node1", "node2"}, ReplicaID: 1},
+		})
+		defer unavailable.Shutdown()
+		coordinator = sharding.NewCoordinator(unavailable)
+
+		// wait for the leader election of the available shard
+		_, err := coordinator.Prepare(electionContext(), "registry", &sharding.PrepareRequest{TxID: "tx0", Timestamp: time.Now()})
+		Expect(err).NotTo(HaveOccurred())
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = coordinator.Prepare(ctx, "registry", &sharding.PrepareRequest{
+			TxID:      "tx1",
+			WriteSet:  map[string][]byte{"registry:apple": []byte("1"), "registry:zebra": []byte("1")},
+			Timestamp: time.Now(),
+		})
+		Expect(err).To(MatchError(ContainSubstring("failed to prepare tx tx1 on shard registry.1")))
+
+		bundle, err := coordinator.Prepare(electionContext(), "registry", &sharding.PrepareRequest{
+			TxID:      "tx2",
+			ReadSet:   map[string][]byte{"registry:apple": nil},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.DependentTxIDs()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,142 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// DependencyInfoVersion is the version of the DependencyInfo encoding
+// produced by this peer
+const DependencyInfoVersion uint32 = 1
+
+// NewDependencyInfo returns the dependency info described by the proof
+func NewDependencyInfo(proof *PrepareProof) *protos.DependencyInfo {
+	return &protos.DependencyInfo{
+		Version:        DependencyInfoVersion,
+		ShardId:        proof.ShardID,
+		TxId:           proof.TxID,
+		CommitIndex:    proof.CommitIndex,
+		Term:           proof.Term,
+		HasDependency:  proof.HasDependency,
+		DependentTxIds: proof.DependentTxIDs,
+		Dependencies:   dependenciesToProto(proof.Dependencies),
+		Signer:         proof.Signer,
+		Signature:      proof.Signature,
+	}
+}
+
+// ProofFromDependencyInfo returns the prepare proof carried by the dependency
+// info so that it can be checked with VerifyProof
+func ProofFromDependencyInfo(info *protos.DependencyInfo) *PrepareProof {
+	return &PrepareProof{
+		TxID:           info.TxId,
+		ShardID:        info.ShardId,
+		CommitIndex:    info.CommitIndex,
+		Term:           info.Term,
+		HasDependency:  info.HasDependency,
+		DependentTxIDs: info.DependentTxIds,
+		Dependencies:   dependenciesFromProto(info.Dependencies),
+		Signer:         info.Signer,
+		Signature:      info.Signature,
+	}
+}
+
+func dependenciesToProto(dependencies []Dependency) []*protos.Dependency {
+	var pbDependencies []*protos.Dependency
+	for _, dep := range dependencies {
+		pbDependencies = append(pbDependencies, &protos.Dependency{
+			Key:  dep.Key,
+			TxId: dep.TxID,
+			Kind: dep.Kind,
+		})
+	}
+	return pbDependencies
+}
+
+func dependenciesFromProto(pbDependencies []*protos.Dependency) []Dependency {
+	var dependencies []Dependency
+	for _, dep := range pbDependencies {
+		dependencies = append(dependencies, Dependency{
+			Key:  dep.GetKey(),
+			TxID: dep.GetTxId(),
+			Kind: dep.GetKind(),
+		})
+	}
+	return dependencies
+}
+
+// AttachDependencyInfo decorates the endorsement with the dependency info of
+// every shard that prepared the transaction, replacing any dependency info
+// that is already present. The endorsement signature does not cover the
+// decoration, so the committer only uses the dependencies it carries that the
+// read/write sets of the block justify, and derives the others from them.
+func AttachDependencyInfo(endorsement *pb.Endorsement, infos ...*protos.DependencyInfo) error {
+	if endorsement == nil {
+		return errors.New("nil endorsement")
+	}
+
+	decorated, err := decoratedEndorsement(endorsement)
+	if err != nil {
+		return err
+	}
+	decorated.DependencyInfo = infos
+	decoratedBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(decorated)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal dependency info")
+	}
+	if err := proto.Unmarshal(decoratedBytes, protoadapt.MessageV2Of(endorsement)); err != nil {
+		return errors.Wrap(err, "failed to decorate endorsement")
+	}
+
+	return nil
+}
+
+// DependencyInfosFromEndorsement returns the dependency info of every shard
+// carried by the endorsement, in the order they were attached. Dependency
+// info of a version this peer does not know is skipped, so that endorsers
+// can be upgraded one at a time. The dependency info is not covered by the
+// endorsement signature and must not be trusted unless its proof is checked
+// with VerifyProof.
+func DependencyInfosFromEndorsement(endorsement *pb.Endorsement) ([]*protos.DependencyInfo, error) {
+	if endorsement == nil {
+		return nil, nil
+	}
+
+	decorated, err := decoratedEndorsement(endorsement)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed to unmarshal dependency info")
+	}
+
+	var infos []*protos.DependencyInfo
+	for _, info := range decorated.DependencyInfo {
+		if info.Version != DependencyInfoVersion {
+			logger.Debugf("Skipping dependency info of version %d for tx %s", info.Version, info.TxId)
+			continue
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, nil
+}
+
+// decoratedEndorsement decodes the endorsement as a DecoratedEndorsement
+func decoratedEndorsement(endorsement *pb.Endorsement) (*protos.DecoratedEndorsement, error) {
+	endorsementBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(protoadapt.MessageV2Of(endorsement))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal endorsement")
+	}
+	decorated := &protos.DecoratedEndorsement{}
+	if err := proto.Unmarshal(endorsementBytes, decorated); err != nil {
+		return nil, errors.Wrap(err, "failed to unmarshal decorated endorsement")
+	}
+	return decorated, nil
+}
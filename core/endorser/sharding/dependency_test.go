@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"github.com/golang/protobuf/proto"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var _ = Describe("DependencyInfo", func() {
+	var (
+		endorsement *pb.Endorsement
+		proof       *sharding.PrepareProof
+	)
+
+	BeforeEach(func() {
+		endorsement = &pb.Endorsement{Endorser: []byte("endorser"), Signature: []byte("signature")}
+		proof = &sharding.PrepareProof{
+			TxID:           "tx2",
+			ShardID:        "testContract",
+			CommitIndex:    7,
+			Term:           2,
+			HasDependency:  true,
+			DependentTxIDs: []string{"tx1"},
+			Dependencies: []sharding.Dependency{
+				{Key: "key1", TxID: "tx1", Kind: protos.DependencyKind_READ},
+				{Key: "key2", TxID: "tx1", Kind: protos.DependencyKind_WRITE_WRITE},
+			},
+			Signer:    []byte("signer"),
+			Signature: []byte("proof-signature"),
+		}
+	})
+
+	It("survives the endorsement being marshaled into a transaction", func() {
+		Expect(sharding.AttachDependencyInfo(endorsement, sharding.NewDependencyInfo(proof))).To(Succeed())
+
+		action := &pb.ChaincodeEndorsedAction{Endorsements: []*pb.Endorsement{endorsement}}
+		actionBytes, err := proto.Marshal(action)
+		Expect(err).NotTo(HaveOccurred())
+		action = &pb.ChaincodeEndorsedAction{}
+		Expect(proto.Unmarshal(actionBytes, action)).To(Succeed())
+
+		received := action.Endorsements[0]
+		Expect(received.Endorser).To(Equal([]byte("endorser")))
+		Expect(received.Signature).To(Equal([]byte("signature")))
+
+		infos, err := sharding.DependencyInfosFromEndorsement(received)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].Version).To(Equal(sharding.DependencyInfoVersion))
+		Expect(sharding.ProofFromDependencyInfo(infos[0])).To(Equal(proof))
+	})
+
+	It("carries the dependency info of every shard that prepared the transaction", func() {
+		other := *proof
+		other.ShardID = "testContract.1"
+		other.DependentTxIDs = []string{"tx0"}
+		Expect(sharding.AttachDependencyInfo(endorsement, sharding.NewDependencyInfo(proof), sharding.NewDependencyInfo(&other))).To(Succeed())
+
+		infos, err := sharding.DependencyInfosFromEndorsement(endorsement)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(HaveLen(2))
+		Expect(sharding.ProofFromDependencyInfo(infos[0])).To(Equal(proof))
+		Expect(sharding.ProofFromDependencyInfo(infos[1])).To(Equal(&other))
+	})
+
+	It("replaces dependency info that is already attached", func() {
+		Expect(sharding.AttachDependencyInfo(endorsement, sharding.NewDependencyInfo(proof))).To(Succeed())
+		proof.DependentTxIDs = []string{"tx0"}
+		Expect(sharding.AttachDependencyInfo(endorsement, sharding.NewDependencyInfo(proof))).To(Succeed())
+
+		infos, err := sharding.DependencyInfosFromEndorsement(endorsement)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(infos[0].DependentTxIds).To(Equal([]string{"tx0"}))
+
+		fresh := &pb.Endorsement{}
+		Expect(sharding.AttachDependencyInfo(fresh, sharding.NewDependencyInfo(proof))).To(Succeed())
+		Expect(proto.Marshal(endorsement)).To(Equal(protoMarshal(&pb.Endorsement{
+			Endorser:         []byte("endorser"),
+			Signature:        []byte("signature"),
+			XXX_unrecognized: fresh.XXX_unrecognized,
+		})))
+	})
+
+	It("returns nil when the endorsement carries no dependency info", func() {
+		infos, err := sharding.DependencyInfosFromEndorsement(endorsement)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(BeEmpty())
+	})
+
+	It("skips the dependency info of an unknown version", func() {
+		Expect(sharding.AttachDependencyInfo(endorsement, &protos.DependencyInfo{Version: 2}, sharding.NewDependencyInfo(proof))).To(Succeed())
+		infos, err := sharding.DependencyInfosFromEndorsement(endorsement)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(infos).To(HaveLen(1))
+		Expect(sharding.ProofFromDependencyInfo(infos[0])).To(Equal(proof))
+	})
+
+	It("rejects dependency info that cannot be decoded", func() {
+		endorsement.XXX_unrecognized = protowire.AppendBytes(protowire.AppendTag(nil, 1000, protowire.BytesType), []byte{0xff})
+		_, err := sharding.DependencyInfosFromEndorsement(endorsement)
+		Expect(err).To(MatchError(ContainSubstring("failed to unmarshal dependency info")))
+	})
+})
+
+func protoMarshal(m proto.Message) []byte {
+	b, err := proto.Marshal(m)
+	Expect(err).NotTo(HaveOccurred())
+	return b
+}
@@ -19,15 +19,20 @@ func TestExperiment5_ResponseTime(t *testing.T) {
 	// The current RunExperiment implementation prints aggregated stats.
 	// For this specific test, we interpret the output duration as a proxy for efficiency.
 	
-	for _, txCount := range txCounts {
-		config := ExperimentConfig{
-			FaultTolerance: 1,    // Cluster size 3
-			TxCount:        txCount,
-			ClientCount:    32,
-			DependencyRate: 0.40,
-			Duration:       30 * time.Second,
-			LossProbability: 0.0,
+	// Fixed batches wait for the batch timeout, adaptive ones are flushed
+	// as soon as the previous batch is applied.
+	for _, adaptive := range []bool{false, true} {
+		for _, txCount := range txCounts {
+			config := ExperimentConfig{
+				FaultTolerance: 1,    // Cluster size 3
+				TxCount:        txCount,
+				ClientCount:    32,
+				DependencyRate: 0.40,
+				Duration:       30 * time.Second,
+				LossProbability: 0.0,
+				AdaptiveBatching: adaptive,
+			}
+			RunExperiment(t, config)
 		}
-		RunExperiment(t, config)
 	}
 }
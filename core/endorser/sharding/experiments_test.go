@@ -20,6 +20,7 @@ type ExperimentConfig struct {
 	DependencyRate float64       // 0.0 to 1.0 (percentage of txs that conflict)
 	Duration       time.Duration // Max duration
 	LossProbability float64      // Network packet loss probability
+	AdaptiveBatching bool        // Flush batches as soon as the shard is idle
 }
 
 // Network simulates the network between Raft nodes
@@ -93,6 +94,7 @@ func RunExperiment(t *testing.T, config ExperimentConfig) {
 			ShardID:      "experiment-shard",
 			ReplicaNodes: replicaNodes,
 			ReplicaID:    uint64(i + 1),
+			Batch:        sharding.BatchConfig{Adaptive: config.AdaptiveBatching},
 		}
 		
 		node, err := sharding.NewShardLeader(shardConfig, 100*time.Millisecond, 50) 
@@ -214,8 +216,8 @@ Loop:
 
 	throughput := float64(successCount) / elapsed.Seconds()
 	
-	fmt.Printf("Config: f=%d, Txs=%d, Clients=%d, Dep=%.2f -> Throughput: %.2f tx/s, Success: %.2f%%\n",
-		f, config.TxCount, config.ClientCount, config.DependencyRate, throughput, float64(successCount)/float64(config.TxCount)*100)
+	fmt.Printf("Config: f=%d, Txs=%d, Clients=%d, Dep=%.2f, Adaptive=%t -> Throughput: %.2f tx/s, Success: %.2f%%\n",
+		f, config.TxCount, config.ClientCount, config.DependencyRate, config.AdaptiveBatching, throughput, float64(successCount)/float64(config.TxCount)*100)
 
 	// Cleanup
 	for _, node := range nodes {
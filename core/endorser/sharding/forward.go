@@ -0,0 +1,186 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/raft/v3"
+)
+
+// forwardTimeout bounds the time a follower waits for the leader to prepare
+// a forwarded batch
+const forwardTimeout = 10 * time.Second
+
+// errLeaderUnreachable is returned by a forwarder that could not deliver a
+// batch to the leader
+var errLeaderUnreachable = errors.New("leader is unreachable")
+
+// NoLeaderError is returned when a prepare cannot complete because the shard
+// has no leader, typically while the replicas elect one or when a majority of
+// them is unreachable. The prepare can be retried after RetryAfter.
+type NoLeaderError struct {
+	ShardID string
+	// RetryAfter is the time within which a shard whose replicas are
+	// reachable elects a leader
+	RetryAfter time.Duration
+	// Err is the error of the context that ended the prepare
+	Err error
+}
+
+func (e *NoLeaderError) Error() string {
+	return fmt.Sprintf("shard %s has no leader, retry after %s or check that a majority of its replicas is reachable: %s", e.ShardID, e.RetryAfter, e.Err)
+}
+
+func (e *NoLeaderError) Unwrap() error {
+	return e.Err
+}
+
+// prepareResult is the outcome of a prepare handed to its waiting caller
+type prepareResult struct {
+	proof *PrepareProof
+	err   error
+}
+
+// batchForwarder prepares a batch on the leader of the shard and returns the
+// proofs of the leader, in the order of the batch
+type batchForwarder func(ctx context.Context, leaderID uint64, batch []*PrepareRequest) ([]*PrepareProof, error)
+
+// setForwarder sets how the batches of a follower reach the leader. Without
+// forwarder, a follower proposes its batches to raft, which drops them while
+// the follower does not know the leader.
+func (sl *ShardLeader) setForwarder(forwarder batchForwarder) {
+	sl.batchLock.Lock()
+	defer sl.batchLock.Unlock()
+	sl.forwarder = forwarder
+}
+
+// forwardBatch prepares the batch on the leader and hands its proofs to the
+// waiting callers. A batch that does not reach the leader, or that the leader
+// refuses because the leadership changed, is queued again for the next
+// leader. Other failures are returned to the callers.
+func (sl *ShardLeader) forwardBatch(forwarder batchForwarder, leaderID uint64, batch []*PrepareRequest) {
+	ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+	defer cancel()
+
+	sl.waitersLock.Lock()
+	for _, req := range batch {
+		sl.forwarded[req.TxID] = struct{}{}
+	}
+	sl.waitersLock.Unlock()
+	defer func() {
+		sl.waitersLock.Lock()
+		for _, req := range batch {
+			delete(sl.forwarded, req.TxID)
+		}
+		sl.waitersLock.Unlock()
+	}()
+
+	proofs, err := forwarder(ctx, leaderID, batch)
+	if cause := errors.Cause(err); cause == ErrNotLeader || cause == errLeaderUnreachable {
+		logger.Warningf("Failed to forward batch of %d requests of shard %s to leader %d, requeuing it: %v", len(batch), sl.shardID, leaderID, err)
+		sl.requeue(batch)
+		return
+	}
+	if err != nil {
+		logger.Errorf("Leader %d failed to prepare a batch of %d requests of shard %s: %v", leaderID, len(batch), sl.shardID, err)
+		sl.failBatch(batch, err)
+		return
+	}
+
+	for _, proof := range proofs {
+		sl.notifyWaiter(proof.TxID, prepareResult{proof: proof})
+	}
+}
+
+// PrepareBatch prepares a batch of requests forwarded by a follower and
+// returns their proofs in the order of the batch. It fails with ErrNotLeader
+// if this replica does not lead the shard.
+func (sl *ShardLeader) PrepareBatch(ctx context.Context, batch []*PrepareRequest) ([]*PrepareProof, error) {
+	if err := sl.checkLeader(); err != nil {
+		return nil, err
+	}
+
+	proofs := make([]*PrepareProof, len(batch))
+	errs := make([]error, len(batch))
+	var wg sync.WaitGroup
+	for i, req := range batch {
+		wg.Add(1)
+		go func(i int, req *PrepareRequest) {
+			defer wg.Done()
+			proofs[i], errs[i] = sl.Prepare(ctx, req)
+		}(i, req)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return proofs, nil
+}
+
+// requeue puts a batch that was not proposed back in front of the queue. Its
+// requests remain flushed, so that an adaptive shard retries them with the
+// batch timeout rather than right away.
+func (sl *ShardLeader) requeue(batch []*PrepareRequest) {
+	sl.batchLock.Lock()
+	defer sl.batchLock.Unlock()
+	sl.batchQueue = append(append(make([]*PrepareRequest, 0, len(batch)+len(sl.batchQueue)), batch...), sl.batchQueue...)
+	for _, req := range batch {
+		sl.batchBytes += req.size()
+	}
+}
+
+// dequeue drops the request of a transaction that was not proposed yet
+func (sl *ShardLeader) dequeue(txID string) {
+	sl.batchLock.Lock()
+	defer sl.batchLock.Unlock()
+	for i, req := range sl.batchQueue {
+		if req.TxID == txID {
+			sl.batchQueue = append(sl.batchQueue[:i], sl.batchQueue[i+1:]...)
+			sl.batchBytes -= req.size()
+			return
+		}
+	}
+}
+
+// failBatch hands the error to the callers waiting on the batch
+func (sl *ShardLeader) failBatch(batch []*PrepareRequest, err error) {
+	for _, req := range batch {
+		sl.notifyWaiter(req.TxID, prepareResult{err: err})
+	}
+}
+
+// notifyWaiter hands the result to the caller waiting on the transaction, if
+// any. It returns whether a caller was waiting.
+func (sl *ShardLeader) notifyWaiter(txID string, result prepareResult) bool {
+	sl.waitersLock.Lock()
+	defer sl.waitersLock.Unlock()
+
+	waiter, exists := sl.waiters[txID]
+	if exists {
+		delete(sl.waiters, txID)
+		// waiter channels are buffered and receive exactly one result
+		waiter <- result
+	}
+	return exists
+}
+
+// waitError returns the error of a prepare whose context ended, which is a
+// NoLeaderError if the shard has no leader
+func (sl *ShardLeader) waitError(ctx context.Context) error {
+	if sl.node.Status().Lead == raft.None {
+		return &NoLeaderError{ShardID: sl.shardID, RetryAfter: electionTick * tickInterval, Err: ctx.Err()}
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+)
+
+// replicaSigner signs proofs with the name of the replica
+type replicaSigner string
+
+func (s replicaSigner) Sign(msg []byte) ([]byte, error) { return []byte(s), nil }
+func (s replicaSigner) Serialize() ([]byte, error)      { return []byte(s), nil }
+
+var _ = Describe("Forwarding", func() {
+	It("prepares the requests of a follower on the leader", func() {
+		addresses := []string{freeAddress(), freeAddress()}
+		var leaders []*sharding.ShardLeader
+		for id := uint64(1); id <= 2; id++ {
+			leader, err := sharding.NewShardLeader(sharding.ShardConfig{
+				ShardID:      "registry",
+				ReplicaNodes: addresses,
+				ReplicaID:    id,
+				Signer:       replicaSigner(addresses[id-1]),
+			}, 10*time.Millisecond, 20)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(leader.Stop)
+
+			peers := sharding.PeerConfig{1: addresses[0], 2: addresses[1]}
+			delete(peers, id)
+			transport := sharding.NewTransport(id, peers, sharding.TransportConfig{}, nil)
+			transport.AddShard(leader)
+			Expect(transport.Start(addresses[id-1])).To(Succeed())
+			DeferCleanup(transport.Stop)
+			leaders = append(leaders, leader)
+		}
+
+		proof, err := leaders[0].Prepare(electionContext(), &sharding.PrepareRequest{
+			TxID:      "tx1",
+			WriteSet:  map[string][]byte{"registry:key1": []byte("value1")},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		leaderID := proof.LeaderID
+		Expect(leaderID).To(BeElementOf(uint64(1), uint64(2)))
+		follower := leaders[2-leaderID]
+
+		proof, err = follower.Prepare(electionContext(), &sharding.PrepareRequest{
+			TxID:      "tx2",
+			ReadSet:   map[string][]byte{"registry:key1": nil},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proof.DependentTxIDs).To(Equal([]string{"tx1"}))
+		Expect(proof.LeaderID).To(Equal(leaderID))
+		Expect(proof.Signer).To(Equal([]byte(addresses[leaderID-1])))
+	})
+
+	It("tells the caller to retry when the shard has no leader", func() {
+		// a second replica that never answers keeps the shard without a leader
+		leader, err := sharding.NewShardLeader(sharding.ShardConfig{
+			ShardID:      "registry",
+			ReplicaNodes: []string{"node1", "node2"},
+			ReplicaID:    1,
+		}, 10*time.Millisecond, 20)
+		Expect(err).NotTo(HaveOccurred())
+		defer leader.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = leader.Prepare(ctx, &sharding.PrepareRequest{TxID: "tx1", Timestamp: time.Now()})
+		Expect(err).To(MatchError(ContainSubstring("shard registry has no leader, retry after 5s")))
+		Expect(errors.Cause(err)).To(BeAssignableToTypeOf(&sharding.NoLeaderError{}))
+	})
+})
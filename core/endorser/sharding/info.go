@@ -0,0 +1,162 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrShardNotExist is returned when asking about a shard that this peer does
+// not host
+var ErrShardNotExist = errors.New("shard does not exist")
+
+// ShardInfo is the state of a shard as seen by one of its replicas
+type ShardInfo struct {
+	ShardID   string `json:"shardID"`
+	ReplicaID uint64 `json:"replicaID"`
+	// State is the raft state of the replica: StateLeader, StateFollower,
+	// StateCandidate or StatePreCandidate
+	State        string   `json:"state"`
+	Leader       uint64   `json:"leader"`
+	Term         uint64   `json:"term"`
+	Voters       []uint64 `json:"voters"`
+	Learners     []uint64 `json:"learners,omitempty"`
+	CommitIndex  uint64   `json:"commitIndex"`
+	AppliedIndex uint64   `json:"appliedIndex"`
+	// QueueDepth is the number of prepares waiting to be proposed
+	QueueDepth int `json:"queueDepth"`
+	// PendingPrepares is the number of prepares whose callers wait for
+	// their proof
+	PendingPrepares int `json:"pendingPrepares"`
+	// DependencyEntries is the number of keys tracked by the dependency map
+	DependencyEntries int `json:"dependencyEntries"`
+}
+
+// ShardList is the state of the shards hosted by a peer
+type ShardList struct {
+	ReplicaID uint64 `json:"replicaID,omitempty"`
+	// Peers are the addresses of the other replicas, by ID
+	Peers  PeerConfig  `json:"peers,omitempty"`
+	Shards []ShardInfo `json:"shards"`
+}
+
+// DependencyDump is the content of the dependency map of a shard for the
+// keys with a prefix, as of AppliedIndex
+type DependencyDump struct {
+	ShardID      string          `json:"shardID"`
+	AppliedIndex uint64          `json:"appliedIndex"`
+	Entries      []KeyDependency `json:"entries"`
+	// Truncated tells whether more keys than the entries have the prefix
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// Info returns the state of the shard on this replica
+func (sl *ShardLeader) Info() ShardInfo {
+	status := sl.node.Status()
+	membership := sl.Membership()
+	info := ShardInfo{
+		ShardID:     sl.shardID,
+		ReplicaID:   sl.replicaID,
+		State:       status.RaftState.String(),
+		Leader:      status.Lead,
+		Term:        status.Term,
+		Voters:      membership.Voters,
+		Learners:    membership.Learners,
+		CommitIndex: status.Commit,
+	}
+
+	sl.mu.RLock()
+	info.AppliedIndex = sl.appliedIndex
+	sl.mu.RUnlock()
+
+	sl.batchLock.Lock()
+	info.QueueDepth = len(sl.batchQueue)
+	sl.batchLock.Unlock()
+
+	sl.waitersLock.Lock()
+	info.PendingPrepares = len(sl.waiters)
+	sl.waitersLock.Unlock()
+
+	sl.variableMapLock.RLock()
+	info.DependencyEntries = len(sl.variableMap)
+	sl.variableMapLock.RUnlock()
+
+	return info
+}
+
+// DumpDependencies returns at most limit entries of the dependency map of
+// this replica whose keys start with prefix, sorted by key. Unlike
+// QueryDependencies, the dump is not linearizable: a follower may lag behind
+// the leader. A limit of zero returns every entry.
+func (sl *ShardLeader) DumpDependencies(prefix string, limit int) DependencyDump {
+	sl.mu.RLock()
+	dump := DependencyDump{ShardID: sl.shardID, AppliedIndex: sl.appliedIndex, Entries: []KeyDependency{}}
+	sl.mu.RUnlock()
+
+	sl.variableMapLock.RLock()
+	defer sl.variableMapLock.RUnlock()
+
+	var keys []string
+	for key := range sl.variableMap {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys, dump.Truncated = keys[:limit], true
+	}
+
+	for _, key := range keys {
+		depInfo := sl.variableMap[key]
+		dump.Entries = append(dump.Entries, KeyDependency{
+			Key:         key,
+			OwnerTxID:   depInfo.DependentTxID,
+			ReaderTxIDs: append([]string(nil), depInfo.ReaderTxIDs...),
+		})
+	}
+	return dump
+}
+
+// Shard returns the shard hosted by this peer, without creating it
+func (sm *ShardManager) Shard(shardID string) (*ShardLeader, error) {
+	sm.shardsLock.RLock()
+	defer sm.shardsLock.RUnlock()
+
+	shard, exists := sm.shards[shardID]
+	if !exists {
+		return nil, errors.WithMessagef(ErrShardNotExist, "shard %s", shardID)
+	}
+	return shard, nil
+}
+
+// ShardList returns the state of the shards hosted by this peer, sorted by
+// shard ID
+func (sm *ShardManager) ShardList() ShardList {
+	sm.shardsLock.RLock()
+	shards := make([]*ShardLeader, 0, len(sm.shards))
+	for _, shard := range sm.shards {
+		shards = append(shards, shard)
+	}
+	sm.shardsLock.RUnlock()
+
+	list := ShardList{Shards: make([]ShardInfo, 0, len(shards))}
+	if sm.topology != nil {
+		list.ReplicaID = sm.topology.ReplicaID
+	}
+	if sm.transport != nil {
+		list.Peers = sm.transport.Peers()
+	}
+	for _, shard := range shards {
+		list.Shards = append(list.Shards, shard.Info())
+	}
+	sort.Slice(list.Shards, func(i, j int) bool { return list.Shards[i].ShardID < list.Shards[j].ShardID })
+	return list
+}
@@ -0,0 +1,182 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+func TestLogEntryLegacyBatch(t *testing.T) {
+	batch := &PrepareRequestBatch{Requests: []*PrepareRequestProto{{TxID: "tx1"}}}
+	data, err := batch.Marshal()
+	require.NoError(t, err)
+
+	entry := &LogEntry{}
+	require.NoError(t, entry.Unmarshal(data))
+	require.Equal(t, EntryTypePrepareBatch, entry.Type)
+	require.Equal(t, batch, entry.Batch)
+}
+
+func TestApplyAbort(t *testing.T) {
+	counter := &metricsfakes.Counter{}
+	counter.WithReturns(counter)
+	metrics := NewMetrics(&disabled.Provider{})
+	metrics.AbortsApplied = counter
+
+	sl, err := NewShardLeader(ShardConfig{
+		ShardID:      "abort",
+		ReplicaNodes: []string{"node1"},
+		ReplicaID:    1,
+		Metrics:      metrics,
+	}, DefaultBatchTimeout, DefaultBatchMaxSize)
+	require.NoError(t, err)
+	// entries are applied directly by the test
+	sl.Stop()
+
+	apply := func(index uint64, entry *LogEntry) {
+		data, err := entry.Marshal()
+		require.NoError(t, err)
+		sl.applyEntry(raftpb.Entry{Index: index, Term: 1, Data: data})
+	}
+	prepare := func(index uint64, txID string, reads, writes []string) {
+		req := &PrepareRequestProto{TxID: txID, ReadSet: map[string][]byte{}, WriteSet: map[string][]byte{}}
+		for _, key := range reads {
+			req.ReadSet[key] = nil
+		}
+		for _, key := range writes {
+			req.WriteSet[key] = []byte(txID)
+		}
+		apply(index, &LogEntry{Type: EntryTypePrepareBatch, Batch: &PrepareRequestBatch{Requests: []*PrepareRequestProto{req}}})
+	}
+
+	prepare(1, "tx1", nil, []string{"a", "b"})
+	prepare(2, "tx2", []string{"a"}, []string{"b", "c"})
+	prepare(3, "tx3", []string{"b"}, nil)
+	prepare(4, "tx4", nil, []string{"b"})
+
+	apply(5, &LogEntry{Type: EntryTypeAbort, Abort: &AbortEntry{TxID: "tx2"}})
+
+	// tx2 is gone from the history of b, its own key c and the readers of a
+	require.Equal(t, "tx1", sl.variableMap["a"].DependentTxID)
+	require.Empty(t, sl.variableMap["a"].ReaderTxIDs)
+	require.Equal(t, "tx4", sl.variableMap["b"].DependentTxID)
+	require.Equal(t, "tx1", sl.variableMap["b"].Previous.DependentTxID)
+	require.Nil(t, sl.variableMap["b"].Previous.Previous)
+	require.NotContains(t, sl.variableMap, "c")
+
+	apply(6, &LogEntry{Type: EntryTypeAbort, Abort: &AbortEntry{TxID: "tx4"}})
+
+	// tx3 read the value written by tx2 and still conflicts with later writers
+	require.Equal(t, "tx1", sl.variableMap["b"].DependentTxID)
+	require.Equal(t, []string{"tx3"}, sl.variableMap["b"].ReaderTxIDs)
+
+	require.Equal(t, 2, counter.AddCallCount())
+	require.Equal(t, []string{"shard", "abort"}, counter.WithArgsForCall(0))
+
+	prepare(7, "tx5", nil, []string{"a"})
+	prepare(8, "tx6", []string{"a"}, []string{"b"})
+	require.Equal(t, "tx1", sl.variableMap["a"].Previous.DependentTxID)
+	require.Equal(t, "tx1", sl.variableMap["b"].Previous.DependentTxID)
+
+	apply(9, &LogEntry{Type: EntryTypeCommitNotify, CommitNotify: &CommitNotifyEntry{
+		BlockNumber: 1,
+		Valid:       []string{"tx5", "tx3"},
+		Invalid:     []string{"tx6"},
+	}})
+
+	// the value written by tx5 is now the ledger state and nothing else
+	// touches a, while the write of tx6 is rolled back to tx1
+	require.NotContains(t, sl.variableMap, "a")
+	require.Equal(t, "tx1", sl.variableMap["b"].DependentTxID)
+	require.Empty(t, sl.variableMap["b"].ReaderTxIDs)
+	require.Nil(t, sl.variableMap["b"].Previous)
+
+	// settling a transaction again has no effect
+	apply(10, &LogEntry{Type: EntryTypeAbort, Abort: &AbortEntry{TxID: "tx5"}})
+	require.Len(t, sl.variableMap, 1)
+
+	apply(11, &LogEntry{Type: EntryTypeCommitNotify, CommitNotify: &CommitNotifyEntry{BlockNumber: 2, Valid: []string{"tx1"}}})
+	require.Empty(t, sl.variableMap)
+	require.Empty(t, sl.prepared)
+}
+
+func TestApplyCommitNotifyExpiry(t *testing.T) {
+	newShard := func() *ShardLeader {
+		sl, err := NewShardLeader(ShardConfig{
+			ShardID:      "expiry",
+			ReplicaNodes: []string{"node1"},
+			ReplicaID:    1,
+			ExpiryBlocks: 2,
+		}, DefaultBatchTimeout, DefaultBatchMaxSize)
+		require.NoError(t, err)
+		// entries are applied directly by the test
+		sl.Stop()
+		return sl
+	}
+	sl := newShard()
+
+	index := uint64(0)
+	apply := func(entry *LogEntry) {
+		data, err := entry.Marshal()
+		require.NoError(t, err)
+		index++
+		sl.applyEntry(raftpb.Entry{Index: index, Term: 1, Data: data})
+	}
+	prepare := func(txID string, reads, writes []string) {
+		req := &PrepareRequestProto{TxID: txID, ReadSet: map[string][]byte{}, WriteSet: map[string][]byte{}}
+		for _, key := range reads {
+			req.ReadSet[key] = nil
+		}
+		for _, key := range writes {
+			req.WriteSet[key] = []byte(txID)
+		}
+		apply(&LogEntry{Type: EntryTypePrepareBatch, Batch: &PrepareRequestBatch{Requests: []*PrepareRequestProto{req}}})
+	}
+	notify := func(blockNumber uint64, valid ...string) {
+		apply(&LogEntry{Type: EntryTypeCommitNotify, CommitNotify: &CommitNotifyEntry{BlockNumber: blockNumber, Valid: valid}})
+	}
+
+	prepare("tx1", nil, []string{"a"})
+	prepare("tx2", []string{"a"}, []string{"b"})
+	require.Equal(t, map[string]struct{}{"a": {}, "b": {}}, sl.prepared["tx2"].keys)
+
+	notify(5)
+	prepare("tx3", nil, []string{"b"})
+
+	// a block notified again does not count towards the expiry
+	notify(5)
+	require.Len(t, sl.prepared, 3)
+
+	// tx1 and tx2 were prepared before the first block and expire with the
+	// second one, returning b to tx3 alone
+	notify(6)
+	require.Len(t, sl.prepared, 1)
+	require.NotContains(t, sl.variableMap, "a")
+	require.Equal(t, "tx3", sl.variableMap["b"].DependentTxID)
+	require.Nil(t, sl.variableMap["b"].Previous)
+
+	// the index and the expiry survive a snapshot
+	prepare("tx4", []string{"b"}, []string{"c"})
+	data, err := sl.snapshotData()
+	require.NoError(t, err)
+	restored := newShard()
+	require.NoError(t, restored.restoreSnapshot(raftpb.Snapshot{Data: data, Metadata: raftpb.SnapshotMetadata{Index: index}}))
+	require.Equal(t, sl.prepared, restored.prepared)
+	require.Equal(t, sl.expiryQueue[len(sl.expiryQueue)-2:], restored.expiryQueue)
+	require.Equal(t, uint64(6), restored.notifiedBlock)
+
+	// tx3 was prepared after the first block and expires with the third one
+	sl = restored
+	notify(7, "tx4")
+	require.Empty(t, sl.prepared)
+	require.Empty(t, sl.variableMap)
+}
@@ -0,0 +1,333 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/raft/v3"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// catchUpInterval is the interval at which the leader checks whether a
+// learner caught up with the log of the shard
+const catchUpInterval = 100 * time.Millisecond
+
+// Membership is the set of replicas of a shard
+type Membership struct {
+	// Voters are the replicas that take part in the elections and commits
+	Voters []uint64
+	// Learners are the replicas that receive the log of the shard without
+	// voting
+	Learners []uint64
+}
+
+// replicaObserver is notified of the replicas added to or removed from a
+// shard by a membership change
+type replicaObserver func(replica Replica, removed bool)
+
+// Membership returns the replicas of the shard as of the last applied
+// membership change
+func (sl *ShardLeader) Membership() Membership {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+	return Membership{
+		Voters:   append([]uint64(nil), sl.confState.Voters...),
+		Learners: append([]uint64(nil), sl.confState.Learners...),
+	}
+}
+
+// Replicas returns the replicas added to the shard after it was created,
+// sorted by ID
+func (sl *ShardLeader) Replicas() []Replica {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+
+	replicas := make([]Replica, 0, len(sl.replicas))
+	for _, replica := range sl.replicas {
+		replicas = append(replicas, replica)
+	}
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].ID < replicas[j].ID })
+	return replicas
+}
+
+// isMember returns whether the replica votes or learns in the shard
+func (sl *ShardLeader) isMember(id uint64) bool {
+	sl.mu.RLock()
+	defer sl.mu.RUnlock()
+	return containsID(sl.confState.Voters, id) || containsID(sl.confState.Learners, id)
+}
+
+// observeReplicas notifies the observer of every replica added to the shard
+// so far and of the membership changes applied from now on
+func (sl *ShardLeader) observeReplicas(observer replicaObserver) {
+	sl.mu.Lock()
+	sl.replicaObserver = observer
+	sl.mu.Unlock()
+
+	if observer == nil {
+		return
+	}
+	for _, replica := range sl.Replicas() {
+		observer(replica, false)
+	}
+}
+
+// AddReplica adds a replica to the shard. The replica joins as a learner,
+// catches up with the log of the shard, from a snapshot if the log is
+// compacted, and is promoted to a voter once it has every committed entry.
+// It must be called on the leader of the shard and returns once the replica
+// is a voter. The replica is started with ShardConfig.Join.
+func (sl *ShardLeader) AddReplica(ctx context.Context, replica Replica) error {
+	if err := replica.Validate(); err != nil {
+		return err
+	}
+	if err := sl.checkLeader(); err != nil {
+		return err
+	}
+
+	membership := sl.Membership()
+	if containsID(membership.Voters, replica.ID) {
+		return errors.Errorf("replica %d is already a voter of shard %s", replica.ID, sl.shardID)
+	}
+
+	info, err := proto.Marshal(&protos.ReplicaInfo{Id: replica.ID, Address: replica.Address, TlsCert: replica.TLSCert})
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal replica info")
+	}
+
+	if !containsID(membership.Learners, replica.ID) {
+		cc := raftpb.ConfChange{Type: raftpb.ConfChangeAddLearnerNode, NodeID: replica.ID, Context: info}
+		if err := sl.proposeConfChange(ctx, cc); err != nil {
+			return errors.WithMessagef(err, "failed to add replica %d as learner of shard %s", replica.ID, sl.shardID)
+		}
+		logger.Infof("Added replica %d at %s as learner of shard %s", replica.ID, replica.Address, sl.shardID)
+	}
+
+	if err := sl.waitCaughtUp(ctx, replica.ID); err != nil {
+		return err
+	}
+
+	cc := raftpb.ConfChange{Type: raftpb.ConfChangeAddNode, NodeID: replica.ID, Context: info}
+	if err := sl.proposeConfChange(ctx, cc); err != nil {
+		return errors.WithMessagef(err, "failed to promote replica %d of shard %s", replica.ID, sl.shardID)
+	}
+	logger.Infof("Promoted replica %d of shard %s to voter", replica.ID, sl.shardID)
+	return nil
+}
+
+// RemoveReplica removes a replica from the shard. It must be called on the
+// leader of the shard and returns once the removal is applied. A leader that
+// removes itself first hands the leadership over to the most up to date
+// voter, since a removed leader keeps its followers from electing another.
+func (sl *ShardLeader) RemoveReplica(ctx context.Context, id uint64) error {
+	if err := sl.checkLeader(); err != nil {
+		return err
+	}
+
+	membership := sl.Membership()
+	switch {
+	case containsID(membership.Learners, id):
+	case !containsID(membership.Voters, id):
+		return errors.Errorf("replica %d is not a member of shard %s", id, sl.shardID)
+	case len(membership.Voters) == 1:
+		return errors.Errorf("replica %d is the last voter of shard %s", id, sl.shardID)
+	}
+
+	if id == sl.replicaID {
+		if err := sl.transferLeadership(ctx); err != nil {
+			return err
+		}
+	}
+
+	// a follower forwards the proposal to the leader
+	cc := raftpb.ConfChange{Type: raftpb.ConfChangeRemoveNode, NodeID: id}
+	if err := sl.proposeConfChange(ctx, cc); err != nil {
+		return errors.WithMessagef(err, "failed to remove replica %d from shard %s", id, sl.shardID)
+	}
+	logger.Infof("Removed replica %d from shard %s", id, sl.shardID)
+	return nil
+}
+
+// ReplaceReplica adds a replica to the shard and removes the replica id once
+// the new replica is a voter, so that the shard never has fewer voters than
+// before the change
+func (sl *ShardLeader) ReplaceReplica(ctx context.Context, id uint64, replica Replica) error {
+	if id == replica.ID {
+		return errors.Errorf("replica %d cannot replace itself", id)
+	}
+	if !containsID(sl.Membership().Voters, id) {
+		return errors.Errorf("replica %d is not a voter of shard %s", id, sl.shardID)
+	}
+	if err := sl.AddReplica(ctx, replica); err != nil {
+		return err
+	}
+	return sl.RemoveReplica(ctx, id)
+}
+
+// checkLeader returns ErrNotLeader if this replica does not lead the shard
+func (sl *ShardLeader) checkLeader() error {
+	status := sl.node.Status()
+	if status.RaftState != raft.StateLeader {
+		return errors.WithMessagef(ErrNotLeader, "replica %d of shard %s, leader is %d", status.ID, sl.shardID, status.Lead)
+	}
+	return nil
+}
+
+// transferLeadership hands the leadership of the shard over to the voter with
+// the most entries and waits until it leads the shard
+func (sl *ShardLeader) transferLeadership(ctx context.Context) error {
+	status := sl.node.Status()
+	var transferee, match uint64
+	for id, progress := range status.Progress {
+		if id != sl.replicaID && !progress.IsLearner && progress.Match >= match {
+			transferee, match = id, progress.Match
+		}
+	}
+	if transferee == 0 {
+		return errors.Errorf("shard %s has no voter to take over the leadership", sl.shardID)
+	}
+
+	logger.Infof("Transferring the leadership of shard %s to replica %d", sl.shardID, transferee)
+	ticker := time.NewTicker(catchUpInterval)
+	defer ticker.Stop()
+	for {
+		// raft abandons a transfer to a replica that does not catch up
+		// within an election timeout
+		status := sl.node.Status()
+		if status.Lead == transferee {
+			return nil
+		}
+		if status.RaftState == raft.StateLeader {
+			sl.node.TransferLeadership(ctx, sl.replicaID, transferee)
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.WithMessagef(ctx.Err(), "replica %d did not take over the leadership of shard %s", transferee, sl.shardID)
+		case <-sl.stopC:
+			return ErrShardStopped
+		}
+	}
+}
+
+// proposeConfChange proposes a membership change and waits until it is
+// applied. Raft drops a change proposed while another one is pending, in
+// which case the wait ends with the context.
+func (sl *ShardLeader) proposeConfChange(ctx context.Context, cc raftpb.ConfChange) error {
+	cc.ID = rand.Uint64()
+	applied := make(chan struct{})
+
+	sl.waitersLock.Lock()
+	sl.confWaiters[cc.ID] = applied
+	sl.waitersLock.Unlock()
+	defer func() {
+		sl.waitersLock.Lock()
+		delete(sl.confWaiters, cc.ID)
+		sl.waitersLock.Unlock()
+	}()
+
+	if err := sl.node.ProposeConfChange(ctx, cc); err != nil {
+		return err
+	}
+
+	select {
+	case <-applied:
+		return nil
+	case <-ctx.Done():
+		return errors.WithMessage(ctx.Err(), "membership change was not applied")
+	case <-sl.stopC:
+		return ErrShardStopped
+	}
+}
+
+// waitCaughtUp waits until the replica has every entry committed by the
+// leader
+func (sl *ShardLeader) waitCaughtUp(ctx context.Context, id uint64) error {
+	ticker := time.NewTicker(catchUpInterval)
+	defer ticker.Stop()
+
+	for {
+		status := sl.node.Status()
+		if status.RaftState != raft.StateLeader {
+			return errors.WithMessagef(ErrNotLeader, "replica %d lost the leadership of shard %s while replica %d caught up", status.ID, sl.shardID, id)
+		}
+		if progress, ok := status.Progress[id]; ok && progress.Match >= status.Commit {
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return errors.WithMessagef(ctx.Err(), "replica %d did not catch up with shard %s", id, sl.shardID)
+		case <-sl.stopC:
+			return ErrShardStopped
+		}
+	}
+}
+
+// applyConfChange applies a committed membership change, records the replica
+// it adds and notifies the observer of the shard. It returns whether the
+// change added a replica.
+func (sl *ShardLeader) applyConfChange(cc raftpb.ConfChange) bool {
+	confState := sl.node.ApplyConfChange(cc)
+
+	var replica *Replica
+	if len(cc.Context) > 0 && cc.Type != raftpb.ConfChangeRemoveNode {
+		info := &protos.ReplicaInfo{}
+		if err := proto.Unmarshal(cc.Context, info); err != nil {
+			logger.Errorf("Failed to unmarshal replica %d added to shard %s: %v", cc.NodeID, sl.shardID, err)
+		} else {
+			replica = &Replica{ID: info.Id, Address: info.Address, TLSCert: info.TlsCert}
+		}
+	}
+
+	sl.mu.Lock()
+	sl.confState = *confState
+	if replica != nil {
+		sl.replicas[replica.ID] = *replica
+	}
+	if cc.Type == raftpb.ConfChangeRemoveNode {
+		delete(sl.replicas, cc.NodeID)
+	}
+	observer := sl.replicaObserver
+	sl.mu.Unlock()
+
+	switch {
+	case cc.Type == raftpb.ConfChangeRemoveNode && cc.NodeID == sl.replicaID:
+		logger.Warningf("This replica was removed from shard %s", sl.shardID)
+	case observer != nil && cc.Type == raftpb.ConfChangeRemoveNode:
+		observer(Replica{ID: cc.NodeID}, true)
+	case observer != nil && replica != nil:
+		observer(*replica, false)
+	}
+
+	sl.waitersLock.Lock()
+	if applied, ok := sl.confWaiters[cc.ID]; ok {
+		close(applied)
+		delete(sl.confWaiters, cc.ID)
+	}
+	sl.waitersLock.Unlock()
+
+	return cc.Type != raftpb.ConfChangeRemoveNode
+}
+
+func containsID(ids []uint64, id uint64) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,131 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Membership", func() {
+	var (
+		addresses  []string
+		leaders    []*sharding.ShardLeader
+		transports []*sharding.Transport
+	)
+
+	// startReplica starts a replica of the registry shard served on its
+	// own transport
+	startReplica := func(config sharding.ShardConfig, peers sharding.PeerConfig) {
+		config.ShardID = "registry"
+		leader, err := sharding.NewShardLeader(config, 10*time.Millisecond, 1)
+		Expect(err).NotTo(HaveOccurred())
+		DeferCleanup(leader.Stop)
+
+		transport := sharding.NewTransport(config.ReplicaID, peers, sharding.TransportConfig{}, nil)
+		transport.AddShard(leader)
+		Expect(transport.Start(addresses[config.ReplicaID-1])).To(Succeed())
+		DeferCleanup(transport.Stop)
+
+		leaders = append(leaders, leader)
+		transports = append(transports, transport)
+	}
+
+	BeforeEach(func() {
+		addresses = []string{freeAddress(), freeAddress()}
+		leaders, transports = nil, nil
+
+		// the log is compacted after a hundred entries, so that the
+		// replicas added later catch up from a snapshot
+		startReplica(sharding.ShardConfig{ReplicaNodes: addresses[:1], ReplicaID: 1, SnapshotInterval: 10}, nil)
+		_, err := leaders[0].Prepare(electionContext(), &sharding.PrepareRequest{
+			TxID:      "tx0",
+			WriteSet:  map[string][]byte{"registry:key1": []byte("value1")},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		for i := 1; i <= 120; i++ {
+			_, err := leaders[0].Prepare(electionContext(), &sharding.PrepareRequest{
+				TxID:      fmt.Sprintf("tx%d", i),
+				WriteSet:  map[string][]byte{fmt.Sprintf("registry:other%d", i): []byte("value")},
+				Timestamp: time.Now(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		startReplica(sharding.ShardConfig{ReplicaID: 2, Join: true}, sharding.PeerConfig{1: addresses[0]})
+	})
+
+	changeMembership := func(address string, req *protos.MembershipRequest) (*protos.MembershipResponse, error) {
+		conn, err := comm.ClientConfig{DialTimeout: time.Second}.Dial(address)
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		return protos.NewShardCommunicationClient(conn).ChangeMembership(electionContext(), req)
+	}
+
+	It("adds a replica that catches up and removes it", func() {
+		Expect(leaders[0].AddReplica(electionContext(), sharding.Replica{ID: 2, Address: addresses[1]})).To(Succeed())
+		Expect(leaders[0].Membership().Voters).To(ConsistOf(uint64(1), uint64(2)))
+		Expect(transports[0].Peers()).To(Equal(sharding.PeerConfig{2: addresses[1]}))
+		Eventually(func() []uint64 { return leaders[1].Membership().Voters }).Should(ConsistOf(uint64(1), uint64(2)))
+
+		// both voters commit the prepare
+		proof, err := leaders[0].Prepare(electionContext(), &sharding.PrepareRequest{
+			TxID:      "tx-read",
+			ReadSet:   map[string][]byte{"registry:key1": nil},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proof.DependentTxIDs).To(Equal([]string{"tx0"}))
+
+		err = leaders[1].AddReplica(context.Background(), sharding.Replica{ID: 3, Address: "127.0.0.1:1"})
+		Expect(errors.Cause(err)).To(Equal(sharding.ErrNotLeader))
+
+		Expect(leaders[0].RemoveReplica(electionContext(), 2)).To(Succeed())
+		Expect(leaders[0].Membership().Voters).To(Equal([]uint64{1}))
+		Eventually(transports[0].Peers, 5*time.Second).Should(BeEmpty())
+	})
+
+	It("replaces the leader through the shard service", func() {
+		resp, err := changeMembership(addresses[0], &protos.MembershipRequest{
+			ShardId:   "registry",
+			Operation: protos.MembershipOperation_REPLACE_REPLICA,
+			Replica:   &protos.ReplicaInfo{Id: 2, Address: addresses[1]},
+			RemovedId: 1,
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Voters).To(Equal([]uint64{2}))
+		Eventually(transports[1].Peers, 5*time.Second).Should(BeEmpty())
+
+		// the state of the shard was restored on the new replica
+		proof, err := leaders[1].Prepare(electionContext(), &sharding.PrepareRequest{
+			TxID:      "tx-read",
+			ReadSet:   map[string][]byte{"registry:key1": nil},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(proof.DependentTxIDs).To(Equal([]string{"tx0"}))
+		Expect(proof.LeaderID).To(Equal(uint64(2)))
+
+		_, err = changeMembership(addresses[0], &protos.MembershipRequest{
+			ShardId:   "registry",
+			Operation: protos.MembershipOperation_REMOVE_REPLICA,
+			RemovedId: 2,
+		})
+		Expect(status.Code(err)).To(Equal(codes.FailedPrecondition))
+	})
+})
@@ -0,0 +1,188 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"github.com/hyperledger/fabric/common/metrics"
+)
+
+var abortsAppliedCounterOpts = metrics.CounterOpts{
+	Namespace:    "endorser",
+	Subsystem:    "shard",
+	Name:         "aborts_applied",
+	Help:         "The number of transaction aborts applied by a shard.",
+	LabelNames:   []string{"shard"},
+	StatsdFormat: "%{#fqname}.%{shard}",
+}
+
+var (
+	batchSizeHistogramOpts = metrics.HistogramOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "batch_size",
+		Help:         "The number of prepare requests in the batches flushed by a shard.",
+		LabelNames:   []string{"shard"},
+		StatsdFormat: "%{#fqname}.%{shard}",
+		Buckets:      []float64{1, 2, 5, 10, 20, 50, 100, 200, 500, 1000},
+	}
+	batchFlushesCounterOpts = metrics.CounterOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "batch_flushes",
+		Help:         "The number of batches flushed by a shard, because the batch was full (size), the batch timeout expired (timeout) or no flushed request waited to be applied (idle).",
+		LabelNames:   []string{"shard", "reason"},
+		StatsdFormat: "%{#fqname}.%{shard}.%{reason}",
+	}
+	proposeToApplyTimeHistogramOpts = metrics.HistogramOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "propose_to_apply_time",
+		Help:         "The time from the flush of a prepare request until it is applied by the flushing replica in seconds.",
+		LabelNames:   []string{"shard"},
+		StatsdFormat: "%{#fqname}.%{shard}",
+	}
+	proofWaitTimeHistogramOpts = metrics.HistogramOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "proof_wait_time",
+		Help:         "The time a prepare waits for its proof in seconds.",
+		LabelNames:   []string{"shard"},
+		StatsdFormat: "%{#fqname}.%{shard}",
+	}
+	proofsDroppedCounterOpts = metrics.CounterOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "proofs_dropped",
+		Help:         "The number of proofs not published on the commit stream of a shard because it was full.",
+		LabelNames:   []string{"shard"},
+		StatsdFormat: "%{#fqname}.%{shard}",
+	}
+	leaderChangesCounterOpts = metrics.CounterOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "leader_changes",
+		Help:         "The number of leader changes of a shard seen by a replica.",
+		LabelNames:   []string{"shard"},
+		StatsdFormat: "%{#fqname}.%{shard}",
+	}
+	preparesInFlightGaugeOpts = metrics.GaugeOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "prepares_in_flight",
+		Help:         "The number of prepares admitted by a shard that wait for their proof.",
+		LabelNames:   []string{"shard"},
+		StatsdFormat: "%{#fqname}.%{shard}",
+	}
+	preparesRejectedCounterOpts = metrics.CounterOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "prepares_rejected",
+		Help:         "The number of prepares rejected by a shard because its admission lane was full.",
+		LabelNames:   []string{"shard", "priority"},
+		StatsdFormat: "%{#fqname}.%{shard}.%{priority}",
+	}
+)
+
+var (
+	egressQueueLengthGaugeOpts = metrics.GaugeOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "egress_queue_length",
+		Help:         "Length of the queue of raft messages to a replica.",
+		LabelNames:   []string{"shard", "replica"},
+		StatsdFormat: "%{#fqname}.%{shard}.%{replica}",
+	}
+	egressQueueCapacityGaugeOpts = metrics.GaugeOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "egress_queue_capacity",
+		Help:         "Capacity of the queue of raft messages to a replica.",
+		LabelNames:   []string{"shard", "replica"},
+		StatsdFormat: "%{#fqname}.%{shard}.%{replica}",
+	}
+	egressStreamCountGaugeOpts = metrics.GaugeOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "egress_stream_count",
+		Help:         "Count of streams to other replicas.",
+		LabelNames:   []string{"shard"},
+		StatsdFormat: "%{#fqname}.%{shard}",
+	}
+	ingressStreamCountGaugeOpts = metrics.GaugeOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "ingress_stream_count",
+		Help:         "Count of streams from other replicas.",
+		StatsdFormat: "%{#fqname}",
+	}
+	msgSendTimeHistogramOpts = metrics.HistogramOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "msg_send_time",
+		Help:         "The time it takes to send a raft message to a replica in seconds.",
+		LabelNames:   []string{"shard", "replica"},
+		StatsdFormat: "%{#fqname}.%{shard}.%{replica}",
+	}
+	msgSendFailuresCounterOpts = metrics.CounterOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "msg_send_failures",
+		Help:         "Count of raft messages that could not be sent to a replica.",
+		LabelNames:   []string{"shard", "replica"},
+		StatsdFormat: "%{#fqname}.%{shard}.%{replica}",
+	}
+	msgDroppedCounterOpts = metrics.CounterOpts{
+		Namespace:    "endorser",
+		Subsystem:    "shard",
+		Name:         "msg_dropped_count",
+		Help:         "Count of raft messages to a replica dropped because its queue was full.",
+		LabelNames:   []string{"shard", "replica"},
+		StatsdFormat: "%{#fqname}.%{shard}.%{replica}",
+	}
+)
+
+// Metrics contains the metrics reported by shards
+type Metrics struct {
+	AbortsApplied       metrics.Counter
+	BatchSize           metrics.Histogram
+	BatchFlushes        metrics.Counter
+	ProposeToApplyTime  metrics.Histogram
+	ProofWaitTime       metrics.Histogram
+	ProofsDropped       metrics.Counter
+	LeaderChanges       metrics.Counter
+	PreparesInFlight    metrics.Gauge
+	PreparesRejected    metrics.Counter
+	EgressQueueLength   metrics.Gauge
+	EgressQueueCapacity metrics.Gauge
+	EgressStreamCount   metrics.Gauge
+	IngressStreamCount  metrics.Gauge
+	MessageSendTime     metrics.Histogram
+	MessageSendFailures metrics.Counter
+	MessagesDropped     metrics.Counter
+}
+
+// NewMetrics creates a new Metrics instance
+func NewMetrics(provider metrics.Provider) *Metrics {
+	return &Metrics{
+		AbortsApplied:       provider.NewCounter(abortsAppliedCounterOpts),
+		BatchSize:           provider.NewHistogram(batchSizeHistogramOpts),
+		BatchFlushes:        provider.NewCounter(batchFlushesCounterOpts),
+		ProposeToApplyTime:  provider.NewHistogram(proposeToApplyTimeHistogramOpts),
+		ProofWaitTime:       provider.NewHistogram(proofWaitTimeHistogramOpts),
+		ProofsDropped:       provider.NewCounter(proofsDroppedCounterOpts),
+		LeaderChanges:       provider.NewCounter(leaderChangesCounterOpts),
+		PreparesInFlight:    provider.NewGauge(preparesInFlightGaugeOpts),
+		PreparesRejected:    provider.NewCounter(preparesRejectedCounterOpts),
+		EgressQueueLength:   provider.NewGauge(egressQueueLengthGaugeOpts),
+		EgressQueueCapacity: provider.NewGauge(egressQueueCapacityGaugeOpts),
+		EgressStreamCount:   provider.NewGauge(egressStreamCountGaugeOpts),
+		IngressStreamCount:  provider.NewGauge(ingressStreamCountGaugeOpts),
+		MessageSendTime:     provider.NewHistogram(msgSendTimeHistogramOpts),
+		MessageSendFailures: provider.NewCounter(msgSendFailuresCounterOpts),
+		MessagesDropped:     provider.NewCounter(msgDroppedCounterOpts),
+	}
+}
@@ -0,0 +1,75 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/stretchr/testify/require"
+)
+
+func TestShardMetrics(t *testing.T) {
+	newCounter := func() *metricsfakes.Counter {
+		counter := &metricsfakes.Counter{}
+		counter.WithReturns(counter)
+		return counter
+	}
+	newHistogram := func() *metricsfakes.Histogram {
+		histogram := &metricsfakes.Histogram{}
+		histogram.WithReturns(histogram)
+		return histogram
+	}
+
+	metrics := NewMetrics(&disabled.Provider{})
+	batchSize, proposeToApply, proofWait := newHistogram(), newHistogram(), newHistogram()
+	flushes, leaderChanges := newCounter(), newCounter()
+	metrics.BatchSize = batchSize
+	metrics.BatchFlushes = flushes
+	metrics.ProposeToApplyTime = proposeToApply
+	metrics.ProofWaitTime = proofWait
+	metrics.LeaderChanges = leaderChanges
+
+	// batches are only flushed once full
+	sl, err := NewShardLeader(ShardConfig{
+		ShardID:      "registry",
+		ReplicaNodes: []string{"node1"},
+		ReplicaID:    1,
+		Metrics:      metrics,
+	}, time.Hour, 2)
+	require.NoError(t, err)
+	defer sl.Stop()
+	// a full batch is only flushed once the shard has a leader
+	require.Eventually(t, func() bool { return sl.node.Status().Lead == 1 }, 10*time.Second, 10*time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	errC := make(chan error, 2)
+	for _, txID := range []string{"tx1", "tx2"} {
+		go func(txID string) {
+			_, err := sl.Prepare(ctx, &PrepareRequest{TxID: txID, Timestamp: time.Now()})
+			errC <- err
+		}(txID)
+	}
+	require.NoError(t, <-errC)
+	require.NoError(t, <-errC)
+
+	require.Equal(t, 1, leaderChanges.AddCallCount())
+	require.Equal(t, []string{"shard", "registry"}, leaderChanges.WithArgsForCall(0))
+
+	require.Equal(t, 1, flushes.AddCallCount())
+	require.Equal(t, []string{"shard", "registry", "reason", "size"}, flushes.WithArgsForCall(0))
+	require.Equal(t, 1, batchSize.ObserveCallCount())
+	require.Equal(t, float64(2), batchSize.ObserveArgsForCall(0))
+
+	require.Equal(t, 2, proposeToApply.ObserveCallCount())
+	require.Equal(t, 2, proofWait.ObserveCallCount())
+	require.Equal(t, []string{"shard", "registry"}, proofWait.WithArgsForCall(0))
+}
@@ -0,0 +1,236 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Partitioning strategies
+const (
+	// PartitionByContract tracks every key of a contract in a single shard
+	PartitionByContract = "contract"
+	// PartitionByHash spreads the keys of a contract over its partitions
+	// using consistent hashing
+	PartitionByHash = "hash"
+	// PartitionByRange assigns contiguous key ranges of a contract to its
+	// partitions
+	PartitionByRange = "range"
+)
+
+// DefaultVirtualNodes is the number of points each partition places on the
+// consistent hash ring
+const DefaultVirtualNodes = 64
+
+// Partitioner decides which shard tracks each key of a contract. Every
+// endorser of a channel must use the same partitioner so that they agree
+// on the owner of a key.
+type Partitioner interface {
+	// ShardID returns the ID of the shard that owns the key of the contract
+	ShardID(contractName, key string) string
+	// ShardIDs returns the IDs of every shard of the contract
+	ShardIDs(contractName string) []string
+}
+
+// PartitionConfig describes how the keys of contracts are partitioned
+type PartitionConfig struct {
+	// Strategy is one of PartitionByContract, PartitionByHash or
+	// PartitionByRange. An empty strategy partitions by contract.
+	Strategy string
+	// Partitions is the number of partitions of each contract hashed over
+	// several shards. Contracts that are not listed keep a single shard.
+	Partitions map[string]int
+	// VirtualNodes is the number of points each partition places on the
+	// hash ring; zero uses DefaultVirtualNodes
+	VirtualNodes int
+	// Splits are the sorted keys that start each partition but the first of
+	// every contract partitioned by range. Contracts that are not listed
+	// keep a single shard.
+	Splits map[string][]string
+}
+
+// NewPartitioner returns the partitioner described by the config
+func NewPartitioner(config PartitionConfig) (Partitioner, error) {
+	switch config.Strategy {
+	case "", PartitionByContract:
+		return ContractPartitioner{}, nil
+	case PartitionByHash:
+		hp, err := NewHashPartitioner(config.Partitions, config.VirtualNodes)
+		if err != nil {
+			return nil, err
+		}
+		return hp, nil
+	case PartitionByRange:
+		rp, err := NewRangePartitioner(config.Splits)
+		if err != nil {
+			return nil, err
+		}
+		return rp, nil
+	default:
+		return nil, errors.Errorf("unknown partitioning strategy '%s'", config.Strategy)
+	}
+}
+
+// PartitionShardID returns the ID of a partition of a contract. Chaincode
+// names cannot contain a dot, so partition IDs never collide with the ID of
+// an unpartitioned contract.
+func PartitionShardID(contractName string, partition int) string {
+	return contractName + "." + strconv.Itoa(partition)
+}
+
+// ContractPartitioner tracks every key of a contract in a shard named after
+// the contract
+type ContractPartitioner struct{}
+
+// ShardID returns the name of the contract
+func (ContractPartitioner) ShardID(contractName, key string) string {
+	return contractName
+}
+
+// ShardIDs returns the name of the contract
+func (ContractPartitioner) ShardIDs(contractName string) []string {
+	return []string{contractName}
+}
+
+// HashPartitioner places the keys of a contract on a consistent hash ring
+// shared by the partitions of the contract, so that changing the number of
+// partitions moves only a fraction of the keys
+type HashPartitioner struct {
+	rings map[string]*hashRing
+}
+
+type hashRing struct {
+	partitions int
+	points     []uint64
+	owners     map[uint64]string
+}
+
+// NewHashPartitioner returns a partitioner that hashes the keys of each
+// listed contract over the given number of partitions
+func NewHashPartitioner(partitions map[string]int, virtualNodes int) (*HashPartitioner, error) {
+	if virtualNodes == 0 {
+		virtualNodes = DefaultVirtualNodes
+	}
+	if virtualNodes < 0 {
+		return nil, errors.Errorf("invalid number of virtual nodes %d", virtualNodes)
+	}
+
+	hp := &HashPartitioner{rings: make(map[string]*hashRing)}
+	for contractName, count := range partitions {
+		if count < 1 {
+			return nil, errors.Errorf("invalid number of partitions %d for contract %s", count, contractName)
+		}
+		if count == 1 {
+			continue
+		}
+
+		ring := &hashRing{partitions: count, owners: make(map[uint64]string)}
+		for i := 0; i < count; i++ {
+			shardID := PartitionShardID(contractName, i)
+			for v := 0; v < virtualNodes; v++ {
+				point := ringHash(fmt.Sprintf("%s#%d", shardID, v))
+				if _, taken := ring.owners[point]; taken {
+					continue
+				}
+				ring.owners[point] = shardID
+				ring.points = append(ring.points, point)
+			}
+		}
+		sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+		hp.rings[contractName] = ring
+	}
+
+	return hp, nil
+}
+
+// ShardID returns the partition that follows the hash of the key on the ring
+func (hp *HashPartitioner) ShardID(contractName, key string) string {
+	ring, ok := hp.rings[contractName]
+	if !ok {
+		return contractName
+	}
+
+	h := ringHash(key)
+	i := sort.Search(len(ring.points), func(i int) bool { return ring.points[i] >= h })
+	if i == len(ring.points) {
+		i = 0
+	}
+	return ring.owners[ring.points[i]]
+}
+
+// ShardIDs returns every partition of the contract
+func (hp *HashPartitioner) ShardIDs(contractName string) []string {
+	ring, ok := hp.rings[contractName]
+	if !ok {
+		return []string{contractName}
+	}
+
+	shardIDs := make([]string, ring.partitions)
+	for i := range shardIDs {
+		shardIDs[i] = PartitionShardID(contractName, i)
+	}
+	return shardIDs
+}
+
+func ringHash(s string) uint64 {
+	sum := sha256.Sum256([]byte(s))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// RangePartitioner assigns contiguous key ranges of a contract to its
+// partitions. With splits s1 < s2 < ... < sn, partition 0 owns the keys below
+// s1 and partition i owns the keys from si up to, but excluding, si+1.
+type RangePartitioner struct {
+	splits map[string][]string
+}
+
+// NewRangePartitioner returns a partitioner that splits the key space of each
+// listed contract at the given keys
+func NewRangePartitioner(splits map[string][]string) (*RangePartitioner, error) {
+	rp := &RangePartitioner{splits: make(map[string][]string)}
+	for contractName, contractSplits := range splits {
+		for i := 1; i < len(contractSplits); i++ {
+			if contractSplits[i-1] >= contractSplits[i] {
+				return nil, errors.Errorf("splits of contract %s are not sorted: '%s' does not precede '%s'",
+					contractName, contractSplits[i-1], contractSplits[i])
+			}
+		}
+		if len(contractSplits) > 0 {
+			rp.splits[contractName] = append([]string(nil), contractSplits...)
+		}
+	}
+	return rp, nil
+}
+
+// ShardID returns the partition whose range contains the key
+func (rp *RangePartitioner) ShardID(contractName, key string) string {
+	splits, ok := rp.splits[contractName]
+	if !ok {
+		return contractName
+	}
+	partition := sort.Search(len(splits), func(i int) bool { return splits[i] > key })
+	return PartitionShardID(contractName, partition)
+}
+
+// ShardIDs returns every partition of the contract
+func (rp *RangePartitioner) ShardIDs(contractName string) []string {
+	splits, ok := rp.splits[contractName]
+	if !ok {
+		return []string{contractName}
+	}
+	shardIDs := make([]string, len(splits)+1)
+	for i := range shardIDs {
+		shardIDs[i] = PartitionShardID(contractName, i)
+	}
+	return shardIDs
+}
@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"fmt"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Partitioner", func() {
+	It("tracks every key of a contract in the shard of the contract by default", func() {
+		p, err := sharding.NewPartitioner(sharding.PartitionConfig{})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(p.ShardID("registry", "asset1")).To(Equal("registry"))
+		Expect(p.ShardIDs("registry")).To(Equal([]string{"registry"}))
+	})
+
+	It("rejects an unknown strategy", func() {
+		_, err := sharding.NewPartitioner(sharding.PartitionConfig{Strategy: "random"})
+		Expect(err).To(MatchError("unknown partitioning strategy 'random'"))
+	})
+
+	Describe("HashPartitioner", func() {
+		var p sharding.Partitioner
+
+		BeforeEach(func() {
+			var err error
+			p, err = sharding.NewPartitioner(sharding.PartitionConfig{
+				Strategy:   sharding.PartitionByHash,
+				Partitions: map[string]int{"registry": 8},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("spreads the keys of a contract over its partitions", func() {
+			Expect(p.ShardIDs("registry")).To(HaveLen(8))
+			Expect(p.ShardIDs("registry")[7]).To(Equal("registry.7"))
+
+			counts := map[string]int{}
+			for i := 0; i < 8000; i++ {
+				counts[p.ShardID("registry", fmt.Sprintf("asset%d", i))]++
+			}
+			Expect(counts).To(HaveLen(8))
+			for shardID, count := range counts {
+				Expect(p.ShardIDs("registry")).To(ContainElement(shardID))
+				Expect(count).To(BeNumerically(">", 500), "partition %s owns too few keys", shardID)
+			}
+		})
+
+		It("assigns keys the same way on every peer", func() {
+			other, err := sharding.NewHashPartitioner(map[string]int{"registry": 8}, 0)
+			Expect(err).NotTo(HaveOccurred())
+			for i := 0; i < 100; i++ {
+				key := fmt.Sprintf("asset%d", i)
+				Expect(other.ShardID("registry", key)).To(Equal(p.ShardID("registry", key)))
+			}
+		})
+
+		It("moves few keys when a partition is added", func() {
+			grown, err := sharding.NewHashPartitioner(map[string]int{"registry": 9}, 0)
+			Expect(err).NotTo(HaveOccurred())
+
+			moved := 0
+			for i := 0; i < 9000; i++ {
+				key := fmt.Sprintf("asset%d", i)
+				if grown.ShardID("registry", key) != p.ShardID("registry", key) {
+					Expect(grown.ShardID("registry", key)).To(Equal("registry.8"))
+					moved++
+				}
+			}
+			Expect(moved).To(BeNumerically("<", 2000))
+		})
+
+		It("keeps a single shard for contracts that are not partitioned", func() {
+			Expect(p.ShardID("other", "asset1")).To(Equal("other"))
+			Expect(p.ShardIDs("other")).To(Equal([]string{"other"}))
+		})
+
+		It("rejects an invalid number of partitions", func() {
+			_, err := sharding.NewHashPartitioner(map[string]int{"registry": 0}, 0)
+			Expect(err).To(MatchError("invalid number of partitions 0 for contract registry"))
+		})
+	})
+
+	Describe("RangePartitioner", func() {
+		var p sharding.Partitioner
+
+		BeforeEach(func() {
+			var err error
+			p, err = sharding.NewPartitioner(sharding.PartitionConfig{
+				Strategy: sharding.PartitionByRange,
+				Splits:   map[string][]string{"registry": {"g", "p"}},
+			})
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("assigns each key to the partition whose range contains it", func() {
+			Expect(p.ShardIDs("registry")).To(Equal([]string{"registry.0", "registry.1", "registry.2"}))
+			Expect(p.ShardID("registry", "")).To(Equal("registry.0"))
+			Expect(p.ShardID("registry", "apple")).To(Equal("registry.0"))
+			Expect(p.ShardID("registry", "g")).To(Equal("registry.1"))
+			Expect(p.ShardID("registry", "orange")).To(Equal("registry.1"))
+			Expect(p.ShardID("registry", "p")).To(Equal("registry.2"))
+			Expect(p.ShardID("registry", "zebra")).To(Equal("registry.2"))
+			Expect(p.ShardID("other", "apple")).To(Equal("other"))
+		})
+
+		It("rejects splits that are not sorted", func() {
+			_, err := sharding.NewRangePartitioner(map[string][]string{"registry": {"p", "g"}})
+			Expect(err).To(MatchError("splits of contract registry are not sorted: 'p' does not precede 'g'"))
+		})
+	})
+})
@@ -0,0 +1,108 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/msp"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/proto"
+)
+
+// SignedBytes returns the canonical encoding of the proof that is covered
+// by its signature
+func (p *PrepareProof) SignedBytes() ([]byte, error) {
+	payload := &protos.PrepareProofPayload{
+		ShardId:        p.ShardID,
+		TxId:           p.TxID,
+		CommitIndex:    p.CommitIndex,
+		Term:           p.Term,
+		HasDependency:  p.HasDependency,
+		DependentTxIds: p.DependentTxIDs,
+		Dependencies:   dependenciesToProto(p.Dependencies),
+	}
+	return proto.MarshalOptions{Deterministic: true}.Marshal(payload)
+}
+
+// VerifyProof checks that the proof is signed by a valid identity known to
+// the given deserializer, typically the channel MSP manager
+func VerifyProof(proof *PrepareProof, deserializer msp.IdentityDeserializer) error {
+	if proof == nil || proof.TxID == "" || proof.ShardID == "" {
+		return errors.New("incomplete proof")
+	}
+	if len(proof.Signer) == 0 || len(proof.Signature) == 0 {
+		return errors.Errorf("proof for tx %s from shard %s is not signed", proof.TxID, proof.ShardID)
+	}
+
+	signer, err := deserializer.DeserializeIdentity(proof.Signer)
+	if err != nil {
+		return errors.WithMessage(err, "failed to deserialize proof signer")
+	}
+	if err := signer.Validate(); err != nil {
+		return errors.WithMessage(err, "proof signer is not valid")
+	}
+
+	msg, err := proof.SignedBytes()
+	if err != nil {
+		return errors.WithMessage(err, "failed to encode proof")
+	}
+	if err := signer.Verify(msg, proof.Signature); err != nil {
+		return errors.WithMessagef(err, "invalid signature on proof for tx %s from shard %s", proof.TxID, proof.ShardID)
+	}
+
+	return nil
+}
+
+// VerifyProofBundle checks that the bundle holds exactly one valid proof
+// for its transaction from each shard that prepared it
+func VerifyProofBundle(bundle *ProofBundle, deserializer msp.IdentityDeserializer) error {
+	if bundle == nil || len(bundle.Proofs) == 0 {
+		return errors.New("empty proof bundle")
+	}
+
+	shards := make(map[string]struct{})
+	for _, proof := range bundle.Proofs {
+		if proof == nil || proof.TxID != bundle.TxID {
+			return errors.Errorf("proof bundle for tx %s holds a proof for another transaction", bundle.TxID)
+		}
+		if _, ok := shards[proof.ShardID]; ok {
+			return errors.Errorf("proof bundle for tx %s holds several proofs from shard %s", bundle.TxID, proof.ShardID)
+		}
+		shards[proof.ShardID] = struct{}{}
+
+		if err := VerifyProof(proof, deserializer); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// signProof signs the proof with the replica's identity. Proofs are left
+// unsigned if the shard has no signer.
+func (sl *ShardLeader) signProof(proof *PrepareProof) error {
+	if sl.signer == nil {
+		return nil
+	}
+
+	msg, err := proof.SignedBytes()
+	if err != nil {
+		return err
+	}
+	creator, err := sl.signer.Serialize()
+	if err != nil {
+		return errors.WithMessage(err, "failed to serialize signer")
+	}
+	sig, err := sl.signer.Sign(msg)
+	if err != nil {
+		return errors.WithMessage(err, "failed to sign proof")
+	}
+
+	proof.Signer = creator
+	proof.Signature = sig
+	return nil
+}
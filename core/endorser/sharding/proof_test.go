@@ -0,0 +1,128 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp/factory"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/msp"
+	"github.com/hyperledger/fabric/msp/mgmt"
+	msptesttools "github.com/hyperledger/fabric/msp/mgmt/testtools"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("PrepareProof", func() {
+	var (
+		localMSP msp.MSP
+		signer   msp.SigningIdentity
+		proof    *sharding.PrepareProof
+	)
+
+	BeforeEach(func() {
+		Expect(msptesttools.LoadMSPSetupForTesting()).To(Succeed())
+		localMSP = mgmt.GetLocalMSP(factory.GetDefault())
+
+		var err error
+		signer, err = localMSP.GetDefaultSigningIdentity()
+		Expect(err).NotTo(HaveOccurred())
+
+		proof = &sharding.PrepareProof{
+			TxID:           "tx2",
+			ShardID:        "testContract",
+			CommitIndex:    7,
+			Term:           2,
+			HasDependency:  true,
+			DependentTxIDs: []string{"tx1"},
+			Dependencies: []sharding.Dependency{
+				{Key: "key1", TxID: "tx1", Kind: protos.DependencyKind_READ},
+			},
+		}
+		msg, err := proof.SignedBytes()
+		Expect(err).NotTo(HaveOccurred())
+		proof.Signer, err = signer.Serialize()
+		Expect(err).NotTo(HaveOccurred())
+		proof.Signature, err = signer.Sign(msg)
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("verifies a proof signed by a channel member", func() {
+		Expect(sharding.VerifyProof(proof, localMSP)).To(Succeed())
+	})
+
+	It("rejects a proof whose content was altered", func() {
+		proof.DependentTxIDs = nil
+		Expect(sharding.VerifyProof(proof, localMSP)).To(MatchError(ContainSubstring("invalid signature on proof for tx tx2")))
+	})
+
+	It("rejects a proof whose dependency kinds were altered", func() {
+		proof.Dependencies[0].Kind = protos.DependencyKind_WRITE
+		Expect(sharding.VerifyProof(proof, localMSP)).To(MatchError(ContainSubstring("invalid signature on proof for tx tx2")))
+	})
+
+	It("rejects an unsigned proof", func() {
+		proof.Signature = nil
+		Expect(sharding.VerifyProof(proof, localMSP)).To(MatchError("proof for tx tx2 from shard testContract is not signed"))
+	})
+
+	It("rejects a proof signed by an unknown identity", func() {
+		proof.Signer = []byte("forged")
+		Expect(sharding.VerifyProof(proof, localMSP)).To(MatchError(ContainSubstring("failed to deserialize proof signer")))
+	})
+
+	It("verifies a bundle holding one proof per shard", func() {
+		other := *proof
+		other.ShardID = "callee"
+		msg, err := other.SignedBytes()
+		Expect(err).NotTo(HaveOccurred())
+		other.Signature, err = signer.Sign(msg)
+		Expect(err).NotTo(HaveOccurred())
+
+		bundle := &sharding.ProofBundle{TxID: "tx2", Proofs: []*sharding.PrepareProof{proof, &other}}
+		Expect(sharding.VerifyProofBundle(bundle, localMSP)).To(Succeed())
+
+		other.Signature = proof.Signature
+		Expect(sharding.VerifyProofBundle(bundle, localMSP)).To(MatchError(ContainSubstring("invalid signature on proof for tx tx2 from shard callee")))
+	})
+
+	It("rejects a bundle holding a proof for another transaction", func() {
+		bundle := &sharding.ProofBundle{TxID: "tx3", Proofs: []*sharding.PrepareProof{proof}}
+		Expect(sharding.VerifyProofBundle(bundle, localMSP)).To(MatchError("proof bundle for tx tx3 holds a proof for another transaction"))
+	})
+
+	It("rejects a bundle holding several proofs from a shard", func() {
+		bundle := &sharding.ProofBundle{TxID: "tx2", Proofs: []*sharding.PrepareProof{proof, proof}}
+		Expect(sharding.VerifyProofBundle(bundle, localMSP)).To(MatchError("proof bundle for tx tx2 holds several proofs from shard testContract"))
+	})
+
+	It("rejects an empty bundle", func() {
+		Expect(sharding.VerifyProofBundle(&sharding.ProofBundle{TxID: "tx2"}, localMSP)).To(MatchError("empty proof bundle"))
+	})
+
+	It("is signed by the shard that applied the prepare", func() {
+		shard, err := sharding.NewShardLeader(sharding.ShardConfig{
+			ShardID:      "testContract",
+			ReplicaNodes: []string{"node1"},
+			ReplicaID:    1,
+			Signer:       signer,
+		}, 10*time.Millisecond, 20)
+		Expect(err).NotTo(HaveOccurred())
+		defer shard.Stop()
+
+		proof, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+			TxID:      "tx1",
+			ShardID:   "testContract",
+			WriteSet:  map[string][]byte{"key1": []byte("value1")},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sharding.VerifyProof(proof, localMSP)).To(Succeed())
+	})
+})
@@ -21,10 +21,120 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// MembershipOperation is a change of the replicas of a shard
+type MembershipOperation int32
+
+const (
+	// ADD_REPLICA adds the replica as a learner and promotes it to a voter
+	// once it caught up with the leader
+	MembershipOperation_ADD_REPLICA MembershipOperation = 0
+	// REMOVE_REPLICA removes the replica removed_id
+	MembershipOperation_REMOVE_REPLICA MembershipOperation = 1
+	// REPLACE_REPLICA adds the replica and then removes the replica removed_id
+	MembershipOperation_REPLACE_REPLICA MembershipOperation = 2
+)
+
+// Enum value maps for MembershipOperation.
+var (
+	MembershipOperation_name = map[int32]string{
+		0: "ADD_REPLICA",
+		1: "REMOVE_REPLICA",
+		2: "REPLACE_REPLICA",
+	}
+	MembershipOperation_value = map[string]int32{
+		"ADD_REPLICA":     0,
+		"REMOVE_REPLICA":  1,
+		"REPLACE_REPLICA": 2,
+	}
+)
+
+func (x MembershipOperation) Enum() *MembershipOperation {
+	p := new(MembershipOperation)
+	*p = x
+	return p
+}
+
+func (x MembershipOperation) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (MembershipOperation) Descriptor() protoreflect.EnumDescriptor {
+	return file_core_endorser_sharding_protos_shard_proto_enumTypes[0].Descriptor()
+}
+
+func (MembershipOperation) Type() protoreflect.EnumType {
+	return &file_core_endorser_sharding_protos_shard_proto_enumTypes[0]
+}
+
+func (x MembershipOperation) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use MembershipOperation.Descriptor instead.
+func (MembershipOperation) EnumDescriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{0}
+}
+
+// DependencyKind describes how a transaction conflicts with the
+// transaction it depends on
+type DependencyKind int32
+
+const (
+	// READ: the transaction reads a key written by the dependency
+	DependencyKind_READ DependencyKind = 0
+	// WRITE: the transaction writes a key read by the dependency
+	DependencyKind_WRITE DependencyKind = 1
+	// WRITE_WRITE: the transaction writes a key written by the dependency
+	DependencyKind_WRITE_WRITE DependencyKind = 2
+)
+
+// Enum value maps for DependencyKind.
+var (
+	DependencyKind_name = map[int32]string{
+		0: "READ",
+		1: "WRITE",
+		2: "WRITE_WRITE",
+	}
+	DependencyKind_value = map[string]int32{
+		"READ":        0,
+		"WRITE":       1,
+		"WRITE_WRITE": 2,
+	}
+)
+
+func (x DependencyKind) Enum() *DependencyKind {
+	p := new(DependencyKind)
+	*p = x
+	return p
+}
+
+func (x DependencyKind) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (DependencyKind) Descriptor() protoreflect.EnumDescriptor {
+	return file_core_endorser_sharding_protos_shard_proto_enumTypes[1].Descriptor()
+}
+
+func (DependencyKind) Type() protoreflect.EnumType {
+	return &file_core_endorser_sharding_protos_shard_proto_enumTypes[1]
+}
+
+func (x DependencyKind) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use DependencyKind.Descriptor instead.
+func (DependencyKind) EnumDescriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{1}
+}
+
 // RaftMessageProto wraps a serialized raftpb.Message
 type RaftMessageProto struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Data  []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	// shard_id is the shard the message is routed to
+	ShardId       string `protobuf:"bytes,2,opt,name=shard_id,json=shardId,proto3" json:"shard_id,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -66,6 +176,13 @@ func (x *RaftMessageProto) GetData() []byte {
 	return nil
 }
 
+func (x *RaftMessageProto) GetShardId() string {
+	if x != nil {
+		return x.ShardId
+	}
+	return ""
+}
+
 type StepResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Success       bool                   `protobuf:"varint,1,opt,name=success,proto3" json:"success,omitempty"`
@@ -118,18 +235,898 @@ func (x *StepResponse) GetError() string {
 	return ""
 }
 
-var File_core_endorser_sharding_protos_shard_proto protoreflect.FileDescriptor
+// ReplicaInfo identifies a shard replica. It is the context of the raft conf
+// changes that add a replica, so that every replica learns how to reach it.
+type ReplicaInfo struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Id      uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	Address string                 `protobuf:"bytes,2,opt,name=address,proto3" json:"address,omitempty"`
+	// tls_cert is the PEM encoded TLS certificate the replica presents
+	TlsCert       []byte `protobuf:"bytes,3,opt,name=tls_cert,json=tlsCert,proto3" json:"tls_cert,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
 
-const file_core_endorser_sharding_protos_shard_proto_rawDesc = "" +
-	"\n" +
-	")core/endorser/sharding/protos/shard.proto\x12\x06protos\"&\n" +
-	"\x10RaftMessageProto\x12\x12\n" +
-	"\x04data\x18\x01 \x01(\fR\x04data\">\n" +
-	"\fStepResponse\x12\x18\n" +
-	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
-	"\x05error\x18\x02 \x01(\tR\x05error2N\n" +
+func (x *ReplicaInfo) Reset() {
+	*x = ReplicaInfo{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReplicaInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReplicaInfo) ProtoMessage() {}
+
+func (x *ReplicaInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReplicaInfo.ProtoReflect.Descriptor instead.
+func (*ReplicaInfo) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *ReplicaInfo) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ReplicaInfo) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *ReplicaInfo) GetTlsCert() []byte {
+	if x != nil {
+		return x.TlsCert
+	}
+	return nil
+}
+
+type MembershipRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ShardId       string                 `protobuf:"bytes,1,opt,name=shard_id,json=shardId,proto3" json:"shard_id,omitempty"`
+	Operation     MembershipOperation    `protobuf:"varint,2,opt,name=operation,proto3,enum=protos.MembershipOperation" json:"operation,omitempty"`
+	Replica       *ReplicaInfo           `protobuf:"bytes,3,opt,name=replica,proto3" json:"replica,omitempty"`
+	RemovedId     uint64                 `protobuf:"varint,4,opt,name=removed_id,json=removedId,proto3" json:"removed_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MembershipRequest) Reset() {
+	*x = MembershipRequest{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MembershipRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MembershipRequest) ProtoMessage() {}
+
+func (x *MembershipRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MembershipRequest.ProtoReflect.Descriptor instead.
+func (*MembershipRequest) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MembershipRequest) GetShardId() string {
+	if x != nil {
+		return x.ShardId
+	}
+	return ""
+}
+
+func (x *MembershipRequest) GetOperation() MembershipOperation {
+	if x != nil {
+		return x.Operation
+	}
+	return MembershipOperation_ADD_REPLICA
+}
+
+func (x *MembershipRequest) GetReplica() *ReplicaInfo {
+	if x != nil {
+		return x.Replica
+	}
+	return nil
+}
+
+func (x *MembershipRequest) GetRemovedId() uint64 {
+	if x != nil {
+		return x.RemovedId
+	}
+	return 0
+}
+
+// MembershipResponse is the membership of the shard after the change
+type MembershipResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Voters        []uint64               `protobuf:"varint,1,rep,packed,name=voters,proto3" json:"voters,omitempty"`
+	Learners      []uint64               `protobuf:"varint,2,rep,packed,name=learners,proto3" json:"learners,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MembershipResponse) Reset() {
+	*x = MembershipResponse{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MembershipResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MembershipResponse) ProtoMessage() {}
+
+func (x *MembershipResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MembershipResponse.ProtoReflect.Descriptor instead.
+func (*MembershipResponse) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *MembershipResponse) GetVoters() []uint64 {
+	if x != nil {
+		return x.Voters
+	}
+	return nil
+}
+
+func (x *MembershipResponse) GetLearners() []uint64 {
+	if x != nil {
+		return x.Learners
+	}
+	return nil
+}
+
+// Dependency is a single conflict found by the shard on one key
+type Dependency struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Key           string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	TxId          string                 `protobuf:"bytes,2,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	Kind          DependencyKind         `protobuf:"varint,3,opt,name=kind,proto3,enum=protos.DependencyKind" json:"kind,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Dependency) Reset() {
+	*x = Dependency{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Dependency) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Dependency) ProtoMessage() {}
+
+func (x *Dependency) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Dependency.ProtoReflect.Descriptor instead.
+func (*Dependency) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Dependency) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *Dependency) GetTxId() string {
+	if x != nil {
+		return x.TxId
+	}
+	return ""
+}
+
+func (x *Dependency) GetKind() DependencyKind {
+	if x != nil {
+		return x.Kind
+	}
+	return DependencyKind_READ
+}
+
+// PrepareProofPayload is the canonical encoding of a prepare proof.
+// It is signed by the shard replica that applied the prepare request.
+type PrepareProofPayload struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ShardId        string                 `protobuf:"bytes,1,opt,name=shard_id,json=shardId,proto3" json:"shard_id,omitempty"`
+	TxId           string                 `protobuf:"bytes,2,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	CommitIndex    uint64                 `protobuf:"varint,3,opt,name=commit_index,json=commitIndex,proto3" json:"commit_index,omitempty"`
+	Term           uint64                 `protobuf:"varint,4,opt,name=term,proto3" json:"term,omitempty"`
+	HasDependency  bool                   `protobuf:"varint,5,opt,name=has_dependency,json=hasDependency,proto3" json:"has_dependency,omitempty"`
+	DependentTxIds []string               `protobuf:"bytes,6,rep,name=dependent_tx_ids,json=dependentTxIds,proto3" json:"dependent_tx_ids,omitempty"`
+	Dependencies   []*Dependency          `protobuf:"bytes,7,rep,name=dependencies,proto3" json:"dependencies,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *PrepareProofPayload) Reset() {
+	*x = PrepareProofPayload{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PrepareProofPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PrepareProofPayload) ProtoMessage() {}
+
+func (x *PrepareProofPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PrepareProofPayload.ProtoReflect.Descriptor instead.
+func (*PrepareProofPayload) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PrepareProofPayload) GetShardId() string {
+	if x != nil {
+		return x.ShardId
+	}
+	return ""
+}
+
+func (x *PrepareProofPayload) GetTxId() string {
+	if x != nil {
+		return x.TxId
+	}
+	return ""
+}
+
+func (x *PrepareProofPayload) GetCommitIndex() uint64 {
+	if x != nil {
+		return x.CommitIndex
+	}
+	return 0
+}
+
+func (x *PrepareProofPayload) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *PrepareProofPayload) GetHasDependency() bool {
+	if x != nil {
+		return x.HasDependency
+	}
+	return false
+}
+
+func (x *PrepareProofPayload) GetDependentTxIds() []string {
+	if x != nil {
+		return x.DependentTxIds
+	}
+	return nil
+}
+
+func (x *PrepareProofPayload) GetDependencies() []*Dependency {
+	if x != nil {
+		return x.Dependencies
+	}
+	return nil
+}
+
+// DependencyInfo carries the dependency resolution of an endorsed
+// transaction. It is attached to each peer.Endorsement so that the
+// proposal response payload stays identical across endorsers, and it
+// includes the shard's signature so that it can be checked independently.
+// The endorsement signature does not cover it: committers treat it as a
+// hint and only keep the dependencies that the read/write sets justify.
+type DependencyInfo struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Version        uint32                 `protobuf:"varint,1,opt,name=version,proto3" json:"version,omitempty"`
+	ShardId        string                 `protobuf:"bytes,2,opt,name=shard_id,json=shardId,proto3" json:"shard_id,omitempty"`
+	TxId           string                 `protobuf:"bytes,3,opt,name=tx_id,json=txId,proto3" json:"tx_id,omitempty"`
+	CommitIndex    uint64                 `protobuf:"varint,4,opt,name=commit_index,json=commitIndex,proto3" json:"commit_index,omitempty"`
+	Term           uint64                 `protobuf:"varint,5,opt,name=term,proto3" json:"term,omitempty"`
+	HasDependency  bool                   `protobuf:"varint,6,opt,name=has_dependency,json=hasDependency,proto3" json:"has_dependency,omitempty"`
+	DependentTxIds []string               `protobuf:"bytes,7,rep,name=dependent_tx_ids,json=dependentTxIds,proto3" json:"dependent_tx_ids,omitempty"`
+	Signer         []byte                 `protobuf:"bytes,8,opt,name=signer,proto3" json:"signer,omitempty"`
+	Signature      []byte                 `protobuf:"bytes,9,opt,name=signature,proto3" json:"signature,omitempty"`
+	Dependencies   []*Dependency          `protobuf:"bytes,10,rep,name=dependencies,proto3" json:"dependencies,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *DependencyInfo) Reset() {
+	*x = DependencyInfo{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DependencyInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DependencyInfo) ProtoMessage() {}
+
+func (x *DependencyInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DependencyInfo.ProtoReflect.Descriptor instead.
+func (*DependencyInfo) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *DependencyInfo) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *DependencyInfo) GetShardId() string {
+	if x != nil {
+		return x.ShardId
+	}
+	return ""
+}
+
+func (x *DependencyInfo) GetTxId() string {
+	if x != nil {
+		return x.TxId
+	}
+	return ""
+}
+
+func (x *DependencyInfo) GetCommitIndex() uint64 {
+	if x != nil {
+		return x.CommitIndex
+	}
+	return 0
+}
+
+func (x *DependencyInfo) GetTerm() uint64 {
+	if x != nil {
+		return x.Term
+	}
+	return 0
+}
+
+func (x *DependencyInfo) GetHasDependency() bool {
+	if x != nil {
+		return x.HasDependency
+	}
+	return false
+}
+
+func (x *DependencyInfo) GetDependentTxIds() []string {
+	if x != nil {
+		return x.DependentTxIds
+	}
+	return nil
+}
+
+func (x *DependencyInfo) GetSigner() []byte {
+	if x != nil {
+		return x.Signer
+	}
+	return nil
+}
+
+func (x *DependencyInfo) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *DependencyInfo) GetDependencies() []*Dependency {
+	if x != nil {
+		return x.Dependencies
+	}
+	return nil
+}
+
+// DecoratedEndorsement is a peer.Endorsement decorated with the dependency
+// info of the shards that prepared the endorsed transaction. Its endorser and
+// signature are the fields of peer.Endorsement, so the two messages decode
+// each other. The dependency info lies outside the range of the Fabric
+// protos: peer.Endorsement keeps it as an unknown field when it is relayed,
+// and clients that drop unknown fields drop it. Readers skip the dependency
+// info of versions they do not know.
+type DecoratedEndorsement struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Endorser       []byte                 `protobuf:"bytes,1,opt,name=endorser,proto3" json:"endorser,omitempty"`
+	Signature      []byte                 `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	DependencyInfo []*DependencyInfo      `protobuf:"bytes,1000,rep,name=dependency_info,json=dependencyInfo,proto3" json:"dependency_info,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *DecoratedEndorsement) Reset() {
+	*x = DecoratedEndorsement{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DecoratedEndorsement) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DecoratedEndorsement) ProtoMessage() {}
+
+func (x *DecoratedEndorsement) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DecoratedEndorsement.ProtoReflect.Descriptor instead.
+func (*DecoratedEndorsement) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *DecoratedEndorsement) GetEndorser() []byte {
+	if x != nil {
+		return x.Endorser
+	}
+	return nil
+}
+
+func (x *DecoratedEndorsement) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
+func (x *DecoratedEndorsement) GetDependencyInfo() []*DependencyInfo {
+	if x != nil {
+		return x.DependencyInfo
+	}
+	return nil
+}
+
+// ForwardRequest carries a batch of prepare requests from a follower to the
+// leader of a shard
+type ForwardRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	ShardId string                 `protobuf:"bytes,1,opt,name=shard_id,json=shardId,proto3" json:"shard_id,omitempty"`
+	// batch is the JSON encoded PrepareRequestBatch, as in the raft log
+	Batch         []byte `protobuf:"bytes,2,opt,name=batch,proto3" json:"batch,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForwardRequest) Reset() {
+	*x = ForwardRequest{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForwardRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForwardRequest) ProtoMessage() {}
+
+func (x *ForwardRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForwardRequest.ProtoReflect.Descriptor instead.
+func (*ForwardRequest) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *ForwardRequest) GetShardId() string {
+	if x != nil {
+		return x.ShardId
+	}
+	return ""
+}
+
+func (x *ForwardRequest) GetBatch() []byte {
+	if x != nil {
+		return x.Batch
+	}
+	return nil
+}
+
+// ForwardResponse holds the proof of every request of a forwarded batch, in
+// the order of the batch
+type ForwardResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Proofs        []*DependencyInfo      `protobuf:"bytes,1,rep,name=proofs,proto3" json:"proofs,omitempty"`
+	LeaderId      uint64                 `protobuf:"varint,2,opt,name=leader_id,json=leaderId,proto3" json:"leader_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ForwardResponse) Reset() {
+	*x = ForwardResponse{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ForwardResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ForwardResponse) ProtoMessage() {}
+
+func (x *ForwardResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ForwardResponse.ProtoReflect.Descriptor instead.
+func (*ForwardResponse) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ForwardResponse) GetProofs() []*DependencyInfo {
+	if x != nil {
+		return x.Proofs
+	}
+	return nil
+}
+
+func (x *ForwardResponse) GetLeaderId() uint64 {
+	if x != nil {
+		return x.LeaderId
+	}
+	return 0
+}
+
+type DependencyQuery struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ShardId       string                 `protobuf:"bytes,1,opt,name=shard_id,json=shardId,proto3" json:"shard_id,omitempty"`
+	Keys          []string               `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DependencyQuery) Reset() {
+	*x = DependencyQuery{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DependencyQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DependencyQuery) ProtoMessage() {}
+
+func (x *DependencyQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DependencyQuery.ProtoReflect.Descriptor instead.
+func (*DependencyQuery) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *DependencyQuery) GetShardId() string {
+	if x != nil {
+		return x.ShardId
+	}
+	return ""
+}
+
+func (x *DependencyQuery) GetKeys() []string {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+// KeyDependency is the dependency state of a key of a shard
+type KeyDependency struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Key   string                 `protobuf:"bytes,1,opt,name=key,proto3" json:"key,omitempty"`
+	// owner_tx_id is the last transaction that wrote the key and is neither
+	// committed nor aborted, empty if there is none
+	OwnerTxId string `protobuf:"bytes,2,opt,name=owner_tx_id,json=ownerTxId,proto3" json:"owner_tx_id,omitempty"`
+	// reader_tx_ids are the transactions that read the key since it was
+	// last written
+	ReaderTxIds   []string `protobuf:"bytes,3,rep,name=reader_tx_ids,json=readerTxIds,proto3" json:"reader_tx_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyDependency) Reset() {
+	*x = KeyDependency{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyDependency) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyDependency) ProtoMessage() {}
+
+func (x *KeyDependency) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyDependency.ProtoReflect.Descriptor instead.
+func (*KeyDependency) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *KeyDependency) GetKey() string {
+	if x != nil {
+		return x.Key
+	}
+	return ""
+}
+
+func (x *KeyDependency) GetOwnerTxId() string {
+	if x != nil {
+		return x.OwnerTxId
+	}
+	return ""
+}
+
+func (x *KeyDependency) GetReaderTxIds() []string {
+	if x != nil {
+		return x.ReaderTxIds
+	}
+	return nil
+}
+
+type DependencyQueryResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// read_index is the commit index of the shard the keys were read at
+	ReadIndex uint64 `protobuf:"varint,1,opt,name=read_index,json=readIndex,proto3" json:"read_index,omitempty"`
+	// keys holds the state of every queried key, in the order of the query
+	Keys          []*KeyDependency `protobuf:"bytes,2,rep,name=keys,proto3" json:"keys,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DependencyQueryResponse) Reset() {
+	*x = DependencyQueryResponse{}
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DependencyQueryResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DependencyQueryResponse) ProtoMessage() {}
+
+func (x *DependencyQueryResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_core_endorser_sharding_protos_shard_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DependencyQueryResponse.ProtoReflect.Descriptor instead.
+func (*DependencyQueryResponse) Descriptor() ([]byte, []int) {
+	return file_core_endorser_sharding_protos_shard_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *DependencyQueryResponse) GetReadIndex() uint64 {
+	if x != nil {
+		return x.ReadIndex
+	}
+	return 0
+}
+
+func (x *DependencyQueryResponse) GetKeys() []*KeyDependency {
+	if x != nil {
+		return x.Keys
+	}
+	return nil
+}
+
+var File_core_endorser_sharding_protos_shard_proto protoreflect.FileDescriptor
+
+const file_core_endorser_sharding_protos_shard_proto_rawDesc = "" +
+	"\n" +
+	")core/endorser/sharding/protos/shard.proto\x12\x06protos\"A\n" +
+	"\x10RaftMessageProto\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x19\n" +
+	"\bshard_id\x18\x02 \x01(\tR\ashardId\">\n" +
+	"\fStepResponse\x12\x18\n" +
+	"\asuccess\x18\x01 \x01(\bR\asuccess\x12\x14\n" +
+	"\x05error\x18\x02 \x01(\tR\x05error\"R\n" +
+	"\vReplicaInfo\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x18\n" +
+	"\aaddress\x18\x02 \x01(\tR\aaddress\x12\x19\n" +
+	"\btls_cert\x18\x03 \x01(\fR\atlsCert\"\xb7\x01\n" +
+	"\x11MembershipRequest\x12\x19\n" +
+	"\bshard_id\x18\x01 \x01(\tR\ashardId\x129\n" +
+	"\toperation\x18\x02 \x01(\x0e2\x1b.protos.MembershipOperationR\toperation\x12-\n" +
+	"\areplica\x18\x03 \x01(\v2\x13.protos.ReplicaInfoR\areplica\x12\x1d\n" +
+	"\n" +
+	"removed_id\x18\x04 \x01(\x04R\tremovedId\"H\n" +
+	"\x12MembershipResponse\x12\x16\n" +
+	"\x06voters\x18\x01 \x03(\x04R\x06voters\x12\x1a\n" +
+	"\blearners\x18\x02 \x03(\x04R\blearners\"_\n" +
+	"\n" +
+	"Dependency\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x13\n" +
+	"\x05tx_id\x18\x02 \x01(\tR\x04txId\x12*\n" +
+	"\x04kind\x18\x03 \x01(\x0e2\x16.protos.DependencyKindR\x04kind\"\x85\x02\n" +
+	"\x13PrepareProofPayload\x12\x19\n" +
+	"\bshard_id\x18\x01 \x01(\tR\ashardId\x12\x13\n" +
+	"\x05tx_id\x18\x02 \x01(\tR\x04txId\x12!\n" +
+	"\fcommit_index\x18\x03 \x01(\x04R\vcommitIndex\x12\x12\n" +
+	"\x04term\x18\x04 \x01(\x04R\x04term\x12%\n" +
+	"\x0ehas_dependency\x18\x05 \x01(\bR\rhasDependency\x12(\n" +
+	"\x10dependent_tx_ids\x18\x06 \x03(\tR\x0edependentTxIds\x126\n" +
+	"\fdependencies\x18\a \x03(\v2\x12.protos.DependencyR\fdependencies\"\xd0\x02\n" +
+	"\x0eDependencyInfo\x12\x18\n" +
+	"\aversion\x18\x01 \x01(\rR\aversion\x12\x19\n" +
+	"\bshard_id\x18\x02 \x01(\tR\ashardId\x12\x13\n" +
+	"\x05tx_id\x18\x03 \x01(\tR\x04txId\x12!\n" +
+	"\fcommit_index\x18\x04 \x01(\x04R\vcommitIndex\x12\x12\n" +
+	"\x04term\x18\x05 \x01(\x04R\x04term\x12%\n" +
+	"\x0ehas_dependency\x18\x06 \x01(\bR\rhasDependency\x12(\n" +
+	"\x10dependent_tx_ids\x18\a \x03(\tR\x0edependentTxIds\x12\x16\n" +
+	"\x06signer\x18\b \x01(\fR\x06signer\x12\x1c\n" +
+	"\tsignature\x18\t \x01(\fR\tsignature\x126\n" +
+	"\fdependencies\x18\n" +
+	" \x03(\v2\x12.protos.DependencyR\fdependencies\"\x92\x01\n" +
+	"\x14DecoratedEndorsement\x12\x1a\n" +
+	"\bendorser\x18\x01 \x01(\fR\bendorser\x12\x1c\n" +
+	"\tsignature\x18\x02 \x01(\fR\tsignature\x12@\n" +
+	"\x0fdependency_info\x18\xe8\a \x03(\v2\x16.protos.DependencyInfoR\x0edependencyInfo\"A\n" +
+	"\x0eForwardRequest\x12\x19\n" +
+	"\bshard_id\x18\x01 \x01(\tR\ashardId\x12\x14\n" +
+	"\x05batch\x18\x02 \x01(\fR\x05batch\"^\n" +
+	"\x0fForwardResponse\x12.\n" +
+	"\x06proofs\x18\x01 \x03(\v2\x16.protos.DependencyInfoR\x06proofs\x12\x1b\n" +
+	"\tleader_id\x18\x02 \x01(\x04R\bleaderId\"@\n" +
+	"\x0fDependencyQuery\x12\x19\n" +
+	"\bshard_id\x18\x01 \x01(\tR\ashardId\x12\x12\n" +
+	"\x04keys\x18\x02 \x03(\tR\x04keys\"e\n" +
+	"\rKeyDependency\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x1e\n" +
+	"\vowner_tx_id\x18\x02 \x01(\tR\townerTxId\x12\"\n" +
+	"\rreader_tx_ids\x18\x03 \x03(\tR\vreaderTxIds\"c\n" +
+	"\x17DependencyQueryResponse\x12\x1d\n" +
+	"\n" +
+	"read_index\x18\x01 \x01(\x04R\treadIndex\x12)\n" +
+	"\x04keys\x18\x02 \x03(\v2\x15.protos.KeyDependencyR\x04keys*O\n" +
+	"\x13MembershipOperation\x12\x0f\n" +
+	"\vADD_REPLICA\x10\x00\x12\x12\n" +
+	"\x0eREMOVE_REPLICA\x10\x01\x12\x13\n" +
+	"\x0fREPLACE_REPLICA\x10\x02*6\n" +
+	"\x0eDependencyKind\x12\b\n" +
+	"\x04READ\x10\x00\x12\t\n" +
+	"\x05WRITE\x10\x01\x12\x0f\n" +
+	"\vWRITE_WRITE\x10\x022\xea\x02\n" +
 	"\x12ShardCommunication\x128\n" +
-	"\x04Step\x12\x18.protos.RaftMessageProto\x1a\x14.protos.StepResponse\"\x00B=Z;github.com/hyperledger/fabric/core/endorser/sharding/protosb\x06proto3"
+	"\x04Step\x12\x18.protos.RaftMessageProto\x1a\x14.protos.StepResponse\"\x00\x12>\n" +
+	"\x06Stream\x12\x18.protos.RaftMessageProto\x1a\x14.protos.StepResponse\"\x00(\x010\x01\x12K\n" +
+	"\x10ChangeMembership\x12\x19.protos.MembershipRequest\x1a\x1a.protos.MembershipResponse\"\x00\x12<\n" +
+	"\aForward\x12\x16.protos.ForwardRequest\x1a\x17.protos.ForwardResponse\"\x00\x12O\n" +
+	"\x11QueryDependencies\x12\x17.protos.DependencyQuery\x1a\x1f.protos.DependencyQueryResponse\"\x00B=Z;github.com/hyperledger/fabric/core/endorser/sharding/protosb\x06proto3"
 
 var (
 	file_core_endorser_sharding_protos_shard_proto_rawDescOnce sync.Once
@@ -143,19 +1140,50 @@ func file_core_endorser_sharding_protos_shard_proto_rawDescGZIP() []byte {
 	return file_core_endorser_sharding_protos_shard_proto_rawDescData
 }
 
-var file_core_endorser_sharding_protos_shard_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_core_endorser_sharding_protos_shard_proto_enumTypes = make([]protoimpl.EnumInfo, 2)
+var file_core_endorser_sharding_protos_shard_proto_msgTypes = make([]protoimpl.MessageInfo, 14)
 var file_core_endorser_sharding_protos_shard_proto_goTypes = []any{
-	(*RaftMessageProto)(nil), // 0: protos.RaftMessageProto
-	(*StepResponse)(nil),     // 1: protos.StepResponse
+	(MembershipOperation)(0),        // 0: protos.MembershipOperation
+	(DependencyKind)(0),             // 1: protos.DependencyKind
+	(*RaftMessageProto)(nil),        // 2: protos.RaftMessageProto
+	(*StepResponse)(nil),            // 3: protos.StepResponse
+	(*ReplicaInfo)(nil),             // 4: protos.ReplicaInfo
+	(*MembershipRequest)(nil),       // 5: protos.MembershipRequest
+	(*MembershipResponse)(nil),      // 6: protos.MembershipResponse
+	(*Dependency)(nil),              // 7: protos.Dependency
+	(*PrepareProofPayload)(nil),     // 8: protos.PrepareProofPayload
+	(*DependencyInfo)(nil),          // 9: protos.DependencyInfo
+	(*DecoratedEndorsement)(nil),    // 10: protos.DecoratedEndorsement
+	(*ForwardRequest)(nil),          // 11: protos.ForwardRequest
+	(*ForwardResponse)(nil),         // 12: protos.ForwardResponse
+	(*DependencyQuery)(nil),         // 13: protos.DependencyQuery
+	(*KeyDependency)(nil),           // 14: protos.KeyDependency
+	(*DependencyQueryResponse)(nil), // 15: protos.DependencyQueryResponse
 }
 var file_core_endorser_sharding_protos_shard_proto_depIdxs = []int32{
-	0, // 0: protos.ShardCommunication.Step:input_type -> protos.RaftMessageProto
-	1, // 1: protos.ShardCommunication.Step:output_type -> protos.StepResponse
-	1, // [1:2] is the sub-list for method output_type
-	0, // [0:1] is the sub-list for method input_type
-	0, // [0:0] is the sub-list for extension type_name
-	0, // [0:0] is the sub-list for extension extendee
-	0, // [0:0] is the sub-list for field type_name
+	0,  // 0: protos.MembershipRequest.operation:type_name -> protos.MembershipOperation
+	4,  // 1: protos.MembershipRequest.replica:type_name -> protos.ReplicaInfo
+	1,  // 2: protos.Dependency.kind:type_name -> protos.DependencyKind
+	7,  // 3: protos.PrepareProofPayload.dependencies:type_name -> protos.Dependency
+	7,  // 4: protos.DependencyInfo.dependencies:type_name -> protos.Dependency
+	9,  // 5: protos.DecoratedEndorsement.dependency_info:type_name -> protos.DependencyInfo
+	9,  // 6: protos.ForwardResponse.proofs:type_name -> protos.DependencyInfo
+	14, // 7: protos.DependencyQueryResponse.keys:type_name -> protos.KeyDependency
+	2,  // 8: protos.ShardCommunication.Step:input_type -> protos.RaftMessageProto
+	2,  // 9: protos.ShardCommunication.Stream:input_type -> protos.RaftMessageProto
+	5,  // 10: protos.ShardCommunication.ChangeMembership:input_type -> protos.MembershipRequest
+	11, // 11: protos.ShardCommunication.Forward:input_type -> protos.ForwardRequest
+	13, // 12: protos.ShardCommunication.QueryDependencies:input_type -> protos.DependencyQuery
+	3,  // 13: protos.ShardCommunication.Step:output_type -> protos.StepResponse
+	3,  // 14: protos.ShardCommunication.Stream:output_type -> protos.StepResponse
+	6,  // 15: protos.ShardCommunication.ChangeMembership:output_type -> protos.MembershipResponse
+	12, // 16: protos.ShardCommunication.Forward:output_type -> protos.ForwardResponse
+	15, // 17: protos.ShardCommunication.QueryDependencies:output_type -> protos.DependencyQueryResponse
+	13, // [13:18] is the sub-list for method output_type
+	8,  // [8:13] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_core_endorser_sharding_protos_shard_proto_init() }
@@ -168,13 +1196,14 @@ func file_core_endorser_sharding_protos_shard_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_core_endorser_sharding_protos_shard_proto_rawDesc), len(file_core_endorser_sharding_protos_shard_proto_rawDesc)),
-			NumEnums:      0,
-			NumMessages:   2,
+			NumEnums:      2,
+			NumMessages:   14,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
 		GoTypes:           file_core_endorser_sharding_protos_shard_proto_goTypes,
 		DependencyIndexes: file_core_endorser_sharding_protos_shard_proto_depIdxs,
+		EnumInfos:         file_core_endorser_sharding_protos_shard_proto_enumTypes,
 		MessageInfos:      file_core_endorser_sharding_protos_shard_proto_msgTypes,
 	}.Build()
 	File_core_endorser_sharding_protos_shard_proto = out.File
@@ -19,7 +19,11 @@ import (
 const _ = grpc.SupportPackageIsVersion7
 
 const (
-	ShardCommunication_Step_FullMethodName = "/protos.ShardCommunication/Step"
+	ShardCommunication_Step_FullMethodName              = "/protos.ShardCommunication/Step"
+	ShardCommunication_Stream_FullMethodName            = "/protos.ShardCommunication/Stream"
+	ShardCommunication_ChangeMembership_FullMethodName  = "/protos.ShardCommunication/ChangeMembership"
+	ShardCommunication_Forward_FullMethodName           = "/protos.ShardCommunication/Forward"
+	ShardCommunication_QueryDependencies_FullMethodName = "/protos.ShardCommunication/QueryDependencies"
 )
 
 // ShardCommunicationClient is the client API for ShardCommunication service.
@@ -28,6 +32,20 @@ const (
 type ShardCommunicationClient interface {
 	// Step passes a Raft message to the recipient node
 	Step(ctx context.Context, in *RaftMessageProto, opts ...grpc.CallOption) (*StepResponse, error)
+	// Stream passes the Raft messages of a sender to the recipient node in
+	// the order they are sent. The recipient only responds to messages it
+	// fails to step.
+	Stream(ctx context.Context, opts ...grpc.CallOption) (ShardCommunication_StreamClient, error)
+	// ChangeMembership adds, removes or replaces a replica of a shard. It
+	// must be sent to the leader of the shard and returns once the change is
+	// applied.
+	ChangeMembership(ctx context.Context, in *MembershipRequest, opts ...grpc.CallOption) (*MembershipResponse, error)
+	// Forward prepares a batch of prepare requests received by a follower on
+	// the leader of the shard and returns the proofs of the leader
+	Forward(ctx context.Context, in *ForwardRequest, opts ...grpc.CallOption) (*ForwardResponse, error)
+	// QueryDependencies returns the transactions that own or read keys of a
+	// shard, as of a linearizable read of the shard
+	QueryDependencies(ctx context.Context, in *DependencyQuery, opts ...grpc.CallOption) (*DependencyQueryResponse, error)
 }
 
 type shardCommunicationClient struct {
@@ -47,12 +65,84 @@ func (c *shardCommunicationClient) Step(ctx context.Context, in *RaftMessageProt
 	return out, nil
 }
 
+func (c *shardCommunicationClient) Stream(ctx context.Context, opts ...grpc.CallOption) (ShardCommunication_StreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &ShardCommunication_ServiceDesc.Streams[0], ShardCommunication_Stream_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &shardCommunicationStreamClient{stream}
+	return x, nil
+}
+
+type ShardCommunication_StreamClient interface {
+	Send(*RaftMessageProto) error
+	Recv() (*StepResponse, error)
+	grpc.ClientStream
+}
+
+type shardCommunicationStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *shardCommunicationStreamClient) Send(m *RaftMessageProto) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *shardCommunicationStreamClient) Recv() (*StepResponse, error) {
+	m := new(StepResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *shardCommunicationClient) ChangeMembership(ctx context.Context, in *MembershipRequest, opts ...grpc.CallOption) (*MembershipResponse, error) {
+	out := new(MembershipResponse)
+	err := c.cc.Invoke(ctx, ShardCommunication_ChangeMembership_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardCommunicationClient) Forward(ctx context.Context, in *ForwardRequest, opts ...grpc.CallOption) (*ForwardResponse, error) {
+	out := new(ForwardResponse)
+	err := c.cc.Invoke(ctx, ShardCommunication_Forward_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *shardCommunicationClient) QueryDependencies(ctx context.Context, in *DependencyQuery, opts ...grpc.CallOption) (*DependencyQueryResponse, error) {
+	out := new(DependencyQueryResponse)
+	err := c.cc.Invoke(ctx, ShardCommunication_QueryDependencies_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 // ShardCommunicationServer is the server API for ShardCommunication service.
 // All implementations must embed UnimplementedShardCommunicationServer
 // for forward compatibility
 type ShardCommunicationServer interface {
 	// Step passes a Raft message to the recipient node
 	Step(context.Context, *RaftMessageProto) (*StepResponse, error)
+	// Stream passes the Raft messages of a sender to the recipient node in
+	// the order they are sent. The recipient only responds to messages it
+	// fails to step.
+	Stream(ShardCommunication_StreamServer) error
+	// ChangeMembership adds, removes or replaces a replica of a shard. It
+	// must be sent to the leader of the shard and returns once the change is
+	// applied.
+	ChangeMembership(context.Context, *MembershipRequest) (*MembershipResponse, error)
+	// Forward prepares a batch of prepare requests received by a follower on
+	// the leader of the shard and returns the proofs of the leader
+	Forward(context.Context, *ForwardRequest) (*ForwardResponse, error)
+	// QueryDependencies returns the transactions that own or read keys of a
+	// shard, as of a linearizable read of the shard
+	QueryDependencies(context.Context, *DependencyQuery) (*DependencyQueryResponse, error)
 	mustEmbedUnimplementedShardCommunicationServer()
 }
 
@@ -63,6 +153,18 @@ type UnimplementedShardCommunicationServer struct {
 func (UnimplementedShardCommunicationServer) Step(context.Context, *RaftMessageProto) (*StepResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Step not implemented")
 }
+func (UnimplementedShardCommunicationServer) Stream(ShardCommunication_StreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method Stream not implemented")
+}
+func (UnimplementedShardCommunicationServer) ChangeMembership(context.Context, *MembershipRequest) (*MembershipResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ChangeMembership not implemented")
+}
+func (UnimplementedShardCommunicationServer) Forward(context.Context, *ForwardRequest) (*ForwardResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Forward not implemented")
+}
+func (UnimplementedShardCommunicationServer) QueryDependencies(context.Context, *DependencyQuery) (*DependencyQueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryDependencies not implemented")
+}
 func (UnimplementedShardCommunicationServer) mustEmbedUnimplementedShardCommunicationServer() {}
 
 // UnsafeShardCommunicationServer may be embedded to opt out of forward compatibility for this service.
@@ -94,6 +196,86 @@ func _ShardCommunication_Step_Handler(srv interface{}, ctx context.Context, dec
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ShardCommunication_Stream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(ShardCommunicationServer).Stream(&shardCommunicationStreamServer{stream})
+}
+
+type ShardCommunication_StreamServer interface {
+	Send(*StepResponse) error
+	Recv() (*RaftMessageProto, error)
+	grpc.ServerStream
+}
+
+type shardCommunicationStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *shardCommunicationStreamServer) Send(m *StepResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *shardCommunicationStreamServer) Recv() (*RaftMessageProto, error) {
+	m := new(RaftMessageProto)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func _ShardCommunication_ChangeMembership_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MembershipRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardCommunicationServer).ChangeMembership(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShardCommunication_ChangeMembership_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardCommunicationServer).ChangeMembership(ctx, req.(*MembershipRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShardCommunication_Forward_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ForwardRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardCommunicationServer).Forward(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShardCommunication_Forward_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardCommunicationServer).Forward(ctx, req.(*ForwardRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ShardCommunication_QueryDependencies_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DependencyQuery)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ShardCommunicationServer).QueryDependencies(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ShardCommunication_QueryDependencies_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ShardCommunicationServer).QueryDependencies(ctx, req.(*DependencyQuery))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 // ShardCommunication_ServiceDesc is the grpc.ServiceDesc for ShardCommunication service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -105,7 +287,26 @@ var ShardCommunication_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Step",
 			Handler:    _ShardCommunication_Step_Handler,
 		},
+		{
+			MethodName: "ChangeMembership",
+			Handler:    _ShardCommunication_ChangeMembership_Handler,
+		},
+		{
+			MethodName: "Forward",
+			Handler:    _ShardCommunication_Forward_Handler,
+		},
+		{
+			MethodName: "QueryDependencies",
+			Handler:    _ShardCommunication_QueryDependencies_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Stream",
+			Handler:       _ShardCommunication_Stream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "core/endorser/sharding/protos/shard.proto",
 }
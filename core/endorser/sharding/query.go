@@ -0,0 +1,145 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/raft/v3"
+)
+
+// KeyDependency is the dependency state of a key of a shard
+type KeyDependency struct {
+	Key string `json:"key"`
+	// OwnerTxID is the last transaction that wrote the key and is neither
+	// committed nor aborted, empty if there is none
+	OwnerTxID string `json:"ownerTxID,omitempty"`
+	// ReaderTxIDs are the transactions that read the key since it was last
+	// written
+	ReaderTxIDs []string `json:"readerTxIDs,omitempty"`
+}
+
+// DependencyQueryResult is the dependency state of the queried keys as of
+// ReadIndex
+type DependencyQueryResult struct {
+	// ReadIndex is the commit index of the shard the keys were read at
+	ReadIndex uint64
+	// Keys holds the state of every queried key, in the order of the query
+	Keys []KeyDependency
+}
+
+// QueryDependencies returns the transactions that own or read the keys,
+// without proposing anything to the shard. The read is linearizable: it
+// reflects every prepare committed by the shard before the query started,
+// on the leader as well as on a follower. Without leader, the query ends
+// with the context and a NoLeaderError.
+func (sl *ShardLeader) QueryDependencies(ctx context.Context, keys []string) (*DependencyQueryResult, error) {
+	index, err := sl.readIndex(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := sl.waitApplied(ctx, index); err != nil {
+		return nil, err
+	}
+
+	sl.variableMapLock.RLock()
+	defer sl.variableMapLock.RUnlock()
+
+	result := &DependencyQueryResult{ReadIndex: index, Keys: make([]KeyDependency, len(keys))}
+	for i, key := range keys {
+		result.Keys[i].Key = key
+		if depInfo, exists := sl.variableMap[key]; exists {
+			result.Keys[i].OwnerTxID = depInfo.DependentTxID
+			result.Keys[i].ReaderTxIDs = append([]string(nil), depInfo.ReaderTxIDs...)
+		}
+	}
+	return result, nil
+}
+
+// readIndex asks the leader of the shard for its commit index, which the
+// leader confirms it still leads the shard at with a quorum of heartbeats
+func (sl *ShardLeader) readIndex(ctx context.Context) (uint64, error) {
+	rctx := make([]byte, 8)
+	binary.BigEndian.PutUint64(rctx, rand.Uint64())
+	indexC := make(chan uint64, 1)
+
+	sl.waitersLock.Lock()
+	sl.readWaiters[string(rctx)] = indexC
+	sl.waitersLock.Unlock()
+	defer func() {
+		sl.waitersLock.Lock()
+		delete(sl.readWaiters, string(rctx))
+		sl.waitersLock.Unlock()
+	}()
+
+	// raft drops the request while the shard has no leader, in which case
+	// the wait ends with the context
+	if err := sl.node.ReadIndex(ctx, rctx); err != nil {
+		return 0, errors.WithMessagef(sl.waitError(ctx), "failed to request read index of shard %s", sl.shardID)
+	}
+
+	select {
+	case index := <-indexC:
+		return index, nil
+	case <-ctx.Done():
+		return 0, errors.WithMessagef(sl.waitError(ctx), "no read index for shard %s", sl.shardID)
+	case <-sl.stopC:
+		return 0, ErrShardStopped
+	}
+}
+
+// deliverReadStates hands the read indexes confirmed by the leader to the
+// waiting queries
+func (sl *ShardLeader) deliverReadStates(readStates []raft.ReadState) {
+	sl.waitersLock.Lock()
+	defer sl.waitersLock.Unlock()
+
+	for _, rs := range readStates {
+		if indexC, ok := sl.readWaiters[string(rs.RequestCtx)]; ok {
+			delete(sl.readWaiters, string(rs.RequestCtx))
+			indexC <- rs.Index
+		}
+	}
+}
+
+// publishApplied records the entries applied by the raft loop and wakes up
+// the queries waiting for them
+func (sl *ShardLeader) publishApplied() {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	if sl.appliedIndex == sl.commitIndex {
+		return
+	}
+	sl.appliedIndex = sl.commitIndex
+	close(sl.appliedC)
+	sl.appliedC = make(chan struct{})
+}
+
+// waitApplied waits until the entries up to index are applied to the
+// dependency map
+func (sl *ShardLeader) waitApplied(ctx context.Context, index uint64) error {
+	for {
+		sl.mu.RLock()
+		applied, appliedC := sl.appliedIndex, sl.appliedC
+		sl.mu.RUnlock()
+		if applied >= index {
+			return nil
+		}
+
+		select {
+		case <-appliedC:
+		case <-ctx.Done():
+			return errors.WithMessagef(ctx.Err(), "shard %s did not apply read index %d, applied %d", sl.shardID, index, applied)
+		case <-sl.stopC:
+			return ErrShardStopped
+		}
+	}
+}
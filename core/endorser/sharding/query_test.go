@@ -0,0 +1,96 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("QueryDependencies", func() {
+	It("reads the owners of keys on a follower without proposing", func() {
+		addresses := []string{freeAddress(), freeAddress()}
+		var leaders []*sharding.ShardLeader
+		for id := uint64(1); id <= 2; id++ {
+			leader, err := sharding.NewShardLeader(sharding.ShardConfig{
+				ShardID:      "registry",
+				ReplicaNodes: addresses,
+				ReplicaID:    id,
+			}, 10*time.Millisecond, 20)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(leader.Stop)
+
+			peers := sharding.PeerConfig{1: addresses[0], 2: addresses[1]}
+			delete(peers, id)
+			transport := sharding.NewTransport(id, peers, sharding.TransportConfig{}, nil)
+			transport.AddShard(leader)
+			Expect(transport.Start(addresses[id-1])).To(Succeed())
+			DeferCleanup(transport.Stop)
+			leaders = append(leaders, leader)
+		}
+
+		proof, err := leaders[0].Prepare(electionContext(), &sharding.PrepareRequest{
+			TxID:      "tx1",
+			WriteSet:  map[string][]byte{"registry:key1": []byte("value1")},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		_, err = leaders[0].Prepare(electionContext(), &sharding.PrepareRequest{
+			TxID:      "tx2",
+			ReadSet:   map[string][]byte{"registry:key1": nil},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		follower := leaders[2-proof.LeaderID]
+
+		result, err := follower.QueryDependencies(electionContext(), []string{"registry:key1", "registry:key2"})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.ReadIndex).To(BeNumerically(">", proof.CommitIndex))
+		Expect(result.Keys).To(Equal([]sharding.KeyDependency{
+			{Key: "registry:key1", OwnerTxID: "tx1", ReaderTxIDs: []string{"tx2"}},
+			{Key: "registry:key2"},
+		}))
+
+		conn, err := comm.ClientConfig{DialTimeout: time.Second}.Dial(addresses[proof.LeaderID-1])
+		Expect(err).NotTo(HaveOccurred())
+		defer conn.Close()
+		client := protos.NewShardCommunicationClient(conn)
+
+		resp, err := client.QueryDependencies(electionContext(), &protos.DependencyQuery{ShardId: "registry", Keys: []string{"registry:key1"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(resp.Keys).To(HaveLen(1))
+		Expect(resp.Keys[0].OwnerTxId).To(Equal("tx1"))
+		Expect(resp.Keys[0].ReaderTxIds).To(Equal([]string{"tx2"}))
+
+		_, err = client.QueryDependencies(electionContext(), &protos.DependencyQuery{ShardId: "unknown"})
+		Expect(status.Code(err)).To(Equal(codes.NotFound))
+	})
+
+	It("tells the caller to retry when the shard has no leader", func() {
+		leader, err := sharding.NewShardLeader(sharding.ShardConfig{
+			ShardID:      "registry",
+			ReplicaNodes: []string{"node1", "node2"},
+			ReplicaID:    1,
+		}, 10*time.Millisecond, 20)
+		Expect(err).NotTo(HaveOccurred())
+		defer leader.Stop()
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		_, err = leader.QueryDependencies(ctx, []string{"registry:key1"})
+		Expect(errors.Cause(err)).To(BeAssignableToTypeOf(&sharding.NoLeaderError{}))
+	})
+})
@@ -0,0 +1,130 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/pkg/errors"
+)
+
+const (
+	// URLBaseV1 is the base of the routes of the sharding API served on the
+	// operations endpoint of the peer
+	URLBaseV1       = "/sharding/v1/"
+	URLBaseV1Shards = URLBaseV1 + "shards"
+
+	// DefaultDumpLimit is the number of dependency entries returned by a dump
+	// that does not set a limit
+	DefaultDumpLimit = 1000
+
+	shardIDKey              = "shardID"
+	urlWithShardIDKey       = URLBaseV1Shards + "/{" + shardIDKey + "}"
+	urlWithShardIDKeyDeps   = urlWithShardIDKey + "/dependencies"
+	prefixQueryParam        = "prefix"
+	limitQueryParam         = "limit"
+	contentTypeHeader       = "Content-Type"
+	contentTypeJSON         = "application/json"
+	cacheControlHeader      = "Cache-Control"
+	cacheControlHeaderValue = "no-store"
+)
+
+// ErrorResponse is the body of the responses of the sharding API that fail
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+// HTTPHandler serves the sharding API, which lets operators inspect the
+// shards hosted by the peer:
+//
+//	GET /sharding/v1/shards                                         the shards and their raft state
+//	GET /sharding/v1/shards/{shardID}                               the raft state of a shard
+//	GET /sharding/v1/shards/{shardID}/dependencies?prefix=&limit=   the dependency entries of a shard
+type HTTPHandler struct {
+	manager *ShardManager
+	router  *mux.Router
+}
+
+// NewHTTPHandler returns the handler of the sharding API of the shards of the
+// manager
+func NewHTTPHandler(manager *ShardManager) *HTTPHandler {
+	handler := &HTTPHandler{
+		manager: manager,
+		router:  mux.NewRouter(),
+	}
+
+	handler.router.HandleFunc(URLBaseV1Shards, handler.serveListAll).Methods(http.MethodGet)
+	handler.router.HandleFunc(URLBaseV1Shards, handler.serveNotAllowed)
+	handler.router.HandleFunc(urlWithShardIDKey, handler.serveListOne).Methods(http.MethodGet)
+	handler.router.HandleFunc(urlWithShardIDKey, handler.serveNotAllowed)
+	handler.router.HandleFunc(urlWithShardIDKeyDeps, handler.serveDependencies).Methods(http.MethodGet)
+	handler.router.HandleFunc(urlWithShardIDKeyDeps, handler.serveNotAllowed)
+
+	return handler
+}
+
+func (h *HTTPHandler) ServeHTTP(resp http.ResponseWriter, req *http.Request) {
+	h.router.ServeHTTP(resp, req)
+}
+
+// List all shards
+func (h *HTTPHandler) serveListAll(resp http.ResponseWriter, req *http.Request) {
+	h.sendResponseOK(resp, h.manager.ShardList())
+}
+
+// List a single shard
+func (h *HTTPHandler) serveListOne(resp http.ResponseWriter, req *http.Request) {
+	shard, err := h.manager.Shard(mux.Vars(req)[shardIDKey])
+	if err != nil {
+		h.sendResponseJSONError(resp, http.StatusNotFound, err)
+		return
+	}
+	h.sendResponseOK(resp, shard.Info())
+}
+
+// Dump the dependency entries of a shard for a key prefix
+func (h *HTTPHandler) serveDependencies(resp http.ResponseWriter, req *http.Request) {
+	shard, err := h.manager.Shard(mux.Vars(req)[shardIDKey])
+	if err != nil {
+		h.sendResponseJSONError(resp, http.StatusNotFound, err)
+		return
+	}
+
+	limit := DefaultDumpLimit
+	if value := req.URL.Query().Get(limitQueryParam); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			h.sendResponseJSONError(resp, http.StatusBadRequest, errors.Errorf("invalid limit %q", value))
+			return
+		}
+	}
+	h.sendResponseOK(resp, shard.DumpDependencies(req.URL.Query().Get(prefixQueryParam), limit))
+}
+
+func (h *HTTPHandler) serveNotAllowed(resp http.ResponseWriter, req *http.Request) {
+	resp.Header().Set("Allow", http.MethodGet)
+	h.sendResponseJSONError(resp, http.StatusMethodNotAllowed, errors.Errorf("invalid request method: %s", req.Method))
+}
+
+func (h *HTTPHandler) sendResponseJSONError(resp http.ResponseWriter, code int, err error) {
+	resp.Header().Set(contentTypeHeader, contentTypeJSON)
+	resp.WriteHeader(code)
+	if err := json.NewEncoder(resp).Encode(&ErrorResponse{Error: err.Error()}); err != nil {
+		logger.Errorf("failed to encode error, err: %s", err)
+	}
+}
+
+func (h *HTTPHandler) sendResponseOK(resp http.ResponseWriter, content interface{}) {
+	resp.Header().Set(contentTypeHeader, contentTypeJSON)
+	resp.Header().Set(cacheControlHeader, cacheControlHeaderValue)
+	resp.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(resp).Encode(content); err != nil {
+		logger.Errorf("failed to encode content, err: %s", err)
+	}
+}
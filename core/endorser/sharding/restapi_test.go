@@ -0,0 +1,106 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("HTTPHandler", func() {
+	var (
+		manager *sharding.ShardManager
+		handler *sharding.HTTPHandler
+	)
+
+	BeforeEach(func() {
+		manager = sharding.NewShardManager("", nil, nil, map[string]sharding.ShardConfig{
+			"registry": {ShardID: "registry", ReplicaNodes: []string{"node1"}, ReplicaID: 1},
+			"callee":   {ShardID: "callee", ReplicaNodes: []string{"node1"}, ReplicaID: 1},
+		}, nil)
+		handler = sharding.NewHTTPHandler(manager)
+
+		shard, err := manager.GetOrCreateShard("registry")
+		Expect(err).NotTo(HaveOccurred())
+		for _, req := range []*sharding.PrepareRequest{
+			{TxID: "tx1", WriteSet: map[string][]byte{"registry:apple": []byte("1"), "registry:banana": []byte("1")}},
+			{TxID: "tx2", ReadSet: map[string][]byte{"registry:apple": nil}, WriteSet: map[string][]byte{"other:cherry": []byte("1")}},
+		} {
+			req.Timestamp = time.Now()
+			_, err := shard.Prepare(electionContext(), req)
+			Expect(err).NotTo(HaveOccurred())
+		}
+	})
+
+	AfterEach(func() {
+		manager.Shutdown()
+	})
+
+	get := func(url string, content interface{}) *httptest.ResponseRecorder {
+		resp := httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, url, nil))
+		if content != nil {
+			Expect(json.Unmarshal(resp.Body.Bytes(), content)).To(Succeed())
+		}
+		return resp
+	}
+
+	It("lists the shards and their state", func() {
+		var list sharding.ShardList
+		resp := get("/sharding/v1/shards", &list)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(resp.Header().Get("Content-Type")).To(Equal("application/json"))
+		Expect(list.Shards).To(HaveLen(2))
+		Expect(list.Shards[0].ShardID).To(Equal("callee"))
+
+		var info sharding.ShardInfo
+		resp = get("/sharding/v1/shards/registry", &info)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(info.State).To(Equal("StateLeader"))
+		Expect(info.Leader).To(Equal(uint64(1)))
+		Expect(info.Voters).To(Equal([]uint64{1}))
+		Expect(info.Term).NotTo(BeZero())
+		Expect(info.AppliedIndex).To(Equal(info.CommitIndex))
+		Expect(info.DependencyEntries).To(Equal(3))
+		Expect(info.QueueDepth).To(BeZero())
+
+		var errResp sharding.ErrorResponse
+		resp = get("/sharding/v1/shards/unknown", &errResp)
+		Expect(resp.Code).To(Equal(http.StatusNotFound))
+		Expect(errResp.Error).To(Equal("shard unknown: shard does not exist"))
+	})
+
+	It("dumps the dependency entries of a key prefix", func() {
+		var dump sharding.DependencyDump
+		resp := get("/sharding/v1/shards/registry/dependencies?prefix=registry:", &dump)
+		Expect(resp.Code).To(Equal(http.StatusOK))
+		Expect(dump.Truncated).To(BeFalse())
+		Expect(dump.Entries).To(Equal([]sharding.KeyDependency{
+			{Key: "registry:apple", OwnerTxID: "tx1", ReaderTxIDs: []string{"tx2"}},
+			{Key: "registry:banana", OwnerTxID: "tx1"},
+		}))
+
+		dump = sharding.DependencyDump{}
+		get("/sharding/v1/shards/registry/dependencies?limit=1", &dump)
+		Expect(dump.Entries).To(HaveLen(1))
+		Expect(dump.Entries[0].Key).To(Equal("other:cherry"))
+		Expect(dump.Truncated).To(BeTrue())
+
+		resp = get("/sharding/v1/shards/registry/dependencies?limit=many", nil)
+		Expect(resp.Code).To(Equal(http.StatusBadRequest))
+
+		resp = httptest.NewRecorder()
+		handler.ServeHTTP(resp, httptest.NewRequest(http.MethodDelete, "/sharding/v1/shards/registry", nil))
+		Expect(resp.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+})
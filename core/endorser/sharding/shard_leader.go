@@ -8,29 +8,70 @@ package sharding
 
 import (
 	"context"
-	"fmt"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/internal/pkg/identity"
+	"github.com/pkg/errors"
 	"go.etcd.io/etcd/raft/v3"
 	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/wal"
 )
 
 var logger = flogging.MustGetLogger("endorser.sharding")
 
+var (
+	// ErrShardStopped is returned when a request is made to a stopped shard
+	ErrShardStopped = errors.New("shard is stopped")
+	// ErrPrepareInProgress is returned when a prepare is already pending for the same transaction
+	ErrPrepareInProgress = errors.New("prepare already in progress for transaction")
+	// ErrNotLeader is returned when a membership change is requested from a
+	// replica that is not the leader of the shard
+	ErrNotLeader = errors.New("replica is not the leader of the shard")
+)
+
 const (
 	DefaultBatchMaxSize   = 20
 	DefaultBatchTimeout   = 300 * time.Millisecond
 	DefaultExpiryDuration = 5 * time.Minute
+	// DefaultExpiryBlocks is the number of blocks notified to a shard after
+	// which a prepared transaction that was neither committed nor aborted is
+	// rolled back
+	DefaultExpiryBlocks = 100
+
+	// tickInterval is the duration of a raft tick
+	tickInterval = 100 * time.Millisecond
+	// electionTick is the number of ticks without a leader after which a
+	// replica starts an election
+	electionTick = 50
+
+	// maxOwnerHistory bounds the number of previous owners kept per key for
+	// rolling back aborted transactions
+	maxOwnerHistory = 16
 )
 
 // TransactionDependencyInfo represents information about a transaction dependency
 type TransactionDependencyInfo struct {
 	Value         []byte
 	DependentTxID string
-	ExpiryTime    time.Time
 	HasDependency bool
+	// ReaderTxIDs are the transactions that read the key since it was last written
+	ReaderTxIDs []string `json:",omitempty"`
+	// Previous is the state of the key before DependentTxID wrote it. It is
+	// restored if DependentTxID is aborted.
+	Previous *TransactionDependencyInfo `json:",omitempty"`
+}
+
+// Dependency is a conflict between a transaction and an earlier transaction
+// on a single key
+type Dependency struct {
+	Key  string
+	TxID string
+	Kind protos.DependencyKind
 }
 
 // ShardConfig represents configuration for a contract shard
@@ -38,6 +79,33 @@ type ShardConfig struct {
 	ShardID      string
 	ReplicaNodes []string
 	ReplicaID    uint64
+	// Join is set on a replica added to a running shard with AddReplica.
+	// The replica starts without members, ignoring ReplicaNodes, and learns
+	// the membership and the state of the shard from its leader.
+	Join bool
+	// WALDir and SnapDir hold the shard's raft log and snapshots.
+	// If WALDir is empty the shard keeps its state in memory only.
+	WALDir  string
+	SnapDir string
+	// SnapshotInterval is the number of applied entries between snapshots
+	SnapshotInterval uint64
+	// Signer signs the proofs produced by this replica.
+	// Proofs are unsigned if it is nil.
+	Signer identity.SignerSerializer
+	// Metrics are updated by the shard if set
+	Metrics *Metrics
+	// Batch tunes how the shard batches its prepare requests. Its Timeout
+	// and MaxSize default to the arguments of NewShardLeader, its MaxBytes to
+	// DefaultBatchMaxBytes.
+	Batch BatchConfig
+	// Admission bounds the prepares the shard handles at once. It defaults
+	// to DefaultAdmissionConfig.
+	Admission AdmissionConfig
+	// ExpiryBlocks is the number of blocks notified to the shard after which
+	// a prepared transaction that was neither committed nor aborted is rolled
+	// back. It must be the same on every replica and defaults to
+	// DefaultExpiryBlocks.
+	ExpiryBlocks uint64
 }
 
 // PrepareRequest represents a dependency preparation request
@@ -47,50 +115,123 @@ type PrepareRequest struct {
 	ReadSet   map[string][]byte
 	WriteSet  map[string][]byte
 	Timestamp time.Time
+	// Priority is the admission lane of the request on the replica that
+	// receives it. It is not replicated.
+	Priority Priority
 }
 
-// PrepareProof represents a committed dependency entry
+// PrepareProof represents a committed dependency entry.
+// Signature is made by Signer over SignedBytes.
 type PrepareProof struct {
-	TxID        string
-	ShardID     string
-	CommitIndex uint64
-	LeaderID    uint64
-	Signature   []byte
-	Term        uint64
+	TxID           string
+	ShardID        string
+	CommitIndex    uint64
+	LeaderID       uint64
+	Term           uint64
+	HasDependency  bool
+	DependentTxIDs []string
+	Dependencies   []Dependency
+	Signer         []byte
+	Signature      []byte
 }
 
 // ShardLeader manages a Raft group for a specific contract
 type ShardLeader struct {
-	shardID         string
-	node            raft.Node
-	storage         *raft.MemoryStorage
-	peers           []raft.Peer
-	commitIndex     uint64
-	variableMap     map[string]TransactionDependencyInfo
-	variableMapLock sync.RWMutex
-	batchQueue      []*PrepareRequest
-	batchLock       sync.Mutex
-	batchTimeout    time.Duration
-	maxBatchSize    int
-	lastBatchTime   time.Time
-	proposeC        chan *PrepareRequest
-	commitC         chan *PrepareProof
-	errorC          chan error
-	stopC           chan struct{}
-	messagesC       chan []raftpb.Message
-	requestsHandled int64
-	mu              sync.RWMutex
-}
-
-// NewShardLeader creates a new Raft-based shard leader
+	shardID          string
+	replicaID        uint64
+	signer           identity.SignerSerializer
+	metrics          *Metrics
+	node             raft.Node
+	storage          *RaftStorage
+	peers            []raft.Peer
+	confState        raftpb.ConfState
+	replicas         map[uint64]Replica
+	replicaObserver  replicaObserver
+	confWaiters      map[uint64]chan struct{}
+	commitIndex      uint64
+	appliedIndex     uint64
+	appliedC         chan struct{}
+	snapshotIndex    uint64
+	snapshotInterval uint64
+	replayIndex      uint64
+	variableMap      map[string]TransactionDependencyInfo
+	prepared         map[string]*preparedTx
+	expiryQueue      []expiringTx
+	notifiedBlock    uint64
+	notifiedBlocks   uint64
+	expiryBlocks     uint64
+	variableMapLock  sync.RWMutex
+	batchQueue       []*PrepareRequest
+	batchBytes       int
+	batchLock        sync.Mutex
+	batch            BatchConfig
+	admission        AdmissionConfig
+	inFlight         int
+	prepareLatency   time.Duration
+	lastBatchTime    time.Time
+	proposeC         chan *PrepareRequest
+	commitC          chan *PrepareProof
+	waiters          map[string]chan prepareResult
+	forwarded        map[string]struct{}
+	flushedAt        map[string]time.Time
+	readWaiters      map[string]chan uint64
+	waitersLock      sync.Mutex
+	forwarder        batchForwarder
+	errorC           chan error
+	flushC           chan struct{}
+	stopC            chan struct{}
+	doneC            chan struct{}
+	messagesC        chan []raftpb.Message
+	requestsHandled  int64
+	mu               sync.RWMutex
+}
+
+// preparedTx is a transaction recorded in the dependency map
+type preparedTx struct {
+	// keys are the keys the transaction read or wrote
+	keys map[string]struct{}
+	// height is the number of blocks notified to the shard when the
+	// transaction was prepared
+	height uint64
+}
+
+// expiringTx is a prepared transaction in the order of expiry
+type expiringTx struct {
+	txID   string
+	height uint64
+}
+
+// NewShardLeader creates a new Raft-based shard leader.
+// If the shard has a WAL on disk, its dependency state is restored from the
+// latest snapshot and the remaining log entries are replayed on start.
 func NewShardLeader(config ShardConfig, batchTimeout time.Duration, maxBatchSize int) (*ShardLeader, error) {
-	storage := raft.NewMemoryStorage()
+	fresh := true
+	var storage *RaftStorage
+	if config.WALDir != "" {
+		if config.SnapDir == "" {
+			return nil, errors.Errorf("shard %s has a WAL directory but no snapshot directory", config.ShardID)
+		}
+		fresh = !wal.Exist(config.WALDir)
+
+		var err error
+		storage, err = CreateStorage(logger, config.WALDir, config.SnapDir)
+		if err != nil {
+			return nil, errors.WithMessagef(err, "failed to create storage for shard %s", config.ShardID)
+		}
+	} else {
+		storage = NewMemoryStorage(logger)
+	}
+
+	snapshotInterval := config.SnapshotInterval
+	if snapshotInterval == 0 {
+		snapshotInterval = DefaultSnapshotInterval
+	}
 
 	c := &raft.Config{
 		ID:              config.ReplicaID,
-		ElectionTick:    50, // Increase to 50 * 100ms = 5 seconds
-		HeartbeatTick:   5,  // Increase to 5 * 100ms = 0.5 seconds
-		Storage:         storage,
+		ElectionTick:    electionTick, // 50 * 100ms = 5 seconds
+		HeartbeatTick:   5,            // 5 * 100ms = 0.5 seconds
+		Storage:         storage.ram,
 		MaxSizePerMsg:   1024 * 1024,
 		MaxInflightMsgs: 256,
 	}
@@ -100,23 +241,86 @@ func NewShardLeader(config ShardConfig, batchTimeout time.Duration, maxBatchSize
 		peers = append(peers, raft.Peer{ID: uint64(i + 1)})
 	}
 
-	node := raft.StartNode(c, peers)
+	metrics := config.Metrics
+	if metrics == nil {
+		metrics = NewMetrics(&disabled.Provider{})
+	}
+
+	batch := config.Batch
+	if batch.Timeout == 0 {
+		batch.Timeout = batchTimeout
+	}
+	if batch.MaxSize == 0 {
+		batch.MaxSize = maxBatchSize
+	}
+	if batch.MaxBytes == 0 {
+		batch.MaxBytes = DefaultBatchMaxBytes
+	}
+
+	admission := config.Admission
+	if admission == (AdmissionConfig{}) {
+		admission = DefaultAdmissionConfig
+	}
+	expiryBlocks := config.ExpiryBlocks
+	if expiryBlocks == 0 {
+		expiryBlocks = DefaultExpiryBlocks
+	}
+	// admitted prepares never wait to be queued
+	proposeCapacity := 1000
+	if admitted := admission.MaxInFlight + admission.PriorityReserve; admitted > proposeCapacity {
+		proposeCapacity = admitted
+	}
 
 	sl := &ShardLeader{
-		shardID:       config.ShardID,
-		node:          node,
-		storage:       storage,
-		peers:         peers,
-		variableMap:   make(map[string]TransactionDependencyInfo),
-		batchQueue:    make([]*PrepareRequest, 0, maxBatchSize),
-		batchTimeout:  batchTimeout,
-		maxBatchSize:  maxBatchSize,
-		lastBatchTime: time.Now(),
-		proposeC:      make(chan *PrepareRequest, 1000),
-		commitC:       make(chan *PrepareProof, 1000),
-		errorC:        make(chan error, 10),
-		stopC:         make(chan struct{}),
-		messagesC:     make(chan []raftpb.Message, 100),
+		shardID:          config.ShardID,
+		replicaID:        config.ReplicaID,
+		signer:           config.Signer,
+		metrics:          metrics,
+		storage:          storage,
+		peers:            peers,
+		replicas:         make(map[uint64]Replica),
+		confWaiters:      make(map[uint64]chan struct{}),
+		snapshotInterval: snapshotInterval,
+		variableMap:      make(map[string]TransactionDependencyInfo),
+		prepared:         make(map[string]*preparedTx),
+		expiryBlocks:     expiryBlocks,
+		batchQueue:       make([]*PrepareRequest, 0, batch.MaxSize),
+		batch:            batch,
+		admission:        admission,
+		lastBatchTime:    time.Now(),
+		proposeC:         make(chan *PrepareRequest, proposeCapacity),
+		commitC:          make(chan *PrepareProof, 1000),
+		waiters:          make(map[string]chan prepareResult),
+		forwarded:        make(map[string]struct{}),
+		flushedAt:        make(map[string]time.Time),
+		readWaiters:      make(map[string]chan uint64),
+		appliedC:         make(chan struct{}),
+		errorC:           make(chan error, 10),
+		flushC:           make(chan struct{}, 1),
+		stopC:            make(chan struct{}),
+		doneC:            make(chan struct{}),
+		messagesC:        make(chan []raftpb.Message, 100),
+	}
+
+	if fresh && config.Join {
+		// the leader sends the membership with the log or a snapshot
+		sl.node = raft.RestartNode(c)
+	} else if fresh {
+		sl.node = raft.StartNode(c, peers)
+	} else {
+		if snapshot := storage.Snapshot(); !raft.IsEmptySnap(snapshot) {
+			if err := sl.restoreSnapshot(snapshot); err != nil {
+				storage.Close()
+				return nil, errors.WithMessagef(err, "failed to restore snapshot for shard %s", config.ShardID)
+			}
+			c.Applied = snapshot.Metadata.Index
+		}
+		// entries up to the persisted commit index were applied before the
+		// restart; they are replayed into the dependency map without proofs
+		sl.replayIndex = storage.HardState().Commit
+		logger.Infof("Restarting shard %s from snapshot index %d, replaying log up to index %d",
+			config.ShardID, sl.snapshotIndex, sl.replayIndex)
+		sl.node = raft.RestartNode(c)
 	}
 
 	go sl.runRaft()
@@ -127,8 +331,13 @@ func NewShardLeader(config ShardConfig, batchTimeout time.Duration, maxBatchSize
 
 // runRaft handles Raft consensus events
 func (sl *ShardLeader) runRaft() {
-	ticker := time.NewTicker(100 * time.Millisecond)
+	ticker := time.NewTicker(tickInterval)
 	defer ticker.Stop()
+	defer close(sl.doneC)
+
+	// entries up to a restored snapshot are applied
+	sl.publishApplied()
+	lead := raft.None
 
 	for {
 		select {
@@ -136,10 +345,25 @@ func (sl *ShardLeader) runRaft() {
 			sl.node.Tick()
 
 		case rd := <-sl.node.Ready():
+			if rd.SoftState != nil && rd.SoftState.Lead != lead {
+				if rd.SoftState.Lead != raft.None {
+					logger.Infof("Replica %d of shard %s sees replica %d as leader", sl.replicaID, sl.shardID, rd.SoftState.Lead)
+					sl.metrics.LeaderChanges.With("shard", sl.shardID).Add(1)
+					// requests queued without leader are not left to the timeout
+					sl.signalFlush()
+				}
+				lead = rd.SoftState.Lead
+			}
+
+			if err := sl.storage.Store(rd.Entries, rd.HardState, rd.Snapshot); err != nil {
+				logger.Panicf("Failed to persist raft data for shard %s: %v", sl.shardID, err)
+			}
+
 			if !raft.IsEmptySnap(rd.Snapshot) {
-				sl.storage.ApplySnapshot(rd.Snapshot)
+				if err := sl.restoreSnapshot(rd.Snapshot); err != nil {
+					logger.Panicf("Failed to apply snapshot for shard %s: %v", sl.shardID, err)
+				}
 			}
-			sl.storage.Append(rd.Entries)
 
 			if len(rd.Messages) > 0 {
 				select {
@@ -149,72 +373,271 @@ func (sl *ShardLeader) runRaft() {
 				}
 			}
 
+			added := false
 			for _, entry := range rd.CommittedEntries {
-				if entry.Type == raftpb.EntryNormal && len(entry.Data) > 0 {
-					sl.applyEntry(entry)
+				switch entry.Type {
+				case raftpb.EntryNormal:
+					if len(entry.Data) > 0 {
+						sl.applyEntry(entry)
+					}
+				case raftpb.EntryConfChange:
+					var cc raftpb.ConfChange
+					if err := cc.Unmarshal(entry.Data); err != nil {
+						logger.Errorf("Failed to unmarshal conf change for shard %s: %v", sl.shardID, err)
+						break
+					}
+					added = sl.applyConfChange(cc) || added
 				}
+				sl.commitIndex = entry.Index
 			}
 
+			// a replica added to the shard catches up from a snapshot
+			// that has it as a member
+			sl.maybeSnapshot(added)
+			sl.publishApplied()
+			sl.deliverReadStates(rd.ReadStates)
 			sl.node.Advance()
 
 		case req := <-sl.proposeC:
-			sl.batchLock.Lock()
-			sl.batchQueue = append(sl.batchQueue, req)
-			shouldFlush := len(sl.batchQueue) >= sl.maxBatchSize
-			sl.batchLock.Unlock()
-
-			if shouldFlush {
-				sl.flushBatch()
+			// proposing blocks until a leader is known, so the flush is
+			// left to the batcher to keep the raft loop ticking
+			if sl.enqueue(req) {
+				sl.signalFlush()
 			}
 
 		case <-sl.stopC:
 			sl.node.Stop()
+			if err := sl.storage.Close(); err != nil {
+				logger.Errorf("Failed to close storage for shard %s: %v", sl.shardID, err)
+			}
 			return
 		}
 	}
 }
 
+// maybeSnapshot takes a snapshot of the dependency map once enough
+// entries have been applied since the last one, or right away if forced
+func (sl *ShardLeader) maybeSnapshot(force bool) {
+	if sl.commitIndex == sl.snapshotIndex || (!force && sl.commitIndex-sl.snapshotIndex < sl.snapshotInterval) {
+		return
+	}
+
+	data, err := sl.snapshotData()
+	if err != nil {
+		logger.Errorf("Failed to serialize snapshot for shard %s: %v", sl.shardID, err)
+		return
+	}
+
+	if err := sl.storage.TakeSnapshot(sl.commitIndex, sl.confState, data); err != nil {
+		logger.Errorf("Failed to take snapshot for shard %s at index %d: %v", sl.shardID, sl.commitIndex, err)
+		return
+	}
+	sl.snapshotIndex = sl.commitIndex
+}
+
+// snapshotData serializes the shard state machine
+func (sl *ShardLeader) snapshotData() ([]byte, error) {
+	sl.variableMapLock.RLock()
+	defer sl.variableMapLock.RUnlock()
+
+	prepared := make(map[string]uint64, len(sl.prepared))
+	for txID, tx := range sl.prepared {
+		prepared[txID] = tx.height
+	}
+	snapshot := &ShardSnapshot{
+		CommitIndex:    sl.commitIndex,
+		VariableMap:    sl.variableMap,
+		Replicas:       sl.Replicas(),
+		NotifiedBlock:  sl.notifiedBlock,
+		NotifiedBlocks: sl.notifiedBlocks,
+		Prepared:       prepared,
+	}
+	return snapshot.Marshal()
+}
+
+// restoreSnapshot replaces the shard state machine with the snapshot content
+func (sl *ShardLeader) restoreSnapshot(snapshot raftpb.Snapshot) error {
+	state := &ShardSnapshot{}
+	if err := state.Unmarshal(snapshot.Data); err != nil {
+		return err
+	}
+	if state.VariableMap == nil {
+		state.VariableMap = make(map[string]TransactionDependencyInfo)
+	}
+
+	sl.variableMapLock.Lock()
+	sl.variableMap = state.VariableMap
+	sl.notifiedBlock = state.NotifiedBlock
+	sl.notifiedBlocks = state.NotifiedBlocks
+	sl.indexPrepared(state.Prepared)
+	sl.variableMapLock.Unlock()
+
+	sl.mu.Lock()
+	sl.confState = snapshot.Metadata.ConfState
+	for _, replica := range state.Replicas {
+		sl.replicas[replica.ID] = replica
+	}
+	observer := sl.replicaObserver
+	sl.mu.Unlock()
+	if observer != nil {
+		for _, replica := range state.Replicas {
+			observer(replica, false)
+		}
+	}
+
+	sl.commitIndex = snapshot.Metadata.Index
+	sl.snapshotIndex = snapshot.Metadata.Index
+	return nil
+}
+
+// indexPrepared rebuilds the index of the prepared transactions from the
+// dependency map and the heights they were prepared at. Transactions without
+// a height, as in snapshots taken before heights were recorded, are given the
+// current one. The caller must hold variableMapLock.
+func (sl *ShardLeader) indexPrepared(heights map[string]uint64) {
+	sl.prepared = make(map[string]*preparedTx)
+	for key, depInfo := range sl.variableMap {
+		for owner := &depInfo; owner != nil; owner = owner.Previous {
+			if owner.DependentTxID != "" {
+				sl.track(owner.DependentTxID, key)
+			}
+			for _, readerTxID := range owner.ReaderTxIDs {
+				sl.track(readerTxID, key)
+			}
+		}
+	}
+
+	sl.expiryQueue = make([]expiringTx, 0, len(sl.prepared))
+	for txID, tx := range sl.prepared {
+		if height, exists := heights[txID]; exists {
+			tx.height = height
+		}
+		sl.expiryQueue = append(sl.expiryQueue, expiringTx{txID: txID, height: tx.height})
+	}
+	sort.Slice(sl.expiryQueue, func(i, j int) bool {
+		a, b := sl.expiryQueue[i], sl.expiryQueue[j]
+		if a.height != b.height {
+			return a.height < b.height
+		}
+		return a.txID < b.txID
+	})
+}
+
 // runBatcher batches prepare requests
 func (sl *ShardLeader) runBatcher() {
-	ticker := time.NewTicker(sl.batchTimeout)
+	ticker := time.NewTicker(sl.batch.Timeout)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			sl.flushBatch()
+			sl.pruneFlushed(forwardTimeout)
+			sl.flushBatch(true)
+		case <-sl.flushC:
+			sl.flushBatch(false)
 		case <-sl.stopC:
 			return
 		}
 	}
 }
 
-// flushBatch proposes batched requests to Raft
-func (sl *ShardLeader) flushBatch() {
+// flushBatch proposes batched requests to Raft. A follower forwards them to
+// the leader when its shard is routed through a transport. Without a leader,
+// the requests stay queued until one is elected. A batch is flushed when it
+// is full, when the batch timeout expires, or, for an adaptive shard, when
+// no flushed request waits to be applied; the reason labels the flushes
+// metric.
+func (sl *ShardLeader) flushBatch(timedOut bool) {
+	lead := sl.node.Status().Lead
+	if lead == raft.None {
+		return
+	}
+	idle := sl.batch.Adaptive && sl.idle()
+
 	sl.batchLock.Lock()
-	if len(sl.batchQueue) == 0 {
+	full := sl.batchFull()
+	if len(sl.batchQueue) == 0 || !(full || timedOut || idle) {
 		sl.batchLock.Unlock()
 		return
 	}
 
-	batch := sl.batchQueue
-	sl.batchQueue = make([]*PrepareRequest, 0, sl.maxBatchSize)
+	batch := sl.takeBatch()
 	sl.lastBatchTime = time.Now()
+	forwarder := sl.forwarder
+	if sl.batchFull() {
+		sl.signalFlush()
+	}
 	sl.batchLock.Unlock()
 
+	reason := "idle"
+	switch {
+	case full:
+		reason = "size"
+	case timedOut:
+		reason = "timeout"
+	}
+	sl.metrics.BatchSize.With("shard", sl.shardID).Observe(float64(len(batch)))
+	sl.metrics.BatchFlushes.With("shard", sl.shardID, "reason", reason).Add(1)
+	sl.markFlushed(batch)
+
+	if lead != sl.replicaID && forwarder != nil {
+		go sl.forwardBatch(forwarder, lead, batch)
+		return
+	}
+
 	data, err := sl.serializeBatch(batch)
 	if err != nil {
 		logger.Errorf("Failed to serialize batch for shard %s: %v", sl.shardID, err)
+		sl.failBatch(batch, err)
 		return
 	}
 
-	if err := sl.node.Propose(context.TODO(), data); err != nil {
-		logger.Errorf("Failed to propose batch for shard %s: %v", sl.shardID, err)
+	ctx, cancel := sl.batchContext()
+	defer cancel()
+	if err := sl.node.Propose(ctx, data); err != nil {
+		logger.Warningf("Failed to propose batch for shard %s, requeuing it: %v", sl.shardID, err)
+		sl.requeue(batch)
+	}
+}
+
+// batchContext returns the context of the proposal of a batch. It expires
+// with the batch timeout and is cancelled when the shard stops, so that a
+// replica that lost its leadership does not block the batcher.
+func (sl *ShardLeader) batchContext() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(context.Background(), sl.batch.Timeout)
+	go func() {
+		select {
+		case <-sl.stopC:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// observeApplied records the time it took for the prepare of the transaction
+// to be applied, if this replica flushed it
+func (sl *ShardLeader) observeApplied(txID string) {
+	sl.waitersLock.Lock()
+	flushedAt, ok := sl.unmarkFlushed(txID)
+	sl.waitersLock.Unlock()
+
+	if ok {
+		sl.metrics.ProposeToApplyTime.With("shard", sl.shardID).Observe(time.Since(flushedAt).Seconds())
 	}
 }
 
 // serializeBatch serializes a batch of prepare requests
 func (sl *ShardLeader) serializeBatch(batch []*PrepareRequest) ([]byte, error) {
+	entry := &LogEntry{
+		Type:  EntryTypePrepareBatch,
+		Batch: newPrepareRequestBatch(batch),
+	}
+	return entry.Marshal()
+}
+
+// newPrepareRequestBatch returns the serializable form of a batch
+func newPrepareRequestBatch(batch []*PrepareRequest) *PrepareRequestBatch {
 	pbBatch := &PrepareRequestBatch{
 		Requests: make([]*PrepareRequestProto, len(batch)),
 	}
@@ -238,40 +661,75 @@ func (sl *ShardLeader) serializeBatch(batch []*PrepareRequest) ([]byte, error) {
 			Timestamp: req.Timestamp.Unix(),
 		}
 	}
+	return pbBatch
+}
 
-	return pbBatch.Marshal()
+// prepareRequests returns the requests of a serialized batch
+func (b *PrepareRequestBatch) prepareRequests() []*PrepareRequest {
+	batch := make([]*PrepareRequest, len(b.Requests))
+	for i, req := range b.Requests {
+		batch[i] = &PrepareRequest{
+			TxID:      req.TxID,
+			ShardID:   req.ShardID,
+			ReadSet:   req.ReadSet,
+			WriteSet:  req.WriteSet,
+			Timestamp: time.Unix(req.Timestamp, 0),
+		}
+	}
+	return batch
 }
 
 // applyEntry applies a committed Raft entry
 func (sl *ShardLeader) applyEntry(entry raftpb.Entry) {
 	sl.commitIndex = entry.Index
+	replayed := entry.Index <= sl.replayIndex
 
-	batch := &PrepareRequestBatch{}
-	if err := batch.Unmarshal(entry.Data); err != nil {
-		logger.Errorf("Failed to unmarshal batch for shard %s: %v", sl.shardID, err)
+	logEntry := &LogEntry{}
+	if err := logEntry.Unmarshal(entry.Data); err != nil {
+		logger.Errorf("Failed to unmarshal log entry %d for shard %s: %v", entry.Index, sl.shardID, err)
 		return
 	}
 
+	switch {
+	case logEntry.Type == EntryTypePrepareBatch && logEntry.Batch != nil:
+		sl.applyPrepareBatch(entry, logEntry.Batch, replayed)
+	case logEntry.Type == EntryTypeAbort && logEntry.Abort != nil:
+		sl.applyAbort(logEntry.Abort, replayed)
+	case logEntry.Type == EntryTypeCommitNotify && logEntry.CommitNotify != nil:
+		sl.applyCommitNotify(logEntry.CommitNotify)
+	default:
+		logger.Errorf("Shard %s: Ignoring malformed log entry %d of type %d", sl.shardID, entry.Index, logEntry.Type)
+	}
+}
+
+// applyPrepareBatch resolves the dependencies of each prepare request in the
+// batch and delivers the resulting proofs
+func (sl *ShardLeader) applyPrepareBatch(entry raftpb.Entry, batch *PrepareRequestBatch, replayed bool) {
 	for _, reqProto := range batch.Requests {
-		hasDependency, dependentTxID := sl.checkDependencies(reqProto)
+		dependencies := sl.checkDependencies(reqProto)
 
-		proof := &PrepareProof{
-			TxID:        reqProto.TxID,
-			ShardID:     sl.shardID,
-			CommitIndex: sl.commitIndex,
-			LeaderID:    sl.node.Status().Lead,
-			Term:        entry.Term,
-			Signature:   sl.signProof(reqProto.TxID, sl.commitIndex),
-		}
+		sl.updateDependencyMap(reqProto, dependencies, entry.Index)
 
-		sl.updateDependencyMap(reqProto, hasDependency, dependentTxID, entry.Index)
+		if replayed {
+			continue
+		}
 
-		select {
-		case sl.commitC <- proof:
-			logger.Debugf("Shard %s: Sent proof for tx %s at index %d", sl.shardID, reqProto.TxID, entry.Index)
-		default:
-			logger.Warnf("Commit channel full for shard %s", sl.shardID)
+		proof := &PrepareProof{
+			TxID:           reqProto.TxID,
+			ShardID:        sl.shardID,
+			CommitIndex:    sl.commitIndex,
+			LeaderID:       sl.node.Status().Lead,
+			Term:           entry.Term,
+			HasDependency:  len(dependencies) > 0,
+			DependentTxIDs: dependentTxIDs(dependencies),
+			Dependencies:   dependencies,
 		}
+		if err := sl.signProof(proof); err != nil {
+			logger.Errorf("Shard %s: Failed to sign proof for tx %s: %v", sl.shardID, reqProto.TxID, err)
+		}
+
+		sl.observeApplied(reqProto.TxID)
+		sl.deliverProof(proof)
 
 		sl.mu.Lock()
 		sl.requestsHandled++
@@ -279,85 +737,455 @@ func (sl *ShardLeader) applyEntry(entry raftpb.Entry) {
 	}
 }
 
-// checkDependencies checks if transaction has dependencies
-func (sl *ShardLeader) checkDependencies(req *PrepareRequestProto) (bool, string) {
+// deliverProof hands the proof to the caller waiting on its transaction, if
+// any, and publishes it on the commit channel for observers. The caller of a
+// transaction forwarded to the leader receives the proof of the leader.
+func (sl *ShardLeader) deliverProof(proof *PrepareProof) {
+	sl.waitersLock.Lock()
+	_, forwarded := sl.forwarded[proof.TxID]
+	sl.waitersLock.Unlock()
+
+	if !forwarded && sl.notifyWaiter(proof.TxID, prepareResult{proof: proof}) {
+		logger.Debugf("Shard %s: Delivered proof for tx %s at index %d", sl.shardID, proof.TxID, proof.CommitIndex)
+	}
+
+	select {
+	case sl.commitC <- proof:
+	default:
+		sl.metrics.ProofsDropped.With("shard", sl.shardID).Add(1)
+		logger.Debugf("Commit channel full for shard %s, proof for tx %s not published", sl.shardID, proof.TxID)
+	}
+}
+
+// checkDependencies returns every conflict between the transaction and the
+// transactions recorded in the dependency map, ordered by key, kind and TxID
+func (sl *ShardLeader) checkDependencies(req *PrepareRequestProto) []Dependency {
 	sl.variableMapLock.RLock()
 	defer sl.variableMapLock.RUnlock()
 
-	hasDependency := false
-	dependentTxID := ""
+	var dependencies []Dependency
 
 	for key := range req.ReadSet {
-		if depInfo, exists := sl.variableMap[key]; exists {
-			hasDependency = true
-			dependentTxID = depInfo.DependentTxID
-			logger.Debugf("Shard %s: Tx %s has read dependency on %s for key %s",
-				sl.shardID, req.TxID, dependentTxID, key)
-			break
-		}
-	}
-
-	if !hasDependency {
-		for key := range req.WriteSet {
-			if depInfo, exists := sl.variableMap[key]; exists {
-				hasDependency = true
-				dependentTxID = depInfo.DependentTxID
-				logger.Debugf("Shard %s: Tx %s has write dependency on %s for key %s",
-					sl.shardID, req.TxID, dependentTxID, key)
-				break
+		depInfo, exists := sl.variableMap[key]
+		if !exists || depInfo.DependentTxID == "" || depInfo.DependentTxID == req.TxID {
+			continue
+		}
+		dependencies = append(dependencies, Dependency{Key: key, TxID: depInfo.DependentTxID, Kind: protos.DependencyKind_READ})
+	}
+
+	for key := range req.WriteSet {
+		depInfo, exists := sl.variableMap[key]
+		if !exists {
+			continue
+		}
+		if depInfo.DependentTxID != "" && depInfo.DependentTxID != req.TxID {
+			dependencies = append(dependencies, Dependency{Key: key, TxID: depInfo.DependentTxID, Kind: protos.DependencyKind_WRITE_WRITE})
+		}
+		for _, readerTxID := range depInfo.ReaderTxIDs {
+			if readerTxID != req.TxID {
+				dependencies = append(dependencies, Dependency{Key: key, TxID: readerTxID, Kind: protos.DependencyKind_WRITE})
 			}
 		}
 	}
 
-	return hasDependency, dependentTxID
+	sort.Slice(dependencies, func(i, j int) bool {
+		a, b := dependencies[i], dependencies[j]
+		if a.Key != b.Key {
+			return a.Key < b.Key
+		}
+		if a.Kind != b.Kind {
+			return a.Kind < b.Kind
+		}
+		return a.TxID < b.TxID
+	})
+
+	for _, dep := range dependencies {
+		logger.Debugf("Shard %s: Tx %s has %s dependency on %s for key %s",
+			sl.shardID, req.TxID, dep.Kind, dep.TxID, dep.Key)
+	}
+
+	return dependencies
 }
 
-// updateDependencyMap updates the shard's dependency tracking
-func (sl *ShardLeader) updateDependencyMap(req *PrepareRequestProto, hasDep bool, depTxID string, commitIndex uint64) {
+// updateDependencyMap records the transaction as the last writer of its
+// written keys and as a reader of the keys it only reads
+func (sl *ShardLeader) updateDependencyMap(req *PrepareRequestProto, dependencies []Dependency, commitIndex uint64) {
 	sl.variableMapLock.Lock()
 	defer sl.variableMapLock.Unlock()
 
-	expiryTime := time.Now().Add(DefaultExpiryDuration)
+	for key := range req.ReadSet {
+		if _, written := req.WriteSet[key]; written {
+			continue
+		}
+		depInfo := sl.variableMap[key]
+		if !containsTxID(depInfo.ReaderTxIDs, req.TxID) {
+			depInfo.ReaderTxIDs = append(depInfo.ReaderTxIDs, req.TxID)
+		}
+		sl.variableMap[key] = depInfo
+		sl.track(req.TxID, key)
+	}
 
 	for key := range req.WriteSet {
+		var previous *TransactionDependencyInfo
+		if depInfo, exists := sl.variableMap[key]; exists {
+			previous = trimOwnerHistory(&depInfo, maxOwnerHistory)
+		}
 		sl.variableMap[key] = TransactionDependencyInfo{
 			Value:         req.WriteSet[key],
 			DependentTxID: req.TxID,
-			ExpiryTime:    expiryTime,
-			HasDependency: hasDep,
+			HasDependency: len(dependencies) > 0,
+			Previous:      previous,
 		}
+		sl.track(req.TxID, key)
 		logger.Debugf("Shard %s: Updated dependency map for key %s -> tx %s at index %d",
 			sl.shardID, key, req.TxID, commitIndex)
 	}
 }
 
-// signProof creates a signature for the proof
-func (sl *ShardLeader) signProof(txID string, commitIndex uint64) []byte {
-	data := fmt.Sprintf("%s:%d:%s", sl.shardID, commitIndex, txID)
-	return []byte(data)
+// track records that the prepared transaction read or wrote the key. A
+// transaction tracked for the first time is queued for expiry. The caller
+// must hold variableMapLock.
+func (sl *ShardLeader) track(txID, key string) {
+	tx, exists := sl.prepared[txID]
+	if !exists {
+		tx = &preparedTx{keys: make(map[string]struct{}), height: sl.notifiedBlocks}
+		sl.prepared[txID] = tx
+		sl.expiryQueue = append(sl.expiryQueue, expiringTx{txID: txID, height: tx.height})
+	}
+	tx.keys[key] = struct{}{}
+}
+
+// applyAbort rolls back the keys owned by the aborted transaction and removes
+// it from the readers of every key
+func (sl *ShardLeader) applyAbort(abort *AbortEntry, replayed bool) {
+	rolledBack := sl.settle(txOutcomes{abort.TxID: false})
+
+	if replayed {
+		return
+	}
+
+	logger.Debugf("Shard %s: Applied abort of tx %s, %d keys rolled back", sl.shardID, abort.TxID, rolledBack)
+	sl.metrics.AbortsApplied.With("shard", sl.shardID).Add(1)
+}
+
+// applyCommitNotify settles the transactions of a block committed to the
+// ledger. Keys written by a valid transaction no longer depend on it, as its
+// writes are part of the ledger state. Invalid transactions are rolled back
+// like aborted ones, and so are the transactions still tracked expiryBlocks
+// blocks after they were prepared. A block notified again only settles its
+// transactions.
+func (sl *ShardLeader) applyCommitNotify(notify *CommitNotifyEntry) {
+	outcomes := make(txOutcomes, len(notify.Valid)+len(notify.Invalid))
+	for _, txID := range notify.Valid {
+		outcomes[txID] = true
+	}
+	for _, txID := range notify.Invalid {
+		outcomes[txID] = false
+	}
+
+	sl.variableMapLock.Lock()
+	if sl.notifiedBlocks == 0 || notify.BlockNumber > sl.notifiedBlock {
+		sl.notifiedBlock = notify.BlockNumber
+		sl.notifiedBlocks++
+	}
+	expired := sl.expire(outcomes)
+	sl.variableMapLock.Unlock()
+
+	if len(expired) > 0 {
+		logger.Warnf("Shard %s: Rolling back %d txs not committed within %d blocks: %v",
+			sl.shardID, len(expired), sl.expiryBlocks, expired)
+	}
+
+	settled := sl.settle(outcomes)
+	logger.Debugf("Shard %s: Finalized %d valid and %d invalid txs of block %d, %d keys updated",
+		sl.shardID, len(notify.Valid), len(notify.Invalid), notify.BlockNumber, settled)
+}
+
+// expire adds as invalid to the outcomes the prepared transactions that were
+// tracked for expiryBlocks notified blocks and returns them. The caller must
+// hold variableMapLock.
+func (sl *ShardLeader) expire(outcomes txOutcomes) []string {
+	var expired []string
+	for len(sl.expiryQueue) > 0 && sl.expiryQueue[0].height+sl.expiryBlocks <= sl.notifiedBlocks {
+		next := sl.expiryQueue[0]
+		sl.expiryQueue = sl.expiryQueue[1:]
+
+		// the transaction may have been settled, and prepared again since
+		tx, tracked := sl.prepared[next.txID]
+		if _, finished := outcomes[next.txID]; !tracked || finished || tx.height != next.height {
+			continue
+		}
+		outcomes[next.txID] = false
+		expired = append(expired, next.txID)
+	}
+	return expired
+}
+
+// txOutcomes maps a finished transaction to whether it was committed valid
+type txOutcomes map[string]bool
+
+// settle removes the finished transactions from the dependency map and
+// returns the number of keys that changed. Only the keys the finished
+// transactions read or wrote are visited.
+func (sl *ShardLeader) settle(outcomes txOutcomes) int {
+	sl.variableMapLock.Lock()
+	defer sl.variableMapLock.Unlock()
+
+	keys := make(map[string]struct{})
+	for txID := range outcomes {
+		tx, tracked := sl.prepared[txID]
+		if !tracked {
+			continue
+		}
+		for key := range tx.keys {
+			keys[key] = struct{}{}
+		}
+		delete(sl.prepared, txID)
+	}
+
+	changedKeys := 0
+	for key := range keys {
+		depInfo, exists := sl.variableMap[key]
+		if !exists {
+			continue
+		}
+		settled, changed := settleKey(&depInfo, outcomes)
+		if !changed {
+			continue
+		}
+		if settled == nil {
+			delete(sl.variableMap, key)
+		} else {
+			sl.variableMap[key] = *settled
+		}
+		changedKeys++
+	}
+	return changedKeys
+}
+
+// settleKey returns a copy of the key state without the finished
+// transactions. A key written by a valid transaction keeps no owner and no
+// history below it; a key written by an invalid or aborted transaction is
+// returned to its previous owner. Finished transactions are removed from the
+// readers. It returns false if no finished transaction touched the key, and a
+// nil state if nothing remains of the key.
+func settleKey(depInfo *TransactionDependencyInfo, outcomes txOutcomes) (*TransactionDependencyInfo, bool) {
+	if depInfo == nil {
+		return nil, false
+	}
+
+	previous, changed := settleKey(depInfo.Previous, outcomes)
+
+	var readers []string
+	for _, readerTxID := range depInfo.ReaderTxIDs {
+		if _, finished := outcomes[readerTxID]; finished {
+			changed = true
+			continue
+		}
+		readers = append(readers, readerTxID)
+	}
+
+	valid, finished := outcomes[depInfo.DependentTxID]
+	switch {
+	case finished && valid:
+		// the written value is now the ledger state
+		return keyState(&TransactionDependencyInfo{ReaderTxIDs: readers}), true
+
+	case finished:
+		// transactions that read the rolled back write keep their conflict
+		// with later writers of the key
+		restored := &TransactionDependencyInfo{}
+		if previous != nil {
+			restored = previous
+		}
+		for _, readerTxID := range readers {
+			if !containsTxID(restored.ReaderTxIDs, readerTxID) {
+				restored.ReaderTxIDs = append(restored.ReaderTxIDs, readerTxID)
+			}
+		}
+		return keyState(restored), true
+
+	case !changed:
+		return depInfo, false
+	}
+
+	settled := *depInfo
+	settled.ReaderTxIDs = readers
+	settled.Previous = previous
+	return keyState(&settled), true
+}
+
+// keyState returns nil if the key state no longer records any transaction
+func keyState(depInfo *TransactionDependencyInfo) *TransactionDependencyInfo {
+	if depInfo.DependentTxID == "" && len(depInfo.ReaderTxIDs) == 0 && depInfo.Previous == nil {
+		return nil
+	}
+	return depInfo
+}
+
+// trimOwnerHistory returns a copy of the key state that keeps at most depth
+// owners
+func trimOwnerHistory(depInfo *TransactionDependencyInfo, depth int) *TransactionDependencyInfo {
+	if depInfo == nil || depth == 0 {
+		return nil
+	}
+	trimmed := *depInfo
+	trimmed.Previous = trimOwnerHistory(depInfo.Previous, depth-1)
+	return &trimmed
 }
 
-// HandleAbort handles abort requests
-func (sl *ShardLeader) HandleAbort(txID string) error {
-	abortData := &AbortEntry{
-		TxID:      txID,
-		Timestamp: time.Now().Unix(),
+// dependentTxIDs returns the distinct transactions named by the dependencies
+// in the order they first appear
+func dependentTxIDs(dependencies []Dependency) []string {
+	var txIDs []string
+	for _, dep := range dependencies {
+		if !containsTxID(txIDs, dep.TxID) {
+			txIDs = append(txIDs, dep.TxID)
+		}
 	}
+	return txIDs
+}
 
-	data, err := abortData.Marshal()
+func containsTxID(txIDs []string, txID string) bool {
+	for _, id := range txIDs {
+		if id == txID {
+			return true
+		}
+	}
+	return false
+}
+
+// Abort proposes an abort of the transaction to the shard. When the abort is
+// applied, the keys written by the transaction are returned to their previous
+// owners and the transaction is removed from the readers of the keys it read.
+// A prepare of the transaction that has not been proposed yet is dropped.
+func (sl *ShardLeader) Abort(ctx context.Context, txID string) error {
+	sl.dequeue(txID)
+
+	entry := &LogEntry{
+		Type: EntryTypeAbort,
+		Abort: &AbortEntry{
+			TxID:      txID,
+			Timestamp: time.Now().Unix(),
+		},
+	}
+	data, err := entry.Marshal()
 	if err != nil {
 		return err
 	}
 
-	return sl.node.Propose(context.TODO(), data)
+	if err := sl.node.Propose(ctx, data); err != nil {
+		return errors.WithMessagef(err, "failed to propose abort of tx %s to shard %s", txID, sl.shardID)
+	}
+	return nil
 }
 
-// ProposeC returns the propose channel
+// NotifyCommitted proposes to the shard the outcome of the transactions of a
+// block committed to the ledger, so that every replica stops tracking them.
+// Every replica commits the block, so only the leader of the shard proposes
+// it; the others return right away. A block without outcomes for the shard
+// is still proposed while the shard tracks transactions, as it counts
+// towards their expiry.
+func (sl *ShardLeader) NotifyCommitted(ctx context.Context, blockNumber uint64, valid, invalid []string) error {
+	if sl.node.Status().Lead != sl.replicaID {
+		return nil
+	}
+	if len(valid) == 0 && len(invalid) == 0 && sl.trackedTxs() == 0 {
+		return nil
+	}
+
+	entry := &LogEntry{
+		Type: EntryTypeCommitNotify,
+		CommitNotify: &CommitNotifyEntry{
+			BlockNumber: blockNumber,
+			Valid:       valid,
+			Invalid:     invalid,
+		},
+	}
+	data, err := entry.Marshal()
+	if err != nil {
+		return err
+	}
+
+	if err := sl.node.Propose(ctx, data); err != nil {
+		return errors.WithMessagef(err, "failed to propose commit of block %d to shard %s", blockNumber, sl.shardID)
+	}
+	return nil
+}
+
+// trackedTxs returns the number of transactions recorded in the dependency map
+func (sl *ShardLeader) trackedTxs() int {
+	sl.variableMapLock.RLock()
+	defer sl.variableMapLock.RUnlock()
+	return len(sl.prepared)
+}
+
+// Prepare submits a prepare request to the shard and waits for the proof of
+// the same transaction. Concurrent callers are isolated from each other: each
+// receives only the proof for its own TxID. The context bounds both the
+// submission and the wait for the proof. A prepare beyond the in-flight limit
+// of its lane is rejected right away with an OverloadedError.
+func (sl *ShardLeader) Prepare(ctx context.Context, req *PrepareRequest) (*PrepareProof, error) {
+	start := time.Now()
+	waiter := make(chan prepareResult, 1)
+	proved := false
+
+	sl.waitersLock.Lock()
+	if _, exists := sl.waiters[req.TxID]; exists {
+		sl.waitersLock.Unlock()
+		return nil, errors.WithMessagef(ErrPrepareInProgress, "tx %s on shard %s", req.TxID, sl.shardID)
+	}
+	if err := sl.admit(req.Priority); err != nil {
+		sl.waitersLock.Unlock()
+		return nil, err
+	}
+	sl.waiters[req.TxID] = waiter
+	sl.waitersLock.Unlock()
+
+	defer func() {
+		sl.waitersLock.Lock()
+		sl.release(time.Since(start), proved)
+		if sl.waiters[req.TxID] == waiter {
+			delete(sl.waiters, req.TxID)
+			// a proposal dropped by raft is never applied
+			sl.unmarkFlushed(req.TxID)
+		}
+		sl.waitersLock.Unlock()
+	}()
+
+	select {
+	case sl.proposeC <- req:
+	case <-ctx.Done():
+		return nil, errors.WithMessagef(sl.waitError(ctx), "failed to submit prepare for tx %s to shard %s", req.TxID, sl.shardID)
+	case <-sl.stopC:
+		return nil, ErrShardStopped
+	}
+
+	select {
+	case result := <-waiter:
+		if result.err == nil {
+			proved = true
+			sl.metrics.ProofWaitTime.With("shard", sl.shardID).Observe(time.Since(start).Seconds())
+		}
+		return result.proof, result.err
+	case <-ctx.Done():
+		// a request that was not proposed yet is not proposed anymore
+		sl.dequeue(req.TxID)
+		return nil, errors.WithMessagef(sl.waitError(ctx), "no proof for tx %s from shard %s", req.TxID, sl.shardID)
+	case <-sl.stopC:
+		return nil, ErrShardStopped
+	}
+}
+
+// ProposeC returns the propose channel. Requests submitted directly on this
+// channel are not matched to a caller; use Prepare to obtain their proof.
 func (sl *ShardLeader) ProposeC() chan<- *PrepareRequest {
 	return sl.proposeC
 }
 
-// CommitC returns the commit channel
+// CommitC returns a best-effort stream of every proof produced by this shard.
+// Proofs are dropped from the stream when it is full, so it is meant for
+// observers only; callers waiting on a specific transaction use Prepare.
 func (sl *ShardLeader) CommitC() <-chan *PrepareProof {
 	return sl.commitC
 }
@@ -379,8 +1207,20 @@ func (sl *ShardLeader) Step(ctx context.Context, msg raftpb.Message) error {
 	return sl.node.Step(ctx, msg)
 }
 
-// Stop gracefully stops the shard leader
+// ReportUnreachable tells raft that the last message to a replica could not
+// be delivered
+func (sl *ShardLeader) ReportUnreachable(id uint64) {
+	sl.node.ReportUnreachable(id)
+}
+
+// ReportSnapshot tells raft whether the last snapshot sent to a replica was
+// delivered
+func (sl *ShardLeader) ReportSnapshot(id uint64, status raft.SnapshotStatus) {
+	sl.node.ReportSnapshot(id, status)
+}
+
+// Stop gracefully stops the shard leader and closes its storage
 func (sl *ShardLeader) Stop() {
 	close(sl.stopC)
-	sl.node.Stop()
+	<-sl.doneC
 }
@@ -1,10 +1,14 @@
 package sharding_test
 
 import (
+    "context"
+    "fmt"
+    "sync"
     "testing"
     "time"
     
     "github.com/hyperledger/fabric/core/endorser/sharding"
+    "github.com/hyperledger/fabric/core/endorser/sharding/protos"
     . "github.com/onsi/ginkgo/v2"
     . "github.com/onsi/gomega"
 )
@@ -23,7 +27,7 @@ var _ = Describe("ShardLeader", func() {
     BeforeEach(func() {
         config = sharding.ShardConfig{
             ShardID: "testContract",
-            ReplicaNodes: []string{"node1", "node2", "node3"},
+            ReplicaNodes: []string{"node1"},
             ReplicaID: 1,
         }
         var err error
@@ -47,15 +51,9 @@ var _ = Describe("ShardLeader", func() {
             Timestamp: time.Now(),
         }
         
-        shard.ProposeC() <- req
-        
-        select {
-        case proof := <-shard.CommitC():
-            Expect(proof).ToNot(BeNil())
-            Expect(proof.TxID).To(Equal("tx1"))
-        case <-time.After(5 * time.Second):
-            Fail("Timeout waiting for proof")
-        }
+        proof, err := shard.Prepare(electionContext(), req)
+        Expect(err).ToNot(HaveOccurred())
+        Expect(proof.TxID).To(Equal("tx1"))
     })
     
     It("should detect dependencies", func() {
@@ -66,8 +64,8 @@ var _ = Describe("ShardLeader", func() {
             WriteSet: map[string][]byte{"key1": []byte("value1")},
             Timestamp: time.Now(),
         }
-        shard.ProposeC() <- req1
-        <-shard.CommitC()
+        _, err := shard.Prepare(electionContext(), req1)
+        Expect(err).ToNot(HaveOccurred())
         
         // Second transaction with dependency
         req2 := &sharding.PrepareRequest{
@@ -76,9 +74,188 @@ var _ = Describe("ShardLeader", func() {
             ReadSet: map[string][]byte{"key1": []byte("value1")},
             Timestamp: time.Now(),
         }
-        shard.ProposeC() <- req2
-        
-        proof := <-shard.CommitC()
+        proof, err := shard.Prepare(electionContext(), req2)
+        Expect(err).ToNot(HaveOccurred())
         Expect(proof.CommitIndex).To(BeNumerically(">", 1))
     })
-})
\ No newline at end of file
+    
+    It("should report every conflicting transaction", func() {
+        for i := 1; i <= 5; i++ {
+            _, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+                TxID: fmt.Sprintf("writer%d", i),
+                ShardID: "testContract",
+                WriteSet: map[string][]byte{fmt.Sprintf("key%d", i): []byte("value")},
+                Timestamp: time.Now(),
+            })
+            Expect(err).ToNot(HaveOccurred())
+        }
+        _, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+            TxID: "reader",
+            ShardID: "testContract",
+            ReadSet: map[string][]byte{"key6": nil},
+            Timestamp: time.Now(),
+        })
+        Expect(err).ToNot(HaveOccurred())
+        
+        proof, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+            TxID: "tx",
+            ShardID: "testContract",
+            ReadSet: map[string][]byte{"key1": nil, "key2": nil, "key3": nil},
+            WriteSet: map[string][]byte{"key3": []byte("v"), "key4": []byte("v"), "key5": []byte("v"), "key6": []byte("v")},
+            Timestamp: time.Now(),
+        })
+        Expect(err).ToNot(HaveOccurred())
+        Expect(proof.HasDependency).To(BeTrue())
+        Expect(proof.Dependencies).To(Equal([]sharding.Dependency{
+            {Key: "key1", TxID: "writer1", Kind: protos.DependencyKind_READ},
+            {Key: "key2", TxID: "writer2", Kind: protos.DependencyKind_READ},
+            {Key: "key3", TxID: "writer3", Kind: protos.DependencyKind_READ},
+            {Key: "key3", TxID: "writer3", Kind: protos.DependencyKind_WRITE_WRITE},
+            {Key: "key4", TxID: "writer4", Kind: protos.DependencyKind_WRITE_WRITE},
+            {Key: "key5", TxID: "writer5", Kind: protos.DependencyKind_WRITE_WRITE},
+            {Key: "key6", TxID: "reader", Kind: protos.DependencyKind_WRITE},
+        }))
+        Expect(proof.DependentTxIDs).To(Equal([]string{"writer1", "writer2", "writer3", "writer4", "writer5", "reader"}))
+    })
+    
+    It("should restore the previous owner of a key when a transaction is aborted", func() {
+        for _, txID := range []string{"tx1", "tx2"} {
+            _, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+                TxID: txID,
+                ShardID: "testContract",
+                WriteSet: map[string][]byte{"key1": []byte(txID)},
+                Timestamp: time.Now(),
+            })
+            Expect(err).ToNot(HaveOccurred())
+        }
+        Expect(shard.Abort(electionContext(), "tx2")).To(Succeed())
+        
+        proof, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+            TxID: "tx3",
+            ShardID: "testContract",
+            ReadSet: map[string][]byte{"key1": nil},
+            Timestamp: time.Now(),
+        })
+        Expect(err).ToNot(HaveOccurred())
+        Expect(proof.DependentTxIDs).To(Equal([]string{"tx1"}))
+    })
+    
+    It("should drop the dependencies of a transaction aborted without a previous owner", func() {
+        _, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+            TxID: "tx1",
+            ShardID: "testContract",
+            WriteSet: map[string][]byte{"key1": []byte("value1")},
+            Timestamp: time.Now(),
+        })
+        Expect(err).ToNot(HaveOccurred())
+        Expect(shard.Abort(electionContext(), "tx1")).To(Succeed())
+        
+        proof, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+            TxID: "tx2",
+            ShardID: "testContract",
+            ReadSet: map[string][]byte{"key1": nil},
+            Timestamp: time.Now(),
+        })
+        Expect(err).ToNot(HaveOccurred())
+        Expect(proof.HasDependency).To(BeFalse())
+    })
+    
+    It("should stop tracking transactions once they are committed", func() {
+        for _, txID := range []string{"tx1", "tx2"} {
+            _, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+                TxID: txID,
+                ShardID: "testContract",
+                WriteSet: map[string][]byte{txID: []byte("value")},
+                Timestamp: time.Now(),
+            })
+            Expect(err).ToNot(HaveOccurred())
+        }
+        Expect(shard.NotifyCommitted(electionContext(), 1, []string{"tx1"}, []string{"tx2"})).To(Succeed())
+        
+        proof, err := shard.Prepare(electionContext(), &sharding.PrepareRequest{
+            TxID: "tx3",
+            ShardID: "testContract",
+            ReadSet: map[string][]byte{"tx1": nil, "tx2": nil},
+            Timestamp: time.Now(),
+        })
+        Expect(err).ToNot(HaveOccurred())
+        Expect(proof.HasDependency).To(BeFalse())
+    })
+    
+    It("should leave commit notifications to the leader of the shard", func() {
+        follower, err := sharding.NewShardLeader(sharding.ShardConfig{
+            ShardID: "testContract",
+            ReplicaNodes: []string{"node1", "node2"},
+            ReplicaID: 2,
+        }, 300*time.Millisecond, 20)
+        Expect(err).ToNot(HaveOccurred())
+        defer follower.Stop()
+        
+        // the shard has no leader, so a proposal would wait for the deadline
+        ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+        defer cancel()
+        Expect(follower.NotifyCommitted(ctx, 1, []string{"tx1"}, nil)).To(Succeed())
+    })
+    
+    It("should route each proof to the caller that prepared it", func() {
+        var wg sync.WaitGroup
+        proofs := make([]*sharding.PrepareProof, 20)
+        errs := make([]error, 20)
+        for i := range proofs {
+            wg.Add(1)
+            go func(i int) {
+                defer wg.Done()
+                proofs[i], errs[i] = shard.Prepare(electionContext(), &sharding.PrepareRequest{
+                    TxID: fmt.Sprintf("tx%d", i),
+                    ShardID: "testContract",
+                    WriteSet: map[string][]byte{"hot-key": []byte("value")},
+                    Timestamp: time.Now(),
+                })
+            }(i)
+        }
+        wg.Wait()
+        
+        for i := range proofs {
+            Expect(errs[i]).ToNot(HaveOccurred())
+            Expect(proofs[i].TxID).To(Equal(fmt.Sprintf("tx%d", i)))
+        }
+    })
+    
+    It("should report cancellation while waiting for a proof", func() {
+        ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+        defer cancel()
+        
+        _, err := shard.Prepare(ctx, &sharding.PrepareRequest{TxID: "tx1", ShardID: "testContract"})
+        Expect(err).To(MatchError(context.DeadlineExceeded))
+    })
+    
+    It("should reject a second prepare for a pending transaction", func() {
+        // no leader is elected within the deadline, so both prepares overlap
+        errs := make(chan error, 2)
+        for i := 0; i < 2; i++ {
+            go func() {
+                ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+                defer cancel()
+                _, err := shard.Prepare(ctx, &sharding.PrepareRequest{TxID: "tx1", ShardID: "testContract"})
+                errs <- err
+            }()
+        }
+        
+        var received []error
+        for i := 0; i < 2; i++ {
+            received = append(received, <-errs)
+        }
+        Expect(received).To(ConsistOf(
+            MatchError(sharding.ErrPrepareInProgress),
+            MatchError(context.DeadlineExceeded),
+        ))
+    })
+})
+
+// electionContext bounds a prepare generously enough to cover the initial
+// leader election of a single replica shard
+func electionContext() context.Context {
+    ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+    DeferCleanup(cancel)
+    return ctx
+}
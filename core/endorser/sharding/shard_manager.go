@@ -7,49 +7,133 @@ SPDX-License-Identifier: Apache-2.0
 package sharding
 
 import (
+	"context"
+	"path/filepath"
 	"sync"
+	"time"
+
+	"github.com/hyperledger/fabric/internal/pkg/identity"
 )
 
-// Metrics interface for shard metrics
-type Metrics interface{}
+// DefaultNotifyTimeout bounds the proposal of a block's outcomes to a shard
+const DefaultNotifyTimeout = 10 * time.Second
+
+// TxOutcome is the ledger outcome of a transaction prepared by a shard
+type TxOutcome struct {
+	TxID    string
+	ShardID string
+	Valid   bool
+}
 
 // ShardManager manages multiple contract shards
 type ShardManager struct {
-	shards     map[string]*ShardLeader
-	shardsLock sync.RWMutex
-	config     map[string]ShardConfig
-	metrics    Metrics
+	shards      map[string]*ShardLeader
+	shardsLock  sync.RWMutex
+	rootDir     string
+	signer      identity.SignerSerializer
+	config      map[string]ShardConfig
+	metrics     *Metrics
+	partitioner Partitioner
+	batching    Batching
+	admission   AdmissionConfig
+	expiry      uint64
+	topology    *Topology
+	transport   *Transport
 }
 
-// NewShardManager creates a shard manager
-func NewShardManager(configs map[string]ShardConfig, metrics Metrics) *ShardManager {
+// NewShardManager creates a shard manager. Each shard persists its raft data
+// in its own directory under rootDir; an empty rootDir keeps shards in memory.
+// The signer is used by every shard to sign the proofs it produces.
+//
+// Shards with a config of their own are created right away. Other shards are
+// created on first use, or when another replica sends them a message, and
+// replicated by every replica of the topology. When a topology is given, the
+// raft messages of all shards go through the transport of the manager, which
+// must be hosted on a gRPC server; without one, shards that are not
+// configured are served by this peer alone.
+func NewShardManager(rootDir string, signer identity.SignerSerializer, topology *Topology, configs map[string]ShardConfig, metrics *Metrics) *ShardManager {
 	if configs == nil {
 		configs = make(map[string]ShardConfig)
 	}
 
 	sm := &ShardManager{
-		shards:  make(map[string]*ShardLeader),
-		config:  configs,
-		metrics: metrics,
+		shards:      make(map[string]*ShardLeader),
+		rootDir:     rootDir,
+		signer:      signer,
+		config:      configs,
+		metrics:     metrics,
+		partitioner: ContractPartitioner{},
+		batching:    Batching{Default: DefaultBatchConfig},
+		admission:   DefaultAdmissionConfig,
+		topology:    topology,
+	}
+	if topology != nil {
+		transportConfig := topology.TransportConfig()
+		transportConfig.Metrics = metrics
+		sm.transport = NewTransport(topology.ReplicaID, topology.PeerConfig(), transportConfig, sm.GetOrCreateShard)
 	}
 
 	for shardID, config := range configs {
-		shard, err := NewShardLeader(config, DefaultBatchTimeout, DefaultBatchMaxSize)
-		if err != nil {
+		if err := sm.createShard(config); err != nil {
 			logger.Errorf("Failed to create shard %s: %v", shardID, err)
 			continue
 		}
-		sm.shards[shardID] = shard
 		logger.Infof("Initialized shard %s with %d replicas", shardID, len(config.ReplicaNodes))
 	}
 
 	return sm
 }
 
-// GetOrCreateShard gets or creates a shard for a contract
-func (sm *ShardManager) GetOrCreateShard(contractName string) (*ShardLeader, error) {
+// SetPartitioner sets the strategy used to assign the keys of contracts to
+// shards. By default every contract is tracked by a single shard.
+func (sm *ShardManager) SetPartitioner(partitioner Partitioner) {
+	sm.shardsLock.Lock()
+	defer sm.shardsLock.Unlock()
+
+	sm.partitioner = partitioner
+}
+
+// SetBatching sets the batching of the shards created from now on without a
+// batch config of their own. By default shards use DefaultBatchConfig.
+func (sm *ShardManager) SetBatching(batching Batching) {
+	sm.shardsLock.Lock()
+	defer sm.shardsLock.Unlock()
+
+	sm.batching = batching
+}
+
+// SetAdmission sets the admission control of the shards created from now on
+// without one of their own. By default shards use DefaultAdmissionConfig.
+func (sm *ShardManager) SetAdmission(admission AdmissionConfig) {
+	sm.shardsLock.Lock()
+	defer sm.shardsLock.Unlock()
+
+	sm.admission = admission
+}
+
+// SetExpiryBlocks sets the number of notified blocks after which the shards
+// created from now on without an expiry of their own roll back a prepared
+// transaction that was neither committed nor aborted. By default shards use
+// DefaultExpiryBlocks.
+func (sm *ShardManager) SetExpiryBlocks(blocks uint64) {
+	sm.shardsLock.Lock()
+	defer sm.shardsLock.Unlock()
+
+	sm.expiry = blocks
+}
+
+// ShardForKey returns the ID of the shard that tracks the key of the contract
+func (sm *ShardManager) ShardForKey(contractName, key string) string {
 	sm.shardsLock.RLock()
-	shard, exists := sm.shards[contractName]
+	defer sm.shardsLock.RUnlock()
+
+	return sm.partitioner.ShardID(contractName, key)
+}
+
+// GetOrCreateShard gets or creates a shard
+func (sm *ShardManager) GetOrCreateShard(shardID string) (*ShardLeader, error) {
+	sm.shardsLock.RLock()
+	shard, exists := sm.shards[shardID]
 	sm.shardsLock.RUnlock()
 
 	if exists {
@@ -59,28 +143,126 @@ func (sm *ShardManager) GetOrCreateShard(contractName string) (*ShardLeader, err
 	sm.shardsLock.Lock()
 	defer sm.shardsLock.Unlock()
 
-	if shard, exists := sm.shards[contractName]; exists {
+	if shard, exists := sm.shards[shardID]; exists {
 		return shard, nil
 	}
 
 	config := ShardConfig{
-		ShardID:      contractName,
-		ReplicaNodes: []string{"localhost:7051", "localhost:7052", "localhost:7053"},
+		ShardID:      shardID,
+		ReplicaNodes: []string{"localhost"},
 		ReplicaID:    1,
 	}
+	if sm.topology != nil {
+		config = sm.topology.ShardConfig(shardID)
+	}
 
-	shard, err := NewShardLeader(config, DefaultBatchTimeout, DefaultBatchMaxSize)
-	if err != nil {
+	if err := sm.createShard(config); err != nil {
 		return nil, err
 	}
 
-	sm.shards[contractName] = shard
-	logger.Infof("Dynamically created shard for contract %s", contractName)
-	return shard, nil
+	logger.Infof("Dynamically created shard %s with %d replicas", shardID, len(config.ReplicaNodes))
+	return sm.shards[shardID], nil
+}
+
+// createShard starts a shard and, when the manager has a topology, routes
+// its messages through the transport. The caller must hold shardsLock or
+// have exclusive access to the manager.
+func (sm *ShardManager) createShard(config ShardConfig) error {
+	shard, err := NewShardLeader(sm.shardConfig(config), DefaultBatchTimeout, DefaultBatchMaxSize)
+	if err != nil {
+		return err
+	}
+
+	if sm.transport != nil {
+		sm.transport.AddShard(shard)
+	}
+
+	sm.shards[config.ShardID] = shard
+	return nil
+}
+
+// Transport returns the transport of the shards of the manager, or nil if
+// the manager has no topology
+func (sm *ShardManager) Transport() *Transport {
+	return sm.transport
+}
+
+// shardConfig completes a shard config with the manager's signer, metrics,
+// batching, admission control and expiry and places the shard's WAL and snapshots
+// under the manager's root directory unless the config specifies its own
+func (sm *ShardManager) shardConfig(config ShardConfig) ShardConfig {
+	if config.Signer == nil {
+		config.Signer = sm.signer
+	}
+	if config.Metrics == nil {
+		config.Metrics = sm.metrics
+	}
+	if config.Batch == (BatchConfig{}) {
+		config.Batch = sm.batching.For(config.ShardID)
+	}
+	if config.Admission == (AdmissionConfig{}) {
+		config.Admission = sm.admission
+	}
+	if config.ExpiryBlocks == 0 {
+		config.ExpiryBlocks = sm.expiry
+	}
+	if sm.rootDir == "" || config.WALDir != "" {
+		return config
+	}
+	config.WALDir = filepath.Join(sm.rootDir, config.ShardID, "wal")
+	config.SnapDir = filepath.Join(sm.rootDir, config.ShardID, "snap")
+	return config
+}
+
+// BlockCommitted tells the shards that prepared the transactions of a
+// committed block whether each transaction was committed valid. Every shard
+// hosted by this peer is told of the block, even without transactions of its
+// own, as blocks count towards the expiry of prepared transactions. The
+// notifications are proposed in the background by the shards this peer
+// leads, so that the commit path is not held up by the shards.
+func (sm *ShardManager) BlockCommitted(blockNumber uint64, outcomes []TxOutcome) {
+	type shardOutcomes struct {
+		valid   []string
+		invalid []string
+	}
+	byShard := make(map[string]*shardOutcomes)
+	for _, outcome := range outcomes {
+		so, ok := byShard[outcome.ShardID]
+		if !ok {
+			so = &shardOutcomes{}
+			byShard[outcome.ShardID] = so
+		}
+		if outcome.Valid {
+			so.valid = append(so.valid, outcome.TxID)
+		} else {
+			so.invalid = append(so.invalid, outcome.TxID)
+		}
+	}
+
+	sm.shardsLock.RLock()
+	defer sm.shardsLock.RUnlock()
+
+	for shardID, shard := range sm.shards {
+		so, ok := byShard[shardID]
+		if !ok {
+			so = &shardOutcomes{}
+		}
+		go func(shardID string, shard *ShardLeader, so *shardOutcomes) {
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultNotifyTimeout)
+			defer cancel()
+			if err := shard.NotifyCommitted(ctx, blockNumber, so.valid, so.invalid); err != nil {
+				logger.Warnf("Failed to notify shard %s of block %d: %s", shardID, blockNumber, err)
+			}
+		}(shardID, shard, so)
+	}
 }
 
 // Shutdown stops all shards
 func (sm *ShardManager) Shutdown() {
+	if sm.transport != nil {
+		sm.transport.Stop()
+	}
+
 	sm.shardsLock.Lock()
 	defer sm.shardsLock.Unlock()
 
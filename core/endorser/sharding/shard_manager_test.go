@@ -17,7 +17,7 @@ var _ = Describe("ShardManager", func() {
                 ReplicaID: 1,
             },
         }
-        manager = sharding.NewShardManager(configs, nil)
+        manager = sharding.NewShardManager("", nil, nil, configs, nil)
     })
     
     AfterEach(func() {
@@ -40,4 +40,29 @@ var _ = Describe("ShardManager", func() {
         shard2, _ := manager.GetOrCreateShard("contract1")
         Expect(shard1).To(BeIdenticalTo(shard2))
     })
+    
+    Context("when contracts are partitioned", func() {
+        var partitioned *sharding.ShardManager
+        
+        BeforeEach(func() {
+            configs := map[string]sharding.ShardConfig{
+                "registry.0": {ShardID: "registry.0", ReplicaNodes: []string{"node1"}, ReplicaID: 1},
+                "registry.1": {ShardID: "registry.1", ReplicaNodes: []string{"node1"}, ReplicaID: 1},
+            }
+            partitioned = sharding.NewShardManager("", nil, nil, configs, nil)
+            p, err := sharding.NewRangePartitioner(map[string][]string{"registry": {"m"}})
+            Expect(err).ToNot(HaveOccurred())
+            partitioned.SetPartitioner(p)
+        })
+        
+        AfterEach(func() {
+            partitioned.Shutdown()
+        })
+        
+        It("should return the shard that owns a key", func() {
+            Expect(partitioned.ShardForKey("registry", "asset1")).To(Equal("registry.0"))
+            Expect(partitioned.ShardForKey("registry", "zebra")).To(Equal("registry.1"))
+            Expect(partitioned.ShardForKey("contract1", "zebra")).To(Equal("contract1"))
+        })
+    })
 })
@@ -0,0 +1,389 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/client/pkg/v3/fileutil"
+	"go.etcd.io/etcd/raft/v3"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"go.etcd.io/etcd/server/v3/etcdserver/api/snap"
+	"go.etcd.io/etcd/server/v3/wal"
+	"go.etcd.io/etcd/server/v3/wal/walpb"
+)
+
+const (
+	// DefaultSnapshotInterval is the number of applied entries after which a
+	// shard takes a snapshot of its dependency state
+	DefaultSnapshotInterval = 1000
+	// DefaultSnapshotCatchUpEntries is the number of entries kept in memory
+	// after a snapshot so that slow followers can catch up without one
+	DefaultSnapshotCatchUpEntries = 100
+	// MaxSnapshotFiles is the number of snapshot files retained on disk per shard
+	MaxSnapshotFiles = 4
+)
+
+// RaftStorage holds the raft log of a shard. Entries are always kept in a
+// raft.MemoryStorage; when the shard is configured with a WAL directory they
+// are also persisted to a write-ahead log and periodic snapshots so that the
+// shard can be restored after a restart.
+type RaftStorage struct {
+	SnapshotCatchUpEntries uint64
+
+	walDir  string
+	snapDir string
+
+	lg *flogging.FabricLogger
+
+	ram  *raft.MemoryStorage
+	wal  *wal.WAL
+	snap *snap.Snapshotter
+
+	// indices of the snapshots on disk, oldest first
+	snapshotIndex []uint64
+}
+
+// NewMemoryStorage creates a RaftStorage that does not persist anything to disk
+func NewMemoryStorage(lg *flogging.FabricLogger) *RaftStorage {
+	return &RaftStorage{
+		SnapshotCatchUpEntries: DefaultSnapshotCatchUpEntries,
+		lg:                     lg,
+		ram:                    raft.NewMemoryStorage(),
+	}
+}
+
+// CreateStorage creates a RaftStorage backed by a WAL in walDir and snapshots
+// in snapDir. Data already present on disk is loaded into memory, so the
+// returned storage reflects the state of the shard before it was stopped.
+func CreateStorage(lg *flogging.FabricLogger, walDir string, snapDir string) (*RaftStorage, error) {
+	if err := os.MkdirAll(snapDir, os.ModePerm); err != nil {
+		return nil, errors.Errorf("failed to mkdir '%s' for snapshot: %s", snapDir, err)
+	}
+	sn := snap.New(lg.Zap(), snapDir)
+
+	snapshot, err := sn.Load()
+	if err != nil {
+		if err != snap.ErrNoSnapshot {
+			return nil, errors.Errorf("failed to load snapshot: %s", err)
+		}
+		lg.Debugf("No snapshot found at %s", snapDir)
+	} else {
+		lg.Debugf("Loaded snapshot at Term %d and Index %d", snapshot.Metadata.Term, snapshot.Metadata.Index)
+	}
+
+	w, st, ents, err := createOrReadWAL(lg, walDir, snapshot)
+	if err != nil {
+		return nil, errors.Errorf("failed to create or read WAL: %s", err)
+	}
+
+	ram := raft.NewMemoryStorage()
+	if snapshot != nil {
+		if err := ram.ApplySnapshot(*snapshot); err != nil {
+			return nil, errors.Errorf("failed to apply snapshot to memory: %s", err)
+		}
+	}
+	ram.SetHardState(st) // MemoryStorage.SetHardState always returns nil
+	ram.Append(ents)     // MemoryStorage.Append always returns nil
+
+	return &RaftStorage{
+		SnapshotCatchUpEntries: DefaultSnapshotCatchUpEntries,
+		lg:                     lg,
+		ram:                    ram,
+		wal:                    w,
+		snap:                   sn,
+		walDir:                 walDir,
+		snapDir:                snapDir,
+		snapshotIndex:          listSnapshots(lg, snapDir),
+	}, nil
+}
+
+func createOrReadWAL(lg *flogging.FabricLogger, walDir string, snapshot *raftpb.Snapshot) (w *wal.WAL, st raftpb.HardState, ents []raftpb.Entry, err error) {
+	if !wal.Exist(walDir) {
+		lg.Infof("No WAL data found, creating new WAL at path '%s'", walDir)
+		w, err := wal.Create(lg.Zap(), walDir, nil)
+		if err != nil {
+			return nil, st, nil, errors.Errorf("failed to initialize WAL: %s", err)
+		}
+		if err = w.Close(); err != nil {
+			return nil, st, nil, errors.Errorf("failed to close the WAL just created: %s", err)
+		}
+	} else {
+		lg.Infof("Found WAL data at path '%s', replaying it", walDir)
+	}
+
+	walsnap := walpb.Snapshot{}
+	if snapshot != nil {
+		walsnap.Index, walsnap.Term = snapshot.Metadata.Index, snapshot.Metadata.Term
+	}
+
+	var repaired bool
+	for {
+		if w, err = wal.Open(lg.Zap(), walDir, walsnap); err != nil {
+			return nil, st, nil, errors.Errorf("failed to open WAL: %s", err)
+		}
+
+		if _, st, ents, err = w.ReadAll(); err != nil {
+			lg.Warnf("Failed to read WAL: %s", err)
+
+			if errc := w.Close(); errc != nil {
+				return nil, st, nil, errors.Errorf("failed to close erroneous WAL: %s", errc)
+			}
+
+			// only repair UnexpectedEOF and only repair once
+			if repaired || err != io.ErrUnexpectedEOF {
+				return nil, st, nil, errors.Errorf("failed to read WAL and cannot repair: %s", err)
+			}
+			if !wal.Repair(lg.Zap(), walDir) {
+				return nil, st, nil, errors.Errorf("failed to repair WAL: %s", err)
+			}
+			repaired = true
+			continue
+		}
+
+		break
+	}
+
+	return w, st, ents, nil
+}
+
+// listSnapshots returns the indices of the intact snapshots stored in snapDir
+func listSnapshots(lg *flogging.FabricLogger, snapDir string) []uint64 {
+	filenames, err := fileutil.ReadDir(snapDir)
+	if err != nil {
+		lg.Errorf("Failed to read snapshot directory %s: %s", snapDir, err)
+		return nil
+	}
+
+	var snapfiles []string
+	for _, f := range filenames {
+		if strings.HasSuffix(f, ".snap") {
+			snapfiles = append(snapfiles, f)
+		}
+	}
+	sort.Strings(snapfiles)
+
+	var snapshots []uint64
+	for _, f := range snapfiles {
+		s, err := snap.Read(lg.Zap(), filepath.Join(snapDir, f))
+		if err != nil {
+			lg.Warnf("Skipping corrupted snapshot file %s: %s", f, err)
+			continue
+		}
+		snapshots = append(snapshots, s.Metadata.Index)
+	}
+
+	return snapshots
+}
+
+// Persistent returns true if the storage is backed by a WAL
+func (rs *RaftStorage) Persistent() bool {
+	return rs.wal != nil
+}
+
+// Snapshot returns the latest snapshot stored in memory
+func (rs *RaftStorage) Snapshot() raftpb.Snapshot {
+	sn, _ := rs.ram.Snapshot() // Snapshot always returns nil error
+	return sn
+}
+
+// HardState returns the last persisted hard state
+func (rs *RaftStorage) HardState() raftpb.HardState {
+	st, _, _ := rs.ram.InitialState() // InitialState always returns nil error
+	return st
+}
+
+// Store persists the entries, hard state and snapshot of a raft Ready
+func (rs *RaftStorage) Store(entries []raftpb.Entry, hardstate raftpb.HardState, snapshot raftpb.Snapshot) error {
+	if rs.wal != nil {
+		if err := rs.wal.Save(hardstate, entries); err != nil {
+			return err
+		}
+	}
+
+	if !raft.IsEmptySnap(snapshot) {
+		if rs.wal != nil {
+			if err := rs.saveSnap(snapshot); err != nil {
+				return err
+			}
+		}
+		rs.ApplySnapshot(snapshot)
+	}
+
+	if !raft.IsEmptyHardState(hardstate) {
+		rs.ram.SetHardState(hardstate)
+	}
+
+	return rs.ram.Append(entries)
+}
+
+func (rs *RaftStorage) saveSnap(snapshot raftpb.Snapshot) error {
+	rs.lg.Infof("Persisting snapshot (term: %d, index: %d) to WAL and disk", snapshot.Metadata.Term, snapshot.Metadata.Index)
+
+	// the snapshot index must be saved to the WAL before the snapshot itself,
+	// so that the WAL is only ever opened at previously saved snapshot indices
+	walsnap := walpb.Snapshot{
+		Index:     snapshot.Metadata.Index,
+		Term:      snapshot.Metadata.Term,
+		ConfState: &snapshot.Metadata.ConfState,
+	}
+	if err := rs.wal.SaveSnapshot(walsnap); err != nil {
+		return errors.Errorf("failed to save snapshot to WAL: %s", err)
+	}
+	if err := rs.snap.SaveSnap(snapshot); err != nil {
+		return errors.Errorf("failed to save snapshot to disk: %s", err)
+	}
+
+	return rs.wal.ReleaseLockTo(snapshot.Metadata.Index)
+}
+
+// TakeSnapshot creates a snapshot at index i carrying the given state machine
+// data, persists it and compacts the entries it covers
+func (rs *RaftStorage) TakeSnapshot(i uint64, cs raftpb.ConfState, data []byte) error {
+	snapshot, err := rs.ram.CreateSnapshot(i, &cs, data)
+	if err != nil {
+		return errors.Errorf("failed to create snapshot from MemoryStorage: %s", err)
+	}
+
+	if rs.wal != nil {
+		if err = rs.saveSnap(snapshot); err != nil {
+			return err
+		}
+		rs.snapshotIndex = append(rs.snapshotIndex, snapshot.Metadata.Index)
+	}
+
+	// keep some entries in memory for slow followers to catch up
+	if i > rs.SnapshotCatchUpEntries {
+		compacti := i - rs.SnapshotCatchUpEntries
+		if err = rs.ram.Compact(compacti); err != nil && err != raft.ErrCompacted {
+			return errors.Errorf("failed to compact raft entries prior to %d: %s", compacti, err)
+		}
+	}
+
+	rs.lg.Debugf("Snapshot is taken at index %d", i)
+
+	rs.gc()
+	return nil
+}
+
+// gc removes WAL segments and snapshot files that are covered by the
+// oldest retained snapshot
+func (rs *RaftStorage) gc() {
+	if len(rs.snapshotIndex) < MaxSnapshotFiles {
+		return
+	}
+
+	rs.snapshotIndex = rs.snapshotIndex[len(rs.snapshotIndex)-MaxSnapshotFiles:]
+
+	rs.purgeWAL()
+	rs.purgeSnap()
+}
+
+func (rs *RaftStorage) purgeWAL() {
+	retain := rs.snapshotIndex[0]
+
+	var files []string
+	err := filepath.Walk(rs.walDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !strings.HasSuffix(path, ".wal") {
+			return nil
+		}
+
+		var seq, index uint64
+		_, f := filepath.Split(path)
+		fmt.Sscanf(f, "%016x-%016x.wal", &seq, &index)
+
+		// only purge WAL with index lower than oldest snapshot
+		if index >= retain {
+			return filepath.SkipDir
+		}
+
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		rs.lg.Errorf("Failed to read WAL directory %s: %s", rs.walDir, err)
+	}
+
+	// one segment with index smaller than the snapshot must be kept,
+	// see wal.ReleaseLockTo
+	if len(files) <= 1 {
+		return
+	}
+
+	rs.purge(files[:len(files)-1])
+}
+
+func (rs *RaftStorage) purgeSnap() {
+	var files []string
+	err := filepath.Walk(rs.snapDir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasSuffix(path, ".snap") {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		rs.lg.Errorf("Failed to read snapshot directory %s: %s", rs.snapDir, err)
+		return
+	}
+
+	if l := len(files); l > MaxSnapshotFiles {
+		rs.purge(files[:l-MaxSnapshotFiles])
+	}
+}
+
+func (rs *RaftStorage) purge(files []string) {
+	for _, file := range files {
+		l, err := fileutil.TryLockFile(file, os.O_WRONLY, fileutil.PrivateFileMode)
+		if err != nil {
+			rs.lg.Debugf("Failed to lock %s, abort purging", file)
+			break
+		}
+
+		if err = os.Remove(file); err != nil {
+			rs.lg.Errorf("Failed to remove %s: %s", file, err)
+		} else {
+			rs.lg.Debugf("Purged file %s", file)
+		}
+
+		if err = l.Close(); err != nil {
+			rs.lg.Errorf("Failed to close file lock %s: %s", l.Name(), err)
+		}
+	}
+}
+
+// ApplySnapshot applies a snapshot received from the leader to memory storage
+func (rs *RaftStorage) ApplySnapshot(snapshot raftpb.Snapshot) {
+	if err := rs.ram.ApplySnapshot(snapshot); err != nil {
+		if err == raft.ErrSnapOutOfDate {
+			rs.lg.Warnf("Attempted to apply out-of-date snapshot at Term %d and Index %d",
+				snapshot.Metadata.Term, snapshot.Metadata.Index)
+		} else {
+			rs.lg.Panicf("Unexpected programming error: %s", err)
+		}
+	}
+}
+
+// Close closes the WAL, if any
+func (rs *RaftStorage) Close() error {
+	if rs.wal == nil {
+		return nil
+	}
+	return rs.wal.Close()
+}
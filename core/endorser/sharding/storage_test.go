@@ -0,0 +1,119 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+func TestRaftStorageReload(t *testing.T) {
+	dir := t.TempDir()
+	walDir, snapDir := filepath.Join(dir, "wal"), filepath.Join(dir, "snap")
+
+	store, err := CreateStorage(logger, walDir, snapDir)
+	require.NoError(t, err)
+	require.True(t, store.Persistent())
+
+	var entries []raftpb.Entry
+	for i := uint64(1); i <= 10; i++ {
+		entries = append(entries, raftpb.Entry{Index: i, Term: 1, Data: []byte(fmt.Sprintf("entry-%d", i))})
+	}
+	err = store.Store(entries, raftpb.HardState{Term: 1, Commit: 10}, raftpb.Snapshot{})
+	require.NoError(t, err)
+
+	store.SnapshotCatchUpEntries = 2
+	err = store.TakeSnapshot(8, raftpb.ConfState{Voters: []uint64{1}}, []byte("state"))
+	require.NoError(t, err)
+	require.NoError(t, store.Close())
+
+	store, err = CreateStorage(logger, walDir, snapDir)
+	require.NoError(t, err)
+	defer store.Close()
+
+	snapshot := store.Snapshot()
+	require.Equal(t, uint64(8), snapshot.Metadata.Index)
+	require.Equal(t, []byte("state"), snapshot.Data)
+	require.Equal(t, uint64(10), store.HardState().Commit)
+
+	last, err := store.ram.LastIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(10), last)
+	first, err := store.ram.FirstIndex()
+	require.NoError(t, err)
+	require.Equal(t, uint64(9), first)
+}
+
+func TestMemoryStorage(t *testing.T) {
+	store := NewMemoryStorage(logger)
+	require.False(t, store.Persistent())
+	require.NoError(t, store.Store([]raftpb.Entry{{Index: 1, Term: 1}}, raftpb.HardState{Term: 1, Commit: 1}, raftpb.Snapshot{}))
+	require.NoError(t, store.TakeSnapshot(1, raftpb.ConfState{Voters: []uint64{1}}, nil))
+	require.NoError(t, store.Close())
+}
+
+func TestShardLeaderRestart(t *testing.T) {
+	dir := t.TempDir()
+	config := ShardConfig{
+		ShardID:          "restart",
+		ReplicaNodes:     []string{"node1"},
+		ReplicaID:        1,
+		WALDir:           filepath.Join(dir, "wal"),
+		SnapDir:          filepath.Join(dir, "snap"),
+		SnapshotInterval: 3,
+	}
+
+	sl, err := NewShardLeader(config, 10*time.Millisecond, 1)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		sl.node.Campaign(context.Background())
+		return sl.node.Status().Lead == config.ReplicaID
+	}, 10*time.Second, 50*time.Millisecond)
+
+	for i := 0; i < 5; i++ {
+		sl.ProposeC() <- &PrepareRequest{
+			TxID:      fmt.Sprintf("tx%d", i),
+			ShardID:   "restart",
+			WriteSet:  map[string][]byte{fmt.Sprintf("key%d", i): []byte("value")},
+			Timestamp: time.Now(),
+		}
+		select {
+		case proof := <-sl.CommitC():
+			require.Equal(t, fmt.Sprintf("tx%d", i), proof.TxID)
+		case <-time.After(10 * time.Second):
+			t.Fatalf("timed out waiting for proof of tx%d", i)
+		}
+	}
+	sl.Stop()
+	require.NotZero(t, sl.snapshotIndex)
+
+	sl, err = NewShardLeader(config, 10*time.Millisecond, 1)
+	require.NoError(t, err)
+	defer sl.Stop()
+
+	require.Eventually(t, func() bool {
+		sl.variableMapLock.RLock()
+		defer sl.variableMapLock.RUnlock()
+		return len(sl.variableMap) == 5
+	}, 10*time.Second, 10*time.Millisecond)
+
+	sl.variableMapLock.RLock()
+	require.Equal(t, "tx4", sl.variableMap["key4"].DependentTxID)
+	sl.variableMapLock.RUnlock()
+
+	select {
+	case proof := <-sl.CommitC():
+		t.Fatalf("replayed entry produced proof for %s", proof.TxID)
+	default:
+	}
+}
@@ -0,0 +1,154 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"sort"
+
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/pkg/errors"
+)
+
+// Config is the sharding configuration of a peer
+type Config struct {
+	// Topology is nil if the shards of this peer are not replicated
+	Topology *Topology
+	// Shards are the shards created when the peer starts
+	Shards map[string]ShardConfig
+	// Partitioning assigns the keys of contracts to shards
+	Partitioning PartitionConfig
+	// Batching tunes how the shards batch their prepare requests
+	Batching Batching
+	// Admission bounds the prepares each shard handles at once
+	Admission AdmissionConfig
+	// ExpiryBlocks is the number of notified blocks after which the shards
+	// roll back a prepared transaction that was neither committed nor aborted
+	ExpiryBlocks uint64
+}
+
+// Replica is an endorser that replicates the shards of a channel
+type Replica struct {
+	// ID is the raft ID of the replica. The replicas of a topology are
+	// numbered from 1.
+	ID uint64
+	// Address is the endpoint of the peer that hosts the replica
+	Address string
+	// TLSCert is the PEM encoded TLS certificate the replica presents
+	TLSCert []byte
+}
+
+// Topology describes the endorsers that replicate every shard. The raft
+// messages of all shards are exchanged through the shard service of the
+// peers of the replicas.
+type Topology struct {
+	// ReplicaID is the raft ID of this peer in every shard
+	ReplicaID uint64
+	// Replicas are the endorsers that replicate every shard
+	Replicas []Replica
+	// Join is set on a replica that is added to running shards. Its shards
+	// start without members and learn the membership from their leader, so
+	// the replica IDs do not need to be numbered without gaps.
+	Join bool
+	// ServerConfig and ClientConfig are the comm configs of the peer the
+	// shard transport is built from
+	ServerConfig comm.ServerConfig
+	ClientConfig comm.ClientConfig
+}
+
+// Validate checks that the replicas are numbered from 1 without gaps, unless
+// the peer joins running shards, that this peer is one of them and that
+// their TLS certificates are valid. The replicas are sorted by ID.
+func (t *Topology) Validate() error {
+	if len(t.Replicas) == 0 {
+		return errors.New("no shard replicas configured")
+	}
+
+	replicas := append([]Replica(nil), t.Replicas...)
+	sort.Slice(replicas, func(i, j int) bool { return replicas[i].ID < replicas[j].ID })
+	member := false
+	for i, replica := range replicas {
+		if !t.Join && replica.ID != uint64(i+1) {
+			return errors.Errorf("shard replica IDs must be numbered from 1 without gaps, found %d at position %d", replica.ID, i+1)
+		}
+		if err := replica.Validate(); err != nil {
+			return err
+		}
+		member = member || replica.ID == t.ReplicaID
+	}
+	if !member {
+		return errors.Errorf("replica ID %d of this peer is not a configured shard replica", t.ReplicaID)
+	}
+
+	t.Replicas = replicas
+	return nil
+}
+
+// Validate checks that the replica has an ID, an address with a port and, if
+// set, a valid TLS certificate
+func (r Replica) Validate() error {
+	if r.ID == 0 {
+		return errors.New("shard replica IDs must be greater than 0")
+	}
+	if _, _, err := net.SplitHostPort(r.Address); err != nil {
+		return errors.Wrapf(err, "invalid address of shard replica %d", r.ID)
+	}
+	if r.TLSCert == nil {
+		return nil
+	}
+	block, _ := pem.Decode(r.TLSCert)
+	if block == nil {
+		return errors.Errorf("TLS certificate of shard replica %d is not PEM encoded", r.ID)
+	}
+	if _, err := x509.ParseCertificate(block.Bytes); err != nil {
+		return errors.Wrapf(err, "invalid TLS certificate of shard replica %d", r.ID)
+	}
+	return nil
+}
+
+// ShardConfig returns the config of a shard replicated by every replica of
+// the topology
+func (t *Topology) ShardConfig(shardID string) ShardConfig {
+	nodes := make([]string, len(t.Replicas))
+	for i, replica := range t.Replicas {
+		nodes[i] = replica.Address
+	}
+	return ShardConfig{
+		ShardID:      shardID,
+		ReplicaNodes: nodes,
+		ReplicaID:    t.ReplicaID,
+		Join:         t.Join,
+	}
+}
+
+// PeerConfig returns the addresses of the other replicas
+func (t *Topology) PeerConfig() PeerConfig {
+	peers := make(PeerConfig)
+	for _, replica := range t.Replicas {
+		if replica.ID != t.ReplicaID {
+			peers[replica.ID] = replica.Address
+		}
+	}
+	return peers
+}
+
+// TransportConfig returns the config of the transport of the shards
+func (t *Topology) TransportConfig() TransportConfig {
+	certs := make(map[uint64][]byte)
+	for _, replica := range t.Replicas {
+		if replica.TLSCert != nil {
+			certs[replica.ID] = replica.TLSCert
+		}
+	}
+	return TransportConfig{
+		ServerConfig: t.ServerConfig,
+		ClientConfig: t.ClientConfig,
+		ReplicaCerts: certs,
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Topology", func() {
+	var topology *sharding.Topology
+
+	BeforeEach(func() {
+		topology = &sharding.Topology{
+			ReplicaID: 2,
+			Replicas: []sharding.Replica{
+				{ID: 3, Address: "peer2.example.com:7051"},
+				{ID: 1, Address: "peer0.example.com:7051"},
+				{ID: 2, Address: "peer1.example.com:7051"},
+			},
+		}
+	})
+
+	It("orders the replicas by ID", func() {
+		Expect(topology.Validate()).To(Succeed())
+		Expect(topology.Replicas[0].Address).To(Equal("peer0.example.com:7051"))
+		Expect(topology.Replicas[2].Address).To(Equal("peer2.example.com:7051"))
+	})
+
+	It("rejects replica IDs that are not numbered from 1", func() {
+		topology.Replicas[0].ID = 4
+		Expect(topology.Validate()).To(MatchError("shard replica IDs must be numbered from 1 without gaps, found 4 at position 3"))
+	})
+
+	It("allows gaps between the replica IDs of a joining peer", func() {
+		topology.Join = true
+		topology.Replicas[0].ID = 4
+		Expect(topology.Validate()).To(Succeed())
+		Expect(topology.ShardConfig("registry").Join).To(BeTrue())
+	})
+
+	It("rejects a peer that is not a replica", func() {
+		topology.ReplicaID = 4
+		Expect(topology.Validate()).To(MatchError("replica ID 4 of this peer is not a configured shard replica"))
+	})
+
+	It("rejects a replica without port", func() {
+		topology.Replicas[0].Address = "peer2.example.com"
+		Expect(topology.Validate()).To(MatchError(ContainSubstring("invalid address of shard replica 3")))
+	})
+
+	It("rejects a TLS certificate that is not PEM encoded", func() {
+		topology.Replicas[0].TLSCert = []byte("certificate")
+		Expect(topology.Validate()).To(MatchError("TLS certificate of shard replica 3 is not PEM encoded"))
+	})
+
+	It("replicates a shard on every replica", func() {
+		Expect(topology.Validate()).To(Succeed())
+
+		Expect(topology.ShardConfig("registry")).To(Equal(sharding.ShardConfig{
+			ShardID:      "registry",
+			ReplicaNodes: []string{"peer0.example.com:7051", "peer1.example.com:7051", "peer2.example.com:7051"},
+			ReplicaID:    2,
+		}))
+		Expect(topology.PeerConfig()).To(Equal(sharding.PeerConfig{
+			1: "peer0.example.com:7051",
+			3: "peer2.example.com:7051",
+		}))
+	})
+
+	It("replicates every shard through one transport per replica", func() {
+		addresses := []string{freeAddress(), freeAddress()}
+		var managers []*sharding.ShardManager
+		for id := uint64(1); id <= 2; id++ {
+			topology := &sharding.Topology{
+				ReplicaID: id,
+				Replicas:  []sharding.Replica{{ID: 1, Address: addresses[0]}, {ID: 2, Address: addresses[1]}},
+			}
+			Expect(topology.Validate()).To(Succeed())
+			m := sharding.NewShardManager("", nil, topology, nil, nil)
+			DeferCleanup(m.Shutdown)
+			Expect(m.Transport().Start(addresses[id-1])).To(Succeed())
+			managers = append(managers, m)
+		}
+
+		// the shards are created on the second replica by the messages of the first
+		for _, contract := range []string{"registry", "ledger"} {
+			_, err := sharding.NewCoordinator(managers[0]).Prepare(electionContext(), contract, &sharding.PrepareRequest{
+				TxID:      "tx1-" + contract,
+				WriteSet:  map[string][]byte{contract + ":key1": []byte("value1")},
+				Timestamp: time.Now(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+		}
+
+		for _, contract := range []string{"registry", "ledger"} {
+			bundle, err := sharding.NewCoordinator(managers[1]).Prepare(electionContext(), contract, &sharding.PrepareRequest{
+				TxID:      "tx2-" + contract,
+				ReadSet:   map[string][]byte{contract + ":key1": nil},
+				Timestamp: time.Now(),
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(bundle.DependentTxIDs()).To(Equal([]string{"tx1-" + contract}))
+		}
+	})
+})
+
+// freeAddress returns a local address that is not in use
+func freeAddress() string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	Expect(err).NotTo(HaveOccurred())
+	defer lis.Close()
+	return lis.Addr().String()
+}
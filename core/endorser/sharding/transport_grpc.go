@@ -1,77 +1,181 @@
 package sharding
 
 import (
+	"bytes"
 	"context"
+	"crypto/x509"
+	"encoding/pem"
 	"fmt"
+	"io"
 	"net"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/hyperledger/fabric/common/metrics/disabled"
+	"github.com/hyperledger/fabric/common/util"
 	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	"github.com/pkg/errors"
+	"go.etcd.io/etcd/raft/v3"
 	"go.etcd.io/etcd/raft/v3/raftpb"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// DefaultSendBufferSize is the number of messages of a shard queued for a
+// replica before further messages to it are dropped
+const DefaultSendBufferSize = 256
+
+// removalGracePeriod is the time a replica removed from a shard is still sent
+// messages, so that the messages that commit its removal reach it
+const removalGracePeriod = time.Second
+
 // PeerConfig maps NodeID to Address (host:port)
 type PeerConfig map[uint64]string
 
-// Transport manages network communication for a shard node
+// ShardResolver returns the shard that the messages received for a shard ID
+// are routed to when the shard is not registered with the transport
+type ShardResolver func(shardID string) (*ShardLeader, error)
+
+// TransportConfig configures the gRPC server and clients of a transport.
+// When the server config enables TLS, replicas authenticate each other with
+// mutual TLS: every replica must present the TLS certificate it is expected
+// to present, both as a server and as a client. The certificates must be
+// self-signed or issued by one of the TLS root CAs of the configs.
+type TransportConfig struct {
+	// ServerConfig is the config of the gRPC server that hosts the transport
+	ServerConfig comm.ServerConfig
+	// ClientConfig is the config of the connections to the other replicas.
+	// Its TLS certificate and key are those of the server when it has none.
+	ClientConfig comm.ClientConfig
+	// ReplicaCerts maps the ID of every replica to the PEM encoded TLS
+	// certificate it presents
+	ReplicaCerts map[uint64][]byte
+	// SendBufferSize is the number of messages of a shard queued for a
+	// replica before further messages to it are dropped.
+	// DefaultSendBufferSize is used if 0.
+	SendBufferSize int
+	// Metrics are updated by the transport if set
+	Metrics *Metrics
+}
+
+// Transport carries the raft messages of every shard hosted by a peer. The
+// messages of all shards share one connection to each replica and are routed
+// to their shard by shard ID on arrival.
 type Transport struct {
 	protos.UnimplementedShardCommunicationServer
 	nodeID     uint64
-	address    string
 	peers      PeerConfig
-	leader     *ShardLeader
-	grpcServer *grpc.Server
+	config     TransportConfig
+	resolve    ShardResolver
+	replicaIDs map[string]uint64
+	metrics    *Metrics
+	ingress    metrics.Gauge
+	grpcServer *comm.GRPCServer
 	clients    map[uint64]protos.ShardCommunicationClient
 	clientConn map[uint64]*grpc.ClientConn
+	shards     map[string]*shardRoute
+	stopped    bool
 	mu         sync.RWMutex
-	stopC      chan struct{}
 }
 
-// NewTransport creates a new gRPC transport
-func NewTransport(nodeID uint64, address string, peers PeerConfig, leader *ShardLeader) *Transport {
-	return &Transport{
+// NewTransport creates a new gRPC transport for the replica nodeID. A config
+// without TLS leaves the replicas unauthenticated and is only meant for tests
+// and local clusters. Messages for shards that are not registered are routed
+// to the shard returned by resolve, if set.
+func NewTransport(nodeID uint64, peers PeerConfig, config TransportConfig, resolve ShardResolver) *Transport {
+	m := config.Metrics
+	if m == nil {
+		m = NewMetrics(&disabled.Provider{})
+	}
+	// the peers and certificates change with the membership of the shards
+	t := &Transport{
 		nodeID:     nodeID,
-		address:    address,
-		peers:      peers,
-		leader:     leader,
+		peers:      make(PeerConfig),
+		config:     config,
+		resolve:    resolve,
+		replicaIDs: make(map[string]uint64),
+		metrics:    m,
+		ingress:    m.IngressStreamCount,
 		clients:    make(map[uint64]protos.ShardCommunicationClient),
 		clientConn: make(map[uint64]*grpc.ClientConn),
-		stopC:      make(chan struct{}),
+		shards:     make(map[string]*shardRoute),
+	}
+
+	for id, address := range peers {
+		t.peers[id] = address
+	}
+	t.config.ReplicaCerts = make(map[uint64][]byte)
+	for id, certPEM := range config.ReplicaCerts {
+		t.addReplicaCert(id, certPEM)
 	}
+	if !config.ServerConfig.SecOpts.UseTLS {
+		logger.Warningf("Shard transport of replica %d does not use TLS, replicas are not authenticated", nodeID)
+	}
+
+	return t
 }
 
-// Start starts the gRPC server and message consumer
-func (t *Transport) Start() error {
-	lis, err := net.Listen("tcp", t.address)
+// Start serves the transport on its own gRPC server listening on address.
+// Transports hosted on the gRPC server of the peer are registered with that
+// server instead.
+func (t *Transport) Start(address string) error {
+	serverConfig := t.config.ServerConfig
+	if serverConfig.SecOpts.UseTLS {
+		serverConfig.SecOpts.RequireClientCert = true
+		t.mu.RLock()
+		serverConfig.SecOpts.ClientRootCAs = t.clientRootCAs()
+		t.mu.RUnlock()
+		serverConfig.SecOpts.VerifyCertificate = t.verifyReplica
+	}
+
+	lis, err := net.Listen("tcp", address)
 	if err != nil {
 		return fmt.Errorf("failed to listen: %v", err)
 	}
 
-	t.grpcServer = grpc.NewServer()
-	protos.RegisterShardCommunicationServer(t.grpcServer, t)
+	server, err := comm.NewGRPCServerFromListener(lis, serverConfig)
+	if err != nil {
+		lis.Close()
+		return errors.WithMessage(err, "failed to create shard gRPC server")
+	}
+	protos.RegisterShardCommunicationServer(server.Server(), t)
+	t.mu.Lock()
+	t.grpcServer = server
+	t.mu.Unlock()
 
 	// Start server
 	go func() {
-		if err := t.grpcServer.Serve(lis); err != nil {
+		if err := server.Start(); err != nil {
 			logger.Errorf("gRPC server error: %v", err)
 		}
 	}()
 
-	// Start message consumer
-	go t.consumeMessages()
-
 	return nil
 }
 
-// Stop stops the transport
+// Stop stops the gRPC server started by Start, the routes of every shard and
+// the connections to the other replicas
 func (t *Transport) Stop() {
-	close(t.stopC)
-	if t.grpcServer != nil {
-		t.grpcServer.Stop()
+	t.mu.RLock()
+	server := t.grpcServer
+	t.mu.RUnlock()
+	if server != nil {
+		server.Stop()
 	}
+
+	t.mu.Lock()
+	routes := t.shards
+	t.shards = make(map[string]*shardRoute)
+	t.stopped = true
+	t.mu.Unlock()
+	for _, route := range routes {
+		route.stop()
+	}
+
 	t.mu.Lock()
 	defer t.mu.Unlock()
 	for _, conn := range t.clientConn {
@@ -79,62 +183,443 @@ func (t *Transport) Stop() {
 	}
 }
 
-// Step receives a message from a peer (gRPC handler)
-func (t *Transport) Step(ctx context.Context, req *protos.RaftMessageProto) (*protos.StepResponse, error) {
+// AddShard routes the messages of the shard through the transport
+func (t *Transport) AddShard(leader *ShardLeader) {
+	t.mu.Lock()
+	if _, exists := t.shards[leader.shardID]; exists || t.stopped {
+		t.mu.Unlock()
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	route := &shardRoute{
+		transport: t,
+		leader:    leader,
+		streams:   t.metrics.EgressStreamCount.With("shard", leader.shardID),
+		senders:   make(map[uint64]*sender),
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	t.shards[leader.shardID] = route
+
+	route.wg.Add(1)
+	go route.consumeMessages()
+	t.mu.Unlock()
+
+	// the replicas added to the shard at runtime are not part of the
+	// configuration of the transport
+	leader.observeReplicas(func(replica Replica, removed bool) {
+		t.updatePeer(leader.shardID, replica, removed)
+	})
+	leader.setForwarder(func(ctx context.Context, leaderID uint64, batch []*PrepareRequest) ([]*PrepareProof, error) {
+		return t.forward(ctx, leaderID, leader.shardID, batch)
+	})
+}
+
+// RemoveShard stops routing the messages of the shard
+func (t *Transport) RemoveShard(shardID string) {
+	t.mu.Lock()
+	route, exists := t.shards[shardID]
+	delete(t.shards, shardID)
+	t.mu.Unlock()
+
+	if exists {
+		route.leader.observeReplicas(nil)
+		route.leader.setForwarder(nil)
+		route.stop()
+	}
+}
+
+// AddPeer adds a replica to the peers of the transport or updates its
+// address and TLS certificate. The connection to a replica that changed is
+// reopened.
+func (t *Transport) AddPeer(replica Replica) {
+	if replica.ID == t.nodeID {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.peers[replica.ID] == replica.Address && bytes.Equal(t.config.ReplicaCerts[replica.ID], replica.TLSCert) {
+		return
+	}
+	t.peers[replica.ID] = replica.Address
+	if replica.TLSCert != nil {
+		t.removeReplicaCert(replica.ID)
+		t.addReplicaCert(replica.ID, replica.TLSCert)
+		if t.grpcServer != nil && t.config.ServerConfig.SecOpts.UseTLS {
+			if err := t.grpcServer.SetClientRootCAs(t.clientRootCAs()); err != nil {
+				logger.Errorf("Failed to trust the TLS certificate of shard replica %d: %v", replica.ID, err)
+			}
+		}
+	}
+	t.closeClient(replica.ID)
+	logger.Infof("Shard replica %d is at %s", replica.ID, replica.Address)
+}
+
+// RemovePeer removes a replica from the peers of the transport and closes the
+// connection to it. Messages from the replica are rejected from now on.
+func (t *Transport) RemovePeer(id uint64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.peers, id)
+	t.removeReplicaCert(id)
+	t.closeClient(id)
+	logger.Infof("Shard replica %d was removed", id)
+}
+
+// Peers returns the addresses of the other replicas
+func (t *Transport) Peers() PeerConfig {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	peers := make(PeerConfig, len(t.peers))
+	for id, address := range t.peers {
+		peers[id] = address
+	}
+	return peers
+}
+
+// updatePeer applies a membership change of a shard to the peers. A removed
+// replica remains a peer as long as another shard has it as a member.
+func (t *Transport) updatePeer(shardID string, replica Replica, removed bool) {
+	if !removed {
+		t.AddPeer(replica)
+		return
+	}
+	time.AfterFunc(removalGracePeriod, func() { t.releasePeer(shardID, replica.ID) })
+}
+
+// releasePeer stops sending the messages of a shard to a replica removed from
+// it and removes the replica once no shard has it as a member
+func (t *Transport) releasePeer(shardID string, id uint64) {
+	t.mu.RLock()
+	route, exists := t.shards[shardID]
+	t.mu.RUnlock()
+	if exists && !route.leader.isMember(id) {
+		route.removeSender(id)
+	}
+
+	t.mu.RLock()
+	for _, route := range t.shards {
+		if route.leader.isMember(id) {
+			t.mu.RUnlock()
+			return
+		}
+	}
+	stopped := t.stopped
+	t.mu.RUnlock()
+	if !stopped {
+		t.RemovePeer(id)
+	}
+}
+
+// closeClient closes the connection to a replica. The caller holds the lock.
+func (t *Transport) closeClient(id uint64) {
+	if conn, exists := t.clientConn[id]; exists {
+		conn.Close()
+	}
+	delete(t.clients, id)
+	delete(t.clientConn, id)
+}
+
+// addReplicaCert identifies a replica by the DER encoding of its TLS
+// certificate. The caller holds the lock.
+func (t *Transport) addReplicaCert(id uint64, certPEM []byte) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		logger.Errorf("TLS certificate of shard replica %d is not PEM encoded, its messages are rejected", id)
+		return
+	}
+	t.config.ReplicaCerts[id] = certPEM
+	t.replicaIDs[string(block.Bytes)] = id
+}
+
+// removeReplicaCert forgets the TLS certificate of a replica. The caller
+// holds the lock.
+func (t *Transport) removeReplicaCert(id uint64) {
+	delete(t.config.ReplicaCerts, id)
+	for der, replicaID := range t.replicaIDs {
+		if replicaID == id {
+			delete(t.replicaIDs, der)
+		}
+	}
+}
+
+// shard returns the shard the messages for the shard ID are routed to
+func (t *Transport) shard(shardID string) (*ShardLeader, error) {
+	t.mu.RLock()
+	route, exists := t.shards[shardID]
+	stopped := t.stopped
+	t.mu.RUnlock()
+	if exists {
+		return route.leader, nil
+	}
+	if stopped {
+		return nil, errors.New("shard transport is stopped")
+	}
+	if t.resolve == nil {
+		return nil, errors.Errorf("unknown shard %s", shardID)
+	}
+	return t.resolve(shardID)
+}
+
+// clientRootCAs returns the CAs of the clients the server accepts. Clients
+// only present certificates issued by a CA the server announces, so the TLS
+// roots of the peer are trusted along with the certificates of the replicas.
+// The caller holds the lock when the transport is running.
+func (t *Transport) clientRootCAs() [][]byte {
+	roots := make([][]byte, 0, len(t.config.ReplicaCerts))
+	for _, cert := range t.config.ReplicaCerts {
+		roots = append(roots, cert)
+	}
+	roots = append(roots, t.config.ServerConfig.SecOpts.ClientRootCAs...)
+	return append(roots, t.config.ClientConfig.SecOpts.ServerRootCAs...)
+}
+
+// replicaID returns the ID of the replica that presents the DER encoded TLS
+// certificate
+func (t *Transport) replicaID(rawCert []byte) (uint64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	id, ok := t.replicaIDs[string(rawCert)]
+	return id, ok
+}
+
+// verifyReplica rejects TLS handshakes with a party that does not present
+// the certificate of a replica
+func (t *Transport) verifyReplica(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return errors.New("no TLS certificate presented")
+	}
+	if _, ok := t.replicaID(rawCerts[0]); !ok {
+		return errors.New("TLS certificate does not belong to a shard replica")
+	}
+	return nil
+}
+
+// authenticate checks that the message was sent over a TLS connection by the
+// replica it claims to be sent by. Without TLS, messages are not checked.
+func (t *Transport) authenticate(ctx context.Context, msg raftpb.Message) error {
+	if !t.config.ServerConfig.SecOpts.UseTLS {
+		return nil
+	}
+	id, ok := t.replicaID(util.ExtractRawCertificateFromContext(ctx))
+	if !ok {
+		return status.Errorf(codes.Unauthenticated, "sender of message from replica %d is not a shard replica", msg.From)
+	}
+	if msg.From != id {
+		return status.Errorf(codes.PermissionDenied, "replica %d sent a message from replica %d", id, msg.From)
+	}
+	return nil
+}
+
+// deliver steps a received message into its shard. It returns an error if
+// the sender may not send the message.
+func (t *Transport) deliver(ctx context.Context, req *protos.RaftMessageProto) (*protos.StepResponse, error) {
 	var msg raftpb.Message
 	if err := msg.Unmarshal(req.Data); err != nil {
 		return &protos.StepResponse{Success: false, Error: err.Error()}, nil
 	}
 
-	if err := t.leader.Step(ctx, msg); err != nil {
+	if err := t.authenticate(ctx, msg); err != nil {
+		logger.Warningf("Rejected raft message of shard %s for replica %d: %s", req.ShardId, t.nodeID, err)
+		return nil, err
+	}
+
+	leader, err := t.shard(req.ShardId)
+	if err != nil {
+		return &protos.StepResponse{Success: false, Error: err.Error()}, nil
+	}
+	if err := leader.Step(ctx, msg); err != nil {
 		return &protos.StepResponse{Success: false, Error: err.Error()}, nil
 	}
 
 	return &protos.StepResponse{Success: true}, nil
 }
 
-// consumeMessages reads outgoing messages from ShardLeader and sends them
-func (t *Transport) consumeMessages() {
+// Step receives a message from a peer (gRPC handler)
+func (t *Transport) Step(ctx context.Context, req *protos.RaftMessageProto) (*protos.StepResponse, error) {
+	return t.deliver(ctx, req)
+}
+
+// Stream receives the messages of a peer in order (gRPC handler). A stream is
+// closed as soon as it carries a message from another replica than the one
+// that opened it.
+func (t *Transport) Stream(stream protos.ShardCommunication_StreamServer) error {
+	t.ingress.Add(1)
+	defer t.ingress.Add(-1)
+
 	for {
-		select {
-		case msgs := <-t.leader.MessagesC():
-			for _, msg := range msgs {
-				go t.send(msg)
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		resp, err := t.deliver(stream.Context(), req)
+		if err != nil {
+			return err
+		}
+		if !resp.Success {
+			if err := stream.Send(resp); err != nil {
+				return err
 			}
-		case <-t.stopC:
-			return
 		}
 	}
 }
 
-// send sends a single Raft message to a peer
-func (t *Transport) send(msg raftpb.Message) {
-	client, err := t.getClient(msg.To)
+// ChangeMembership adds, removes or replaces a replica of a shard led by this
+// replica (gRPC handler). With TLS, only replicas may change the membership.
+func (t *Transport) ChangeMembership(ctx context.Context, req *protos.MembershipRequest) (*protos.MembershipResponse, error) {
+	if err := t.authenticateReplica(ctx); err != nil {
+		return nil, err
+	}
+
+	t.mu.RLock()
+	route, exists := t.shards[req.ShardId]
+	t.mu.RUnlock()
+	if !exists {
+		return nil, status.Errorf(codes.NotFound, "unknown shard %s", req.ShardId)
+	}
+	leader := route.leader
+
+	var replica Replica
+	if req.Replica != nil {
+		replica = Replica{ID: req.Replica.Id, Address: req.Replica.Address, TLSCert: req.Replica.TlsCert}
+	}
+
+	var err error
+	switch req.Operation {
+	case protos.MembershipOperation_ADD_REPLICA:
+		err = leader.AddReplica(ctx, replica)
+	case protos.MembershipOperation_REMOVE_REPLICA:
+		err = leader.RemoveReplica(ctx, req.RemovedId)
+	case protos.MembershipOperation_REPLACE_REPLICA:
+		err = leader.ReplaceReplica(ctx, req.RemovedId, replica)
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown membership operation %d", req.Operation)
+	}
+	if errors.Cause(err) == ErrNotLeader {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
 	if err != nil {
-		logger.Errorf("Failed to get client for node %d: %v", msg.To, err)
-		return
+		return nil, status.Error(codes.Unknown, err.Error())
 	}
 
-	data, err := msg.Marshal()
+	membership := leader.Membership()
+	return &protos.MembershipResponse{Voters: membership.Voters, Learners: membership.Learners}, nil
+}
+
+// Forward prepares a batch forwarded by a follower on the shard led by this
+// replica (gRPC handler)
+func (t *Transport) Forward(ctx context.Context, req *protos.ForwardRequest) (*protos.ForwardResponse, error) {
+	if err := t.authenticateReplica(ctx); err != nil {
+		return nil, err
+	}
+
+	leader, err := t.shard(req.ShardId)
 	if err != nil {
-		logger.Errorf("Failed to marshal raft message: %v", err)
-		return
+		return nil, status.Error(codes.NotFound, err.Error())
 	}
 
-	req := &protos.RaftMessageProto{
-		Data: data,
+	pbBatch := &PrepareRequestBatch{}
+	if err := pbBatch.Unmarshal(req.Batch); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid batch: %s", err)
+	}
+	proofs, err := leader.PrepareBatch(ctx, pbBatch.prepareRequests())
+	if errors.Cause(err) == ErrNotLeader {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Unknown, err.Error())
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+	resp := &protos.ForwardResponse{LeaderId: t.nodeID}
+	for _, proof := range proofs {
+		resp.Proofs = append(resp.Proofs, NewDependencyInfo(proof))
+	}
+	return resp, nil
+}
+
+// QueryDependencies returns the transactions that own or read keys of a
+// shard served by this replica (gRPC handler)
+func (t *Transport) QueryDependencies(ctx context.Context, req *protos.DependencyQuery) (*protos.DependencyQueryResponse, error) {
+	if err := t.authenticateReplica(ctx); err != nil {
+		return nil, err
+	}
 
-	_, err = client.Step(ctx, req)
+	leader, err := t.shard(req.ShardId)
+	if err != nil {
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+
+	result, err := leader.QueryDependencies(ctx, req.Keys)
+	if _, ok := errors.Cause(err).(*NoLeaderError); ok {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
 	if err != nil {
-		logger.Warnf("Failed to send message to node %d: %v", msg.To, err)
+		return nil, status.Error(codes.Unknown, err.Error())
 	}
+
+	resp := &protos.DependencyQueryResponse{ReadIndex: result.ReadIndex}
+	for _, key := range result.Keys {
+		resp.Keys = append(resp.Keys, &protos.KeyDependency{Key: key.Key, OwnerTxId: key.OwnerTxID, ReaderTxIds: key.ReaderTxIDs})
+	}
+	return resp, nil
 }
 
-// getClient returns or creates a gRPC client for a node
+// forward prepares a batch of a shard on its leader
+func (t *Transport) forward(ctx context.Context, leaderID uint64, shardID string, batch []*PrepareRequest) ([]*PrepareProof, error) {
+	client, err := t.getClient(leaderID)
+	if err != nil {
+		return nil, errors.WithMessage(errLeaderUnreachable, err.Error())
+	}
+
+	data, err := newPrepareRequestBatch(batch).Marshal()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to marshal batch")
+	}
+
+	resp, err := client.Forward(ctx, &protos.ForwardRequest{ShardId: shardID, Batch: data})
+	switch status.Code(err) {
+	case codes.OK:
+	case codes.FailedPrecondition:
+		return nil, errors.WithMessage(ErrNotLeader, status.Convert(err).Message())
+	case codes.Unavailable:
+		return nil, errors.WithMessage(errLeaderUnreachable, status.Convert(err).Message())
+	default:
+		return nil, err
+	}
+	if len(resp.Proofs) != len(batch) {
+		return nil, errors.Errorf("leader %d returned %d proofs for a batch of %d requests", leaderID, len(resp.Proofs), len(batch))
+	}
+
+	proofs := make([]*PrepareProof, len(resp.Proofs))
+	for i, info := range resp.Proofs {
+		proofs[i] = ProofFromDependencyInfo(info)
+		proofs[i].LeaderID = resp.LeaderId
+	}
+	return proofs, nil
+}
+
+// authenticateReplica checks that the caller of an RPC is a replica. Without
+// TLS, callers are not checked.
+func (t *Transport) authenticateReplica(ctx context.Context) error {
+	if !t.config.ServerConfig.SecOpts.UseTLS {
+		return nil
+	}
+	if _, ok := t.replicaID(util.ExtractRawCertificateFromContext(ctx)); !ok {
+		return status.Error(codes.Unauthenticated, "caller is not a shard replica")
+	}
+	return nil
+}
+
+// getClient returns or creates a gRPC client for a node. The client is
+// shared by the shards.
 func (t *Transport) getClient(nodeID uint64) (protos.ShardCommunicationClient, error) {
 	t.mu.RLock()
 	client, exists := t.clients[nodeID]
@@ -157,7 +642,7 @@ func (t *Transport) getClient(nodeID uint64) (protos.ShardCommunicationClient, e
 	}
 
 	// Connect
-	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := t.clientConfig(nodeID).Dial(addr)
 	if err != nil {
 		return nil, err
 	}
@@ -168,3 +653,258 @@ func (t *Transport) getClient(nodeID uint64) (protos.ShardCommunicationClient, e
 
 	return client, nil
 }
+
+// clientConfig returns the config of the connection to a replica. With TLS,
+// the connection presents the certificate of this replica and only accepts
+// the certificate of the replica it connects to.
+func (t *Transport) clientConfig(nodeID uint64) comm.ClientConfig {
+	config := t.config.ClientConfig
+	// connect in the background so that an unreachable replica does not
+	// hold up the messages to the others
+	config.AsyncConnect = true
+	if config.DialTimeout == 0 {
+		config.DialTimeout = comm.DefaultConnectionTimeout
+	}
+	if !t.config.ServerConfig.SecOpts.UseTLS {
+		return config
+	}
+
+	serverSecOpts := t.config.ServerConfig.SecOpts
+	config.SecOpts.UseTLS = true
+	config.SecOpts.RequireClientCert = true
+	if config.SecOpts.Certificate == nil {
+		config.SecOpts.Certificate = serverSecOpts.Certificate
+		config.SecOpts.Key = serverSecOpts.Key
+	}
+	expected := t.config.ReplicaCerts[nodeID]
+	config.SecOpts.ServerRootCAs = append([][]byte{expected}, config.SecOpts.ServerRootCAs...)
+	config.SecOpts.VerifyCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		block, _ := pem.Decode(expected)
+		if len(rawCerts) == 0 || block == nil || !bytes.Equal(rawCerts[0], block.Bytes) {
+			return errors.Errorf("TLS certificate does not belong to shard replica %d", nodeID)
+		}
+		return nil
+	}
+	return config
+}
+
+func (t *Transport) sendBufferSize() int {
+	if t.config.SendBufferSize > 0 {
+		return t.config.SendBufferSize
+	}
+	return DefaultSendBufferSize
+}
+
+// shardRoute carries the messages of a shard to the other replicas
+type shardRoute struct {
+	transport *Transport
+	leader    *ShardLeader
+	streams   metrics.Gauge
+	senders   map[uint64]*sender
+	mu        sync.Mutex
+	ctx       context.Context
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// stop stops the senders of the shard and waits for them to return
+func (r *shardRoute) stop() {
+	r.cancel()
+	r.wg.Wait()
+}
+
+// consumeMessages reads outgoing messages from ShardLeader and queues them
+// for their destinations
+func (r *shardRoute) consumeMessages() {
+	defer r.wg.Done()
+	for {
+		select {
+		case msgs := <-r.leader.MessagesC():
+			for _, msg := range msgs {
+				r.enqueue(msg)
+			}
+		case <-r.ctx.Done():
+			return
+		}
+	}
+}
+
+// enqueue queues a message for its destination. When the queue of the
+// destination is full, the message is dropped and the destination is
+// reported unreachable so that raft slows down replication to it.
+func (r *shardRoute) enqueue(msg raftpb.Message) {
+	s, err := r.getSender(msg.To)
+	if err != nil {
+		logger.Errorf("Failed to send message to node %d: %v", msg.To, err)
+		return
+	}
+
+	select {
+	case s.queue <- msg:
+		s.queueLength.Set(float64(len(s.queue)))
+	default:
+		logger.Warnf("Dropped message to node %d of shard %s, its send queue is full", msg.To, r.leader.shardID)
+		s.dropped.Add(1)
+		r.reportFailure(msg)
+	}
+}
+
+// reportFailure tells raft that a message could not be delivered
+func (r *shardRoute) reportFailure(msg raftpb.Message) {
+	r.leader.ReportUnreachable(msg.To)
+	if msg.Type == raftpb.MsgSnap {
+		r.leader.ReportSnapshot(msg.To, raft.SnapshotFailure)
+	}
+}
+
+// getSender returns or starts the sender of the messages to a node
+func (r *shardRoute) getSender(nodeID uint64) (*sender, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, exists := r.senders[nodeID]; exists {
+		return s, nil
+	}
+	t := r.transport
+	t.mu.RLock()
+	_, ok := t.peers[nodeID]
+	t.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown peer %d", nodeID)
+	}
+
+	labels := []string{"shard", r.leader.shardID, "replica", strconv.FormatUint(nodeID, 10)}
+	ctx, cancel := context.WithCancel(r.ctx)
+	s := &sender{
+		route:       r,
+		nodeID:      nodeID,
+		ctx:         ctx,
+		cancel:      cancel,
+		queue:       make(chan raftpb.Message, t.sendBufferSize()),
+		queueLength: t.metrics.EgressQueueLength.With(labels...),
+		sendTime:    t.metrics.MessageSendTime.With(labels...),
+		failures:    t.metrics.MessageSendFailures.With(labels...),
+		dropped:     t.metrics.MessagesDropped.With(labels...),
+	}
+	t.metrics.EgressQueueCapacity.With(labels...).Set(float64(cap(s.queue)))
+	r.senders[nodeID] = s
+
+	r.wg.Add(1)
+	go s.run()
+
+	return s, nil
+}
+
+// removeSender stops the sender of the messages to a node that is no longer
+// a member of the shard
+func (r *shardRoute) removeSender(nodeID uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, exists := r.senders[nodeID]; exists {
+		s.cancel()
+		delete(r.senders, nodeID)
+	}
+}
+
+// sender sends the messages of a shard queued for a node, in order, over a
+// stream that is opened on the first message and reopened after a failure
+type sender struct {
+	route       *shardRoute
+	nodeID      uint64
+	ctx         context.Context
+	cancel      context.CancelFunc
+	queue       chan raftpb.Message
+	queueLength metrics.Gauge
+	sendTime    metrics.Histogram
+	failures    metrics.Counter
+	dropped     metrics.Counter
+}
+
+func (s *sender) run() {
+	defer s.route.wg.Done()
+
+	var stream protos.ShardCommunication_StreamClient
+	var cancel context.CancelFunc
+	closeStream := func() {
+		if stream != nil {
+			cancel()
+			stream = nil
+			s.route.streams.Add(-1)
+		}
+	}
+	defer closeStream()
+
+	for {
+		select {
+		case msg := <-s.queue:
+			s.queueLength.Set(float64(len(s.queue)))
+
+			if stream == nil {
+				var err error
+				stream, cancel, err = s.connect()
+				if err != nil {
+					logger.Warnf("Failed to open stream to node %d: %v", s.nodeID, err)
+					s.failures.Add(1)
+					s.route.reportFailure(msg)
+					continue
+				}
+				s.route.streams.Add(1)
+			}
+
+			if err := s.send(stream, msg); err != nil {
+				logger.Warnf("Failed to send message to node %d: %v", s.nodeID, err)
+				s.failures.Add(1)
+				closeStream()
+				s.route.reportFailure(msg)
+				continue
+			}
+			if msg.Type == raftpb.MsgSnap {
+				s.route.leader.ReportSnapshot(s.nodeID, raft.SnapshotFinish)
+			}
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// connect opens a stream to the node and logs the messages it fails to step
+func (s *sender) connect() (protos.ShardCommunication_StreamClient, context.CancelFunc, error) {
+	client, err := s.route.transport.getClient(s.nodeID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(s.ctx)
+	stream, err := client.Stream(ctx)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	go func() {
+		for {
+			resp, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			logger.Warnf("Node %d failed to step a message of shard %s: %s", s.nodeID, s.route.leader.shardID, resp.Error)
+		}
+	}()
+
+	return stream, cancel, nil
+}
+
+func (s *sender) send(stream protos.ShardCommunication_StreamClient, msg raftpb.Message) error {
+	data, err := msg.Marshal()
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal raft message")
+	}
+
+	start := time.Now()
+	if err := stream.Send(&protos.RaftMessageProto{Data: data, ShardId: s.route.leader.shardID}); err != nil {
+		return err
+	}
+	s.sendTime.Observe(time.Since(start).Seconds())
+	return nil
+}
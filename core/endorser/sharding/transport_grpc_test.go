@@ -0,0 +1,71 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/common/metrics/metricsfakes"
+	"github.com/stretchr/testify/require"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+)
+
+func TestTransportDropsMessagesWhenQueueIsFull(t *testing.T) {
+	// a replica that accepts connections but never answers
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+
+	leader, err := NewShardLeader(ShardConfig{
+		ShardID:      "registry",
+		ReplicaNodes: []string{"replica1", "replica2"},
+		ReplicaID:    1,
+	}, DefaultBatchTimeout, DefaultBatchMaxSize)
+	require.NoError(t, err)
+	defer leader.Stop()
+
+	dropped := &metricsfakes.Counter{}
+	dropped.WithReturns(dropped)
+	counter := &metricsfakes.Counter{}
+	counter.WithReturns(counter)
+	gauge := &metricsfakes.Gauge{}
+	gauge.WithReturns(gauge)
+	histogram := &metricsfakes.Histogram{}
+	histogram.WithReturns(histogram)
+	provider := &metricsfakes.Provider{}
+	provider.NewCounterReturns(counter)
+	provider.NewGaugeReturns(gauge)
+	provider.NewHistogramReturns(histogram)
+	metrics := NewMetrics(provider)
+	metrics.MessagesDropped = dropped
+
+	transport := NewTransport(1, PeerConfig{2: lis.Addr().String()}, TransportConfig{
+		SendBufferSize: 1,
+		Metrics:        metrics,
+	}, nil)
+	defer transport.Stop()
+	transport.AddShard(leader)
+	route := transport.shards["registry"]
+
+	// the sender of replica 2 takes the first message and waits for the stream
+	route.enqueue(raftpb.Message{Type: raftpb.MsgHeartbeat, From: 1, To: 2})
+	require.Eventually(t, func() bool {
+		s, err := route.getSender(2)
+		return err == nil && len(s.queue) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+
+	route.enqueue(raftpb.Message{Type: raftpb.MsgHeartbeat, From: 1, To: 2})
+	require.Equal(t, 0, dropped.AddCallCount())
+	route.enqueue(raftpb.Message{Type: raftpb.MsgSnap, From: 1, To: 2})
+	require.Equal(t, 1, dropped.AddCallCount())
+	require.Equal(t, []string{"shard", "registry", "replica", "2"}, dropped.WithArgsForCall(0))
+
+	route.enqueue(raftpb.Message{Type: raftpb.MsgHeartbeat, From: 1, To: 3})
+	require.Equal(t, 1, dropped.AddCallCount())
+}
@@ -0,0 +1,187 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package sharding_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
+	"github.com/hyperledger/fabric/internal/pkg/comm"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.etcd.io/etcd/raft/v3/raftpb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var _ = Describe("Transport", func() {
+	var (
+		ca       tlsgen.CA
+		replicas []*tlsgen.CertKeyPair
+	)
+
+	BeforeEach(func() {
+		var err error
+		ca, err = tlsgen.NewCA()
+		Expect(err).NotTo(HaveOccurred())
+		replicas = nil
+		for i := 0; i < 2; i++ {
+			kp, err := ca.NewServerCertKeyPair("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+			replicas = append(replicas, kp)
+		}
+	})
+
+	serverConfig := func(kp *tlsgen.CertKeyPair) comm.ServerConfig {
+		return comm.ServerConfig{SecOpts: comm.SecureOptions{UseTLS: true, Certificate: kp.Cert, Key: kp.Key}}
+	}
+
+	clientConfig := func() comm.ClientConfig {
+		return comm.ClientConfig{SecOpts: comm.SecureOptions{UseTLS: true, ServerRootCAs: [][]byte{ca.CertBytes()}}}
+	}
+
+	It("replicates a shard over mutual TLS", func() {
+		addresses := []string{freeAddress(), freeAddress()}
+		var managers []*sharding.ShardManager
+		for id := uint64(1); id <= 2; id++ {
+			topology := &sharding.Topology{
+				ReplicaID: id,
+				Replicas: []sharding.Replica{
+					{ID: 1, Address: addresses[0], TLSCert: replicas[0].Cert},
+					{ID: 2, Address: addresses[1], TLSCert: replicas[1].Cert},
+				},
+				ServerConfig: serverConfig(replicas[id-1]),
+				ClientConfig: clientConfig(),
+			}
+			Expect(topology.Validate()).To(Succeed())
+			m := sharding.NewShardManager("", nil, topology, map[string]sharding.ShardConfig{
+				"registry": topology.ShardConfig("registry"),
+			}, nil)
+			DeferCleanup(m.Shutdown)
+			Expect(m.Transport().Start(addresses[id-1])).To(Succeed())
+			managers = append(managers, m)
+		}
+
+		_, err := sharding.NewCoordinator(managers[0]).Prepare(electionContext(), "registry", &sharding.PrepareRequest{
+			TxID:      "tx1",
+			WriteSet:  map[string][]byte{"registry:key1": []byte("value1")},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+
+		bundle, err := sharding.NewCoordinator(managers[1]).Prepare(electionContext(), "registry", &sharding.PrepareRequest{
+			TxID:      "tx2",
+			ReadSet:   map[string][]byte{"registry:key1": nil},
+			Timestamp: time.Now(),
+		})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(bundle.DependentTxIDs()).To(Equal([]string{"tx1"}))
+	})
+
+	Describe("Step", func() {
+		var address string
+
+		BeforeEach(func() {
+			leader, err := sharding.NewShardLeader(sharding.ShardConfig{
+				ShardID:      "registry",
+				ReplicaNodes: []string{"replica1", "replica2"},
+				ReplicaID:    1,
+			}, sharding.DefaultBatchTimeout, sharding.DefaultBatchMaxSize)
+			Expect(err).NotTo(HaveOccurred())
+			DeferCleanup(leader.Stop)
+
+			address = freeAddress()
+			transport := sharding.NewTransport(1, sharding.PeerConfig{2: "127.0.0.1:1"}, sharding.TransportConfig{
+				ServerConfig: serverConfig(replicas[0]),
+				ClientConfig: clientConfig(),
+				ReplicaCerts: map[uint64][]byte{1: replicas[0].Cert, 2: replicas[1].Cert},
+			}, nil)
+			transport.AddShard(leader)
+			Expect(transport.Start(address)).To(Succeed())
+			DeferCleanup(transport.Stop)
+		})
+
+		step := func(kp *tlsgen.CertKeyPair, from uint64, shardID string) (*protos.StepResponse, error) {
+			conn, err := comm.ClientConfig{
+				SecOpts: comm.SecureOptions{
+					UseTLS:            true,
+					RequireClientCert: true,
+					Certificate:       kp.Cert,
+					Key:               kp.Key,
+					ServerRootCAs:     [][]byte{ca.CertBytes()},
+				},
+				DialTimeout: time.Second,
+			}.Dial(address)
+			if err != nil {
+				return nil, err
+			}
+			defer conn.Close()
+
+			data, err := (&raftpb.Message{Type: raftpb.MsgHeartbeat, From: from, To: 1}).Marshal()
+			Expect(err).NotTo(HaveOccurred())
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			return protos.NewShardCommunicationClient(conn).Step(ctx, &protos.RaftMessageProto{Data: data, ShardId: shardID})
+		}
+
+		It("accepts messages from the replica that sends them", func() {
+			resp, err := step(replicas[1], 2, "registry")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Success).To(BeTrue())
+		})
+
+		It("does not step messages for unknown shards", func() {
+			resp, err := step(replicas[1], 2, "other")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Success).To(BeFalse())
+			Expect(resp.Error).To(Equal("unknown shard other"))
+		})
+
+		It("rejects messages from another replica than the sender", func() {
+			_, err := step(replicas[1], 3, "registry")
+			Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+			Expect(err).To(MatchError(ContainSubstring("replica 2 sent a message from replica 3")))
+		})
+
+		It("closes streams that carry messages from another replica than the sender", func() {
+			conn, err := comm.ClientConfig{
+				SecOpts: comm.SecureOptions{
+					UseTLS:            true,
+					RequireClientCert: true,
+					Certificate:       replicas[1].Cert,
+					Key:               replicas[1].Key,
+					ServerRootCAs:     [][]byte{ca.CertBytes()},
+				},
+				DialTimeout: time.Second,
+			}.Dial(address)
+			Expect(err).NotTo(HaveOccurred())
+			defer conn.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			defer cancel()
+			stream, err := protos.NewShardCommunicationClient(conn).Stream(ctx)
+			Expect(err).NotTo(HaveOccurred())
+			for _, from := range []uint64{2, 3} {
+				data, err := (&raftpb.Message{Type: raftpb.MsgHeartbeat, From: from, To: 1}).Marshal()
+				Expect(err).NotTo(HaveOccurred())
+				Expect(stream.Send(&protos.RaftMessageProto{Data: data, ShardId: "registry"})).To(Succeed())
+			}
+			_, err = stream.Recv()
+			Expect(status.Code(err)).To(Equal(codes.PermissionDenied))
+		})
+
+		It("rejects senders that are not replicas", func() {
+			kp, err := ca.NewServerCertKeyPair("127.0.0.1")
+			Expect(err).NotTo(HaveOccurred())
+			_, err = step(kp, 2, "registry")
+			Expect(err).To(HaveOccurred())
+		})
+	})
+})
@@ -30,6 +30,35 @@ type AbortEntry struct {
 	Timestamp int64
 }
 
+// CommitNotifyEntry reports the outcome of transactions of a block
+// committed to the ledger
+type CommitNotifyEntry struct {
+	BlockNumber uint64
+	Valid       []string
+	Invalid     []string
+}
+
+// LogEntryType identifies the content of a shard log entry
+type LogEntryType int32
+
+const (
+	// EntryTypePrepareBatch carries a batch of prepare requests
+	EntryTypePrepareBatch LogEntryType = iota + 1
+	// EntryTypeAbort rolls back the keys owned by an aborted transaction
+	EntryTypeAbort
+	// EntryTypeCommitNotify reports transactions committed to the ledger
+	EntryTypeCommitNotify
+)
+
+// LogEntry is the envelope of every entry proposed to a shard's raft log.
+// Exactly one of the payloads matching Type is set.
+type LogEntry struct {
+	Type         LogEntryType
+	Batch        *PrepareRequestBatch `json:",omitempty"`
+	Abort        *AbortEntry          `json:",omitempty"`
+	CommitNotify *CommitNotifyEntry   `json:",omitempty"`
+}
+
 // Marshal serializes the batch to JSON
 func (b *PrepareRequestBatch) Marshal() ([]byte, error) {
 	return json.Marshal(b)
@@ -40,6 +69,30 @@ func (b *PrepareRequestBatch) Unmarshal(data []byte) error {
 	return json.Unmarshal(data, b)
 }
 
+// Marshal serializes the log entry to JSON
+func (e *LogEntry) Marshal() ([]byte, error) {
+	return json.Marshal(e)
+}
+
+// Unmarshal deserializes the log entry from JSON. Entries written before the
+// envelope was introduced hold a bare prepare batch and are decoded as such.
+func (e *LogEntry) Unmarshal(data []byte) error {
+	if err := json.Unmarshal(data, e); err != nil {
+		return err
+	}
+	if e.Type != 0 {
+		return nil
+	}
+
+	batch := &PrepareRequestBatch{}
+	if err := batch.Unmarshal(data); err != nil {
+		return err
+	}
+	e.Type = EntryTypePrepareBatch
+	e.Batch = batch
+	return nil
+}
+
 // Marshal serializes the abort entry to JSON
 func (a *AbortEntry) Marshal() ([]byte, error) {
 	return json.Marshal(a)
@@ -49,3 +102,28 @@ func (a *AbortEntry) Marshal() ([]byte, error) {
 func (a *AbortEntry) Unmarshal(data []byte) error {
 	return json.Unmarshal(data, a)
 }
+
+// ShardSnapshot is the state machine data stored in a shard snapshot
+type ShardSnapshot struct {
+	CommitIndex uint64
+	VariableMap map[string]TransactionDependencyInfo
+	// Replicas are the replicas added to the shard after it was created
+	Replicas []Replica `json:",omitempty"`
+	// NotifiedBlock is the last block notified to the shard and
+	// NotifiedBlocks the number of blocks notified
+	NotifiedBlock  uint64 `json:",omitempty"`
+	NotifiedBlocks uint64 `json:",omitempty"`
+	// Prepared maps the transactions of the variable map to the number of
+	// blocks notified when they were prepared
+	Prepared map[string]uint64 `json:",omitempty"`
+}
+
+// Marshal serializes the snapshot to JSON
+func (s *ShardSnapshot) Marshal() ([]byte, error) {
+	return json.Marshal(s)
+}
+
+// Unmarshal deserializes the snapshot from JSON
+func (s *ShardSnapshot) Unmarshal(data []byte) error {
+	return json.Unmarshal(data, s)
+}
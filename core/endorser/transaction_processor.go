@@ -7,13 +7,14 @@ SPDX-License-Identifier: Apache-2.0
 package endorser
 
 import (
-	"fmt"
 	"time"
 
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
 	pb "github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/common/util"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
 )
 
 // cleanupExpiredDependencies periodically removes expired dependency entries
@@ -126,8 +127,17 @@ func (e *Endorser) processTransaction(tx *pb.ProposalResponse) (*pb.ProposalResp
 	}
 	e.VariableMapLock.Unlock()
 
-	tx.Response.Message = fmt.Sprintf("DependencyInfo:HasDependency=%v,DependentTxID=%s,ExpiryTime=%d",
-		depInfo.HasDependency, depInfo.DependentTxID, time.Now().Add(e.EndorsementExpiryDuration).Unix())
+	info := &protos.DependencyInfo{
+		Version:       sharding.DependencyInfoVersion,
+		TxId:          txID,
+		HasDependency: depInfo.HasDependency,
+	}
+	if depInfo.DependentTxID != "" {
+		info.DependentTxIds = []string{depInfo.DependentTxID}
+	}
+	if err := sharding.AttachDependencyInfo(tx.Endorsement, info); err != nil {
+		return nil, err
+	}
 
 	return tx, nil
 }
@@ -7,6 +7,7 @@ SPDX-License-Identifier: Apache-2.0
 package endorser
 
 import (
+	"encoding/hex"
 	"fmt"
 
 	"github.com/golang/protobuf/proto"
@@ -54,90 +55,80 @@ func CreateCCEventBytes(ccevent *pb.ChaincodeEvent) ([]byte, error) {
 	return proto.Marshal(ccevent)
 }
 
-// extractTransactionDependencies identifies variables that the transaction operates on
-func (e *Endorser) extractTransactionDependencies(simResult *ledger.TxSimulationResults) (map[string][]byte, error) {
-	dependencies := make(map[string][]byte)
+// extractTransactionDependencies identifies the variables that the transaction
+// reads and writes. Read variables map to the version that was read, written
+// variables to no value, as the prepare requests are replicated and persisted
+// by the shards. The variables of private data collections are taken from the
+// hashed read/write sets, so that neither their keys nor their values leave
+// the peer.
+func (e *Endorser) extractTransactionDependencies(simResult *ledger.TxSimulationResults) (reads map[string][]byte, writes map[string][]byte, err error) {
+	reads = make(map[string][]byte)
+	writes = make(map[string][]byte)
+
+	if simResult.PubSimulationResults == nil {
+		return reads, writes, nil
+	}
 
-	// Extract variables from public state
-	if simResult.PubSimulationResults != nil {
-		for _, nsRWSet := range simResult.PubSimulationResults.NsRwset {
-			namespace := nsRWSet.Namespace
+	for _, nsRWSet := range simResult.PubSimulationResults.NsRwset {
+		namespace := nsRWSet.Namespace
 
-			if e.Support.IsSysCC(namespace) {
-				continue
-			}
+		if e.Support.IsSysCC(namespace) {
+			continue
+		}
 
-			kvRWSet := &kvrwset.KVRWSet{}
-			if err := proto.Unmarshal(nsRWSet.Rwset, kvRWSet); err != nil {
-				logger.Warningf("Failed to unmarshal rwset for namespace %s: %s", namespace, err)
-				continue
-			}
+		kvRWSet := &kvrwset.KVRWSet{}
+		if err := proto.Unmarshal(nsRWSet.Rwset, kvRWSet); err != nil {
+			logger.Warningf("Failed to unmarshal rwset for namespace %s: %s", namespace, err)
+			continue
+		}
 
-			// Extract write dependencies
-			for _, write := range kvRWSet.Writes {
-				key := namespace + ":" + string(write.Key)
-				dependencies[key] = write.Value
-				logger.Debugf("Transaction write dependency identified: %s", key)
-			}
+		// Extract write dependencies
+		for _, write := range kvRWSet.Writes {
+			key := namespace + ":" + write.Key
+			writes[key] = nil
+			logger.Debugf("Transaction write dependency identified: %s", key)
+		}
 
-			// Extract read dependencies
-			for _, read := range kvRWSet.Reads {
-				key := namespace + ":" + string(read.Key)
-				if _, exists := dependencies[key]; !exists {
-					if read.Version != nil {
-						versionBytes := []byte(fmt.Sprintf("%d-%d", read.Version.BlockNum, read.Version.TxNum))
-						dependencies[key] = versionBytes
-					} else {
-						dependencies[key] = []byte{}
-					}
-					logger.Debugf("Transaction read dependency identified: %s", key)
-				}
-			}
+		// Extract read dependencies
+		for _, read := range kvRWSet.Reads {
+			key := namespace + ":" + read.Key
+			reads[key] = readVersionBytes(read.Version)
+			logger.Debugf("Transaction read dependency identified: %s", key)
 		}
-	}
 
-	// Extract variables from private data
-	if simResult.PvtSimulationResults != nil {
-		for _, pvtRWSet := range simResult.PvtSimulationResults.NsPvtRwset {
-			namespace := pvtRWSet.Namespace
+		// Extract the dependencies on private data from the key hashes
+		for _, collection := range nsRWSet.CollectionHashedRwset {
+			collectionName := collection.CollectionName
 
-			if e.Support.IsSysCC(namespace) {
+			hashedRWSet := &kvrwset.HashedRWSet{}
+			if err := proto.Unmarshal(collection.HashedRwset, hashedRWSet); err != nil {
+				logger.Warningf("Failed to unmarshal hashed rwset for namespace %s, collection %s: %s",
+					namespace, collectionName, err)
 				continue
 			}
 
-			for _, collection := range pvtRWSet.CollectionPvtRwset {
-				collectionName := collection.CollectionName
-
-				collKVRWSet := &kvrwset.KVRWSet{}
-				if err := proto.Unmarshal(collection.Rwset, collKVRWSet); err != nil {
-					logger.Warningf("Failed to unmarshal collection rwset for namespace %s, collection %s: %s",
-						namespace, collectionName, err)
-					continue
-				}
-
-				// Extract private write dependencies
-				for _, write := range collKVRWSet.Writes {
-					key := namespace + ":" + collectionName + ":" + string(write.Key)
-					dependencies[key] = write.Value
-					logger.Debugf("Private data write dependency identified: %s", key)
-				}
-
-				// Extract private read dependencies
-				for _, read := range collKVRWSet.Reads {
-					key := namespace + ":" + collectionName + ":" + string(read.Key)
-					if _, exists := dependencies[key]; !exists {
-						if read.Version != nil {
-							versionBytes := []byte(fmt.Sprintf("%d-%d", read.Version.BlockNum, read.Version.TxNum))
-							dependencies[key] = versionBytes
-						} else {
-							dependencies[key] = []byte{}
-						}
-						logger.Debugf("Private data read dependency identified: %s", key)
-					}
-				}
+			for _, write := range hashedRWSet.HashedWrites {
+				key := namespace + ":" + collectionName + ":" + hex.EncodeToString(write.KeyHash)
+				writes[key] = nil
+				logger.Debugf("Private data write dependency identified: %s", key)
+			}
+
+			for _, read := range hashedRWSet.HashedReads {
+				key := namespace + ":" + collectionName + ":" + hex.EncodeToString(read.KeyHash)
+				reads[key] = readVersionBytes(read.Version)
+				logger.Debugf("Private data read dependency identified: %s", key)
 			}
 		}
 	}
 
-	return dependencies, nil
+	return reads, writes, nil
+}
+
+// readVersionBytes encodes the version of a read, or returns an empty value
+// if the key did not exist
+func readVersionBytes(version *kvrwset.Version) []byte {
+	if version == nil {
+		return []byte{}
+	}
+	return []byte(fmt.Sprintf("%d-%d", version.BlockNum, version.TxNum))
 }
@@ -0,0 +1,87 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package endorser
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset"
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/stretchr/testify/require"
+)
+
+// sysCCSupport is a Support that only knows of the system chaincodes
+type sysCCSupport struct {
+	Support
+}
+
+func (sysCCSupport) IsSysCC(name string) bool {
+	return name == "lscc"
+}
+
+func TestExtractTransactionDependencies(t *testing.T) {
+	kvRWSet := &kvrwset.KVRWSet{
+		Reads: []*kvrwset.KVRead{
+			{Key: "key1", Version: &kvrwset.Version{BlockNum: 3, TxNum: 1}},
+			{Key: "key2"},
+		},
+		Writes: []*kvrwset.KVWrite{{Key: "key1", Value: []byte("public-value")}},
+	}
+	hashedRWSet := &kvrwset.HashedRWSet{
+		HashedReads:  []*kvrwset.KVReadHash{{KeyHash: []byte("read-hash"), Version: &kvrwset.Version{BlockNum: 2}}},
+		HashedWrites: []*kvrwset.KVWriteHash{{KeyHash: []byte("write-hash"), ValueHash: []byte("value-hash")}},
+	}
+	pvtKVRWSet := &kvrwset.KVRWSet{
+		Writes: []*kvrwset.KVWrite{{Key: "private-key", Value: []byte("private-value")}},
+	}
+	simResults := &ledger.TxSimulationResults{
+		PubSimulationResults: &rwset.TxReadWriteSet{
+			NsRwset: []*rwset.NsReadWriteSet{
+				{
+					Namespace: "cc",
+					Rwset:     protoutil.MarshalOrPanic(kvRWSet),
+					CollectionHashedRwset: []*rwset.CollectionHashedReadWriteSet{{
+						CollectionName: "coll",
+						HashedRwset:    protoutil.MarshalOrPanic(hashedRWSet),
+					}},
+				},
+				{
+					Namespace: "lscc",
+					Rwset:     protoutil.MarshalOrPanic(kvRWSet),
+				},
+			},
+		},
+		PvtSimulationResults: &rwset.TxPvtReadWriteSet{
+			NsPvtRwset: []*rwset.NsPvtReadWriteSet{{
+				Namespace: "cc",
+				CollectionPvtRwset: []*rwset.CollectionPvtReadWriteSet{{
+					CollectionName: "coll",
+					Rwset:          protoutil.MarshalOrPanic(pvtKVRWSet),
+				}},
+			}},
+		},
+	}
+
+	e := &Endorser{Support: sysCCSupport{}}
+	reads, writes, err := e.extractTransactionDependencies(simResults)
+	require.NoError(t, err)
+
+	// only the keys, the versions read and the hashes of the private keys
+	// are extracted
+	require.Equal(t, map[string][]byte{
+		"cc:key1": []byte("3-1"),
+		"cc:key2": {},
+		"cc:coll:" + hex.EncodeToString([]byte("read-hash")): []byte("2-0"),
+	}, reads)
+	require.Equal(t, map[string][]byte{
+		"cc:key1": nil,
+		"cc:coll:" + hex.EncodeToString([]byte("write-hash")): nil,
+	}, writes)
+}
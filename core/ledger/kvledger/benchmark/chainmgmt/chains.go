@@ -43,6 +43,10 @@ func newChainsMgr(mgrConf *ChainMgrConf, batchConf *BatchConf, initOp chainInitO
 	dataDir := filepath.Join(mgrConf.DataDir, "ledgersData")
 	ledgermgmtInitializer := ledgermgmttest.NewInitializer(dataDir)
 	ledgermgmtInitializer.Config.HistoryDBConfig.Enabled = true
+	ledgermgmtInitializer.Config.ValidationConfig = &ledger.ValidationConfig{
+		Parallel:    true,
+		Parallelism: mgrConf.ValidationParallelism,
+	}
 	if os.Getenv("useCouchDB") == "true" {
 		couchdbAddr, set := os.LookupEnv("COUCHDB_ADDR")
 		if !set {
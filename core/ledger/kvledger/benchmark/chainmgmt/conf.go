@@ -12,6 +12,9 @@ type ChainMgrConf struct {
 	DataDir string
 	// NumChains field specifies the number of chains to instantiate
 	NumChains int
+	// ValidationParallelism field specifies the number of transactions of a block
+	// validated in parallel. 1 validates serially and 0 uses the number of CPUs
+	ValidationParallelism int
 }
 
 // BatchConf captures the batch related configurations
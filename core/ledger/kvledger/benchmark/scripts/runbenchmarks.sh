@@ -81,6 +81,15 @@ function varyNumTxs {
     done
 }
 
+function varyValidationParallelism {
+    source $PARAM_FILE
+    for v in "${ArrayValidationParallelism[@]}"
+    do
+        ValidationParallelism=$v
+        rm -rf $DataDir;upCouchDB;runInsertTxs;runReadWriteTxs
+    done
+}
+
 function runLargeDataExperiment {
   source $PARAM_FILE
   if [[ $RunLargeDataExperiment = "true" ]]
@@ -125,4 +134,5 @@ fi
   varyKVSize
   varyBatchSize
   varyNumTxs
+  varyValidationParallelism
   runLargeDataExperiment
@@ -35,6 +35,12 @@ func TestProvider(t *testing.T) {
 	require.NoError(t, err)
 	require.Equal(t, []byte("value3"), val)
 
+	dagStatisticsDB := p.GetDBHandle("TestLedger", DAGStatistics)
+	require.NoError(t, dagStatisticsDB.Put([]byte("key4"), []byte("value4"), true))
+	val, err = dagStatisticsDB.Get([]byte("key4"))
+	require.NoError(t, err)
+	require.Equal(t, []byte("value4"), val)
+
 	require.NoError(t, p.Drop("TestLedger"))
 
 	val, err = pvtdataExpiryDB.Get([]byte("key1"))
@@ -46,6 +52,9 @@ func TestProvider(t *testing.T) {
 	val, err = snapshotRequestDB.Get([]byte("key3"))
 	require.NoError(t, err)
 	require.Nil(t, val)
+	val, err = dagStatisticsDB.Get([]byte("key4"))
+	require.NoError(t, err)
+	require.Nil(t, val)
 
 	// drop again is not an error
 	require.NoError(t, p.Drop("TestLedger"))
@@ -0,0 +1,65 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kvledger
+
+import (
+	"encoding/json"
+
+	"github.com/hyperledger/fabric/common/ledger/util"
+	"github.com/hyperledger/fabric/common/ledger/util/leveldbhelper"
+	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/pkg/errors"
+)
+
+// dagStatsStore keeps, by block number, the statistics of the dependency
+// graphs that the committer records along the blocks
+type dagStatsStore struct {
+	dbHandle *leveldbhelper.DBHandle
+}
+
+// put records the statistics of the given block. They are written without
+// sync, as they are not needed to recover the ledger.
+func (s *dagStatsStore) put(blockNum uint64, stats *ledger.DAGStats) error {
+	value, err := json.Marshal(stats)
+	if err != nil {
+		return errors.Wrapf(err, "failed to marshal the DAG statistics of block %d", blockNum)
+	}
+	return s.dbHandle.Put(encodeDAGStatsKey(blockNum), value, false)
+}
+
+// get returns the statistics recorded for the given block, or nil if none
+// were recorded
+func (s *dagStatsStore) get(blockNum uint64) (*ledger.DAGStats, error) {
+	value, err := s.dbHandle.Get(encodeDAGStatsKey(blockNum))
+	if err != nil || value == nil {
+		return nil, err
+	}
+	stats := &ledger.DAGStats{}
+	if err := json.Unmarshal(value, stats); err != nil {
+		return nil, errors.Wrapf(err, "failed to unmarshal the DAG statistics of block %d", blockNum)
+	}
+	return stats, nil
+}
+
+func encodeDAGStatsKey(blockNum uint64) []byte {
+	return util.EncodeOrderPreservingVarUint64(blockNum)
+}
+
+// recordDAGStats records the statistics of the dependency graph of a
+// committed block and reports them as metrics. The block is committed by
+// then, so a failure to record them is only logged.
+func (l *kvLedger) recordDAGStats(blockNum uint64, stats *ledger.DAGStats) {
+	if err := l.dagStatsStore.put(blockNum, stats); err != nil {
+		logger.Errorw("Failed to record the DAG statistics", "channel", l.ledgerID, "blockNum", blockNum, "error", err)
+	}
+	l.stats.updateDAGStats(stats)
+}
+
+// GetDAGStats implements method in interface `ledger.PeerLedger`
+func (l *kvLedger) GetDAGStats(blockNum uint64) (*ledger.DAGStats, error) {
+	return l.dagStatsStore.get(blockNum)
+}
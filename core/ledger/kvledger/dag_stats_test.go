@@ -0,0 +1,85 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package kvledger
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric/bccsp/sw"
+	"github.com/hyperledger/fabric/common/ledger/testutil"
+	lgr "github.com/hyperledger/fabric/core/ledger"
+	"github.com/hyperledger/fabric/core/ledger/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDAGStats(t *testing.T) {
+	conf, cleanup := testConfig(t)
+	defer cleanup()
+	testMetricProvider := testutilConstructMetricProvider()
+
+	cryptoProvider, err := sw.NewDefaultSecurityLevelWithKeystore(sw.NewDummyKeyStore())
+	require.NoError(t, err)
+	newProvider := func() *Provider {
+		provider, err := NewProvider(
+			&lgr.Initializer{
+				DeployedChaincodeInfoProvider: &mock.DeployedChaincodeInfoProvider{},
+				MetricsProvider:               testMetricProvider.fakeProvider,
+				Config:                        conf,
+				HashProvider:                  cryptoProvider,
+			},
+		)
+		require.NoError(t, err)
+		return provider
+	}
+
+	provider := newProvider()
+	bg, gb := testutil.NewBlockGenerator(t, "ledger1", false)
+	l, err := provider.CreateFromGenesisBlock(gb)
+	require.NoError(t, err)
+
+	dagStats := &lgr.DAGStats{
+		Transactions:      5,
+		LevelWidths:       []int{3, 1, 1},
+		Edges:             3,
+		DependencyInvalid: 2,
+		Duration:          1500 * time.Millisecond,
+	}
+	block1 := bg.NextBlock([][]byte{})
+	require.NoError(t, l.CommitLegacy(&lgr.BlockAndPvtData{Block: block1}, &lgr.CommitOptions{DAGStats: dagStats}))
+	block2 := bg.NextBlock([][]byte{})
+	require.NoError(t, l.CommitLegacy(&lgr.BlockAndPvtData{Block: block2}, &lgr.CommitOptions{}))
+
+	stats, err := l.GetDAGStats(1)
+	require.NoError(t, err)
+	require.Equal(t, dagStats, stats)
+	stats, err = l.GetDAGStats(2)
+	require.NoError(t, err)
+	require.Nil(t, stats)
+
+	require.Equal(t, 1, testMetricProvider.fakeDAGLevelsHist.ObserveCallCount())
+	require.Equal(t, []string{"channel", "ledger1"}, testMetricProvider.fakeDAGLevelsHist.WithArgsForCall(0))
+	require.Equal(t, float64(3), testMetricProvider.fakeDAGLevelsHist.ObserveArgsForCall(0))
+	require.Equal(t, 3, testMetricProvider.fakeDAGLevelWidthHist.ObserveCallCount())
+	require.Equal(t, float64(3), testMetricProvider.fakeDAGLevelWidthHist.ObserveArgsForCall(0))
+	require.Equal(t, float64(1), testMetricProvider.fakeDAGLevelWidthHist.ObserveArgsForCall(2))
+	require.Equal(t, float64(3), testMetricProvider.fakeDAGEdgesHist.ObserveArgsForCall(0))
+	require.Equal(t, float64(2), testMetricProvider.fakeDAGDependencyInvalidCount.AddArgsForCall(0))
+	require.Equal(t, 1.5, testMetricProvider.fakeDAGValidationTimeHist.ObserveArgsForCall(0))
+
+	// the statistics outlive the peer
+	l.Close()
+	provider.Close()
+	provider = newProvider()
+	defer provider.Close()
+	l, err = provider.Open("ledger1")
+	require.NoError(t, err)
+	defer l.Close()
+	stats, err = l.GetDAGStats(1)
+	require.NoError(t, err)
+	require.Equal(t, dagStats, stats)
+}
@@ -10,6 +10,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"math"
+	"runtime"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -59,6 +60,7 @@ type kvLedger struct {
 	historyDB              *history.DB
 	configHistoryRetriever *collectionConfigHistoryRetriever
 	snapshotMgr            *snapshotMgr
+	dagStatsStore          *dagStatsStore
 	blockAPIsRWLock        *sync.RWMutex
 	stats                  *ledgerStats
 	commitHash             []byte
@@ -130,6 +132,12 @@ func newKVLedger(initializer *lgrInitializer) (*kvLedger, error) {
 		CustomTxProcessors:  initializer.customTxProcessors,
 		HashFunc:            rwsetHashFunc,
 	}
+	if validationConfig := initializer.config.ValidationConfig; validationConfig != nil && validationConfig.Parallel {
+		txmgrInitializer.ValidationParallelism = validationConfig.Parallelism
+		if txmgrInitializer.ValidationParallelism == 0 {
+			txmgrInitializer.ValidationParallelism = runtime.NumCPU()
+		}
+	}
 	if err := l.initTxMgr(txmgrInitializer); err != nil {
 		return nil, err
 	}
@@ -178,6 +186,9 @@ func newKVLedger(initializer *lgrInitializer) (*kvLedger, error) {
 	if err := l.initSnapshotMgr(initializer); err != nil {
 		return nil, err
 	}
+	l.dagStatsStore = &dagStatsStore{
+		dbHandle: initializer.bookkeeperProvider.GetDBHandle(ledgerID, bookkeeping.DAGStatistics),
+	}
 
 	l.stats = initializer.stats
 	return l, nil
@@ -725,6 +736,9 @@ func (l *kvLedger) commit(pvtdataAndBlock *ledger.BlockAndPvtData, commitOpts *l
 		elapsedCommitState,
 		txstatsInfo,
 	)
+	if commitOpts.DAGStats != nil {
+		l.recordDAGStats(blockNo, commitOpts.DAGStats)
+	}
 
 	l.sendCommitNotification(blockNo, txstatsInfo)
 	return nil
@@ -10,7 +10,9 @@ import (
 	"time"
 
 	"github.com/hyperledger/fabric/common/metrics"
+	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/validation"
+	"github.com/hyperledger/fabric/internal/pkg/txflags"
 )
 
 type stats struct {
@@ -18,6 +20,11 @@ type stats struct {
 	blockAndPvtdataStoreCommitTime metrics.Histogram
 	statedbCommitTime              metrics.Histogram
 	transactionsCount              metrics.Counter
+	dagLevels                      metrics.Histogram
+	dagLevelWidth                  metrics.Histogram
+	dagEdges                       metrics.Histogram
+	dagDependencyInvalidCount      metrics.Counter
+	dagValidationTime              metrics.Histogram
 }
 
 func newStats(metricsProvider metrics.Provider) *stats {
@@ -26,6 +33,11 @@ func newStats(metricsProvider metrics.Provider) *stats {
 	stats.blockAndPvtdataStoreCommitTime = metricsProvider.NewHistogram(blockAndPvtdataStoreCommitTimeOpts)
 	stats.statedbCommitTime = metricsProvider.NewHistogram(statedbCommitTimeOpts)
 	stats.transactionsCount = metricsProvider.NewCounter(transactionCountOpts)
+	stats.dagLevels = metricsProvider.NewHistogram(dagLevelsOpts)
+	stats.dagLevelWidth = metricsProvider.NewHistogram(dagLevelWidthOpts)
+	stats.dagEdges = metricsProvider.NewHistogram(dagEdgesOpts)
+	stats.dagDependencyInvalidCount = metricsProvider.NewCounter(dagDependencyInvalidCountOpts)
+	stats.dagValidationTime = metricsProvider.NewHistogram(dagValidationTimeOpts)
 	return stats
 }
 
@@ -70,11 +82,21 @@ func (s *ledgerStats) updateTransactionsStats(
 			"channel", s.ledgerid,
 			"transaction_type", transactionTypeStr,
 			"chaincode", chaincodeName,
-			"validation_code", txstat.ValidationCode.String(),
+			"validation_code", txflags.CodeName(txstat.ValidationCode),
 		).Add(1)
 	}
 }
 
+func (s *ledgerStats) updateDAGStats(dagStats *ledger.DAGStats) {
+	s.stats.dagLevels.With("channel", s.ledgerid).Observe(float64(len(dagStats.LevelWidths)))
+	for _, width := range dagStats.LevelWidths {
+		s.stats.dagLevelWidth.With("channel", s.ledgerid).Observe(float64(width))
+	}
+	s.stats.dagEdges.With("channel", s.ledgerid).Observe(float64(dagStats.Edges))
+	s.stats.dagDependencyInvalidCount.With("channel", s.ledgerid).Add(float64(dagStats.DependencyInvalid))
+	s.stats.dagValidationTime.With("channel", s.ledgerid).Observe(dagStats.Duration.Seconds())
+}
+
 var (
 	blockProcessingTimeOpts = metrics.HistogramOpts{
 		Namespace:    "ledger",
@@ -114,4 +136,53 @@ var (
 		LabelNames:   []string{"channel", "transaction_type", "chaincode", "validation_code"},
 		StatsdFormat: "%{#fqname}.%{channel}.%{transaction_type}.%{chaincode}.%{validation_code}",
 	}
+
+	dagLevelsOpts = metrics.HistogramOpts{
+		Namespace:    "ledger",
+		Subsystem:    "",
+		Name:         "dag_levels",
+		Help:         "Number of levels of the dependency graph of a block.",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+		Buckets:      []float64{1, 2, 4, 8, 16, 32, 64, 128},
+	}
+
+	dagLevelWidthOpts = metrics.HistogramOpts{
+		Namespace:    "ledger",
+		Subsystem:    "",
+		Name:         "dag_level_width",
+		Help:         "Number of transactions of a level of the dependency graph of a block.",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+		Buckets:      []float64{1, 2, 4, 8, 16, 32, 64, 128, 256, 512},
+	}
+
+	dagEdgesOpts = metrics.HistogramOpts{
+		Namespace:    "ledger",
+		Subsystem:    "",
+		Name:         "dag_edges",
+		Help:         "Number of edges between the transactions of the dependency graph of a block.",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+		Buckets:      []float64{0, 1, 4, 16, 64, 256, 1024, 4096},
+	}
+
+	dagDependencyInvalidCountOpts = metrics.CounterOpts{
+		Namespace:    "ledger",
+		Subsystem:    "",
+		Name:         "dag_dependency_invalid_count",
+		Help:         "Number of transactions invalidated because a transaction of their block they depend on is invalid.",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+	}
+
+	dagValidationTimeOpts = metrics.HistogramOpts{
+		Namespace:    "ledger",
+		Subsystem:    "",
+		Name:         "dag_validation_time",
+		Help:         "Time taken in seconds for building the dependency graph of a block and validating the block along it.",
+		LabelNames:   []string{"channel"},
+		StatsdFormat: "%{#fqname}.%{channel}",
+		Buckets:      []float64{0.005, 0.01, 0.015, 0.05, 0.1, 1, 10},
+	}
 )
@@ -148,6 +148,11 @@ type testMetricProvider struct {
 	fakeBlockstorageCommitWithPvtDataTimeHist *metricsfakes.Histogram
 	fakeStatedbCommitTimeHist                 *metricsfakes.Histogram
 	fakeTransactionsCount                     *metricsfakes.Counter
+	fakeDAGLevelsHist                         *metricsfakes.Histogram
+	fakeDAGLevelWidthHist                     *metricsfakes.Histogram
+	fakeDAGEdgesHist                          *metricsfakes.Histogram
+	fakeDAGDependencyInvalidCount             *metricsfakes.Counter
+	fakeDAGValidationTimeHist                 *metricsfakes.Histogram
 }
 
 func testutilConstructMetricProvider() *testMetricProvider {
@@ -156,6 +161,11 @@ func testutilConstructMetricProvider() *testMetricProvider {
 	fakeBlockstorageCommitWithPvtDataTimeHist := testutilConstructHist()
 	fakeStatedbCommitTimeHist := testutilConstructHist()
 	fakeTransactionsCount := testutilConstructCounter()
+	fakeDAGLevelsHist := testutilConstructHist()
+	fakeDAGLevelWidthHist := testutilConstructHist()
+	fakeDAGEdgesHist := testutilConstructHist()
+	fakeDAGDependencyInvalidCount := testutilConstructCounter()
+	fakeDAGValidationTimeHist := testutilConstructHist()
 	fakeProvider.NewGaugeStub = func(opts metrics.GaugeOpts) metrics.Gauge {
 		// return a gauge for metrics in common/ledger
 		return testutilConstructGauge()
@@ -168,6 +178,14 @@ func testutilConstructMetricProvider() *testMetricProvider {
 			return fakeBlockstorageCommitWithPvtDataTimeHist
 		case statedbCommitTimeOpts.Name:
 			return fakeStatedbCommitTimeHist
+		case dagLevelsOpts.Name:
+			return fakeDAGLevelsHist
+		case dagLevelWidthOpts.Name:
+			return fakeDAGLevelWidthHist
+		case dagEdgesOpts.Name:
+			return fakeDAGEdgesHist
+		case dagValidationTimeOpts.Name:
+			return fakeDAGValidationTimeHist
 		default:
 			// return a histogram for metrics in common/ledger
 			return testutilConstructHist()
@@ -178,6 +196,8 @@ func testutilConstructMetricProvider() *testMetricProvider {
 		switch opts.Name {
 		case transactionCountOpts.Name:
 			return fakeTransactionsCount
+		case dagDependencyInvalidCountOpts.Name:
+			return fakeDAGDependencyInvalidCount
 		}
 		return nil
 	}
@@ -187,6 +207,11 @@ func testutilConstructMetricProvider() *testMetricProvider {
 		fakeBlockstorageCommitWithPvtDataTimeHist,
 		fakeStatedbCommitTimeHist,
 		fakeTransactionsCount,
+		fakeDAGLevelsHist,
+		fakeDAGLevelWidthHist,
+		fakeDAGEdgesHist,
+		fakeDAGDependencyInvalidCount,
+		fakeDAGValidationTimeHist,
 	}
 }
 
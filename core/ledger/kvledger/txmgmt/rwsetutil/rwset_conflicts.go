@@ -0,0 +1,204 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rwsetutil
+
+import (
+	"sort"
+	"strings"
+)
+
+// ConflictKind is the set of ways in which the read/write set of a
+// transaction conflicts with the one of a preceding transaction of its block
+type ConflictKind uint8
+
+const (
+	// ReadAfterWrite: the transaction reads a key, or a key hash, that the
+	// preceding transaction writes
+	ReadAfterWrite ConflictKind = 1 << iota
+	// WriteAfterWrite: the transaction writes a key, or a key hash, that the
+	// preceding transaction writes
+	WriteAfterWrite
+	// PhantomRead: a range query of the transaction covers a key that the
+	// preceding transaction writes
+	PhantomRead
+)
+
+var conflictKindNames = []string{"READ_AFTER_WRITE", "WRITE_AFTER_WRITE", "PHANTOM_READ"}
+
+func (k ConflictKind) String() string {
+	var names []string
+	for i, name := range conflictKindNames {
+		if k&(1<<i) != 0 {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "|")
+}
+
+// Conflict is a conflict of the read/write set of a transaction with the one
+// of a preceding transaction of its block
+type Conflict struct {
+	// Position is the position of the preceding transaction among the
+	// accesses the conflicts are derived from
+	Position int
+	Kind     ConflictKind
+}
+
+// accessedKey is a key of the public state of a namespace, or the hash of a
+// key of a collection
+type accessedKey struct {
+	ns, coll, key string
+}
+
+// keyRange is a range query of the public state of a namespace
+type keyRange struct {
+	ns         string
+	start, end string
+}
+
+// contains returns whether the key may be among the results of the range
+// query. The end key is always included, as the validation of a range query
+// whose iterator was not exhausted reads it.
+func (r keyRange) contains(k accessedKey) bool {
+	return k.coll == "" && k.ns == r.ns && k.key >= r.start && (r.end == "" || k.key <= r.end)
+}
+
+// Accesses are the keys, and key hashes, that a transaction reads and writes
+type Accesses struct {
+	reads  map[accessedKey]struct{}
+	writes map[accessedKey]struct{}
+	ranges []keyRange
+}
+
+// AccessesOf returns the keys accessed by the read/write sets of the actions
+// of a transaction. Writes of metadata count as writes of their key.
+func AccessesOf(txRWSets ...*TxRwSet) *Accesses {
+	accesses := &Accesses{
+		reads:  map[accessedKey]struct{}{},
+		writes: map[accessedKey]struct{}{},
+	}
+
+	for _, txRWSet := range txRWSets {
+		if txRWSet == nil {
+			continue
+		}
+		for _, nsRWSet := range txRWSet.NsRwSets {
+			ns := nsRWSet.NameSpace
+			if kvRWSet := nsRWSet.KvRwSet; kvRWSet != nil {
+				for _, kvRead := range kvRWSet.Reads {
+					accesses.reads[accessedKey{ns: ns, key: kvRead.Key}] = struct{}{}
+				}
+				for _, rqi := range kvRWSet.RangeQueriesInfo {
+					accesses.ranges = append(accesses.ranges, keyRange{ns: ns, start: rqi.StartKey, end: rqi.EndKey})
+				}
+				for _, kvWrite := range kvRWSet.Writes {
+					accesses.writes[accessedKey{ns: ns, key: kvWrite.Key}] = struct{}{}
+				}
+				for _, kvMetadataWrite := range kvRWSet.MetadataWrites {
+					accesses.writes[accessedKey{ns: ns, key: kvMetadataWrite.Key}] = struct{}{}
+				}
+			}
+
+			for _, coll := range nsRWSet.CollHashedRwSets {
+				hashedRWSet := coll.HashedRwSet
+				if hashedRWSet == nil {
+					continue
+				}
+				hashedKey := func(keyHash []byte) accessedKey {
+					return accessedKey{ns: ns, coll: coll.CollectionName, key: string(keyHash)}
+				}
+				for _, kvReadHash := range hashedRWSet.HashedReads {
+					accesses.reads[hashedKey(kvReadHash.KeyHash)] = struct{}{}
+				}
+				for _, kvWriteHash := range hashedRWSet.HashedWrites {
+					accesses.writes[hashedKey(kvWriteHash.KeyHash)] = struct{}{}
+				}
+				for _, kvMetadataWriteHash := range hashedRWSet.MetadataWrites {
+					accesses.writes[hashedKey(kvMetadataWriteHash.KeyHash)] = struct{}{}
+				}
+			}
+		}
+	}
+
+	return accesses
+}
+
+// SharesWrittenKey returns whether one of the transactions writes a key that
+// the other reads, writes or covers with a range query
+func (a *Accesses) SharesWrittenKey(other *Accesses) bool {
+	return a.writesAccessedKey(other) || other.writesAccessedKey(a)
+}
+
+// writesAccessedKey returns whether the transaction writes a key the other
+// transaction accesses
+func (a *Accesses) writesAccessedKey(other *Accesses) bool {
+	for k := range a.writes {
+		if _, ok := other.reads[k]; ok {
+			return true
+		}
+		if _, ok := other.writes[k]; ok {
+			return true
+		}
+		for _, r := range other.ranges {
+			if r.contains(k) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Conflicts returns, for each transaction, the preceding transactions it
+// conflicts with, ordered by position. The accesses are in the order of the
+// block, and nil for the transactions without a read/write set. The result
+// depends on the accesses alone, so that every peer derives the same
+// conflicts from a block.
+func Conflicts(accesses []*Accesses) [][]Conflict {
+	// writers are the positions of the transactions that wrote each key so far
+	writers := map[accessedKey][]int{}
+
+	conflicts := make([][]Conflict, len(accesses))
+	for i, txAccesses := range accesses {
+		if txAccesses == nil {
+			continue
+		}
+
+		kinds := map[int]ConflictKind{}
+		addConflicts := func(kind ConflictKind, positions []int) {
+			for _, p := range positions {
+				kinds[p] |= kind
+			}
+		}
+		for k := range txAccesses.reads {
+			addConflicts(ReadAfterWrite, writers[k])
+		}
+		for k := range txAccesses.writes {
+			addConflicts(WriteAfterWrite, writers[k])
+		}
+		for _, r := range txAccesses.ranges {
+			for k, positions := range writers {
+				if r.contains(k) {
+					addConflicts(PhantomRead, positions)
+				}
+			}
+		}
+
+		positions := make([]int, 0, len(kinds))
+		for p := range kinds {
+			positions = append(positions, p)
+		}
+		sort.Ints(positions)
+		for _, p := range positions {
+			conflicts[i] = append(conflicts[i], Conflict{Position: p, Kind: kinds[p]})
+		}
+
+		for k := range txAccesses.writes {
+			writers[k] = append(writers[k], i)
+		}
+	}
+	return conflicts
+}
@@ -0,0 +1,62 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package rwsetutil
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConflicts(t *testing.T) {
+	txRWSet := func(ns string, kvRWSet *kvrwset.KVRWSet, colls ...*CollHashedRwSet) *TxRwSet {
+		return &TxRwSet{NsRwSets: []*NsRwSet{{NameSpace: ns, KvRwSet: kvRWSet, CollHashedRwSets: colls}}}
+	}
+
+	accesses := []*Accesses{
+		// tx0 writes key1 and the hash of a private key
+		AccessesOf(txRWSet("ns1", &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "key1"}}}, &CollHashedRwSet{
+			CollectionName: "coll1",
+			HashedRwSet:    &kvrwset.HashedRWSet{HashedWrites: []*kvrwset.KVWriteHash{{KeyHash: []byte("hash1")}}},
+		})),
+		// tx1 has no read/write set
+		nil,
+		// tx2 reads and writes key1 in two actions
+		AccessesOf(
+			txRWSet("ns1", &kvrwset.KVRWSet{Reads: []*kvrwset.KVRead{{Key: "key1"}}}),
+			txRWSet("ns1", &kvrwset.KVRWSet{Writes: []*kvrwset.KVWrite{{Key: "key1"}}}),
+		),
+		// tx3 queries a range covering key1, and reads key1 of another namespace
+		AccessesOf(
+			txRWSet("ns1", &kvrwset.KVRWSet{RangeQueriesInfo: []*kvrwset.RangeQueryInfo{{StartKey: "key0", EndKey: "key1"}}}),
+			txRWSet("ns2", &kvrwset.KVRWSet{Reads: []*kvrwset.KVRead{{Key: "key1"}}}),
+		),
+		// tx4 reads the hash of the private key and updates the metadata of key2
+		AccessesOf(txRWSet("ns1", &kvrwset.KVRWSet{MetadataWrites: []*kvrwset.KVMetadataWrite{{Key: "key2"}}}, &CollHashedRwSet{
+			CollectionName: "coll1",
+			HashedRwSet:    &kvrwset.HashedRWSet{HashedReads: []*kvrwset.KVReadHash{{KeyHash: []byte("hash1")}}},
+		})),
+		// tx5 reads key2
+		AccessesOf(txRWSet("ns1", &kvrwset.KVRWSet{Reads: []*kvrwset.KVRead{{Key: "key2"}}})),
+	}
+
+	require.Equal(t, [][]Conflict{
+		nil,
+		nil,
+		{{Position: 0, Kind: ReadAfterWrite | WriteAfterWrite}},
+		{{Position: 0, Kind: PhantomRead}, {Position: 2, Kind: PhantomRead}},
+		{{Position: 0, Kind: ReadAfterWrite}},
+		{{Position: 4, Kind: ReadAfterWrite}},
+	}, Conflicts(accesses))
+	require.Equal(t, "READ_AFTER_WRITE|PHANTOM_READ", (ReadAfterWrite | PhantomRead).String())
+
+	// a shared written key is found in either direction
+	require.True(t, accesses[0].SharesWrittenKey(accesses[3]))
+	require.True(t, accesses[3].SharesWrittenKey(accesses[0]))
+	require.False(t, accesses[3].SharesWrittenKey(accesses[5]))
+}
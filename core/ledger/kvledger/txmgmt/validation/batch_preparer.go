@@ -50,19 +50,22 @@ type TxStatInfo struct {
 }
 
 // NewCommitBatchPreparer constructs a validator that internally manages statebased validator and in addition
-// handles the tasks that are agnostic to a particular validation scheme such as parsing the block and handling the pvt data
+// handles the tasks that are agnostic to a particular validation scheme such as parsing the block and handling the pvt data.
+// The statebased validator validates up to parallelism transactions at once, in the order of their dependencies.
 func NewCommitBatchPreparer(
 	postOrderSimulatorProvider PostOrderSimulatorProvider,
 	db *privacyenabledstate.DB,
 	customTxProcessors map[common.HeaderType]ledger.CustomTxProcessor,
 	hashFunc rwsetutil.HashFunc,
+	parallelism int,
 ) *CommitBatchPreparer {
 	return &CommitBatchPreparer{
 		postOrderSimulatorProvider,
 		db,
 		&validator{
-			db:       db,
-			hashFunc: hashFunc,
+			db:          db,
+			hashFunc:    hashFunc,
+			parallelism: parallelism,
 		},
 		customTxProcessors,
 	}
@@ -216,7 +219,7 @@ func preprocessProtoBlock(postOrderSimulatorProvider PostOrderSimulatorProvider,
 			logger.Warningf("Channel [%s]: Block [%d] Transaction index [%d] TxId [%s]"+
 				" marked as invalid by committer. Reason code [%s]",
 				chdr.GetChannelId(), blk.Header.Number, txIndex, chdr.GetTxId(),
-				txsFilter.Flag(txIndex).String())
+				txflags.CodeName(txsFilter.Flag(txIndex)))
 			continue
 		}
 		if err != nil {
@@ -0,0 +1,119 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package validation
+
+import (
+	"sync"
+
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/internal/version"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+)
+
+// The serial validation checks the reads of a transaction against the committed
+// state and the writes of the preceding valid transactions of the block. Only
+// the preceding transactions that write a key the transaction reads, a key hash
+// it reads, or a key in the range of one of its range queries can change the
+// outcome, which makes them the dependencies of the transaction. The parallel
+// validation validates the transactions level by level of the dependency
+// graph, each transaction against the writes of its valid dependencies alone,
+// and so yields the validation codes of the serial validation.
+
+// validateInParallel returns the validation code of every transaction of the
+// block, validating at most v.parallelism transactions at once
+func (v *validator) validateInParallel(blk *block) ([]peer.TxValidationCode, error) {
+	deps := txDependencies(blk)
+	levels := txLevels(deps)
+	logger.Debugf("Block [%d] validating %d transactions in %d levels of dependencies", blk.num, len(blk.txs), len(levels))
+
+	codes := make([]peer.TxValidationCode, len(blk.txs))
+	errs := make([]error, len(blk.txs))
+	sem := make(chan struct{}, v.parallelism)
+	for _, level := range levels {
+		var wg sync.WaitGroup
+		for _, i := range level {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func(i int) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+				codes[i], errs[i] = v.validateAfterDependencies(blk, i, deps[i], codes)
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	// the serial validation fails with the error of the first transaction
+	// that fails to validate
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return codes, nil
+}
+
+// validateAfterDependencies validates the i-th transaction of the block
+// against the writes of its dependencies that are valid, applied in the order
+// of the block
+func (v *validator) validateAfterDependencies(blk *block, i int, deps []int, codes []peer.TxValidationCode) (peer.TxValidationCode, error) {
+	updates := newPubAndHashUpdates()
+	for _, d := range deps {
+		if codes[d] != peer.TxValidationCode_VALID {
+			continue
+		}
+		dep := blk.txs[d]
+		depHeight := version.NewHeight(blk.num, uint64(dep.indexInBlock))
+		if err := updates.applyWriteSet(dep.rwset, depHeight, v.db, dep.containsPostOrderWrites); err != nil {
+			return peer.TxValidationCode(-1), err
+		}
+	}
+	return v.validateTx(blk.txs[i].rwset, updates)
+}
+
+// txDependencies returns, for every transaction of the block, the positions
+// of the preceding transactions it depends on, in the order of the block. The
+// dependencies are the conflicts that the committer derives for its DAG, but
+// for the writes of the keys a transaction only writes, which do not change
+// the outcome of its validation.
+func txDependencies(blk *block) [][]int {
+	accesses := make([]*rwsetutil.Accesses, len(blk.txs))
+	for i, tx := range blk.txs {
+		accesses[i] = rwsetutil.AccessesOf(tx.rwset)
+	}
+
+	deps := make([][]int, len(blk.txs))
+	for i, conflicts := range rwsetutil.Conflicts(accesses) {
+		for _, conflict := range conflicts {
+			if conflict.Kind&^rwsetutil.WriteAfterWrite != 0 {
+				deps[i] = append(deps[i], conflict.Position)
+			}
+		}
+	}
+	return deps
+}
+
+// txLevels groups the positions of the transactions by level of the
+// dependency graph: a transaction is one level above its highest dependency
+func txLevels(deps [][]int) [][]int {
+	var levels [][]int
+	txLevel := make([]int, len(deps))
+	for i, txDeps := range deps {
+		for _, d := range txDeps {
+			if txLevel[d]+1 > txLevel[i] {
+				txLevel[i] = txLevel[d] + 1
+			}
+		}
+		if txLevel[i] == len(levels) {
+			levels = append(levels, nil)
+		}
+		levels[txLevel[i]] = append(levels[txLevel[i]], i)
+	}
+	return levels
+}
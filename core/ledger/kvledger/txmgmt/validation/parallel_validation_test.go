@@ -0,0 +1,170 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package validation
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/hyperledger/fabric-protos-go/ledger/rwset/kvrwset"
+	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/ledger/internal/version"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/privacyenabledstate"
+	"github.com/hyperledger/fabric/core/ledger/kvledger/txmgmt/rwsetutil"
+	"github.com/hyperledger/fabric/core/ledger/util"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxDependencies(t *testing.T) {
+	// tx0 writes key1 and pvtKey1
+	b0 := rwsetutil.NewRWSetBuilder()
+	b0.AddToWriteSet("ns1", "key1", []byte("value1"))
+	b0.AddToPvtAndHashedWriteSet("ns1", "coll1", "pvtKey1", []byte("pvtValue1"))
+	// tx1 reads key2 and writes key3, independent of tx0
+	b1 := rwsetutil.NewRWSetBuilder()
+	b1.AddToReadSet("ns1", "key2", nil)
+	b1.AddToWriteSet("ns1", "key3", []byte("value3"))
+	// tx2 reads key1
+	b2 := rwsetutil.NewRWSetBuilder()
+	b2.AddToReadSet("ns1", "key1", nil)
+	// tx3 queries the range including key3
+	b3 := rwsetutil.NewRWSetBuilder()
+	b3.AddToRangeQuerySet("ns1", &kvrwset.RangeQueryInfo{StartKey: "key2", EndKey: "key3", ItrExhausted: false})
+	// tx4 reads the hash of pvtKey1, and key1 of another namespace
+	b4 := rwsetutil.NewRWSetBuilder()
+	b4.AddToHashedReadSet("ns1", "coll1", "pvtKey1", nil)
+	b4.AddToReadSet("ns2", "key1", nil)
+	// tx5 updates the metadata of key2, that tx6 reads
+	b5 := rwsetutil.NewRWSetBuilder()
+	b5.AddToMetadataWriteSet("ns1", "key2", map[string][]byte{"m": []byte("v")})
+	b6 := rwsetutil.NewRWSetBuilder()
+	b6.AddToReadSet("ns1", "key2", nil)
+	b6.AddToReadSet("ns1", "key1", nil)
+
+	blk := &block{num: 1}
+	for i, rwset := range getTestPubSimulationRWSet(t, b0, b1, b2, b3, b4, b5, b6) {
+		blk.txs = append(blk.txs, &transaction{indexInBlock: i, id: fmt.Sprintf("txid-%d", i), rwset: rwset})
+	}
+
+	deps := txDependencies(blk)
+	require.Equal(t, [][]int{nil, nil, {0}, {1}, {0}, nil, {0, 5}}, deps)
+	require.Equal(t, [][]int{{0, 1, 5}, {2, 3, 4, 6}}, txLevels(deps))
+}
+
+func TestParallelValidationMatchesSerial(t *testing.T) {
+	testDBEnv := testEnvs[levelDBtestEnvName]
+	testDBEnv.Init(t)
+	defer testDBEnv.Cleanup()
+	db := testDBEnv.GetDBHandle("TestDB")
+
+	// the committed state has ten public keys and ten private keys
+	batch := privacyenabledstate.NewUpdateBatch()
+	for i := 0; i < 10; i++ {
+		batch.PubUpdates.Put("ns1", fmt.Sprintf("key%d", i), []byte("value"), version.NewHeight(1, uint64(i)))
+		batch.HashUpdates.Put("ns1", "coll1", util.ComputeStringHash(fmt.Sprintf("pvtKey%d", i)), []byte("value"), version.NewHeight(1, uint64(i)))
+	}
+	require.NoError(t, db.ApplyPrivacyAwareUpdates(batch, version.NewHeight(1, 9)))
+
+	val := &validator{db: db, hashFunc: testHashFunc}
+	for seed := int64(0); seed < 20; seed++ {
+		rnd := rand.New(rand.NewSource(seed))
+		var builders []*rwsetutil.RWSetBuilder
+		for i := 0; i < 50; i++ {
+			builders = append(builders, randomRWSetBuilder(rnd))
+		}
+
+		var txs []*transaction
+		for i, rwset := range getTestPubSimulationRWSet(t, builders...) {
+			txs = append(txs, &transaction{indexInBlock: i, id: fmt.Sprintf("txid-%d", i), rwset: rwset})
+		}
+		blk := &block{num: 2, txs: txs}
+		_, _, err := val.validateAndPrepareBatch(blk, true)
+		require.NoError(t, err)
+		requireSameAsParallel(t, val, blk)
+	}
+}
+
+// randomRWSetBuilder simulates a transaction over the keys of
+// TestParallelValidationMatchesSerial, most of whose reads are up to date
+func randomRWSetBuilder(rnd *rand.Rand) *rwsetutil.RWSetBuilder {
+	readVersion := func(i int) *version.Height {
+		if rnd.Intn(10) == 0 {
+			return version.NewHeight(0, 0)
+		}
+		return version.NewHeight(1, uint64(i))
+	}
+
+	b := rwsetutil.NewRWSetBuilder()
+	for n := rnd.Intn(3); n > 0; n-- {
+		i := rnd.Intn(10)
+		b.AddToReadSet("ns1", fmt.Sprintf("key%d", i), readVersion(i))
+	}
+	for n := rnd.Intn(2); n > 0; n-- {
+		i := rnd.Intn(10)
+		b.AddToHashedReadSet("ns1", "coll1", fmt.Sprintf("pvtKey%d", i), readVersion(i))
+	}
+	if rnd.Intn(5) == 0 {
+		start, end := rnd.Intn(10), rnd.Intn(10)
+		if start > end {
+			start, end = end, start
+		}
+		exhausted := rnd.Intn(2) == 0
+		var reads []*kvrwset.KVRead
+		for i := start; i < end || (!exhausted && i == end); i++ {
+			reads = append(reads, rwsetutil.NewKVRead(fmt.Sprintf("key%d", i), version.NewHeight(1, uint64(i))))
+		}
+		rqi := &kvrwset.RangeQueryInfo{StartKey: fmt.Sprintf("key%d", start), EndKey: fmt.Sprintf("key%d", end), ItrExhausted: exhausted}
+		rwsetutil.SetRawReads(rqi, reads)
+		b.AddToRangeQuerySet("ns1", rqi)
+	}
+	// the keys key10 and key11 are deleted, never updated with metadata alone
+	for n := rnd.Intn(3); n > 0; n-- {
+		switch rnd.Intn(4) {
+		case 0:
+			b.AddToWriteSet("ns1", fmt.Sprintf("key%d", 10+rnd.Intn(2)), nil)
+		case 1:
+			b.AddToMetadataWriteSet("ns1", fmt.Sprintf("key%d", rnd.Intn(10)), map[string][]byte{"m": []byte("v")})
+		default:
+			b.AddToWriteSet("ns1", fmt.Sprintf("key%d", rnd.Intn(12)), []byte("newValue"))
+		}
+	}
+	if rnd.Intn(3) == 0 {
+		b.AddToPvtAndHashedWriteSet("ns1", "coll1", fmt.Sprintf("pvtKey%d", rnd.Intn(10)), []byte("newValue"))
+	}
+	return b
+}
+
+// requireSameAsParallel requires the parallel validation of the block to
+// yield the validation codes and the updates of the serial validation
+func requireSameAsParallel(t *testing.T, val *validator, blk *block) {
+	serialCodes := make([]peer.TxValidationCode, len(blk.txs))
+	for i, tx := range blk.txs {
+		serialCodes[i] = tx.validationCode
+	}
+	serialUpdates, serialPurges, err := val.validateAndPrepareBatch(blk, true)
+	require.NoError(t, err)
+
+	parallelVal := &validator{db: val.db, hashFunc: val.hashFunc, parallelism: 4}
+	parallelBlk := &block{num: blk.num}
+	for _, tx := range blk.txs {
+		parallelBlk.txs = append(parallelBlk.txs, &transaction{
+			indexInBlock:            tx.indexInBlock,
+			id:                      tx.id,
+			rwset:                   tx.rwset,
+			containsPostOrderWrites: tx.containsPostOrderWrites,
+		})
+	}
+	parallelUpdates, parallelPurges, err := parallelVal.validateAndPrepareBatch(parallelBlk, true)
+	require.NoError(t, err)
+
+	for i, tx := range parallelBlk.txs {
+		require.Equal(t, serialCodes[i], tx.validationCode, "transaction %d", i)
+	}
+	require.Equal(t, serialUpdates, parallelUpdates)
+	require.ElementsMatch(t, serialPurges, parallelPurges)
+}
@@ -20,6 +20,10 @@ import (
 type validator struct {
 	db       *privacyenabledstate.DB
 	hashFunc rwsetutil.HashFunc
+	// parallelism is the number of transactions validated at once, in the
+	// order of their dependencies. Below 2, transactions are validated
+	// serially.
+	parallelism int
 }
 
 // preLoadCommittedVersionOfRSet loads committed version of all keys in each
@@ -89,13 +93,23 @@ func (v *validator) validateAndPrepareBatch(blk *block, doMVCCValidation bool) (
 		}
 	}
 
+	var parallelCodes []peer.TxValidationCode
+	if doMVCCValidation && v.parallelism > 1 {
+		var err error
+		if parallelCodes, err = v.validateInParallel(blk); err != nil {
+			return nil, nil, err
+		}
+	}
+
 	updates := newPubAndHashUpdates()
 	purgeTracker := newPvtdataPurgeTracker()
 
-	for _, tx := range blk.txs {
+	for i, tx := range blk.txs {
 		var validationCode peer.TxValidationCode
 		var err error
-		if validationCode, err = v.validateEndorserTX(tx.rwset, doMVCCValidation, updates); err != nil {
+		if parallelCodes != nil {
+			validationCode = parallelCodes[i]
+		} else if validationCode, err = v.validateEndorserTX(tx.rwset, doMVCCValidation, updates); err != nil {
 			return nil, nil, err
 		}
 
@@ -508,6 +508,7 @@ func checkValidation(t *testing.T, val *validator, transRWSets []*rwsetutil.TxRw
 	_, _, err := val.validateAndPrepareBatch(blk, true)
 	require.NoError(t, err)
 	t.Logf("block.Txs[0].ValidationCode = %d", blk.txs[0].validationCode)
+	requireSameAsParallel(t, val, blk)
 	var invalidTxs []int
 	for _, tx := range blk.txs {
 		if tx.validationCode != peer.TxValidationCode_VALID {
@@ -52,6 +52,9 @@ type Config struct {
 	HistoryDBConfig *HistoryDBConfig
 	// SnapshotsConfig holds the configuration parameters for the snapshots.
 	SnapshotsConfig *SnapshotsConfig
+	// ValidationConfig holds the configuration parameters for the validation of the
+	// read sets of the transactions. A nil ValidationConfig validates serially.
+	ValidationConfig *ValidationConfig
 }
 
 // StateDBConfig is a structure used to configure the state parameters for the ledger.
@@ -133,6 +136,18 @@ type SnapshotsConfig struct {
 	RootDir string
 }
 
+// ValidationConfig is a structure used to configure the validation of the read sets
+// of the transactions of a block against the state.
+type ValidationConfig struct {
+	// Parallel enables the validation of independent transactions in parallel. The
+	// transactions that depend on the writes of preceding transactions of the block
+	// are validated after them, which gives the results of the serial validation.
+	Parallel bool
+	// Parallelism is the maximum number of transactions validated at once. Zero
+	// means the number of CPUs.
+	Parallelism int
+}
+
 // PeerLedgerProvider provides handle to ledger instances
 type PeerLedgerProvider interface {
 	// CreateFromGenesisBlock creates a new ledger with the given genesis block.
@@ -192,6 +207,9 @@ type PeerLedger interface {
 	CommitLegacy(blockAndPvtdata *BlockAndPvtData, commitOpts *CommitOptions) error
 	// GetConfigHistoryRetriever returns the ConfigHistoryRetriever
 	GetConfigHistoryRetriever() (ConfigHistoryRetriever, error)
+	// GetDAGStats returns the statistics of the dependency graph recorded along
+	// the given block, or nil if none were recorded
+	GetDAGStats(blockNum uint64) (*DAGStats, error)
 	// CommitPvtDataOfOldBlocks commits the private data corresponding to already committed block
 	// If hashes for some of the private data supplied in this function does not match
 	// the corresponding hash present in the block, the unmatched private data is not
@@ -425,6 +443,27 @@ type BlockPvtdata struct {
 // CommitOptions encapsulates options associated with a block commit.
 type CommitOptions struct {
 	FetchPvtDataFromLedger bool
+	// DAGStats are recorded along the block when not nil
+	DAGStats *DAGStats
+}
+
+// DAGStats are the statistics of the dependency graph of the transactions of
+// a block, as built and validated by the committer
+type DAGStats struct {
+	// Transactions is the number of transactions in the graph
+	Transactions int `json:"transactions"`
+	// LevelWidths are the numbers of transactions of the levels of the graph,
+	// whose number is the number of levels
+	LevelWidths []int `json:"level_widths"`
+	// Edges is the number of dependencies and conflicts between transactions
+	// of the block
+	Edges int `json:"edges"`
+	// DependencyInvalid is the number of transactions invalidated because a
+	// transaction of the block they depend on is invalid
+	DependencyInvalid int `json:"dependency_invalid"`
+	// Duration is the time spent building the graph and validating the block
+	// along it
+	Duration time.Duration `json:"duration"`
 }
 
 // PvtCollFilter represents the set of the collection names (as keys of the map with value 'true')
@@ -154,6 +154,19 @@ type PeerLedger struct {
 		result1 ledger.ConfigHistoryRetriever
 		result2 error
 	}
+	GetDAGStatsStub        func(uint64) (*ledger.DAGStats, error)
+	getDAGStatsMutex       sync.RWMutex
+	getDAGStatsArgsForCall []struct {
+		arg1 uint64
+	}
+	getDAGStatsReturns struct {
+		result1 *ledger.DAGStats
+		result2 error
+	}
+	getDAGStatsReturnsOnCall map[int]struct {
+		result1 *ledger.DAGStats
+		result2 error
+	}
 	GetMissingPvtDataTrackerStub        func() (ledger.MissingPvtDataTracker, error)
 	getMissingPvtDataTrackerMutex       sync.RWMutex
 	getMissingPvtDataTrackerArgsForCall []struct {
@@ -1005,6 +1018,69 @@ func (fake *PeerLedger) GetConfigHistoryRetrieverReturnsOnCall(i int, result1 le
 	}{result1, result2}
 }
 
+func (fake *PeerLedger) GetDAGStats(arg1 uint64) (*ledger.DAGStats, error) {
+	fake.getDAGStatsMutex.Lock()
+	ret, specificReturn := fake.getDAGStatsReturnsOnCall[len(fake.getDAGStatsArgsForCall)]
+	fake.getDAGStatsArgsForCall = append(fake.getDAGStatsArgsForCall, struct {
+		arg1 uint64
+	}{arg1})
+	fake.recordInvocation("GetDAGStats", []interface{}{arg1})
+	fake.getDAGStatsMutex.Unlock()
+	if fake.GetDAGStatsStub != nil {
+		return fake.GetDAGStatsStub(arg1)
+	}
+	if specificReturn {
+		return ret.result1, ret.result2
+	}
+	fakeReturns := fake.getDAGStatsReturns
+	return fakeReturns.result1, fakeReturns.result2
+}
+
+func (fake *PeerLedger) GetDAGStatsCallCount() int {
+	fake.getDAGStatsMutex.RLock()
+	defer fake.getDAGStatsMutex.RUnlock()
+	return len(fake.getDAGStatsArgsForCall)
+}
+
+func (fake *PeerLedger) GetDAGStatsCalls(stub func(uint64) (*ledger.DAGStats, error)) {
+	fake.getDAGStatsMutex.Lock()
+	defer fake.getDAGStatsMutex.Unlock()
+	fake.GetDAGStatsStub = stub
+}
+
+func (fake *PeerLedger) GetDAGStatsArgsForCall(i int) uint64 {
+	fake.getDAGStatsMutex.RLock()
+	defer fake.getDAGStatsMutex.RUnlock()
+	argsForCall := fake.getDAGStatsArgsForCall[i]
+	return argsForCall.arg1
+}
+
+func (fake *PeerLedger) GetDAGStatsReturns(result1 *ledger.DAGStats, result2 error) {
+	fake.getDAGStatsMutex.Lock()
+	defer fake.getDAGStatsMutex.Unlock()
+	fake.GetDAGStatsStub = nil
+	fake.getDAGStatsReturns = struct {
+		result1 *ledger.DAGStats
+		result2 error
+	}{result1, result2}
+}
+
+func (fake *PeerLedger) GetDAGStatsReturnsOnCall(i int, result1 *ledger.DAGStats, result2 error) {
+	fake.getDAGStatsMutex.Lock()
+	defer fake.getDAGStatsMutex.Unlock()
+	fake.GetDAGStatsStub = nil
+	if fake.getDAGStatsReturnsOnCall == nil {
+		fake.getDAGStatsReturnsOnCall = make(map[int]struct {
+			result1 *ledger.DAGStats
+			result2 error
+		})
+	}
+	fake.getDAGStatsReturnsOnCall[i] = struct {
+		result1 *ledger.DAGStats
+		result2 error
+	}{result1, result2}
+}
+
 func (fake *PeerLedger) GetMissingPvtDataTracker() (ledger.MissingPvtDataTracker, error) {
 	fake.getMissingPvtDataTrackerMutex.Lock()
 	ret, specificReturn := fake.getMissingPvtDataTrackerReturnsOnCall[len(fake.getMissingPvtDataTrackerArgsForCall)]
@@ -1695,6 +1771,8 @@ func (fake *PeerLedger) Invocations() map[string][][]interface{} {
 	defer fake.getBlocksIteratorMutex.RUnlock()
 	fake.getConfigHistoryRetrieverMutex.RLock()
 	defer fake.getConfigHistoryRetrieverMutex.RUnlock()
+	fake.getDAGStatsMutex.RLock()
+	defer fake.getDAGStatsMutex.RUnlock()
 	fake.getMissingPvtDataTrackerMutex.RLock()
 	defer fake.getMissingPvtDataTrackerMutex.RUnlock()
 	fake.getPvtDataAndBlockByNumMutex.RLock()
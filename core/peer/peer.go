@@ -164,6 +164,7 @@ type Peer struct {
 	channels map[string]*Channel
 
 	configCallbacks []channelconfig.BundleActor
+	commitListeners []committer.CommitListener
 }
 
 // AddConfigCallbacks adds one or more BundleActor functions to list of callbacks that
@@ -172,6 +173,12 @@ func (p *Peer) AddConfigCallbacks(callbacks ...channelconfig.BundleActor) {
 	p.configCallbacks = append(p.configCallbacks, callbacks...)
 }
 
+// AddCommitListeners adds one or more listeners that are notified of the
+// shard prepared transactions of every block committed to a channel ledger.
+func (p *Peer) AddCommitListeners(listeners ...committer.CommitListener) {
+	p.commitListeners = append(p.commitListeners, listeners...)
+}
+
 func (p *Peer) openStore(cid string) (*transientstore.Store, error) {
 	store, err := p.StoreProvider.OpenStore(cid)
 	if err != nil {
@@ -329,7 +336,7 @@ func (p *Peer) createChannel(
 		callbacks...,
 	)
 
-	committer := committer.NewLedgerCommitter(l)
+	committer := committer.NewLedgerCommitter(l, p.commitListeners...)
 	validator := &txvalidator.ValidationRouter{
 		CapabilityProvider: channel,
 		V14Validator: validatorv14.NewTxValidator(
@@ -7,10 +7,12 @@ SPDX-License-Identifier: Apache-2.0
 package qscc
 
 import (
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/hyperledger/fabric-chaincode-go/shim"
 	"github.com/hyperledger/fabric-chaincode-go/shimtest"
@@ -212,6 +214,52 @@ func TestQueryGetBlockByTxID(t *testing.T) {
 	require.Equal(t, int32(shim.ERROR), res.Status, "GetBlockByTxID should have failed with blank txId.")
 }
 
+func TestQueryGetDAGStats(t *testing.T) {
+	chainid := "mytestchainid10"
+	path := tempDir(t, "test10")
+	defer os.RemoveAll(path)
+
+	stub, p, cleanup, err := setupTestLedger(chainid, path)
+	if err != nil {
+		t.Fatalf(err.Error())
+	}
+	defer cleanup()
+
+	dagStats := &ledger2.DAGStats{
+		Transactions:      3,
+		LevelWidths:       []int{2, 1},
+		Edges:             2,
+		DependencyInvalid: 1,
+		Duration:          20 * time.Millisecond,
+	}
+	ledger := p.GetLedger(chainid)
+	bcInfo, err := ledger.GetBlockchainInfo()
+	require.NoError(t, err)
+	block1 := testutil.ConstructBlock(t, 1, bcInfo.CurrentBlockHash, [][]byte{}, false)
+	require.NoError(t, ledger.CommitLegacy(&ledger2.BlockAndPvtData{Block: block1}, &ledger2.CommitOptions{DAGStats: dagStats}))
+
+	args := [][]byte{[]byte(GetDAGStats), []byte(chainid), []byte("1")}
+	prop := resetProvider(resources.Qscc_GetDAGStats, chainid, nil, nil)
+	res := stub.MockInvokeWithSignedProposal("1", args, prop)
+	require.Equal(t, int32(shim.OK), res.Status, "GetDAGStats failed with err: %s", res.Message)
+	stats := &ledger2.DAGStats{}
+	require.NoError(t, json.Unmarshal(res.Payload, stats))
+	require.Equal(t, dagStats, stats)
+
+	// no statistics were recorded along the genesis block
+	args = [][]byte{[]byte(GetDAGStats), []byte(chainid), []byte("0")}
+	res = stub.MockInvoke("2", args)
+	require.Equal(t, int32(shim.ERROR), res.Status, "GetDAGStats should have failed for block number: 0")
+
+	args = [][]byte{[]byte(GetDAGStats), []byte(chainid), []byte("abc")}
+	res = stub.MockInvoke("3", args)
+	require.Equal(t, int32(shim.ERROR), res.Status, "GetDAGStats should have failed with invalid block number")
+
+	args = [][]byte{[]byte(GetDAGStats), []byte(chainid), []byte(nil)}
+	res = stub.MockInvoke("4", args)
+	require.Equal(t, int32(shim.ERROR), res.Status, "GetDAGStats should have failed with nil block number")
+}
+
 func TestFailingCC2CC(t *testing.T) {
 	t.Run("BadProposal", func(t *testing.T) {
 		stub := shimtest.NewMockStub("testchannel", &LedgerQuerier{})
@@ -0,0 +1,108 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	cb "github.com/hyperledger/fabric-protos-go/common"
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/scc/qscc"
+	"github.com/hyperledger/fabric/internal/peer/common"
+	"github.com/hyperledger/fabric/protoutil"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func getDAGStatsCmd(cf *ChannelCmdFactory) *cobra.Command {
+	getDAGStatsCmd := &cobra.Command{
+		Use:   "getdagstats <blockNumber>",
+		Short: "get the dependency graph statistics of a block of a specified channel.",
+		Long:  "get the statistics of the transaction dependency graph recorded along a block of a specified channel. Requires '-c'.",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return getDAGStats(cmd, args, cf)
+		},
+	}
+	flagList := []string{
+		"channelID",
+	}
+	attachFlags(getDAGStatsCmd, flagList)
+
+	return getDAGStatsCmd
+}
+
+func (cc *endorserClient) getDAGStats(blockNum uint64) ([]byte, error) {
+	invocation := &pb.ChaincodeInvocationSpec{
+		ChaincodeSpec: &pb.ChaincodeSpec{
+			Type:        pb.ChaincodeSpec_Type(pb.ChaincodeSpec_Type_value["GOLANG"]),
+			ChaincodeId: &pb.ChaincodeID{Name: "qscc"},
+			Input: &pb.ChaincodeInput{Args: [][]byte{
+				[]byte(qscc.GetDAGStats),
+				[]byte(channelID),
+				[]byte(strconv.FormatUint(blockNum, 10)),
+			}},
+		},
+	}
+
+	c, _ := cc.cf.Signer.Serialize()
+	prop, _, err := protoutil.CreateProposalFromCIS(cb.HeaderType_ENDORSER_TRANSACTION, "", invocation, c)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot create proposal")
+	}
+
+	signedProp, err := protoutil.GetSignedProposal(prop, cc.cf.Signer)
+	if err != nil {
+		return nil, errors.WithMessage(err, "cannot create signed proposal")
+	}
+
+	proposalResp, err := cc.cf.EndorserClient.ProcessProposal(context.Background(), signedProp)
+	if err != nil {
+		return nil, errors.WithMessage(err, "failed sending proposal")
+	}
+
+	if proposalResp.Response == nil || proposalResp.Response.Status != 200 {
+		return nil, errors.Errorf("received bad response, status %d: %s", proposalResp.Response.Status, proposalResp.Response.Message)
+	}
+
+	return proposalResp.Response.Payload, nil
+}
+
+func getDAGStats(cmd *cobra.Command, args []string, cf *ChannelCmdFactory) error {
+	// the global chainID filled by the "-c" command
+	if channelID == common.UndefinedParamValue {
+		return errors.New("Must supply channel ID")
+	}
+	if len(args) != 1 {
+		return errors.New("Must supply a block number")
+	}
+	blockNum, err := strconv.ParseUint(args[0], 10, 64)
+	if err != nil {
+		return errors.Wrapf(err, "invalid block number %s", args[0])
+	}
+	// Parsing of the command line is done so silence cmd usage
+	cmd.SilenceUsage = true
+
+	if cf == nil {
+		cf, err = InitCmdFactory(EndorserRequired, PeerDeliverNotRequired, OrdererNotRequired)
+		if err != nil {
+			return err
+		}
+	}
+
+	client := &endorserClient{cf}
+
+	jsonBytes, err := client.getDAGStats(blockNum)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("DAG statistics of block %d: %s\n", blockNum, string(jsonBytes))
+
+	return nil
+}
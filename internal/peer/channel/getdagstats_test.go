@@ -0,0 +1,120 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package channel
+
+import (
+	"testing"
+
+	pb "github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/internal/peer/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetDAGStats(t *testing.T) {
+	InitMSP()
+	resetFlags()
+
+	mockResponse := &pb.ProposalResponse{
+		Response: &pb.Response{
+			Status:  200,
+			Payload: []byte(`{"transactions":3,"level_widths":[2,1],"edges":2,"dependency_invalid":1,"duration":20000000}`),
+		},
+		Endorsement: &pb.Endorsement{},
+	}
+
+	signer, err := common.GetDefaultSigner()
+	require.NoError(t, err)
+
+	mockCF := &ChannelCmdFactory{
+		EndorserClient:   common.GetMockEndorserClient(mockResponse, nil),
+		BroadcastFactory: mockBroadcastClientFactory,
+		Signer:           signer,
+	}
+
+	cmd := getDAGStatsCmd(mockCF)
+	AddFlags(cmd)
+
+	args := []string{"-c", mockChannel, "1"}
+	cmd.SetArgs(args)
+
+	require.NoError(t, cmd.Execute())
+}
+
+func TestGetDAGStatsBadResponse(t *testing.T) {
+	InitMSP()
+	resetFlags()
+
+	mockResponse := &pb.ProposalResponse{
+		Response: &pb.Response{
+			Status:  500,
+			Message: "No DAG statistics recorded for block number 1",
+		},
+		Endorsement: &pb.Endorsement{},
+	}
+
+	signer, err := common.GetDefaultSigner()
+	require.NoError(t, err)
+
+	mockCF := &ChannelCmdFactory{
+		EndorserClient:   common.GetMockEndorserClient(mockResponse, nil),
+		BroadcastFactory: mockBroadcastClientFactory,
+		Signer:           signer,
+	}
+
+	cmd := getDAGStatsCmd(mockCF)
+	AddFlags(cmd)
+
+	cmd.SetArgs([]string{"-c", mockChannel, "1"})
+
+	require.EqualError(t, cmd.Execute(), "received bad response, status 500: No DAG statistics recorded for block number 1")
+}
+
+func TestGetDAGStatsInvalidArgs(t *testing.T) {
+	InitMSP()
+
+	signer, err := common.GetDefaultSigner()
+	require.NoError(t, err)
+
+	mockCF := &ChannelCmdFactory{
+		Signer: signer,
+	}
+
+	for _, testCase := range []struct {
+		name        string
+		args        []string
+		expectedErr string
+	}{
+		{
+			name:        "missing channel ID",
+			args:        []string{"1"},
+			expectedErr: "Must supply channel ID",
+		},
+		{
+			name:        "missing block number",
+			args:        []string{"-c", mockChannel},
+			expectedErr: "Must supply a block number",
+		},
+		{
+			name:        "invalid block number",
+			args:        []string{"-c", mockChannel, "newest"},
+			expectedErr: "invalid block number newest",
+		},
+	} {
+		t.Run(testCase.name, func(t *testing.T) {
+			resetFlags()
+
+			cmd := getDAGStatsCmd(mockCF)
+			AddFlags(cmd)
+
+			cmd.SetArgs(testCase.args)
+
+			err := cmd.Execute()
+			require.Error(t, err)
+			require.Contains(t, err.Error(), testCase.expectedErr)
+		})
+	}
+}
@@ -7,11 +7,14 @@ SPDX-License-Identifier: Apache-2.0
 package node
 
 import (
+	"os"
 	"path/filepath"
 	"time"
 
 	coreconfig "github.com/hyperledger/fabric/core/config"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
 	"github.com/hyperledger/fabric/core/ledger"
+	"github.com/pkg/errors"
 	"github.com/spf13/viper"
 )
 
@@ -71,6 +74,10 @@ func ledgerConfig() *ledger.Config {
 		SnapshotsConfig: &ledger.SnapshotsConfig{
 			RootDir: snapshotsRootDir,
 		},
+		ValidationConfig: &ledger.ValidationConfig{
+			Parallel:    viper.GetBool("ledger.validation.parallel"),
+			Parallelism: viper.GetInt("ledger.validation.parallelism"),
+		},
 	}
 
 	if conf.StateDBConfig.StateDatabase == ledger.CouchDB {
@@ -90,3 +97,161 @@ func ledgerConfig() *ledger.Config {
 	}
 	return conf
 }
+
+func shardingConfig() (*sharding.Config, error) {
+	var replicas []struct {
+		ID      uint64 `mapstructure:"id"`
+		Address string `mapstructure:"address"`
+		TLSCert string `mapstructure:"tlsCert"`
+	}
+	if err := viper.UnmarshalKey("sharding.replicas", &replicas); err != nil {
+		return nil, errors.Wrap(err, "could not read sharding.replicas")
+	}
+	shardIDs := viper.GetStringSlice("sharding.shards")
+
+	conf := &sharding.Config{
+		Shards: map[string]sharding.ShardConfig{},
+		Partitioning: sharding.PartitionConfig{
+			Strategy:     viper.GetString("sharding.partitioning.strategy"),
+			VirtualNodes: viper.GetInt("sharding.partitioning.virtualNodes"),
+		},
+	}
+	if err := viper.UnmarshalKey("sharding.partitioning.partitions", &conf.Partitioning.Partitions); err != nil {
+		return nil, errors.Wrap(err, "could not read sharding.partitioning.partitions")
+	}
+	if err := viper.UnmarshalKey("sharding.partitioning.splits", &conf.Partitioning.Splits); err != nil {
+		return nil, errors.Wrap(err, "could not read sharding.partitioning.splits")
+	}
+	batching, err := shardBatching()
+	if err != nil {
+		return nil, err
+	}
+	conf.Batching = batching
+	admission, err := shardAdmission()
+	if err != nil {
+		return nil, err
+	}
+	conf.Admission = admission
+	conf.ExpiryBlocks = sharding.DefaultExpiryBlocks
+	if viper.IsSet("sharding.expiryBlocks") {
+		expiryBlocks := viper.GetInt("sharding.expiryBlocks")
+		if expiryBlocks <= 0 {
+			return nil, errors.New("sharding.expiryBlocks must be positive")
+		}
+		conf.ExpiryBlocks = uint64(expiryBlocks)
+	}
+
+	replicaID := viper.GetUint64("sharding.replicaID")
+	if replicaID == 0 && len(replicas) == 0 {
+		if len(shardIDs) > 0 {
+			return nil, errors.New("sharding.shards requires sharding.replicaID and sharding.replicas")
+		}
+		return conf, nil
+	}
+
+	topology := &sharding.Topology{
+		ReplicaID: replicaID,
+		Join:      viper.GetBool("sharding.join"),
+	}
+
+	configDir := filepath.Dir(viper.ConfigFileUsed())
+	for _, r := range replicas {
+		replica := sharding.Replica{ID: r.ID, Address: r.Address}
+		if r.TLSCert != "" {
+			cert, err := os.ReadFile(coreconfig.TranslatePath(configDir, r.TLSCert))
+			if err != nil {
+				return nil, errors.Wrapf(err, "could not read TLS certificate of shard replica %d", r.ID)
+			}
+			replica.TLSCert = cert
+		}
+		topology.Replicas = append(topology.Replicas, replica)
+	}
+	if err := topology.Validate(); err != nil {
+		return nil, errors.WithMessage(err, "invalid shard topology")
+	}
+	conf.Topology = topology
+
+	for _, shardID := range shardIDs {
+		shardConf := topology.ShardConfig(shardID)
+		shardConf.Batch = batching.For(shardID)
+		shardConf.Admission = admission
+		shardConf.ExpiryBlocks = conf.ExpiryBlocks
+		conf.Shards[shardID] = shardConf
+	}
+
+	return conf, nil
+}
+
+// shardBatching reads the batching of the shards. The settings of a contract
+// under sharding.batching override the defaults of the sharding section for
+// the shards of the contract.
+func shardBatching() (sharding.Batching, error) {
+	batching := sharding.Batching{
+		Default: sharding.DefaultBatchConfig,
+		Shards:  map[string]sharding.BatchConfig{},
+	}
+	if viper.IsSet("sharding.batchTimeout") {
+		batching.Default.Timeout = viper.GetDuration("sharding.batchTimeout")
+	}
+	if viper.IsSet("sharding.maxBatchSize") {
+		batching.Default.MaxSize = viper.GetInt("sharding.maxBatchSize")
+	}
+	if viper.IsSet("sharding.maxBatchBytes") {
+		batching.Default.MaxBytes = viper.GetInt("sharding.maxBatchBytes")
+	}
+	if viper.IsSet("sharding.adaptiveBatching") {
+		batching.Default.Adaptive = viper.GetBool("sharding.adaptiveBatching")
+	}
+
+	var overrides map[string]struct {
+		BatchTimeout     time.Duration `mapstructure:"batchTimeout"`
+		MaxBatchSize     int           `mapstructure:"maxBatchSize"`
+		MaxBatchBytes    int           `mapstructure:"maxBatchBytes"`
+		AdaptiveBatching *bool         `mapstructure:"adaptiveBatching"`
+	}
+	if err := viper.UnmarshalKey("sharding.batching", &overrides); err != nil {
+		return sharding.Batching{}, errors.Wrap(err, "could not read sharding.batching")
+	}
+	for contract, override := range overrides {
+		config := batching.Default
+		if override.BatchTimeout != 0 {
+			config.Timeout = override.BatchTimeout
+		}
+		if override.MaxBatchSize != 0 {
+			config.MaxSize = override.MaxBatchSize
+		}
+		if override.MaxBatchBytes != 0 {
+			config.MaxBytes = override.MaxBatchBytes
+		}
+		if override.AdaptiveBatching != nil {
+			config.Adaptive = *override.AdaptiveBatching
+		}
+		batching.Shards[contract] = config
+	}
+
+	configs := map[string]sharding.BatchConfig{"sharding": batching.Default}
+	for contract, config := range batching.Shards {
+		configs["sharding.batching."+contract] = config
+	}
+	for key, config := range configs {
+		if config.Timeout <= 0 || config.MaxSize <= 0 || config.MaxBytes <= 0 {
+			return sharding.Batching{}, errors.Errorf("%s must have a positive batchTimeout, maxBatchSize and maxBatchBytes", key)
+		}
+	}
+	return batching, nil
+}
+
+// shardAdmission reads the admission control of the shards
+func shardAdmission() (sharding.AdmissionConfig, error) {
+	admission := sharding.DefaultAdmissionConfig
+	if viper.IsSet("sharding.maxInFlightPrepares") {
+		admission.MaxInFlight = viper.GetInt("sharding.maxInFlightPrepares")
+	}
+	if viper.IsSet("sharding.priorityInFlightReserve") {
+		admission.PriorityReserve = viper.GetInt("sharding.priorityInFlightReserve")
+	}
+	if admission.MaxInFlight <= 0 || admission.PriorityReserve < 0 {
+		return sharding.AdmissionConfig{}, errors.New("sharding.maxInFlightPrepares must be positive and sharding.priorityInFlightReserve must not be negative")
+	}
+	return admission, nil
+}
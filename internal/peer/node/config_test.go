@@ -7,9 +7,13 @@ SPDX-License-Identifier: Apache-2.0
 package node
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"github.com/hyperledger/fabric/common/crypto/tlsgen"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
 	"github.com/hyperledger/fabric/core/ledger"
 	"github.com/spf13/viper"
 	"github.com/stretchr/testify/require"
@@ -47,6 +51,7 @@ func TestLedgerConfig(t *testing.T) {
 				SnapshotsConfig: &ledger.SnapshotsConfig{
 					RootDir: "/peerfs/snapshots",
 				},
+				ValidationConfig: &ledger.ValidationConfig{},
 			},
 		},
 		{
@@ -94,6 +99,7 @@ func TestLedgerConfig(t *testing.T) {
 				SnapshotsConfig: &ledger.SnapshotsConfig{
 					RootDir: "/peerfs/snapshots",
 				},
+				ValidationConfig: &ledger.ValidationConfig{},
 			},
 		},
 		{
@@ -118,6 +124,8 @@ func TestLedgerConfig(t *testing.T) {
 				"ledger.pvtdataStore.deprioritizedDataReconcilerInterval": "180m",
 				"ledger.history.enableHistoryDatabase":                    true,
 				"ledger.snapshots.rootDir":                                "/peerfs/customLocationForsnapshots",
+				"ledger.validation.parallel":                              true,
+				"ledger.validation.parallelism":                           8,
 			},
 			expected: &ledger.Config{
 				RootFSPath: "/peerfs/ledgersData",
@@ -150,6 +158,10 @@ func TestLedgerConfig(t *testing.T) {
 				SnapshotsConfig: &ledger.SnapshotsConfig{
 					RootDir: "/peerfs/customLocationForsnapshots",
 				},
+				ValidationConfig: &ledger.ValidationConfig{
+					Parallel:    true,
+					Parallelism: 8,
+				},
 			},
 		},
 	}
@@ -165,3 +177,126 @@ func TestLedgerConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestShardingConfig(t *testing.T) {
+	defer viper.Reset()
+
+	t.Run("not replicated", func(t *testing.T) {
+		viper.Reset()
+		conf, err := shardingConfig()
+		require.NoError(t, err)
+		require.Nil(t, conf.Topology)
+		require.Empty(t, conf.Shards)
+	})
+
+	t.Run("replicated", func(t *testing.T) {
+		viper.Reset()
+		ca, err := tlsgen.NewCA()
+		require.NoError(t, err)
+		cert := ca.CertBytes()
+		certFile := filepath.Join(t.TempDir(), "peer1.pem")
+		require.NoError(t, os.WriteFile(certFile, cert, 0o600))
+		viper.Set("sharding.replicaID", 2)
+		viper.Set("sharding.replicas", []map[string]interface{}{
+			{"id": 1, "address": "peer0.example.com:7051"},
+			{"id": 2, "address": "peer1.example.com:7051", "tlsCert": certFile},
+		})
+		viper.Set("sharding.shards", []string{"registry"})
+		viper.Set("sharding.partitioning.strategy", "hash")
+		viper.Set("sharding.partitioning.partitions", map[string]int{"registry": 4})
+
+		conf, err := shardingConfig()
+		require.NoError(t, err)
+		require.Equal(t, &sharding.Topology{
+			ReplicaID: 2,
+			Replicas: []sharding.Replica{
+				{ID: 1, Address: "peer0.example.com:7051"},
+				{ID: 2, Address: "peer1.example.com:7051", TLSCert: cert},
+			},
+		}, conf.Topology)
+		require.Equal(t, map[string]sharding.ShardConfig{
+			"registry": {
+				ShardID:      "registry",
+				ReplicaNodes: []string{"peer0.example.com:7051", "peer1.example.com:7051"},
+				ReplicaID:    2,
+				Batch:        sharding.DefaultBatchConfig,
+				Admission:    sharding.DefaultAdmissionConfig,
+				ExpiryBlocks: sharding.DefaultExpiryBlocks,
+			},
+		}, conf.Shards)
+		require.Equal(t, sharding.PartitionConfig{
+			Strategy:   "hash",
+			Partitions: map[string]int{"registry": 4},
+		}, conf.Partitioning)
+	})
+
+	t.Run("batching", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("sharding.batchTimeout", "50ms")
+		viper.Set("sharding.maxBatchSize", 100)
+		viper.Set("sharding.maxBatchBytes", 65536)
+		viper.Set("sharding.adaptiveBatching", true)
+		viper.Set("sharding.batching", map[string]interface{}{
+			"registry": map[string]interface{}{"maxBatchSize": 500, "adaptiveBatching": false},
+		})
+
+		conf, err := shardingConfig()
+		require.NoError(t, err)
+		defaults := sharding.BatchConfig{Timeout: 50 * time.Millisecond, MaxSize: 100, MaxBytes: 65536, Adaptive: true}
+		require.Equal(t, defaults, conf.Batching.For("callee"))
+		registry := sharding.BatchConfig{Timeout: 50 * time.Millisecond, MaxSize: 500, MaxBytes: 65536}
+		require.Equal(t, registry, conf.Batching.For("registry"))
+		require.Equal(t, registry, conf.Batching.For("registry.3"))
+
+		viper.Set("sharding.batching", map[string]interface{}{
+			"registry": map[string]interface{}{"maxBatchSize": -1},
+		})
+		_, err = shardingConfig()
+		require.EqualError(t, err, "sharding.batching.registry must have a positive batchTimeout, maxBatchSize and maxBatchBytes")
+	})
+
+	t.Run("admission", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("sharding.maxInFlightPrepares", 200)
+		viper.Set("sharding.priorityInFlightReserve", 0)
+
+		conf, err := shardingConfig()
+		require.NoError(t, err)
+		require.Equal(t, sharding.AdmissionConfig{MaxInFlight: 200}, conf.Admission)
+
+		viper.Set("sharding.maxInFlightPrepares", 0)
+		_, err = shardingConfig()
+		require.EqualError(t, err, "sharding.maxInFlightPrepares must be positive and sharding.priorityInFlightReserve must not be negative")
+	})
+
+	t.Run("expiry", func(t *testing.T) {
+		viper.Reset()
+		conf, err := shardingConfig()
+		require.NoError(t, err)
+		require.Equal(t, uint64(sharding.DefaultExpiryBlocks), conf.ExpiryBlocks)
+
+		viper.Set("sharding.expiryBlocks", 20)
+		conf, err = shardingConfig()
+		require.NoError(t, err)
+		require.Equal(t, uint64(20), conf.ExpiryBlocks)
+
+		viper.Set("sharding.expiryBlocks", 0)
+		_, err = shardingConfig()
+		require.EqualError(t, err, "sharding.expiryBlocks must be positive")
+	})
+
+	t.Run("invalid topology", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("sharding.replicaID", 3)
+		viper.Set("sharding.replicas", []map[string]interface{}{{"id": 1, "address": "peer0.example.com:7051"}})
+		_, err := shardingConfig()
+		require.EqualError(t, err, "invalid shard topology: replica ID 3 of this peer is not a configured shard replica")
+	})
+
+	t.Run("shards without topology", func(t *testing.T) {
+		viper.Reset()
+		viper.Set("sharding.shards", []string{"registry"})
+		_, err := shardingConfig()
+		require.EqualError(t, err, "sharding.shards requires sharding.replicaID and sharding.replicas")
+	})
+}
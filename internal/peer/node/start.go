@@ -59,6 +59,8 @@ import (
 	"github.com/hyperledger/fabric/core/deliverservice"
 	"github.com/hyperledger/fabric/core/dispatcher"
 	"github.com/hyperledger/fabric/core/endorser"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	shardprotos "github.com/hyperledger/fabric/core/endorser/sharding/protos"
 	authHandler "github.com/hyperledger/fabric/core/handlers/auth"
 	endorsement2 "github.com/hyperledger/fabric/core/handlers/endorsement/api"
 	endorsement3 "github.com/hyperledger/fabric/core/handlers/endorsement/api/identities"
@@ -752,13 +754,56 @@ func serve(args []string) error {
 	channelFetcher := endorserChannelAdapter{
 		peer: peerInstance,
 	}
+	endorserMetrics := endorser.NewMetrics(metricsProvider)
+	shardConf, err := shardingConfig()
+	if err != nil {
+		return errors.WithMessage(err, "could not decode sharding configuration")
+	}
+	partitioner, err := sharding.NewPartitioner(shardConf.Partitioning)
+	if err != nil {
+		return errors.WithMessage(err, "invalid sharding partitioning")
+	}
+	if shardConf.Topology != nil {
+		// replicas authenticate each other with the TLS certificate of their peer
+		for _, replica := range shardConf.Topology.Replicas {
+			if serverConfig.SecOpts.UseTLS && replica.TLSCert == nil {
+				return errors.Errorf("shard replica %d has no TLS certificate while TLS is enabled", replica.ID)
+			}
+		}
+		shardConf.Topology.ServerConfig = serverConfig
+		shardConf.Topology.ClientConfig = comm.ClientConfig{
+			SecOpts: comm.SecureOptions{
+				UseTLS:        serverConfig.SecOpts.UseTLS,
+				ServerRootCAs: serverConfig.SecOpts.ServerRootCAs,
+			},
+			KaOpts:      comm.DefaultKeepaliveOptions,
+			DialTimeout: serverConfig.ConnectionTimeout,
+		}
+	}
+	shardManager := sharding.NewShardManager(
+		filepath.Join(coreconfig.GetPath("peer.fileSystemPath"), "shards"),
+		signingIdentity,
+		shardConf.Topology,
+		shardConf.Shards,
+		endorserMetrics.Sharding,
+	)
+	shardManager.SetPartitioner(partitioner)
+	shardManager.SetBatching(shardConf.Batching)
+	shardManager.SetAdmission(shardConf.Admission)
+	shardManager.SetExpiryBlocks(shardConf.ExpiryBlocks)
+	// the shard dumps carry transaction IDs, so they require a client
+	// certificate like the log spec
+	opsSystem.RegisterHandler(sharding.URLBaseV1, sharding.NewHTTPHandler(shardManager), coreConfig.OperationsTLSEnabled)
 	serverEndorser := &endorser.Endorser{
 		PrivateDataDistributor: gossipService,
 		ChannelFetcher:         channelFetcher,
 		LocalMSP:               localMSP,
 		Support:                endorserSupport,
-		Metrics:                endorser.NewMetrics(metricsProvider),
+		Metrics:                endorserMetrics,
+		ShardManager:           shardManager,
 	}
+	// release shard dependency entries once their transactions are committed
+	peerInstance.AddCommitListeners(serverEndorser.ShardManager)
 
 	// deploy system chaincodes
 	for _, cc := range []scc.SelfDescribingSysCC{lsccInst, csccInst, qsccInst, lifecycleSCC} {
@@ -912,6 +957,11 @@ func serve(args []string) error {
 	// Register the Endorser server
 	pb.RegisterEndorserServer(peerServer.Server(), auth)
 
+	// Register the shard service that carries the raft messages of the shards
+	if transport := shardManager.Transport(); transport != nil {
+		shardprotos.RegisterShardCommunicationServer(peerServer.Server(), transport)
+	}
+
 	// register the snapshot server
 	snapshotSvc := &snapshotgrpc.SnapshotService{LedgerGetter: peerInstance, ACLProvider: aclProvider}
 	pb.RegisterSnapshotServer(peerServer.Server(), snapshotSvc)
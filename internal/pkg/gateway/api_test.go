@@ -21,6 +21,7 @@ import (
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/common/crypto/tlsgen"
 	"github.com/hyperledger/fabric/common/ledger"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
 	"github.com/hyperledger/fabric/gossip/api"
 	"github.com/hyperledger/fabric/gossip/common"
 	gdiscovery "github.com/hyperledger/fabric/gossip/discovery"
@@ -729,6 +730,12 @@ func createErrorResponse(t *testing.T, status int32, errMessage string, payload
 	}
 }
 
+func createOverloadedResponse(t *testing.T, retryAfter time.Duration) *peer.ProposalResponse {
+	response, err := sharding.NewOverloadedResponse(&sharding.OverloadedError{ShardID: testChaincode, InFlight: 900, RetryAfter: retryAfter})
+	require.NoError(t, err)
+	return &peer.ProposalResponse{Response: response}
+}
+
 func marshal(msg proto.Message, t *testing.T) []byte {
 	buf, err := proto.Marshal(msg)
 	require.NoError(t, err, "Failed to marshal message")
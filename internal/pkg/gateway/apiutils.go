@@ -14,6 +14,8 @@ import (
 	gp "github.com/hyperledger/fabric-protos-go/gateway"
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/core/chaincode"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -37,6 +39,10 @@ func responseStatus(response *peer.ProposalResponse, err error) (statusCode code
 		// preProcess does all the signature and ACL checking. In either case, no point retrying, or closing the connection (it's a client error)
 		return codes.FailedPrecondition, err.Error(), false, false
 	}
+	if response.Response.Status == sharding.StatusTooManyRequests {
+		// the shards of the peer are overloaded - retry on another peer, or later
+		return codes.ResourceExhausted, response.Response.Message, true, false
+	}
 	if response.Response.Status < 200 || response.Response.Status >= 400 {
 		if response.Payload == nil && response.Response.Status == 500 {
 			// there's a error 500 response but no payload, so the response was generated in the peer rather than the chaincode
@@ -55,6 +61,16 @@ func responseStatus(response *peer.ProposalResponse, err error) (statusCode code
 	return codes.OK, "", false, false
 }
 
+// retryInfo returns the retry info of the response of a peer whose shards are
+// overloaded, unless the previous retry info asks for a longer delay
+func retryInfo(previous *errdetails.RetryInfo, response *peer.ProposalResponse) *errdetails.RetryInfo {
+	info, err := sharding.RetryInfoFromResponse(response.GetResponse())
+	if err != nil || (previous != nil && previous.GetRetryDelay().AsDuration() > info.GetRetryDelay().AsDuration()) {
+		return previous
+	}
+	return info
+}
+
 func newRpcError(code codes.Code, message string, details ...proto.Message) error {
 	st := status.New(code, message)
 	if len(details) != 0 {
@@ -23,6 +23,9 @@ import (
 //
 // If the transaction commit status cannot be returned, for example if the specified channel does not exist, a
 // FailedPrecondition error will be returned.
+//
+// The result may be a validation code of the dependency validation, such as txflags.DependencyInvalid, which the
+// protos do not define, so that clients see it as a bare number.
 func (gs *Server) CommitStatus(ctx context.Context, signedRequest *gp.SignedCommitStatusRequest) (*gp.CommitStatusResponse, error) {
 	if len(signedRequest.GetRequest()) == 0 {
 		return nil, status.Error(codes.InvalidArgument, "a commit status request is required")
@@ -14,6 +14,7 @@ import (
 	pb "github.com/hyperledger/fabric-protos-go/gateway"
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/internal/pkg/gateway/commit"
+	"github.com/hyperledger/fabric/internal/pkg/txflags"
 	"github.com/hyperledger/fabric/protoutil"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
@@ -39,6 +40,17 @@ func TestCommitStatus(t *testing.T) {
 				BlockNumber: 101,
 			},
 		},
+		{
+			name: "returns dependency validation status unknown to the protos",
+			finderStatus: &commit.Status{
+				Code:        txflags.DependencyInvalid,
+				BlockNumber: 101,
+			},
+			expectedResponse: &pb.CommitStatusResponse{
+				Result:      txflags.DependencyInvalid,
+				BlockNumber: 101,
+			},
+		},
 		{
 			name: "passes channel name to finder",
 			postSetup: func(t *testing.T, test *preparedTest) {
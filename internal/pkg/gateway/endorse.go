@@ -15,10 +15,17 @@ import (
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/common/flogging"
 	"github.com/hyperledger/fabric/protoutil"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
+// DependentTxIDsHeader is the response header in which Endorse returns the IDs of the
+// transactions that the endorsed transaction depends on, as declared by the shards that prepared it.
+const DependentTxIDsHeader = "fabric-dependent-txids"
+
 // Endorse will collect endorsements by invoking the transaction function specified in the SignedProposal against
 // sufficient Peers to satisfy the endorsement policy.
 func (gs *Server) Endorse(ctx context.Context, request *gp.EndorseRequest) (*gp.EndorseResponse, error) {
@@ -105,10 +112,19 @@ func (gs *Server) Endorse(ctx context.Context, request *gp.EndorseRequest) (*gp.
 	}
 
 	if plan.completedLayout == nil {
+		if plan.retryInfo != nil {
+			return nil, newRpcError(codes.ResourceExhausted, "failed to collect enough transaction endorsements, endorsers are overloaded, see attached details for more info", append(plan.errorDetails, plan.retryInfo)...)
+		}
 		return nil, newRpcError(codes.Aborted, "failed to collect enough transaction endorsements, see attached details for more info", plan.errorDetails...)
 	}
 
 	action = &peer.ChaincodeEndorsedAction{ProposalResponsePayload: plan.responsePayload, Endorsements: uniqueEndorsements(plan.completedLayout.endorsements)}
+	if dependencies := dependentTxIDs(action.Endorsements); len(dependencies) > 0 {
+		logger.Debugw("Endorsed transaction has dependencies", "dependentTxIDs", dependencies)
+		if err := grpc.SetHeader(ctx, metadata.MD{DependentTxIDsHeader: dependencies}); err != nil {
+			logger.Debugw("Failed to return the dependencies of the endorsed transaction", "error", err)
+		}
+	}
 
 	preparedTransaction, err := prepareTransaction(header, payload, action)
 	if err != nil {
@@ -146,7 +162,11 @@ func (gs *Server) processProposal(ctx context.Context, plan *plan, endorser *end
 			if remove {
 				gs.registry.removeEndorser(endorser)
 			}
-			plan.addError(errorDetail(endorser.endpointConfig, message))
+			if code == codes.ResourceExhausted {
+				plan.addRejection(errorDetail(endorser.endpointConfig, message), resp.response)
+			} else {
+				plan.addError(errorDetail(endorser.endpointConfig, message))
+			}
 			return false
 		}
 		response = resp.response
@@ -194,6 +214,7 @@ func (gs *Server) planFromFirstEndorser(ctx context.Context, channel string, cha
 	// 2. Process the proposal on this endorser
 	var firstResponse *peer.ProposalResponse
 	var errDetails []proto.Message
+	var firstRetryInfo *errdetails.RetryInfo
 
 	for firstResponse == nil && firstEndorser != nil {
 		done := make(chan struct{})
@@ -208,6 +229,9 @@ func (gs *Server) planFromFirstEndorser(ctx context.Context, channel string, cha
 			if code != codes.OK {
 				logger.Warnw("Endorse call to endorser failed", "endorserAddress", firstEndorser.address, "endorserMspid", firstEndorser.mspid, "error", message)
 				errDetails = append(errDetails, errorDetail(firstEndorser.endpointConfig, message))
+				if code == codes.ResourceExhausted {
+					firstRetryInfo = retryInfo(firstRetryInfo, firstResponse)
+				}
 				if remove {
 					gs.registry.removeEndorser(firstEndorser)
 				}
@@ -225,6 +249,9 @@ func (gs *Server) planFromFirstEndorser(ctx context.Context, channel string, cha
 		}
 	}
 	if firstEndorser == nil || firstResponse == nil {
+		if firstRetryInfo != nil {
+			return nil, newRpcError(codes.ResourceExhausted, "failed to endorse transaction, endorsers are overloaded, see attached details for more info", append(errDetails, firstRetryInfo)...)
+		}
 		return nil, newRpcError(codes.Aborted, "failed to endorse transaction, see attached details for more info", errDetails...)
 	}
 
@@ -19,13 +19,17 @@ import (
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/common/flogging"
 	"github.com/hyperledger/fabric/common/flogging/mock"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
 	"github.com/hyperledger/fabric/internal/pkg/gateway/mocks"
 	"github.com/hyperledger/fabric/protoutil"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap/zapcore"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -599,6 +603,74 @@ func TestEndorse(t *testing.T) {
 	}
 }
 
+func TestEndorseOverloaded(t *testing.T) {
+	tt := &testDef{
+		plan: endorsementPlan{
+			"g1": {{endorser: localhostMock, height: 1}},
+			"g2": {{endorser: peer4Mock, height: 1}},
+		},
+		postSetup: func(t *testing.T, def *preparedTest) {
+			def.localEndorser.ProcessProposalReturns(createProposalResponse(t, localhostMock.address, "all_good", 200, ""), nil)
+			peer4Mock.client.(*mocks.EndorserClient).ProcessProposalReturns(createOverloadedResponse(t, 250*time.Millisecond), nil)
+		},
+	}
+	test := prepareTest(t, tt)
+
+	response, err := test.server.Endorse(test.ctx, &pb.EndorseRequest{ProposedTransaction: test.signedProposal})
+	require.Nil(t, response)
+
+	s := status.Convert(err)
+	require.Equal(t, codes.ResourceExhausted, s.Code())
+	require.Equal(t, "failed to collect enough transaction endorsements, endorsers are overloaded, see attached details for more info", s.Message())
+	require.Len(t, s.Details(), 2)
+	require.Equal(t, "peer4:11051", s.Details()[0].(*pb.ErrorDetail).GetAddress())
+	require.Contains(t, s.Details()[0].(*pb.ErrorDetail).GetMessage(), "shard test_chaincode is overloaded")
+	require.Equal(t, 250*time.Millisecond, s.Details()[1].(*errdetails.RetryInfo).GetRetryDelay().AsDuration())
+}
+
+// headerStream is a grpc.ServerTransportStream that records the headers set by a unary call
+type headerStream struct {
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return "/gateway.Gateway/Endorse" }
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *headerStream) SetTrailer(md metadata.MD) error { return nil }
+
+func TestEndorseReturnsDependencies(t *testing.T) {
+	tt := &testDef{
+		plan: endorsementPlan{
+			"g1": {{endorser: localhostMock, height: 1}},
+			"g2": {{endorser: peer4Mock, height: 1}},
+		},
+		postSetup: func(t *testing.T, def *preparedTest) {
+			response := createProposalResponse(t, localhostMock.address, "all_good", 200, "")
+			require.NoError(t, sharding.AttachDependencyInfo(response.Endorsement, &protos.DependencyInfo{
+				Version:        sharding.DependencyInfoVersion,
+				HasDependency:  true,
+				DependentTxIds: []string{"tx1", "tx2"},
+			}))
+			def.localEndorser.ProcessProposalReturns(response, nil)
+			peer4Mock.client.(*mocks.EndorserClient).ProcessProposalReturns(createProposalResponse(t, peer4Mock.address, "all_good", 200, ""), nil)
+		},
+	}
+	test := prepareTest(t, tt)
+
+	stream := &headerStream{}
+	ctx := grpc.NewContextWithServerTransportStream(test.ctx, stream)
+	response, err := test.server.Endorse(ctx, &pb.EndorseRequest{ProposedTransaction: test.signedProposal})
+	require.NoError(t, err)
+	checkTransaction(t, []string{"localhost:7051", "peer4:11051"}, response.GetPreparedTransaction())
+	require.Equal(t, []string{"tx1", "tx2"}, stream.header.Get(DependentTxIDsHeader))
+}
+
 func checkTransaction(t *testing.T, expectedEndorsers []string, transaction *cp.Envelope) {
 	// check the prepared transaction contains the correct endorsements
 	var actualEndorsers []string
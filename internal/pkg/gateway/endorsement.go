@@ -14,7 +14,9 @@ import (
 	"github.com/golang/protobuf/proto"
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/common/flogging"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
 	"go.uber.org/zap/zapcore"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 )
 
 type layout struct {
@@ -36,6 +38,7 @@ type plan struct {
 	responsePayload []byte
 	completedLayout *layout
 	errorDetails    []proto.Message
+	retryInfo       *errdetails.RetryInfo
 	planLock        sync.Mutex
 	mismatchLogger  *flogging.FabricLogger
 }
@@ -111,6 +114,13 @@ func (p *plan) processEndorsement(endorser *endorser, response *peer.ProposalRes
 		}
 	}
 
+	// check the dependency info attached by the endorser can be decoded
+	if _, err := sharding.DependencyInfosFromEndorsement(response.GetEndorsement()); err != nil {
+		logger.Warnw("Endorser returned invalid dependency info", "endpoint", endorser.address, "MSPID", endorser.mspid, "error", err)
+		p.errorDetails = append(p.errorDetails, errorDetail(endorser.endpointConfig, fmt.Sprintf("invalid dependency info: %s", err)))
+		return false
+	}
+
 	// check the proposal responses are the same
 	if p.responsePayload == nil {
 		p.responsePayload = response.GetPayload()
@@ -195,6 +205,14 @@ func (p *plan) addError(detail proto.Message) {
 	p.errorDetails = append(p.errorDetails, detail)
 }
 
+// addRejection records the error of an overloaded endorser, with the retry info of its response
+func (p *plan) addRejection(detail proto.Message, response *peer.ProposalResponse) {
+	p.planLock.Lock()
+	defer p.planLock.Unlock()
+	p.errorDetails = append(p.errorDetails, detail)
+	p.retryInfo = retryInfo(p.retryInfo, response)
+}
+
 func uniqueEndorsements(endorsements []*peer.Endorsement) []*peer.Endorsement {
 	endorsersUsed := make(map[string]struct{})
 	var unique []*peer.Endorsement
@@ -211,3 +229,26 @@ func uniqueEndorsements(endorsements []*peer.Endorsement) []*peer.Endorsement {
 	}
 	return unique
 }
+
+// dependentTxIDs returns the transactions that the endorsers reported the
+// endorsed transaction as depending on, without duplicates
+func dependentTxIDs(endorsements []*peer.Endorsement) []string {
+	var txIDs []string
+	seen := make(map[string]struct{})
+	for _, e := range endorsements {
+		infos, err := sharding.DependencyInfosFromEndorsement(e)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			for _, txID := range info.GetDependentTxIds() {
+				if _, ok := seen[txID]; ok {
+					continue
+				}
+				txIDs = append(txIDs, txID)
+				seen[txID] = struct{}{}
+			}
+		}
+	}
+	return txIDs
+}
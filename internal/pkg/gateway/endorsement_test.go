@@ -10,7 +10,10 @@ import (
 	"testing"
 
 	"github.com/hyperledger/fabric-protos-go/peer"
+	"github.com/hyperledger/fabric/core/endorser/sharding"
+	"github.com/hyperledger/fabric/core/endorser/sharding/protos"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
 )
 
 func TestSingleLayoutPlan(t *testing.T) {
@@ -283,3 +286,71 @@ func TestUniqueEndorsements(t *testing.T) {
 	require.Len(t, unique, 3)
 	require.ElementsMatch(t, unique, []*peer.Endorsement{e1, e2, e4})
 }
+
+func TestInvalidDependencyInfo(t *testing.T) {
+	layouts := []*layout{
+		{required: map[string]int{"g1": 1}},
+	}
+	groupEndorsers := map[string][]*endorser{
+		"g1": {peer1Mock, peer2Mock},
+	}
+	plan := newPlan(layouts, groupEndorsers)
+
+	// the dependency info field holds bytes that do not decode
+	endorsement := &peer.Endorsement{Endorser: []byte("e1")}
+	endorsement.XXX_unrecognized = protowire.AppendBytes(protowire.AppendTag(nil, 1000, protowire.BytesType), []byte{0xff})
+	response1 := &peer.ProposalResponse{Payload: []byte("p"), Endorsement: endorsement}
+	response2 := &peer.ProposalResponse{Payload: []byte("p"), Endorsement: &peer.Endorsement{Endorser: []byte("e2")}}
+
+	success := plan.processEndorsement(peer1Mock, response1)
+	require.False(t, success)
+	require.Len(t, plan.errorDetails, 1)
+	require.Nil(t, plan.completedLayout)
+
+	next := plan.nextPeerInGroup(peer1Mock)
+	require.Equal(t, peer2Mock, next)
+	success = plan.processEndorsement(peer2Mock, response2)
+	require.True(t, success)
+	require.ElementsMatch(t, plan.completedLayout.endorsements, []*peer.Endorsement{response2.Endorsement})
+}
+
+func TestUnknownDependencyInfoVersion(t *testing.T) {
+	layouts := []*layout{
+		{required: map[string]int{"g1": 1}},
+	}
+	groupEndorsers := map[string][]*endorser{
+		"g1": {peer1Mock, peer2Mock},
+	}
+	plan := newPlan(layouts, groupEndorsers)
+
+	endorsement := &peer.Endorsement{Endorser: []byte("e1")}
+	require.NoError(t, sharding.AttachDependencyInfo(endorsement, &protos.DependencyInfo{Version: 99, DependentTxIds: []string{"tx1"}}))
+	response := &peer.ProposalResponse{Payload: []byte("p"), Endorsement: endorsement}
+
+	success := plan.processEndorsement(peer1Mock, response)
+	require.True(t, success)
+	require.Empty(t, plan.errorDetails)
+	require.ElementsMatch(t, plan.completedLayout.endorsements, []*peer.Endorsement{endorsement})
+	require.Empty(t, dependentTxIDs(plan.completedLayout.endorsements))
+}
+
+func TestDependentTxIDs(t *testing.T) {
+	e1 := &peer.Endorsement{Endorser: []byte("endorserA")}
+	require.NoError(t, sharding.AttachDependencyInfo(e1, &protos.DependencyInfo{
+		Version:        sharding.DependencyInfoVersion,
+		TxId:           "tx3",
+		HasDependency:  true,
+		DependentTxIds: []string{"tx2"},
+	}))
+	e2 := &peer.Endorsement{Endorser: []byte("endorserB")}
+	require.NoError(t, sharding.AttachDependencyInfo(e2, &protos.DependencyInfo{
+		Version:        sharding.DependencyInfoVersion,
+		TxId:           "tx3",
+		HasDependency:  true,
+		DependentTxIds: []string{"tx1", "tx2"},
+	}))
+	e3 := &peer.Endorsement{Endorser: []byte("endorserC")}
+
+	require.Equal(t, []string{"tx2", "tx1"}, dependentTxIDs([]*peer.Endorsement{e1, e2, e3}))
+	require.Empty(t, dependentTxIDs([]*peer.Endorsement{e3}))
+}
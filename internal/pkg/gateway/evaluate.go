@@ -15,6 +15,7 @@ import (
 	"github.com/hyperledger/fabric-protos-go/peer"
 	"github.com/hyperledger/fabric/protoutil"
 	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -53,6 +54,7 @@ func (gs *Server) Evaluate(ctx context.Context, request *gp.EvaluateRequest) (*g
 	endorser := plan.endorsers()[0]
 	var response *peer.Response
 	var errDetails []proto.Message
+	var evaluateRetryInfo *errdetails.RetryInfo
 	for response == nil {
 		gs.logger.Debugw("Sending to peer:", "channel", channel, "chaincode", chaincodeID, "txID", request.GetTransactionId(), "MSPID", endorser.mspid, "endpoint", endorser.address)
 
@@ -77,12 +79,18 @@ func (gs *Server) Evaluate(ctx context.Context, request *gp.EvaluateRequest) (*g
 				if remove {
 					gs.registry.removeEndorser(endorser)
 				}
+				if code == codes.ResourceExhausted {
+					evaluateRetryInfo = retryInfo(evaluateRetryInfo, pr)
+				}
 				if retry {
 					endorser = plan.nextPeerInGroup(endorser)
 				} else {
 					done <- newRpcError(code, "evaluate call to endorser returned error: "+message, errDetails...)
 				}
 				if endorser == nil {
+					if code == codes.ResourceExhausted && evaluateRetryInfo != nil {
+						errDetails = append(errDetails, evaluateRetryInfo)
+					}
 					done <- newRpcError(code, "failed to evaluate transaction, see attached details for more info", errDetails...)
 				}
 			}
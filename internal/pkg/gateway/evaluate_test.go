@@ -230,6 +230,24 @@ func TestEvaluate(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "restrict to local org peers - which are all overloaded",
+			members: []networkMember{
+				{"id1", "localhost:7051", "msp1", 4},
+				{"id2", "peer1:8051", "msp1", 4},
+			},
+			localLedgerHeight: 4,
+			plan: endorsementPlan{
+				"g1": {{endorser: localhostMock, height: 4}, {endorser: peer1Mock, height: 4}}, // msp1
+			},
+			postSetup: func(t *testing.T, def *preparedTest) {
+				def.localEndorser.ProcessProposalReturns(createOverloadedResponse(t, 100*time.Millisecond), nil)
+				peer1Mock.client.(*mocks.EndorserClient).ProcessProposalReturns(createOverloadedResponse(t, 200*time.Millisecond), nil)
+			},
+			endorsingOrgs: []string{"msp1"},
+			errCode:       codes.ResourceExhausted,
+			errString:     "failed to evaluate transaction, see attached details for more info",
+		},
 		{
 			name: "fails due to invalid signature (pre-process check) - does not retry",
 			members: []networkMember{
@@ -0,0 +1,39 @@
+/*
+Copyright IBM Corp. All Rights Reserved.
+
+SPDX-License-Identifier: Apache-2.0
+*/
+
+package txflags
+
+import (
+	"github.com/hyperledger/fabric-protos-go/peer"
+)
+
+// Validation codes of the dependency validation of the committer, which runs
+// after the txvalidator and only invalidates the transactions it left valid.
+// They lie in the range left free between the codes of the protos and
+// NOT_VALIDATED.
+//
+// The peer.TxValidationCode enum of fabric-protos-go does not define these
+// codes, so they reach clients, through the block metadata, the deliver
+// service or the gateway's CommitStatus, as bare numbers: their String
+// returns "100" rather than a name. Only CodeName knows their names.
+const (
+	// DependencyInvalid marks a transaction that depends on a transaction of
+	// its block that is invalid
+	DependencyInvalid peer.TxValidationCode = 100
+)
+
+var dependencyCodeNames = map[peer.TxValidationCode]string{
+	DependencyInvalid: "DEPENDENCY_INVALID",
+}
+
+// CodeName returns the name of a validation code, including the codes of the
+// dependency validation that the protos do not know of
+func CodeName(code peer.TxValidationCode) string {
+	if name, ok := dependencyCodeNames[code]; ok {
+		return name
+	}
+	return code.String()
+}
@@ -24,3 +24,13 @@ func TestTransactionValidationFlags(t *testing.T) {
 	txFlags.SetFlag(1, peer.TxValidationCode_MVCC_READ_CONFLICT)
 	require.Equal(t, true, txFlags.IsInvalid(1))
 }
+
+func TestCodeName(t *testing.T) {
+	require.Equal(t, "MVCC_READ_CONFLICT", CodeName(peer.TxValidationCode_MVCC_READ_CONFLICT))
+	require.Equal(t, "DEPENDENCY_INVALID", CodeName(DependencyInvalid))
+	require.Equal(t, "99", CodeName(peer.TxValidationCode(99)))
+
+	txFlags := NewWithValues(1, peer.TxValidationCode_VALID)
+	txFlags.SetFlag(0, DependencyInvalid)
+	require.True(t, txFlags.IsInvalid(0))
+}